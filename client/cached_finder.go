@@ -0,0 +1,139 @@
+package client
+
+import (
+	"context"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/packethost/pkg/log"
+	"github.com/pkg/errors"
+	"github.com/tinkerbell/boots/metrics"
+)
+
+// ErrStaleHardware is returned by a CachedHardwareFinder when the backend can
+// not be reached and the cached hardware is older than the max age.
+var ErrStaleHardware = errors.New("cached hardware too old")
+
+// CachedHardwareFinder is a HardwareFinder reusing the hardware found by
+// another finder. Entries are looked up again once older than the TTL, a
+// failing lookup serves the cached entry, logged and counted as stale, until
+// it is older than the max age, or fails right away when not serving stale.
+// Each lookup gets its own copy of the cached Discoverer.
+type CachedHardwareFinder struct {
+	logger     log.Logger
+	finder     HardwareFinder
+	ttl        time.Duration
+	maxAge     time.Duration
+	serveStale bool
+	maxEntries int
+	now        func() time.Time
+
+	mu      sync.Mutex
+	entries map[string]cachedHardware
+}
+
+type cachedHardware struct {
+	d       Discoverer
+	fetched time.Time
+}
+
+// NewCachedHardwareFinder returns a HardwareFinder caching the hardware found
+// by f for ttl and, with serveStale, for up to maxAge while f fails. A maxAge
+// of 0 serves cached hardware for as long as f fails. At most maxEntries
+// lookups are cached, the oldest evicted first, 0 means no limit.
+func NewCachedHardwareFinder(logger log.Logger, f HardwareFinder, ttl, maxAge time.Duration, serveStale bool, maxEntries int) *CachedHardwareFinder {
+	return &CachedHardwareFinder{
+		logger:     logger,
+		finder:     f,
+		ttl:        ttl,
+		maxAge:     maxAge,
+		serveStale: serveStale,
+		maxEntries: maxEntries,
+		now:        time.Now,
+		entries:    make(map[string]cachedHardware),
+	}
+}
+
+// ByIP returns a Discoverer for a particular IP.
+func (c *CachedHardwareFinder) ByIP(ctx context.Context, ip net.IP) (Discoverer, error) {
+	return c.find("ip "+ip.String(), func() (Discoverer, error) {
+		return c.finder.ByIP(ctx, ip)
+	})
+}
+
+// ByMAC returns a Discoverer for a particular MAC address.
+func (c *CachedHardwareFinder) ByMAC(ctx context.Context, mac net.HardwareAddr, giaddr net.IP, circuitID string) (Discoverer, error) {
+	return c.find("mac "+mac.String()+" "+giaddr.String()+" "+circuitID, func() (Discoverer, error) {
+		return c.finder.ByMAC(ctx, mac, giaddr, circuitID)
+	})
+}
+
+// ByUUID returns a Discoverer for a particular SMBIOS UUID.
+func (c *CachedHardwareFinder) ByUUID(ctx context.Context, uuid string) (Discoverer, error) {
+	return c.find("uuid "+uuid, func() (Discoverer, error) {
+		return FindByUUID(ctx, c.finder, uuid)
+	})
+}
+
+func (c *CachedHardwareFinder) find(key string, lookup func() (Discoverer, error)) (Discoverer, error) {
+	now := c.now()
+	c.mu.Lock()
+	e, ok := c.entries[key]
+	c.mu.Unlock()
+	if ok && now.Sub(e.fetched) < c.ttl {
+		return CopyDiscoverer(e.d), nil
+	}
+
+	d, err := lookup()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	switch {
+	case err == nil:
+		if !ok {
+			c.evict(now)
+		}
+		c.entries[key] = cachedHardware{d: d, fetched: now}
+
+		return CopyDiscoverer(d), nil
+	case errors.Is(err, ErrNotFound) || IsAmbiguous(err) || !ok:
+		delete(c.entries, key)
+
+		return nil, err
+	case !c.serveStale:
+		// kept to be served from again once the backend recovers
+		return nil, err
+	case c.maxAge > 0 && now.Sub(e.fetched) >= c.maxAge:
+		return nil, errors.Wrapf(ErrStaleHardware, "%s fetched %s ago: %v", key, now.Sub(e.fetched).Round(time.Second), err)
+	}
+
+	age := now.Sub(e.fetched).Round(time.Second)
+	c.logger.With("lookup", key, "age", age.String(), "error", err).Info("backend failing, serving stale hardware")
+	metrics.StaleHardwareServed.WithLabelValues(strings.Fields(key)[0]).Inc()
+
+	return CopyDiscoverer(e.d), nil
+}
+
+// evict makes room for a new entry, dropping the entries that can no longer
+// be served and, while still full, the oldest. c.mu must be held.
+func (c *CachedHardwareFinder) evict(now time.Time) {
+	if c.maxEntries <= 0 || len(c.entries) < c.maxEntries {
+		return
+	}
+	for key, e := range c.entries {
+		age := now.Sub(e.fetched)
+		if (!c.serveStale && age >= c.ttl) || (c.maxAge > 0 && age >= c.maxAge) {
+			delete(c.entries, key)
+		}
+	}
+	for len(c.entries) >= c.maxEntries {
+		var oldest string
+		for key, e := range c.entries {
+			if oldest == "" || e.fetched.Before(c.entries[oldest].fetched) {
+				oldest = key
+			}
+		}
+		delete(c.entries, oldest)
+	}
+}
@@ -0,0 +1,221 @@
+package client
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/packethost/pkg/log"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/tinkerbell/boots/metrics"
+)
+
+type countingFinder struct {
+	d     Discoverer
+	err   error
+	calls int
+}
+
+func (f *countingFinder) ByIP(context.Context, net.IP) (Discoverer, error) {
+	f.calls++
+
+	return f.d, f.err
+}
+
+func (f *countingFinder) ByMAC(context.Context, net.HardwareAddr, net.IP, string) (Discoverer, error) {
+	f.calls++
+
+	return f.d, f.err
+}
+
+// discovererName returns the name of d, a *namedDiscoverer, "" for nil.
+func discovererName(d Discoverer) string {
+	if d == nil {
+		return ""
+	}
+
+	return d.(*namedDiscoverer).name
+}
+
+func TestCachedHardwareFinder(t *testing.T) {
+	first := &namedDiscoverer{name: "first"}
+	second := &namedDiscoverer{name: "second"}
+	errBackend := errors.New("backend unavailable")
+	ip := net.ParseIP("192.0.2.1")
+
+	tests := map[string]struct {
+		// backend answer after the first lookup and time elapsed since it
+		d       Discoverer
+		err     error
+		elapsed time.Duration
+		want    Discoverer
+		wantErr error
+		calls   int
+	}{
+		"fresh entry is served from the cache": {
+			d: second, elapsed: 30 * time.Second, want: first, calls: 1,
+		},
+		"entry past the ttl is refreshed": {
+			d: second, elapsed: 2 * time.Minute, want: second, calls: 2,
+		},
+		"entry past the ttl is served while the backend fails": {
+			err: errBackend, elapsed: time.Hour, want: first, calls: 2,
+		},
+		"entry past the max age is refreshed": {
+			d: second, elapsed: 48 * time.Hour, want: second, calls: 2,
+		},
+		"entry past the max age fails while the backend fails": {
+			err: errBackend, elapsed: 48 * time.Hour, wantErr: ErrStaleHardware, calls: 2,
+		},
+		"entry removed from the backend is dropped": {
+			err: ErrNotFound, elapsed: 2 * time.Minute, wantErr: ErrNotFound, calls: 2,
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			now := time.Now()
+			f := &countingFinder{d: first}
+			c := NewCachedHardwareFinder(log.Test(t, "TestCachedHardwareFinder"), f, time.Minute, 24*time.Hour, true, 0)
+			c.now = func() time.Time { return now }
+			if _, err := c.ByIP(context.Background(), ip); err != nil {
+				t.Fatal(err)
+			}
+
+			f.d, f.err = tt.d, tt.err
+			now = now.Add(tt.elapsed)
+			d, err := c.ByIP(context.Background(), ip)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("unexpected error, want: %v, got: %v", tt.wantErr, err)
+			}
+			if discovererName(d) != discovererName(tt.want) {
+				t.Fatalf("unexpected discoverer, want: %v, got: %v", tt.want, d)
+			}
+			if f.calls != tt.calls {
+				t.Fatalf("unexpected backend calls, want: %d, got: %d", tt.calls, f.calls)
+			}
+		})
+	}
+}
+
+func TestCachedHardwareFinderStaysStale(t *testing.T) {
+	now := time.Now()
+	f := &countingFinder{d: &namedDiscoverer{name: "first"}}
+	c := NewCachedHardwareFinder(log.Test(t, "TestCachedHardwareFinderStaysStale"), f, time.Minute, time.Hour, true, 0)
+	c.now = func() time.Time { return now }
+	mac := net.HardwareAddr{0x00, 0x00, 0xba, 0xdd, 0xbe, 0xef}
+	if _, err := c.ByMAC(context.Background(), mac, nil, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	// the backend stays unreachable, stale hardware is never served again
+	f.d, f.err = nil, errors.New("backend unavailable")
+	for _, elapsed := range []time.Duration{2 * time.Hour, 3 * time.Hour} {
+		now = now.Add(elapsed)
+		if _, err := c.ByMAC(context.Background(), mac, nil, ""); !errors.Is(err, ErrStaleHardware) {
+			t.Fatalf("unexpected error after %s, want: %v, got: %v", elapsed, ErrStaleHardware, err)
+		}
+	}
+}
+
+func TestCachedHardwareFinderServeStale(t *testing.T) {
+	errBackend := errors.New("backend unavailable")
+	ip := net.ParseIP("192.0.2.1")
+
+	tests := map[string]struct {
+		serveStale bool
+		elapsed    time.Duration
+		served     bool
+		wantErr    error
+	}{
+		"stale served within the grace": {serveStale: true, elapsed: time.Hour, served: true},
+		"stale refused after the grace": {serveStale: true, elapsed: 48 * time.Hour, wantErr: ErrStaleHardware},
+		"fail closed":                   {elapsed: 2 * time.Minute, wantErr: errBackend},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			now := time.Now()
+			first := &namedDiscoverer{name: "first"}
+			f := &countingFinder{d: first}
+			c := NewCachedHardwareFinder(log.Test(t, "TestCachedHardwareFinderServeStale"), f, time.Minute, 24*time.Hour, tt.serveStale, 0)
+			c.now = func() time.Time { return now }
+			if _, err := c.ByIP(context.Background(), ip); err != nil {
+				t.Fatal(err)
+			}
+
+			served := testutil.ToFloat64(metrics.StaleHardwareServed.WithLabelValues("ip"))
+			f.d, f.err = nil, errBackend
+			now = now.Add(tt.elapsed)
+			d, err := c.ByIP(context.Background(), ip)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("unexpected error, want: %v, got: %v", tt.wantErr, err)
+			}
+			if tt.served != (discovererName(d) == "first") {
+				t.Fatalf("unexpected discoverer, stale served: %v, got: %v", tt.served, d)
+			}
+			if tt.served {
+				served++
+			}
+			if got := testutil.ToFloat64(metrics.StaleHardwareServed.WithLabelValues("ip")); got != served {
+				t.Fatalf("unexpected stale hardware served, want: %v, got: %v", served, got)
+			}
+
+			// lookups succeed again once the backend recovers
+			f.d, f.err = first, nil
+			if d, err := c.ByIP(context.Background(), ip); err != nil || discovererName(d) != "first" {
+				t.Fatalf("unexpected lookup after recovery: %v, %v", d, err)
+			}
+		})
+	}
+}
+
+func TestCachedHardwareFinderCopies(t *testing.T) {
+	f := &countingFinder{d: &namedDiscoverer{name: "first"}}
+	c := NewCachedHardwareFinder(log.Test(t, "TestCachedHardwareFinderCopies"), f, time.Minute, 24*time.Hour, true, 0)
+	ip := net.ParseIP("192.0.2.1")
+
+	d, err := c.ByIP(context.Background(), ip)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d.(*namedDiscoverer).name = "modified"
+	if d, err := c.ByIP(context.Background(), ip); err != nil || discovererName(d) != "first" {
+		t.Fatalf("cached hardware modified through a lookup: %v, %v", d, err)
+	}
+	if f.calls != 1 {
+		t.Fatalf("unexpected backend calls, want: 1, got: %d", f.calls)
+	}
+}
+
+func TestCachedHardwareFinderMaxEntries(t *testing.T) {
+	now := time.Now()
+	f := &countingFinder{d: &namedDiscoverer{name: "first"}}
+	c := NewCachedHardwareFinder(log.Test(t, "TestCachedHardwareFinderMaxEntries"), f, time.Minute, 24*time.Hour, true, 2)
+	c.now = func() time.Time { return now }
+
+	ips := []net.IP{net.ParseIP("192.0.2.1"), net.ParseIP("192.0.2.2"), net.ParseIP("192.0.2.3")}
+	for _, ip := range ips {
+		if _, err := c.ByIP(context.Background(), ip); err != nil {
+			t.Fatal(err)
+		}
+		now = now.Add(time.Second)
+	}
+	if len(c.entries) != 2 {
+		t.Fatalf("unexpected cached entries, want: 2, got: %d", len(c.entries))
+	}
+	if _, ok := c.entries["ip "+ips[0].String()]; ok {
+		t.Fatal("oldest entry not evicted")
+	}
+
+	// entries that can no longer be served go first
+	now = now.Add(25 * time.Hour)
+	c.entries["ip "+ips[2].String()] = cachedHardware{d: f.d, fetched: now}
+	if _, err := c.ByIP(context.Background(), ips[0]); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := c.entries["ip "+ips[1].String()]; ok || len(c.entries) != 2 {
+		t.Fatalf("expired entry not evicted: %v", c.entries)
+	}
+}
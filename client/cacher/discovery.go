@@ -35,12 +35,15 @@ type HardwareCacher struct {
 	PreinstallOS      client.OperatingSystem `json:"preinstalled_operating_system_version"`
 	PrivateSubnets    []string               `json:"private_subnets,omitempty"`
 	UEFI              bool                   `json:"efi_boot"`
-	AllowPXE          bool                   `json:"allow_pxe"`
+	AllowPXE          *bool                  `json:"allow_pxe"`
 	AllowWorkflow     bool                   `json:"allow_workflow"`
+	NoWorkflow        bool                   `json:"no_workflow"`
 	ServicesVersion   client.ServicesVersion `json:"services"`
 	Instance          *client.Instance       `json:"instance"`
 	ProvisionerEngine string                 `json:"provisioner_engine"`
 	Traceparent       string                 `json:"traceparent"`
+	Serial            string                 `json:"serial_number"`
+	AssetTag          string                 `json:"asset_tag"`
 }
 
 func (d DiscoveryCacher) Hardware() client.Hardware {
@@ -279,7 +282,7 @@ func (h *HardwareCacher) Management() (address, netmask, gateway net.IP) {
 }
 
 func (h HardwareCacher) Interfaces() []client.Port {
-	ports := make([]client.Port, 0, len(h.NetworkPorts)-1)
+	ports := make([]client.Port, 0, len(h.NetworkPorts))
 	for _, p := range h.NetworkPorts {
 		if p.Type == "ipmi" {
 			continue
@@ -294,13 +297,21 @@ func (h HardwareCacher) Interfaces() []client.Port {
 }
 
 func (h HardwareCacher) HardwareAllowPXE(net.HardwareAddr) bool {
-	return h.AllowPXE
+	return h.AllowPXE != nil && *h.AllowPXE
+}
+
+func (h HardwareCacher) HardwareAllowPXESet(net.HardwareAddr) bool {
+	return h.AllowPXE != nil
 }
 
 func (h HardwareCacher) HardwareAllowWorkflow(net.HardwareAddr) bool {
 	return h.AllowWorkflow
 }
 
+func (h HardwareCacher) HardwareNoWorkflow(net.HardwareAddr) bool {
+	return h.NoWorkflow
+}
+
 func (h HardwareCacher) HardwareArch(net.HardwareAddr) string {
 	return h.Arch
 }
@@ -345,6 +356,14 @@ func (h HardwareCacher) HardwareOSIEVersion() string {
 	return h.ServicesVersion.OSIE
 }
 
+func (h HardwareCacher) HardwareSerial() string {
+	return h.Serial
+}
+
+func (h HardwareCacher) HardwareAssetTag() string {
+	return h.AssetTag
+}
+
 func (h HardwareCacher) HardwareState() client.HardwareState {
 	return h.State
 }
@@ -109,6 +109,31 @@ func TestOperatingSystemCacher(t *testing.T) {
 	}
 }
 
+func TestAllowPXESetCacher(t *testing.T) {
+	for _, test := range []struct {
+		json  string
+		allow bool
+		set   bool
+	}{
+		{json: `{"id": "hw"}`},
+		{json: `{"id": "hw", "allow_pxe": false}`, set: true},
+		{json: `{"id": "hw", "allow_pxe": true}`, allow: true, set: true},
+	} {
+		t.Run(test.json, func(t *testing.T) {
+			h := HardwareCacher{}
+			if err := json.Unmarshal([]byte(test.json), &h); err != nil {
+				t.Fatal(err)
+			}
+			if got := h.HardwareAllowPXE(nil); got != test.allow {
+				t.Fatalf("unexpected allow_pxe, want: %t, got: %t", test.allow, got)
+			}
+			if got := client.HardwareAllowPXESet(&h, nil); got != test.set {
+				t.Fatalf("unexpected allow_pxe presence, want: %t, got: %t", test.set, got)
+			}
+		})
+	}
+}
+
 var cacherTests = map[string]struct {
 	mac            string
 	primaryDataMac string
@@ -0,0 +1,68 @@
+package client
+
+import (
+	"context"
+	"net"
+
+	"github.com/pkg/errors"
+)
+
+// ChainHardwareFinder is a HardwareFinder that queries a list of finders in
+// order and returns the first hardware found. A finder answering with
+// ErrNotFound always hands the lookup to the next finder. Any other error stops
+// the lookup unless the chain was created with continueOnError set.
+type ChainHardwareFinder struct {
+	finders         []HardwareFinder
+	continueOnError bool
+}
+
+// NewChainHardwareFinder returns a HardwareFinder that tries each of finders in order.
+func NewChainHardwareFinder(continueOnError bool, finders ...HardwareFinder) *ChainHardwareFinder {
+	return &ChainHardwareFinder{
+		finders:         finders,
+		continueOnError: continueOnError,
+	}
+}
+
+// ByIP returns a Discoverer for a particular IP from the first finder that knows about it.
+func (c *ChainHardwareFinder) ByIP(ctx context.Context, ip net.IP) (Discoverer, error) {
+	return c.find(func(f HardwareFinder) (Discoverer, error) {
+		return f.ByIP(ctx, ip)
+	})
+}
+
+// ByMAC returns a Discoverer for a particular MAC address from the first finder that knows about it.
+func (c *ChainHardwareFinder) ByMAC(ctx context.Context, mac net.HardwareAddr, giaddr net.IP, circuitID string) (Discoverer, error) {
+	return c.find(func(f HardwareFinder) (Discoverer, error) {
+		return f.ByMAC(ctx, mac, giaddr, circuitID)
+	})
+}
+
+// ByUUID returns a Discoverer for a particular SMBIOS UUID from the first finder
+// that knows about it, finders that can not look hardware up by UUID are skipped.
+func (c *ChainHardwareFinder) ByUUID(ctx context.Context, uuid string) (Discoverer, error) {
+	return c.find(func(f HardwareFinder) (Discoverer, error) {
+		return FindByUUID(ctx, f, uuid)
+	})
+}
+
+func (c *ChainHardwareFinder) find(lookup func(HardwareFinder) (Discoverer, error)) (Discoverer, error) {
+	var lastErr error
+	for _, f := range c.finders {
+		d, err := lookup(f)
+		if err == nil {
+			return d, nil
+		}
+		if !errors.Is(err, ErrNotFound) {
+			if !c.continueOnError {
+				return nil, err
+			}
+			lastErr = err
+		}
+	}
+	if lastErr != nil {
+		return nil, lastErr
+	}
+
+	return nil, ErrNotFound
+}
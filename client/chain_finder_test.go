@@ -0,0 +1,117 @@
+package client
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+type staticFinder struct {
+	d   Discoverer
+	err error
+}
+
+func (f staticFinder) ByIP(context.Context, net.IP) (Discoverer, error) {
+	return f.d, f.err
+}
+
+func (f staticFinder) ByMAC(context.Context, net.HardwareAddr, net.IP, string) (Discoverer, error) {
+	return f.d, f.err
+}
+
+type namedDiscoverer struct {
+	Discoverer
+	name string
+}
+
+func TestChainHardwareFinder(t *testing.T) {
+	primary := &namedDiscoverer{name: "primary"}
+	secondary := &namedDiscoverer{name: "secondary"}
+	errBackend := errors.New("backend unavailable")
+
+	tests := map[string]struct {
+		finders         []HardwareFinder
+		continueOnError bool
+		want            Discoverer
+		wantErr         error
+	}{
+		"primary resolves": {
+			finders: []HardwareFinder{staticFinder{d: primary}, staticFinder{d: secondary}},
+			want:    primary,
+		},
+		"primary not found, secondary resolves": {
+			finders: []HardwareFinder{staticFinder{err: ErrNotFound}, staticFinder{d: secondary}},
+			want:    secondary,
+		},
+		"wrapped not found falls through": {
+			finders: []HardwareFinder{staticFinder{err: errors.Wrap(ErrNotFound, "cacher")}, staticFinder{d: secondary}},
+			want:    secondary,
+		},
+		"all not found": {
+			finders: []HardwareFinder{staticFinder{err: ErrNotFound}, staticFinder{err: ErrNotFound}},
+			wantErr: ErrNotFound,
+		},
+		"backend error short-circuits": {
+			finders: []HardwareFinder{staticFinder{err: errBackend}, staticFinder{d: secondary}},
+			wantErr: errBackend,
+		},
+		"backend error continues": {
+			finders:         []HardwareFinder{staticFinder{err: errBackend}, staticFinder{d: secondary}},
+			continueOnError: true,
+			want:            secondary,
+		},
+		"backend error is returned over not found": {
+			finders:         []HardwareFinder{staticFinder{err: errBackend}, staticFinder{err: ErrNotFound}},
+			continueOnError: true,
+			wantErr:         errBackend,
+		},
+		"no finders": {
+			wantErr: ErrNotFound,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			f := NewChainHardwareFinder(tc.continueOnError, tc.finders...)
+			for _, lookup := range []func() (Discoverer, error){
+				func() (Discoverer, error) { return f.ByIP(context.Background(), net.ParseIP("192.168.1.1")) },
+				func() (Discoverer, error) { return f.ByMAC(context.Background(), MinMAC.HardwareAddr(), nil, "") },
+			} {
+				d, err := lookup()
+				if !errors.Is(err, tc.wantErr) {
+					t.Fatalf("unexpected error, want: %v, got: %v", tc.wantErr, err)
+				}
+				if d != tc.want {
+					t.Fatalf("unexpected discoverer, want: %v, got: %v", tc.want, d)
+				}
+			}
+		})
+	}
+}
+
+type uuidFinder struct {
+	staticFinder
+}
+
+func (f uuidFinder) ByUUID(context.Context, string) (Discoverer, error) {
+	return f.d, f.err
+}
+
+func TestChainHardwareFinderByUUID(t *testing.T) {
+	found := &namedDiscoverer{name: "found"}
+
+	f := NewChainHardwareFinder(false, staticFinder{d: &namedDiscoverer{name: "mac only"}}, uuidFinder{staticFinder{err: ErrNotFound}}, uuidFinder{staticFinder{d: found}})
+	d, err := f.ByUUID(context.Background(), "4c4c4544-0042-3010-8057-b3c04f4e4d32")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d != found {
+		t.Fatalf("unexpected hardware, want: %v, got: %v", found, d)
+	}
+
+	if _, err := FindByUUID(context.Background(), NewInstrumentedHardwareFinder(staticFinder{}), "4c4c4544-0042-3010-8057-b3c04f4e4d32"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected not found from a finder without uuid lookups, got: %v", err)
+	}
+}
@@ -2,7 +2,11 @@ package client
 
 import (
 	"context"
+	"fmt"
 	"net"
+	"reflect"
+	"sort"
+	"strings"
 	"time"
 
 	"github.com/pkg/errors"
@@ -10,12 +14,105 @@ import (
 
 var ErrNotFound = errors.New("hardware not found")
 
+// AmbiguousHardwareError is returned by HardwareFinders when more than one
+// hardware record matches a lookup.
+type AmbiguousHardwareError struct {
+	// Key is what was looked up, e.g. "mac 00:00:00:00:00:01".
+	Key     string
+	Matches []Discoverer
+}
+
+func (e *AmbiguousHardwareError) Error() string {
+	return fmt.Sprintf("%d hardware records match %s: %s", len(e.Matches), e.Key, strings.Join(e.IDs(), ", "))
+}
+
+// IDs returns the sorted IDs of the matching hardware records.
+func (e *AmbiguousHardwareError) IDs() []string {
+	ids := make([]string, len(e.Matches))
+	for i, d := range e.Matches {
+		ids[i] = d.Hardware().HardwareID().String()
+	}
+	sort.Strings(ids)
+
+	return ids
+}
+
+// Lowest returns the matching hardware record with the lowest ID.
+func (e *AmbiguousHardwareError) Lowest() Discoverer {
+	var lowest Discoverer
+	for _, d := range e.Matches {
+		if lowest == nil || d.Hardware().HardwareID() < lowest.Hardware().HardwareID() {
+			lowest = d
+		}
+	}
+
+	return lowest
+}
+
+// IsAmbiguous reports whether err is, or wraps, an AmbiguousHardwareError.
+func IsAmbiguous(err error) bool {
+	var amb *AmbiguousHardwareError
+
+	return errors.As(err, &amb)
+}
+
 // HardwareFinder is a type for discovering hardware.
 type HardwareFinder interface {
 	ByIP(context.Context, net.IP) (Discoverer, error)
 	ByMAC(context.Context, net.HardwareAddr, net.IP, string) (Discoverer, error)
 }
 
+// UUIDFinder is implemented by HardwareFinders that can also look hardware up
+// by the SMBIOS UUID PXE clients send in DHCP option 97.
+type UUIDFinder interface {
+	ByUUID(context.Context, string) (Discoverer, error)
+}
+
+// FindByUUID looks up the hardware with uuid using f, ErrNotFound if f can not
+// look hardware up by UUID.
+func FindByUUID(ctx context.Context, f HardwareFinder, uuid string) (Discoverer, error) {
+	uf, ok := f.(UUIDFinder)
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	return uf.ByUUID(ctx, uuid)
+}
+
+// AllowPXEReporter is implemented by Hardware that can tell an absent
+// allow_pxe field apart from one set to false.
+type AllowPXEReporter interface {
+	HardwareAllowPXESet(mac net.HardwareAddr) bool
+}
+
+// HardwareAllowPXESet reports whether hw has an allow_pxe value for mac,
+// always true for hardware that can not tell.
+func HardwareAllowPXESet(hw Hardware, mac net.HardwareAddr) bool {
+	r, ok := hw.(AllowPXEReporter)
+	if !ok {
+		return true
+	}
+
+	return r.HardwareAllowPXESet(mac)
+}
+
+// NoWorkflowReporter is implemented by Hardware that can mark a machine as not
+// expected to run a workflow.
+type NoWorkflowReporter interface {
+	HardwareNoWorkflow(mac net.HardwareAddr) bool
+}
+
+// HardwareNoWorkflow reports whether hw marks mac as not expected to run a
+// workflow, always false for hardware that can not tell.
+func HardwareNoWorkflow(hw Hardware, mac net.HardwareAddr) bool {
+	r, ok := hw.(NoWorkflowReporter)
+	if !ok {
+		return false
+	}
+
+	return r.HardwareNoWorkflow(mac)
+}
+
 // WorkflowFinder looks for a Tinkerbell workflow for a given HardwareID.
 type WorkflowFinder interface {
 	HasActiveWorkflow(context.Context, HardwareID) (bool, error)
@@ -61,6 +158,20 @@ type Discoverer interface {
 	SetMAC(mac net.HardwareAddr)
 }
 
+// CopyDiscoverer returns a shallow copy of d, so that a caller can SetMAC on
+// a Discoverer others hold too. Discoverers that are not pointers are returned
+// as is.
+func CopyDiscoverer(d Discoverer) Discoverer {
+	v := reflect.ValueOf(d)
+	if v.Kind() != reflect.Ptr || v.IsNil() {
+		return d
+	}
+	c := reflect.New(v.Elem().Type())
+	c.Elem().Set(v.Elem())
+
+	return c.Interface().(Discoverer)
+}
+
 // HardwareState is the hardware state (e.g. provisioning).
 type HardwareState string
 
@@ -80,6 +191,8 @@ type Hardware interface {
 	HardwarePlanVersionSlug() string
 	HardwareState() HardwareState
 	HardwareOSIEVersion() string
+	HardwareSerial() string
+	HardwareAssetTag() string
 	HardwareUEFI(mac net.HardwareAddr) bool
 	GetVLANID(net.HardwareAddr) string
 	OSIEBaseURL(mac net.HardwareAddr) string
@@ -0,0 +1,169 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/packethost/pkg/log"
+	"github.com/pkg/errors"
+)
+
+// SinkEvent is an event, phone-home, failure or problem reported for the
+// hardware or instance ID.
+type SinkEvent struct {
+	Time time.Time       `json:"time"`
+	Kind string          `json:"kind"`
+	ID   string          `json:"id"`
+	Body json.RawMessage `json:"body,omitempty"`
+}
+
+// EventSink records the events of machines, for deployments without a backend
+// to report them to.
+type EventSink interface {
+	Record(ctx context.Context, e SinkEvent) error
+}
+
+// sinkReporter is a noOpReporter recording the events, phone-homes, failures
+// and problems it is given to a sink.
+type sinkReporter struct {
+	noOpReporter
+	sink EventSink
+}
+
+// NewSinkReporter returns a reporter recording events, phone-homes, failures
+// and problems to sink, and dropping anything else.
+func NewSinkReporter(logger log.Logger, sink EventSink) Reporter {
+	return &sinkReporter{noOpReporter: noOpReporter{logger: logger}, sink: sink}
+}
+
+func (c *sinkReporter) record(ctx context.Context, kind, id string, r io.Reader) error {
+	e := SinkEvent{Time: time.Now().UTC(), Kind: kind, ID: id}
+	if r != nil {
+		b, err := io.ReadAll(r)
+		if err != nil {
+			return errors.Wrap(err, "reading event body")
+		}
+		if json.Valid(b) {
+			e.Body = b
+		} else if len(b) > 0 {
+			e.Body, _ = json.Marshal(string(b))
+		}
+	}
+
+	return errors.WithMessage(c.sink.Record(ctx, e), "recording "+kind)
+}
+
+func (c *sinkReporter) PostHardwareEvent(ctx context.Context, id string, r io.Reader) (string, error) {
+	return "", c.record(ctx, "hardware.event", id, r)
+}
+
+func (c *sinkReporter) PostHardwarePhoneHome(ctx context.Context, id string) error {
+	return c.record(ctx, "hardware.phone-home", id, nil)
+}
+
+func (c *sinkReporter) PostHardwareFail(ctx context.Context, id string, r io.Reader) error {
+	return c.record(ctx, "hardware.fail", id, r)
+}
+
+func (c *sinkReporter) PostHardwareProblem(ctx context.Context, id HardwareID, r io.Reader) (string, error) {
+	return "", c.record(ctx, "hardware.problem", id.String(), r)
+}
+
+func (c *sinkReporter) PostInstancePhoneHome(ctx context.Context, id string) error {
+	return c.record(ctx, "instance.phone-home", id, nil)
+}
+
+func (c *sinkReporter) PostInstanceEvent(ctx context.Context, id string, r io.Reader) (string, error) {
+	return "", c.record(ctx, "instance.event", id, r)
+}
+
+func (c *sinkReporter) PostInstanceFail(ctx context.Context, id string, r io.Reader) error {
+	return c.record(ctx, "instance.fail", id, r)
+}
+
+type logSink struct {
+	logger log.Logger
+}
+
+// NewLogSink returns a sink logging events.
+func NewLogSink(logger log.Logger) EventSink {
+	return logSink{logger: logger}
+}
+
+func (s logSink) Record(_ context.Context, e SinkEvent) error {
+	s.logger.With("kind", e.Kind, "id", e.ID, "body", string(e.Body)).Info("not reporting, no reporter configured")
+
+	return nil
+}
+
+type fileSink struct {
+	mu   sync.Mutex
+	path string
+}
+
+// NewFileSink returns a sink appending events to the file at path, one JSON
+// object per line.
+func NewFileSink(path string) EventSink {
+	return &fileSink{path: path}
+}
+
+func (s *fileSink) Record(_ context.Context, e SinkEvent) error {
+	b, err := json.Marshal(e)
+	if err != nil {
+		return errors.Wrap(err, "encoding event")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	f, err := os.OpenFile(s.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return errors.Wrap(err, "opening event file")
+	}
+	if _, err := f.Write(append(b, '\n')); err != nil {
+		f.Close()
+
+		return errors.Wrap(err, "writing event file")
+	}
+
+	return errors.Wrap(f.Close(), "closing event file")
+}
+
+type webhookSink struct {
+	url    string
+	client *http.Client
+}
+
+// NewWebhookSink returns a sink POSTing each event as JSON to url, giving up
+// on an event after timeout.
+func NewWebhookSink(url string, timeout time.Duration) EventSink {
+	return &webhookSink{url: url, client: &http.Client{Timeout: timeout}}
+}
+
+func (s *webhookSink) Record(ctx context.Context, e SinkEvent) error {
+	b, err := json.Marshal(e)
+	if err != nil {
+		return errors.Wrap(err, "encoding event")
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, bytes.NewReader(b))
+	if err != nil {
+		return errors.Wrap(err, "creating webhook request")
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return errors.Wrap(err, "posting event to webhook")
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return errors.Errorf("posting event to webhook: unexpected status %s", resp.Status)
+	}
+
+	return nil
+}
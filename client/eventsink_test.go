@@ -0,0 +1,83 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/packethost/pkg/log"
+)
+
+func TestFileSink(t *testing.T) {
+	l, _ := log.Init("github.com/tinkerbell/boots")
+	path := filepath.Join(t.TempDir(), "events.jsonl")
+	r := NewSinkReporter(l, NewFileSink(path))
+
+	if _, err := r.PostInstanceEvent(context.Background(), "instance-id", strings.NewReader(`{"type":"user.1","body":"hello"}`)); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.PostInstancePhoneHome(context.Background(), "instance-id"); err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(b)), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("unexpected number of events, want: 2, got: %d", len(lines))
+	}
+	var e SinkEvent
+	if err := json.Unmarshal([]byte(lines[0]), &e); err != nil {
+		t.Fatal(err)
+	}
+	if e.Kind != "instance.event" || e.ID != "instance-id" || string(e.Body) != `{"type":"user.1","body":"hello"}` {
+		t.Fatalf("unexpected event: %+v", e)
+	}
+	e = SinkEvent{}
+	if err := json.Unmarshal([]byte(lines[1]), &e); err != nil {
+		t.Fatal(err)
+	}
+	if e.Kind != "instance.phone-home" || e.ID != "instance-id" || e.Body != nil {
+		t.Fatalf("unexpected event: %+v", e)
+	}
+}
+
+func TestWebhookSink(t *testing.T) {
+	l, _ := log.Init("github.com/tinkerbell/boots")
+	posted := make(chan SinkEvent, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		b, _ := io.ReadAll(req.Body)
+		var e SinkEvent
+		if req.Method != http.MethodPost || req.Header.Get("Content-Type") != "application/json" || json.Unmarshal(b, &e) != nil {
+			w.WriteHeader(http.StatusBadRequest)
+
+			return
+		}
+		posted <- e
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	r := NewSinkReporter(l, NewWebhookSink(srv.URL, time.Second))
+	if _, err := r.PostHardwareProblem(context.Background(), HardwareID("hardware-id"), strings.NewReader(`{"problem":"memory"}`)); err != nil {
+		t.Fatal(err)
+	}
+	e := <-posted
+	if e.Kind != "hardware.problem" || e.ID != "hardware-id" || string(e.Body) != `{"problem":"memory"}` {
+		t.Fatalf("unexpected event: %+v", e)
+	}
+
+	srv.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) { w.WriteHeader(http.StatusInternalServerError) })
+	if _, err := r.PostInstanceEvent(context.Background(), "instance-id", strings.NewReader(`{}`)); err == nil {
+		t.Fatal("expected an error from a failing webhook")
+	}
+}
@@ -191,8 +191,9 @@ type DHCP struct {
 
 // Netboot holds details for a hardware to boot over network.
 type Netboot struct {
-	AllowPXE      bool `json:"allow_pxe"`      // to be removed?
-	AllowWorkflow bool `json:"allow_workflow"` // to be removed?
+	AllowPXE      *bool `json:"allow_pxe"`      // to be removed?
+	AllowWorkflow bool  `json:"allow_workflow"` // to be removed?
+	NoWorkflow    bool  `json:"no_workflow"`    // only boots OSIE, e.g. for discovery
 	IPXE          struct {
 		URL      string `json:"url"`
 		Contents string `json:"contents"`
@@ -248,6 +249,8 @@ type Metadata struct {
 	} `json:"custom"`
 	Facility          Facility `json:"facility"`
 	ProvisionerEngine string   `json:"provisioner_engine"`
+	Serial            string   `json:"serial_number"`
+	AssetTag          string   `json:"asset_tag"`
 }
 
 // Facility represents the facilty in use.
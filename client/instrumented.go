@@ -0,0 +1,191 @@
+package client
+
+import (
+	"context"
+	"io"
+	"net"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/tinkerbell/boots/metrics"
+)
+
+const (
+	backendHardwareFinder = "hardware_finder"
+	backendWorkflowFinder = "workflow_finder"
+	backendReporter       = "reporter"
+)
+
+// observeBackend records the duration of the op call to the given backend
+// started at start, and the current time as the last success or last failure
+// of the backend depending on err. A hardware not found or ambiguous hardware
+// error is a valid answer from the backend and counts as a success.
+func observeBackend(backend, op string, start time.Time, err error) {
+	metrics.BackendCallDuration.WithLabelValues(backend, op).Observe(time.Since(start).Seconds())
+	if err != nil && !errors.Is(err, ErrNotFound) && !IsAmbiguous(err) {
+		metrics.BackendCallErrors.WithLabelValues(backend, op).Inc()
+		metrics.BackendLastFailure.WithLabelValues(backend).SetToCurrentTime()
+
+		return
+	}
+	metrics.BackendLastSuccess.WithLabelValues(backend).SetToCurrentTime()
+}
+
+type instrumentedHardwareFinder struct {
+	HardwareFinder
+}
+
+// NewInstrumentedHardwareFinder wraps f so that every call updates the backend
+// last success/failure gauges and call duration and error metrics.
+func NewInstrumentedHardwareFinder(f HardwareFinder) HardwareFinder {
+	return &instrumentedHardwareFinder{f}
+}
+
+func (f *instrumentedHardwareFinder) ByIP(ctx context.Context, ip net.IP) (Discoverer, error) {
+	start := time.Now()
+	d, err := f.HardwareFinder.ByIP(ctx, ip)
+	observeBackend(backendHardwareFinder, "by_ip", start, err)
+
+	return d, err
+}
+
+func (f *instrumentedHardwareFinder) ByMAC(ctx context.Context, mac net.HardwareAddr, giaddr net.IP, circuitID string) (Discoverer, error) {
+	start := time.Now()
+	d, err := f.HardwareFinder.ByMAC(ctx, mac, giaddr, circuitID)
+	observeBackend(backendHardwareFinder, "by_mac", start, err)
+
+	return d, err
+}
+
+func (f *instrumentedHardwareFinder) ByUUID(ctx context.Context, uuid string) (Discoverer, error) {
+	start := time.Now()
+	d, err := FindByUUID(ctx, f.HardwareFinder, uuid)
+	observeBackend(backendHardwareFinder, "by_uuid", start, err)
+
+	return d, err
+}
+
+type instrumentedWorkflowFinder struct {
+	WorkflowFinder
+}
+
+// NewInstrumentedWorkflowFinder wraps f so that every call updates the backend
+// last success/failure gauges and call duration and error metrics.
+func NewInstrumentedWorkflowFinder(f WorkflowFinder) WorkflowFinder {
+	return &instrumentedWorkflowFinder{f}
+}
+
+func (f *instrumentedWorkflowFinder) HasActiveWorkflow(ctx context.Context, id HardwareID) (bool, error) {
+	start := time.Now()
+	ok, err := f.WorkflowFinder.HasActiveWorkflow(ctx, id)
+	observeBackend(backendWorkflowFinder, "has_active_workflow", start, err)
+
+	return ok, err
+}
+
+type instrumentedReporter struct {
+	Reporter
+}
+
+// NewInstrumentedReporter wraps r so that every call updates the backend last
+// success/failure gauges and call duration and error metrics.
+func NewInstrumentedReporter(r Reporter) Reporter {
+	return &instrumentedReporter{r}
+}
+
+// Ping checks the wrapped reporter can reach its backend, see PingReporter.
+func (r *instrumentedReporter) Ping(ctx context.Context) error {
+	start := time.Now()
+	err := PingReporter(ctx, r.Reporter)
+	observeBackend(backendReporter, "ping", start, err)
+
+	return err
+}
+
+func (r *instrumentedReporter) PostHardwareComponent(ctx context.Context, hardwareID HardwareID, body io.Reader) (*ComponentsResponse, error) {
+	start := time.Now()
+	res, err := r.Reporter.PostHardwareComponent(ctx, hardwareID, body)
+	observeBackend(backendReporter, "post_hardware_component", start, err)
+
+	return res, err
+}
+
+func (r *instrumentedReporter) PostHardwareEvent(ctx context.Context, id string, body io.Reader) (string, error) {
+	start := time.Now()
+	res, err := r.Reporter.PostHardwareEvent(ctx, id, body)
+	observeBackend(backendReporter, "post_hardware_event", start, err)
+
+	return res, err
+}
+
+func (r *instrumentedReporter) PostHardwarePhoneHome(ctx context.Context, id string) error {
+	start := time.Now()
+	err := r.Reporter.PostHardwarePhoneHome(ctx, id)
+	observeBackend(backendReporter, "post_hardware_phone_home", start, err)
+
+	return err
+}
+
+func (r *instrumentedReporter) PostHardwareFail(ctx context.Context, id string, body io.Reader) error {
+	start := time.Now()
+	err := r.Reporter.PostHardwareFail(ctx, id, body)
+	observeBackend(backendReporter, "post_hardware_fail", start, err)
+
+	return err
+}
+
+func (r *instrumentedReporter) PostHardwareProblem(ctx context.Context, id HardwareID, body io.Reader) (string, error) {
+	start := time.Now()
+	res, err := r.Reporter.PostHardwareProblem(ctx, id, body)
+	observeBackend(backendReporter, "post_hardware_problem", start, err)
+
+	return res, err
+}
+
+func (r *instrumentedReporter) PostInstancePhoneHome(ctx context.Context, id string) error {
+	start := time.Now()
+	err := r.Reporter.PostInstancePhoneHome(ctx, id)
+	observeBackend(backendReporter, "post_instance_phone_home", start, err)
+
+	return err
+}
+
+func (r *instrumentedReporter) PostInstanceEvent(ctx context.Context, id string, body io.Reader) (string, error) {
+	start := time.Now()
+	res, err := r.Reporter.PostInstanceEvent(ctx, id, body)
+	observeBackend(backendReporter, "post_instance_event", start, err)
+
+	return res, err
+}
+
+func (r *instrumentedReporter) PostInstanceFail(ctx context.Context, id string, body io.Reader) error {
+	start := time.Now()
+	err := r.Reporter.PostInstanceFail(ctx, id, body)
+	observeBackend(backendReporter, "post_instance_fail", start, err)
+
+	return err
+}
+
+func (r *instrumentedReporter) PostInstancePassword(ctx context.Context, id, pass string) error {
+	start := time.Now()
+	err := r.Reporter.PostInstancePassword(ctx, id, pass)
+	observeBackend(backendReporter, "post_instance_password", start, err)
+
+	return err
+}
+
+func (r *instrumentedReporter) UpdateInstance(ctx context.Context, id string, body io.Reader) error {
+	start := time.Now()
+	err := r.Reporter.UpdateInstance(ctx, id, body)
+	observeBackend(backendReporter, "update_instance", start, err)
+
+	return err
+}
+
+func (r *instrumentedReporter) Post(ctx context.Context, ref, mime string, body io.Reader, v interface{}) error {
+	start := time.Now()
+	err := r.Reporter.Post(ctx, ref, mime, body, v)
+	observeBackend(backendReporter, "post", start, err)
+
+	return err
+}
@@ -0,0 +1,185 @@
+package client
+
+import (
+	"context"
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/packethost/pkg/log"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/tinkerbell/boots/metrics"
+)
+
+func TestMain(m *testing.M) {
+	l, _ := log.Init("github.com/tinkerbell/boots")
+	metrics.Init(l)
+	os.Exit(m.Run())
+}
+
+type fakeFinder struct {
+	err   error
+	delay time.Duration
+}
+
+func (f fakeFinder) ByIP(context.Context, net.IP) (Discoverer, error) {
+	time.Sleep(f.delay)
+
+	return nil, f.err
+}
+
+func (f fakeFinder) ByMAC(context.Context, net.HardwareAddr, net.IP, string) (Discoverer, error) {
+	time.Sleep(f.delay)
+
+	return nil, f.err
+}
+
+func (f fakeFinder) HasActiveWorkflow(context.Context, HardwareID) (bool, error) {
+	return false, f.err
+}
+
+type fakeReporter struct {
+	Reporter
+	err error
+}
+
+func (r fakeReporter) PostInstancePhoneHome(context.Context, string) error {
+	return r.err
+}
+
+func TestInstrumentedBackends(t *testing.T) {
+	tests := map[string]struct {
+		backend string
+		call    func(err error) error
+	}{
+		"hardware finder by ip": {
+			backend: backendHardwareFinder,
+			call: func(err error) error {
+				_, err = NewInstrumentedHardwareFinder(fakeFinder{err: err}).ByIP(context.Background(), nil)
+
+				return err
+			},
+		},
+		"hardware finder by mac": {
+			backend: backendHardwareFinder,
+			call: func(err error) error {
+				_, err = NewInstrumentedHardwareFinder(fakeFinder{err: err}).ByMAC(context.Background(), nil, nil, "")
+
+				return err
+			},
+		},
+		"workflow finder": {
+			backend: backendWorkflowFinder,
+			call: func(err error) error {
+				_, err = NewInstrumentedWorkflowFinder(fakeFinder{err: err}).HasActiveWorkflow(context.Background(), "")
+
+				return err
+			},
+		},
+		"reporter": {
+			backend: backendReporter,
+			call: func(err error) error {
+				return NewInstrumentedReporter(fakeReporter{err: err}).PostInstancePhoneHome(context.Background(), "")
+			},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			success := metrics.BackendLastSuccess.WithLabelValues(tc.backend)
+			failure := metrics.BackendLastFailure.WithLabelValues(tc.backend)
+			success.Set(0)
+			failure.Set(0)
+
+			if err := tc.call(nil); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got := testutil.ToFloat64(success); got == 0 {
+				t.Fatal("last success was not updated after a successful call")
+			}
+			if got := testutil.ToFloat64(failure); got != 0 {
+				t.Fatalf("last failure was updated after a successful call: %v", got)
+			}
+
+			success.Set(0)
+			if err := tc.call(errors.New("backend down")); err == nil {
+				t.Fatal("expected an error")
+			}
+			if got := testutil.ToFloat64(failure); got == 0 {
+				t.Fatal("last failure was not updated after a failed call")
+			}
+			if got := testutil.ToFloat64(success); got != 0 {
+				t.Fatalf("last success was updated after a failed call: %v", got)
+			}
+
+			failure.Set(0)
+			if err := tc.call(ErrNotFound); !errors.Is(err, ErrNotFound) {
+				t.Fatalf("expected ErrNotFound, got: %v", err)
+			}
+			if got := testutil.ToFloat64(success); got == 0 {
+				t.Fatal("last success was not updated after a not found response")
+			}
+			if got := testutil.ToFloat64(failure); got != 0 {
+				t.Fatalf("last failure was updated after a not found response: %v", got)
+			}
+		})
+	}
+}
+
+// callDuration returns the number of observations and their sum for the
+// backend call duration histogram of backend and op.
+func callDuration(t *testing.T, backend, op string) (uint64, float64) {
+	t.Helper()
+
+	m := &dto.Metric{}
+	if err := metrics.BackendCallDuration.WithLabelValues(backend, op).(prometheus.Metric).Write(m); err != nil {
+		t.Fatal(err)
+	}
+
+	return m.GetHistogram().GetSampleCount(), m.GetHistogram().GetSampleSum()
+}
+
+func TestInstrumentedCallMetrics(t *testing.T) {
+	const delay = 20 * time.Millisecond
+	errs := metrics.BackendCallErrors.WithLabelValues(backendHardwareFinder, "by_mac")
+	f := NewInstrumentedHardwareFinder(fakeFinder{delay: delay})
+
+	count, sum := callDuration(t, backendHardwareFinder, "by_mac")
+	failed := testutil.ToFloat64(errs)
+	if _, err := f.ByMAC(context.Background(), nil, nil, ""); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	gotCount, gotSum := callDuration(t, backendHardwareFinder, "by_mac")
+	if gotCount != count+1 {
+		t.Fatalf("want %d observations, got %d", count+1, gotCount)
+	}
+	if gotSum-sum < delay.Seconds() {
+		t.Fatalf("observed duration %vs is shorter than the call delay %v", gotSum-sum, delay)
+	}
+	if got := testutil.ToFloat64(errs); got != failed {
+		t.Fatalf("error counter was incremented after a successful call: %v", got)
+	}
+
+	f = NewInstrumentedHardwareFinder(fakeFinder{err: errors.New("backend down"), delay: delay})
+	if _, err := f.ByMAC(context.Background(), nil, nil, ""); err == nil {
+		t.Fatal("expected an error")
+	}
+	if gotCount, _ := callDuration(t, backendHardwareFinder, "by_mac"); gotCount != count+2 {
+		t.Fatalf("want %d observations, got %d", count+2, gotCount)
+	}
+	if got := testutil.ToFloat64(errs); got != failed+1 {
+		t.Fatalf("want %v errors, got %v", failed+1, got)
+	}
+
+	f = NewInstrumentedHardwareFinder(fakeFinder{err: ErrNotFound})
+	if _, err := f.ByMAC(context.Background(), nil, nil, ""); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected ErrNotFound, got: %v", err)
+	}
+	if got := testutil.ToFloat64(errs); got != failed+1 {
+		t.Fatalf("error counter was incremented after a not found response: %v", got)
+	}
+}
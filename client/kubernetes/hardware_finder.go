@@ -79,7 +79,7 @@ func (f *Finder) ByIP(ctx context.Context, ip net.IP) (client.Discoverer, error)
 	}
 
 	if len(hardwareList.Items) > 1 {
-		return nil, errors.Errorf("got %d hardware for ip %s, expected only 1", len(hardwareList.Items), ip)
+		return nil, ambiguous("ip "+ip.String(), hardwareList)
 	}
 
 	return NewK8sDiscoverer(&hardwareList.Items[0]), nil
@@ -101,12 +101,22 @@ func (f *Finder) ByMAC(ctx context.Context, mac net.HardwareAddr, _ net.IP, _ st
 	}
 
 	if len(hardwareList.Items) > 1 {
-		return nil, errors.Errorf("got %d hardware for mac %s, expected only 1", len(hardwareList.Items), mac)
+		return nil, ambiguous("mac "+mac.String(), hardwareList)
 	}
 
 	return NewK8sDiscoverer(&hardwareList.Items[0]), nil
 }
 
+// ambiguous returns the error for the lookup of key matching all of hardwareList.
+func ambiguous(key string, hardwareList *v1alpha1.HardwareList) error {
+	matches := make([]client.Discoverer, len(hardwareList.Items))
+	for i := range hardwareList.Items {
+		matches[i] = NewK8sDiscoverer(&hardwareList.Items[i])
+	}
+
+	return &client.AmbiguousHardwareError{Key: key, Matches: matches}
+}
+
 // HasActiveWorkflow finds if an active workflow exists for a particular hardware ID.
 func (f *Finder) HasActiveWorkflow(ctx context.Context, hwID client.HardwareID) (bool, error) {
 	if hwID == "" {
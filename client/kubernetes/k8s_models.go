@@ -184,7 +184,17 @@ func (d *K8sDiscoverer) HardwareAllowWorkflow(mac net.HardwareAddr) bool {
 func (d *K8sDiscoverer) HardwareAllowPXE(mac net.HardwareAddr) bool {
 	for _, iface := range d.hw.Spec.Interfaces {
 		if iface.Netboot != nil && iface.DHCP != nil && mac.String() == iface.DHCP.MAC {
-			return *iface.Netboot.AllowPXE
+			return iface.Netboot.AllowPXE != nil && *iface.Netboot.AllowPXE
+		}
+	}
+
+	return false
+}
+
+func (d *K8sDiscoverer) HardwareAllowPXESet(mac net.HardwareAddr) bool {
+	for _, iface := range d.hw.Spec.Interfaces {
+		if iface.DHCP != nil && mac.String() == iface.DHCP.MAC {
+			return iface.Netboot != nil && iface.Netboot.AllowPXE != nil
 		}
 	}
 
@@ -278,6 +288,16 @@ func (d *K8sDiscoverer) HardwareOSIEVersion() string {
 	return ""
 }
 
+// HardwareSerial is not part of the Hardware resource.
+func (d *K8sDiscoverer) HardwareSerial() string {
+	return ""
+}
+
+// HardwareAssetTag is not part of the Hardware resource.
+func (d *K8sDiscoverer) HardwareAssetTag() string {
+	return ""
+}
+
 func (d *K8sDiscoverer) HardwareUEFI(net.HardwareAddr) bool {
 	for _, iface := range d.hw.Spec.Interfaces {
 		if iface.DHCP != nil {
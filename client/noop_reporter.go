@@ -62,3 +62,13 @@ func NewNoOpReporter(logger log.Logger) Reporter {
 		logger: logger,
 	}
 }
+
+// NewLocalReporter returns the reporter used when none is configured, one that
+// does nothing or, with logEvents, one that only logs what it is given.
+func NewLocalReporter(logger log.Logger, logEvents bool) Reporter {
+	if logEvents {
+		return NewSinkReporter(logger, NewLogSink(logger))
+	}
+
+	return NewNoOpReporter(logger)
+}
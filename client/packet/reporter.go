@@ -69,6 +69,22 @@ func (c *Reporter) Do(ctx context.Context, req *http.Request, v interface{}) err
 	return unmarshalResponse(res, v)
 }
 
+// Ping checks the API is reachable, any response counts.
+func (c *Reporter) Ping(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, c.baseURL.String(), nil)
+	if err != nil {
+		return errors.Wrap(err, "setup HEAD request")
+	}
+	c.addHeaders(req)
+	res, err := c.http.Do(req)
+	if err != nil {
+		return errors.Wrap(err, "ping api")
+	}
+	res.Body.Close()
+
+	return nil
+}
+
 func (c *Reporter) Get(ctx context.Context, ref string, v interface{}) error {
 	req, err := http.NewRequest("GET", ref, nil)
 	if err != nil {
@@ -20,3 +20,19 @@ type Reporter interface {
 
 	Post(ctx context.Context, ref, mime string, body io.Reader, v interface{}) error
 }
+
+// Pinger is implemented by Reporters that can check their backend is reachable.
+type Pinger interface {
+	Ping(ctx context.Context) error
+}
+
+// PingReporter checks the backend of r is reachable, always nil for reporters
+// that can not tell.
+func PingReporter(ctx context.Context, r Reporter) error {
+	p, ok := r.(Pinger)
+	if !ok {
+		return nil
+	}
+
+	return p.Ping(ctx)
+}
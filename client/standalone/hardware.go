@@ -4,24 +4,37 @@ import (
 	"net"
 
 	"github.com/tinkerbell/boots/client"
+	"github.com/tinkerbell/boots/conf"
 )
 
 // HardwareStandalone implements the Hardware interface for standalone operation.
 type HardwareStandalone struct {
-	ID          string          `json:"id"`
+	ID string `json:"id"`
+	// SMBIOS UUID of the machine, as PXE clients send it in DHCP option 97.
+	UUID        string          `json:"uuid"`
 	Network     client.Network  `json:"network"`
 	Metadata    client.Metadata `json:"metadata"`
 	Traceparent string          `json:"traceparent"`
 }
 
 func (hs *HardwareStandalone) HardwareAllowPXE(net.HardwareAddr) bool {
-	return hs.getPrimaryInterface().Netboot.AllowPXE
+	allow := hs.getPrimaryInterface().Netboot.AllowPXE
+
+	return allow != nil && *allow
+}
+
+func (hs *HardwareStandalone) HardwareAllowPXESet(net.HardwareAddr) bool {
+	return hs.getPrimaryInterface().Netboot.AllowPXE != nil
 }
 
 func (hs *HardwareStandalone) HardwareAllowWorkflow(net.HardwareAddr) bool {
 	return hs.getPrimaryInterface().Netboot.AllowWorkflow
 }
 
+func (hs *HardwareStandalone) HardwareNoWorkflow(net.HardwareAddr) bool {
+	return hs.getPrimaryInterface().Netboot.NoWorkflow
+}
+
 func (hs *HardwareStandalone) HardwareArch(net.HardwareAddr) string {
 	return hs.getPrimaryInterface().DHCP.Arch
 }
@@ -30,8 +43,22 @@ func (hs *HardwareStandalone) HardwareBondingMode() client.BondingMode {
 	return hs.Metadata.BondingMode
 }
 
+// HardwareFacilityCode returns the facility of the hardware, without one in
+// the record the FACILITY_NETWORKS facility of its first address in one.
 func (hs *HardwareStandalone) HardwareFacilityCode() string {
-	return hs.Metadata.Facility.FacilityCode
+	if code := hs.Metadata.Facility.FacilityCode; code != "" {
+		return code
+	}
+	for _, ip := range hs.HardwareIPs() {
+		if ip.Address == nil {
+			continue
+		}
+		if code := conf.FacilityForIP(ip.Address); code != "" {
+			return code
+		}
+	}
+
+	return ""
 }
 
 func (hs *HardwareStandalone) HardwareID() client.HardwareID {
@@ -75,6 +102,14 @@ func (hs *HardwareStandalone) HardwareOSIEVersion() string {
 	return "" // stubbed out in tink too
 }
 
+func (hs *HardwareStandalone) HardwareSerial() string {
+	return hs.Metadata.Serial
+}
+
+func (hs *HardwareStandalone) HardwareAssetTag() string {
+	return hs.Metadata.AssetTag
+}
+
 func (hs *HardwareStandalone) HardwareUEFI(net.HardwareAddr) bool {
 	return hs.getPrimaryInterface().DHCP.UEFI
 }
@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"net"
 	"os"
+	"strings"
 
 	"github.com/pkg/errors"
 	"github.com/tinkerbell/boots/client"
@@ -35,24 +36,59 @@ func NewHardwareFinder(path string) (*HardwareFinder, error) {
 
 // ByIP returns a Discoverer for a particular IP.
 func (f *HardwareFinder) ByIP(_ context.Context, ip net.IP) (client.Discoverer, error) {
+	var matches []client.Discoverer
 	for _, d := range f.db {
 		for _, hip := range d.HardwareIPs() {
 			if hip.Address.Equal(ip) {
-				return d, nil
+				matches = append(matches, d)
+
+				break
 			}
 		}
 	}
+	if len(matches) == 0 {
+		return nil, errors.Wrapf(client.ErrNotFound, "no hardware found for ip %q", ip)
+	}
 
-	return nil, errors.Errorf("no hardware found for ip %q", ip)
+	return unique("ip "+ip.String(), matches)
 }
 
 // ByMAC returns a Discoverer for a particular MAC address.
 func (f *HardwareFinder) ByMAC(_ context.Context, mac net.HardwareAddr, _ net.IP, _ string) (client.Discoverer, error) {
+	var matches []client.Discoverer
 	for _, d := range f.db {
 		if d.MAC().String() == mac.String() {
-			return d, nil
+			matches = append(matches, d)
+		}
+	}
+	if len(matches) == 0 {
+		return nil, errors.Wrapf(client.ErrNotFound, "no entry for MAC %q in standalone data", mac.String())
+	}
+
+	return unique("mac "+mac.String(), matches)
+}
+
+// unique returns the only match of the lookup of key, an
+// AmbiguousHardwareError if there are several.
+func unique(key string, matches []client.Discoverer) (client.Discoverer, error) {
+	if len(matches) > 1 {
+		return nil, &client.AmbiguousHardwareError{Key: key, Matches: matches}
+	}
+
+	return matches[0], nil
+}
+
+// ByUUID returns a Discoverer for the hardware whose SMBIOS UUID is uuid.
+func (f *HardwareFinder) ByUUID(_ context.Context, uuid string) (client.Discoverer, error) {
+	var matches []client.Discoverer
+	for _, d := range f.db {
+		if d.UUID != "" && strings.EqualFold(d.UUID, uuid) {
+			matches = append(matches, d)
 		}
 	}
+	if len(matches) == 0 {
+		return nil, errors.Wrapf(client.ErrNotFound, "no entry for UUID %q in standalone data", uuid)
+	}
 
-	return nil, errors.Errorf("no entry for MAC %q in standalone data", mac.String())
+	return unique("uuid "+uuid, matches)
 }
@@ -8,6 +8,7 @@ import (
 	"github.com/google/go-cmp/cmp"
 	"github.com/pkg/errors"
 	"github.com/tinkerbell/boots/client"
+	"github.com/tinkerbell/boots/conf"
 )
 
 func TestByIP(t *testing.T) {
@@ -40,7 +41,7 @@ func TestByIP(t *testing.T) {
 				},
 			},
 			want:    nil,
-			wantErr: errors.New(`no hardware found for ip "192.168.1.1"`),
+			wantErr: errors.New(`no hardware found for ip "192.168.1.1": hardware not found`),
 		},
 		{
 			name: "happy path",
@@ -165,7 +166,7 @@ func TestByMAC(t *testing.T) {
 				},
 			},
 			want:    nil,
-			wantErr: errors.New(`no entry for MAC "ab:cd:ef:01:12:34" in standalone data`),
+			wantErr: errors.New(`no entry for MAC "ab:cd:ef:01:12:34" in standalone data: hardware not found`),
 		},
 		{
 			name: "happy path",
@@ -253,3 +254,92 @@ func TestByMAC(t *testing.T) {
 		})
 	}
 }
+
+func TestByUUID(t *testing.T) {
+	d := &DiscoverStandalone{HardwareStandalone: HardwareStandalone{ID: "abc123", UUID: "4c4c4544-0042-3010-8057-b3c04f4e4d32"}}
+	f := HardwareFinder{db: []*DiscoverStandalone{{HardwareStandalone: HardwareStandalone{ID: "4c4c4544-0042-3010-8057-b3c04f4e4d32"}}, d}}
+
+	got, err := client.FindByUUID(context.Background(), &f, "4C4C4544-0042-3010-8057-B3C04F4E4D32")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != d {
+		t.Fatalf("unexpected hardware, want: %v, got: %v", d, got)
+	}
+
+	if _, err := f.ByUUID(context.Background(), "00000000-0000-0000-0000-000000000000"); !errors.Is(err, client.ErrNotFound) {
+		t.Fatalf("expected not found for an unknown uuid, got: %v", err)
+	}
+}
+
+func TestByMACAmbiguous(t *testing.T) {
+	db := []*DiscoverStandalone{
+		{HardwareStandalone: HardwareStandalone{ID: "b", Network: client.Network{Interfaces: []client.NetworkInterface{{DHCP: client.DHCP{MAC: &client.MaxMAC, IP: client.IP{Address: net.ParseIP("192.168.1.1")}}}}}}},
+		{HardwareStandalone: HardwareStandalone{ID: "a", Network: client.Network{Interfaces: []client.NetworkInterface{{DHCP: client.DHCP{MAC: &client.MaxMAC, IP: client.IP{Address: net.ParseIP("192.168.1.1")}}}}}}},
+	}
+	f := HardwareFinder{db: db}
+
+	for name, lookup := range map[string]func() (client.Discoverer, error){
+		"mac": func() (client.Discoverer, error) {
+			return f.ByMAC(context.Background(), client.MaxMAC.HardwareAddr(), nil, "")
+		},
+		"ip": func() (client.Discoverer, error) { return f.ByIP(context.Background(), net.ParseIP("192.168.1.1")) },
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, err := lookup()
+			var amb *client.AmbiguousHardwareError
+			if !errors.As(err, &amb) {
+				t.Fatalf("expected an ambiguous hardware error, got: %v", err)
+			}
+			if diff := cmp.Diff([]string{"a", "b"}, amb.IDs()); diff != "" {
+				t.Fatal(diff)
+			}
+			if id := amb.Lowest().Hardware().HardwareID(); id != "a" {
+				t.Fatalf("unexpected lowest hardware id: %s", id)
+			}
+		})
+	}
+}
+
+func TestByIPFacilityNetworks(t *testing.T) {
+	defer func(networks []conf.FacilityNetwork) { conf.FacilityNetworks = networks }(conf.FacilityNetworks)
+	network := func(cidr, facility string) conf.FacilityNetwork {
+		_, n, _ := net.ParseCIDR(cidr)
+
+		return conf.FacilityNetwork{Network: n, Facility: facility}
+	}
+	conf.FacilityNetworks = []conf.FacilityNetwork{
+		network("192.168.0.0/16", "ewr1"),
+		network("192.168.2.0/24", "sjc1"),
+	}
+	hardware := func(id, ip, facility string) *DiscoverStandalone {
+		return &DiscoverStandalone{HardwareStandalone: HardwareStandalone{
+			ID: id,
+			Network: client.Network{Interfaces: []client.NetworkInterface{{
+				DHCP: client.DHCP{IP: client.IP{Address: net.ParseIP(ip)}},
+			}}},
+			Metadata: client.Metadata{Facility: client.Facility{FacilityCode: facility}},
+		}}
+	}
+	f := &HardwareFinder{db: []*DiscoverStandalone{
+		hardware("a", "192.168.1.5", ""),
+		hardware("b", "192.168.2.5", ""),
+		hardware("c", "192.168.2.6", "dfw2"),
+		hardware("d", "10.0.0.5", ""),
+	}}
+
+	for ip, want := range map[string]string{
+		"192.168.1.5": "ewr1",
+		"192.168.2.5": "sjc1",
+		"192.168.2.6": "dfw2",
+		"10.0.0.5":    "",
+	} {
+		d, err := f.ByIP(context.Background(), net.ParseIP(ip))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := d.Hardware().HardwareFacilityCode(); got != want {
+			t.Fatalf("%s: unexpected facility, want: %q, got: %q", ip, want, got)
+		}
+	}
+}
@@ -90,13 +90,23 @@ func (d *DiscoveryTinkerbellV1) SetMAC(mac net.HardwareAddr) {
 }
 
 func (h HardwareTinkerbellV1) HardwareAllowPXE(mac net.HardwareAddr) bool {
-	return h.Network.InterfaceByMac(mac).Netboot.AllowPXE
+	allow := h.Network.InterfaceByMac(mac).Netboot.AllowPXE
+
+	return allow != nil && *allow
+}
+
+func (h HardwareTinkerbellV1) HardwareAllowPXESet(mac net.HardwareAddr) bool {
+	return h.Network.InterfaceByMac(mac).Netboot.AllowPXE != nil
 }
 
 func (h HardwareTinkerbellV1) HardwareAllowWorkflow(mac net.HardwareAddr) bool {
 	return h.Network.InterfaceByMac(mac).Netboot.AllowWorkflow
 }
 
+func (h HardwareTinkerbellV1) HardwareNoWorkflow(mac net.HardwareAddr) bool {
+	return h.Network.InterfaceByMac(mac).Netboot.NoWorkflow
+}
+
 func (h HardwareTinkerbellV1) HardwareArch(mac net.HardwareAddr) string {
 	return h.Network.InterfaceByMac(mac).DHCP.Arch
 }
@@ -147,6 +157,14 @@ func (h HardwareTinkerbellV1) HardwareOSIEVersion() string {
 	return ""
 }
 
+func (h HardwareTinkerbellV1) HardwareSerial() string {
+	return h.Metadata.Serial
+}
+
+func (h HardwareTinkerbellV1) HardwareAssetTag() string {
+	return h.Metadata.AssetTag
+}
+
 func (h HardwareTinkerbellV1) HardwareUEFI(mac net.HardwareAddr) bool {
 	return h.Network.InterfaceByMac(mac).DHCP.UEFI
 }
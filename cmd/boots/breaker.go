@@ -0,0 +1,66 @@
+package main
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/tinkerbell/boots/conf"
+	"github.com/tinkerbell/boots/ipxe"
+	"github.com/tinkerbell/boots/metrics"
+)
+
+// outageBackends are the backends whose outage stops boot files from being
+// served, boot files can not be trusted without them.
+var outageBackends = []string{"hardware_finder", "workflow_finder"}
+
+// backendOutage reports whether one of outageBackends last failed after its
+// last success, and that success, or the start of boots if there was none, is
+// older than conf.BackendOutageTimeout.
+func backendOutage(now time.Time) bool {
+	if conf.BackendOutageTimeout <= 0 {
+		return false
+	}
+	for _, backend := range outageBackends {
+		success := gaugeTime(metrics.BackendLastSuccess.WithLabelValues(backend))
+		failure := gaugeTime(metrics.BackendLastFailure.WithLabelValues(backend))
+		if !failure.After(success) {
+			continue
+		}
+		if success.IsZero() {
+			success = StartTime
+		}
+		if now.Sub(success) > conf.BackendOutageTimeout {
+			return true
+		}
+	}
+
+	return false
+}
+
+// gaugeTime returns the time of the unix timestamp of g, the zero time if unset.
+func gaugeTime(g prometheus.Gauge) time.Time {
+	m := &dto.Metric{}
+	if err := g.Write(m); err != nil || m.GetGauge().GetValue() == 0 {
+		return time.Time{}
+	}
+
+	return time.Unix(0, int64(m.GetGauge().GetValue()*float64(time.Second)))
+}
+
+// serveBackendOutage responds to a boot file request during a backend outage,
+// with conf.BackendOutageScript an iPXE script rebooting to try again later.
+func serveBackendOutage(w http.ResponseWriter, req *http.Request) {
+	mainlog.With("client", req.RemoteAddr, "uri", req.RequestURI).Info("backends are down, not serving boot files")
+	if !conf.BackendOutageScript {
+		w.WriteHeader(http.StatusServiceUnavailable)
+
+		return
+	}
+	s := ipxe.NewScript()
+	s.Echo("boots backends are unavailable, retrying later")
+	s.Sleep(int(conf.BackendOutageRetryDelay.Seconds()))
+	s.Reboot()
+	_, _ = w.Write(s.Bytes())
+}
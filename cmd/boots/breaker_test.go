@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/tinkerbell/boots/conf"
+	"github.com/tinkerbell/boots/ipxe"
+	"github.com/tinkerbell/boots/job"
+	"github.com/tinkerbell/boots/metrics"
+)
+
+func TestBackendOutage(t *testing.T) {
+	defer func(timeout time.Duration, script bool) {
+		conf.BackendOutageTimeout, conf.BackendOutageScript = timeout, script
+	}(conf.BackendOutageTimeout, conf.BackendOutageScript)
+	conf.BackendOutageTimeout = time.Minute
+	success := metrics.BackendLastSuccess.WithLabelValues("hardware_finder")
+	failure := metrics.BackendLastFailure.WithLabelValues("hardware_finder")
+	defer success.Set(0)
+	defer failure.Set(0)
+
+	i := job.NewInstallers()
+	i.RegisterDistro("alpine", func(_ context.Context, _ job.Job, s *ipxe.Script) { s.Echo("alpine installer") })
+	mock := job.NewMock(t, "c3.small.x86", "ewr1")
+	mock.SetOSDistro("alpine")
+	mock.SetAllowPXE(true)
+	j := mock.Job()
+	h := (&BootsHTTPServer{jobManager: tjobManager{j: &j}}).handler(i, "/ipxe/", nil)
+	get := func() *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest("GET", "http://example.com/auto.ipxe", nil))
+
+		return w
+	}
+	at := func(g prometheus.Gauge, tm time.Time) {
+		g.Set(float64(tm.UnixNano()) / float64(time.Second))
+	}
+
+	now := time.Now()
+	at(success, now.Add(-30*time.Second))
+	at(failure, now.Add(-time.Second))
+	if w := get(); w.Code != http.StatusOK {
+		t.Fatalf("failing for less than the timeout: unexpected status, want: %d, got: %d", http.StatusOK, w.Code)
+	}
+
+	at(success, now.Add(-2*time.Minute))
+	if w := get(); w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("failing for longer than the timeout: unexpected status, want: %d, got: %d", http.StatusServiceUnavailable, w.Code)
+	}
+	conf.BackendOutageScript = true
+	if w := get(); w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "reboot") || strings.Contains(w.Body.String(), "alpine installer") {
+		t.Fatalf("failing for longer than the timeout: unexpected outage script, status: %d\n%s", w.Code, w.Body.String())
+	}
+
+	at(success, time.Now())
+	if w := get(); w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "alpine installer") {
+		t.Fatalf("recovered: unexpected response, status: %d\n%s", w.Code, w.Body.String())
+	}
+}
+
+func TestBackendOutageNeverSucceeded(t *testing.T) {
+	defer func(timeout time.Duration, start time.Time) {
+		conf.BackendOutageTimeout, StartTime = timeout, start
+	}(conf.BackendOutageTimeout, StartTime)
+	conf.BackendOutageTimeout = time.Minute
+	failure := metrics.BackendLastFailure.WithLabelValues("workflow_finder")
+	defer failure.Set(0)
+	failure.SetToCurrentTime()
+
+	StartTime = time.Now()
+	if backendOutage(time.Now()) {
+		t.Fatal("outage right after starting")
+	}
+	StartTime = time.Now().Add(-2 * time.Minute)
+	if !backendOutage(time.Now()) {
+		t.Fatal("no outage after failing since startup for longer than the timeout")
+	}
+	conf.BackendOutageTimeout = 0
+	if backendOutage(time.Now()) {
+		t.Fatal("outage while disabled")
+	}
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"fmt"
 	"net"
 	"runtime"
 
@@ -10,10 +11,11 @@ import (
 	dhcp4 "github.com/packethost/dhcp4-go"
 	"github.com/packethost/pkg/env"
 	"github.com/pkg/errors"
-	"github.com/prometheus/client_golang/prometheus"
 	"github.com/tinkerbell/boots/conf"
+	"github.com/tinkerbell/boots/dhcp"
 	"github.com/tinkerbell/boots/job"
 	"github.com/tinkerbell/boots/metrics"
+	"github.com/tinkerbell/boots/timeline"
 	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/codes"
@@ -22,6 +24,10 @@ import (
 
 type BootsDHCPServer struct {
 	jobmanager job.Manager
+	// httpPort is the port boots serves HTTP on and ipxePattern the path it
+	// serves the iPXE binaries under, empty if they are served remotely.
+	httpPort    string
+	ipxePattern string
 }
 
 // ServeDHCP starts the DHCP server.
@@ -34,7 +40,10 @@ func (s *BootsDHCPServer) ServeDHCP(addr string, nextServer net.IP, ipxeBaseURL
 		nextServer:   nextServer,
 		ipxeBaseURL:  ipxeBaseURL,
 		bootsBaseURL: bootsBaseURL,
+		httpPort:     s.httpPort,
+		ipxePattern:  s.ipxePattern,
 		jobmanager:   s.jobmanager,
+		limiter:      newPacketLimiter(conf.DHCPRateLimit, conf.DHCPRateLimitBurst),
 	}
 	defer handler.pool.Stop()
 
@@ -53,10 +62,19 @@ type dhcpHandler struct {
 	nextServer   net.IP
 	ipxeBaseURL  string
 	bootsBaseURL string
+	httpPort     string
+	ipxePattern  string
 	jobmanager   job.Manager
+	limiter      *packetLimiter
 }
 
 func (d dhcpHandler) ServeDHCP(w dhcp4.ReplyWriter, req *dhcp4.Packet) {
+	// drop floods before they take up workers
+	if !d.limiter.allow(req.GetCHAddr().String()) {
+		metrics.DHCPRateLimited.Inc()
+
+		return
+	}
 	d.pool.Submit(func() { d.serve(w, req) })
 }
 
@@ -76,10 +94,7 @@ func (d dhcpHandler) serve(w dhcp4.ReplyWriter, req *dhcp4.Packet) {
 	}
 
 	metrics.DHCPTotal.WithLabelValues("recv", req.GetMessageType().String(), gi.String()).Inc()
-	labels := prometheus.Labels{"from": "dhcp", "op": req.GetMessageType().String()}
-	metrics.JobsTotal.With(labels).Inc()
-	metrics.JobsInProgress.With(labels).Inc()
-	timer := prometheus.NewTimer(metrics.JobDuration.With(labels))
+	jm := startJobMetrics("dhcp", req.GetMessageType().String())
 
 	circuitID, err := getCircuitID(req)
 	if err != nil {
@@ -96,20 +111,26 @@ func (d dhcpHandler) serve(w dhcp4.ReplyWriter, req *dhcp4.Packet) {
 		trace.WithAttributes(attribute.String("CircuitID", circuitID)),
 	)
 
-	ctx, j, err := d.jobmanager.CreateFromDHCP(ctx, mac, gi, circuitID)
+	ctx, j, err := d.jobmanager.CreateFromDHCP(ctx, mac, gi, circuitID, dhcp.ClientUUID(req))
 	if err != nil {
 		mainlog.With("type", req.GetMessageType(), "mac", mac).Error(err, "retrieved job is empty")
-		metrics.JobsInProgress.With(labels).Dec()
-		timer.ObserveDuration()
+		jm.done()
 		span.SetStatus(codes.Error, err.Error())
 		span.End()
 
 		return
 	}
 	span.End()
+	jm.resolved(j)
+	timeline.Record(mac, "dhcp", fmt.Sprintf("received %s giaddr=%s", req.GetMessageType(), gi))
 	j.IpxeBaseURL = d.ipxeBaseURL
 	j.BootsBaseURL = d.bootsBaseURL
 	j.NextServer = d.nextServer
+	if subnet, ok := conf.DHCPSubnetFor(gi); ok {
+		j.With("giaddr", gi, "subnet", subnet.Subnet, "server", subnet.Server).Info("using the boots address of the relayed subnet")
+		j.NextServer = subnet.Server
+		j.BootsBaseURL, j.IpxeBaseURL = d.subnetBaseURLs(subnet)
+	}
 
 	go func() {
 		ctx, span := tracer.Start(ctx, "DHCP Reply")
@@ -126,8 +147,7 @@ func (d dhcpHandler) serve(w dhcp4.ReplyWriter, req *dhcp4.Packet) {
 			}
 		}
 		span.End()
-		metrics.JobsInProgress.With(labels).Dec()
-		timer.ObserveDuration()
+		jm.done()
 	}()
 }
 
@@ -146,3 +166,18 @@ func getCircuitID(req *dhcp4.Packet) (string, error) {
 
 	return circuitID, nil
 }
+
+// subnetBaseURLs returns the boots and iPXE base URLs for machines of a relayed
+// subnet, reaching boots at the subnet server on the port it serves HTTP on.
+// Remotely served iPXE binaries keep their configured URL.
+func (d dhcpHandler) subnetBaseURLs(subnet conf.DHCPSubnet) (string, string) {
+	boots := subnet.Server.String()
+	if d.httpPort != "" && d.httpPort != "80" {
+		boots = net.JoinHostPort(boots, d.httpPort)
+	}
+	if d.ipxePattern == "" {
+		return boots, d.ipxeBaseURL
+	}
+
+	return boots, boots + d.ipxePattern
+}
@@ -1,11 +1,19 @@
 package main
 
 import (
+	"bytes"
+	"net"
 	"os"
 	"testing"
+	"time"
 
+	"github.com/gammazero/workerpool"
 	"github.com/packethost/dhcp4-go"
 	"github.com/packethost/pkg/log"
+	"github.com/tinkerbell/boots/conf"
+	"github.com/tinkerbell/boots/dhcp"
+	"github.com/tinkerbell/boots/httplog"
+	"github.com/tinkerbell/boots/job"
 	"github.com/tinkerbell/boots/metrics"
 )
 
@@ -58,13 +66,100 @@ func TestGetCircuitID(t *testing.T) {
 	}
 }
 
+// treplyWriter hands the replies written to it over to the test.
+type treplyWriter chan dhcp4.Reply
+
+func (w treplyWriter) WriteReply(r dhcp4.Reply) error {
+	w <- r
+
+	return nil
+}
+
+func TestDHCPRelaySubnet(t *testing.T) {
+	defer func(subnets []conf.DHCPSubnet) { conf.DHCPSubnets = subnets }(conf.DHCPSubnets)
+	subnets, err := conf.ParseDHCPSubnets("10.10.0.0/24:10.10.0.2,10.20.0.0/24:10.20.0.2,10.20.0.128/25:10.20.0.130")
+	if err != nil {
+		t.Fatal(err)
+	}
+	conf.DHCPSubnets = subnets
+
+	for _, test := range []struct {
+		name        string
+		giaddr      net.IP
+		httpPort    string
+		ipxePattern string
+		server      string
+		boots       string
+		ipxe        string
+	}{
+		{name: "relayed from subnet b", giaddr: net.ParseIP("10.20.0.1"), httpPort: "80", ipxePattern: "/ipxe/", server: "10.20.0.2", boots: "10.20.0.2", ipxe: "10.20.0.2/ipxe/"},
+		{name: "relayed from subnet a", giaddr: net.ParseIP("10.10.0.1"), httpPort: "80", ipxePattern: "/ipxe/", server: "10.10.0.2", boots: "10.10.0.2", ipxe: "10.10.0.2/ipxe/"},
+		{name: "most specific subnet", giaddr: net.ParseIP("10.20.0.129"), httpPort: "80", ipxePattern: "/ipxe/", server: "10.20.0.130", boots: "10.20.0.130", ipxe: "10.20.0.130/ipxe/"},
+		{name: "http port", giaddr: net.ParseIP("10.20.0.1"), httpPort: "8080", ipxePattern: "/ipxe/", server: "10.20.0.2", boots: "10.20.0.2:8080", ipxe: "10.20.0.2:8080/ipxe/"},
+		{name: "remote ipxe", giaddr: net.ParseIP("10.20.0.1"), httpPort: "8080", server: "10.20.0.2", boots: "10.20.0.2:8080", ipxe: "ipxe.example.com/"},
+		{name: "relayed from unknown subnet", giaddr: net.ParseIP("10.30.0.1"), httpPort: "8080", ipxePattern: "/ipxe/", server: "192.168.0.2", boots: "192.168.0.2", ipxe: "ipxe.example.com/"},
+		{name: "not relayed", giaddr: net.IPv4zero, httpPort: "8080", ipxePattern: "/ipxe/", server: "192.168.0.2", boots: "192.168.0.2", ipxe: "ipxe.example.com/"},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			mock := job.NewMock(t, "c3.small.x86", "ewr1")
+			mock.SetMAC("00:00:ba:dd:be:ef")
+			mock.SetNetwork(net.ParseIP("10.20.0.10"), net.ParseIP("255.255.255.0"), net.ParseIP("10.20.0.1"))
+			mock.SetAllowPXE(true)
+			j := mock.Job()
+			d := dhcpHandler{
+				pool:         workerpool.New(1),
+				nextServer:   net.ParseIP("192.168.0.2"),
+				ipxeBaseURL:  "ipxe.example.com/",
+				bootsBaseURL: "192.168.0.2",
+				httpPort:     test.httpPort,
+				ipxePattern:  test.ipxePattern,
+				jobmanager:   tjobManager{j: &j},
+			}
+			defer d.pool.Stop()
+
+			req := dhcp4.NewPacket(dhcp4.BootRequest)
+			hw, _ := net.ParseMAC("00:00:ba:dd:be:ef")
+			req.HLen()[0] = byte(len(hw))
+			copy(req.CHAddr(), hw)
+			req.SetGIAddr(test.giaddr.To4())
+			req.SetMessageType(dhcp4.MessageTypeDiscover)
+			req.SetString(dhcp4.OptionClassID, "PXEClient")
+			req.SetString(dhcp4.OptionUserClass, "Tinkerbell")
+
+			w := make(treplyWriter, 1)
+			d.serve(w, &req)
+			var rep *dhcp4.Packet
+			select {
+			case r := <-w:
+				rep = r.Reply()
+			case <-time.After(5 * time.Second):
+				t.Fatal("no reply")
+			}
+
+			if got := rep.GetSIAddr().String(); got != test.server {
+				t.Fatalf("unexpected next server, want: %s, got: %s", test.server, got)
+			}
+			want := "http://" + test.boots + "/auto.ipxe"
+			if got := string(bytes.TrimRight(rep.File(), "\x00")); got != want {
+				t.Fatalf("unexpected filename, want: %s, got: %s", want, got)
+			}
+			if j.IpxeBaseURL != test.ipxe {
+				t.Fatalf("unexpected ipxe base url, want: %s, got: %s", test.ipxe, j.IpxeBaseURL)
+			}
+		})
+	}
+}
+
 func TestMain(m *testing.M) {
 	l, err := log.Init("github.com/tinkerbell/boots")
 	if err != nil {
 		panic(nil)
 	}
 	defer l.Close()
-	mainlog = l.Package("main")
+	mainlog = job.NewRedactingLogger(l.Package("main"))
+	httplog.Init(l)
+	dhcp.Init(l)
+	conf.MetricsFacilityLabel = true
 	metrics.Init(l)
 	os.Exit(m.Run()) //nolint:gocritic // this seems to be the correct pattern
 }
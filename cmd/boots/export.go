@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"strconv"
+
+	"github.com/pkg/errors"
+	"github.com/tinkerbell/boots/conf"
+	"github.com/tinkerbell/boots/installers/flatcar"
+	"github.com/tinkerbell/boots/installers/vmware"
+	"github.com/tinkerbell/boots/job"
+)
+
+// exportRequest selects the machines, by MAC, whose config is exported, the
+// kind of config (ipxe, ignition or kickstart, ipxe by default) and optionally
+// the installer forced for the ipxe boot scripts.
+type exportRequest struct {
+	MACs      []string `json:"macs"`
+	Config    string   `json:"config"`
+	Installer string   `json:"installer"`
+}
+
+// exportResponse holds the configs rendered, and the errors of the machines
+// they could not be rendered for, by the requested MAC.
+type exportResponse struct {
+	Configs map[string]string `json:"configs"`
+	Errors  map[string]string `json:"errors,omitempty"`
+}
+
+type exportRenderer func(context.Context, job.Job) ([]byte, error)
+
+// exportRendererFor returns the renderer of the config named name, false if there is none.
+func exportRendererFor(name string, i job.Installers) (exportRenderer, bool) {
+	switch name {
+	case "", "ipxe":
+		return func(ctx context.Context, j job.Job) ([]byte, error) {
+			script, ok := j.AutoScript(ctx, i)
+			if !ok {
+				return nil, errors.New("no boot script to serve")
+			}
+
+			return script, nil
+		}, true
+	case "ignition":
+		return flatcar.IgnitionConfig, true
+	case "kickstart":
+		return func(_ context.Context, j job.Job) ([]byte, error) { return vmware.Kickstart(j) }, true
+	}
+
+	return nil, false
+}
+
+// serveExport renders the config of each machine of an exportRequest for
+// audits, reporting no events for them.
+func (h *jobHandler) serveExport(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+
+		return
+	}
+
+	var er exportRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, req.Body, 1<<20)).Decode(&er); err != nil {
+		http.Error(w, "invalid export request: "+err.Error(), http.StatusBadRequest)
+
+		return
+	}
+	if len(er.MACs) == 0 || len(er.MACs) > conf.ExportMaxMachines {
+		http.Error(w, "invalid export request: number of macs must be between 1 and "+strconv.Itoa(conf.ExportMaxMachines), http.StatusBadRequest)
+
+		return
+	}
+	render, ok := exportRendererFor(er.Config, h.i)
+	if !ok {
+		http.Error(w, "invalid export request: unknown config "+er.Config, http.StatusBadRequest)
+
+		return
+	}
+
+	ctx := req.Context()
+	if er.Installer != "" {
+		ctx = job.WithInstallerOverride(ctx, er.Installer)
+	}
+	res := exportResponse{Configs: make(map[string]string, len(er.MACs))}
+	fail := func(mac string, err error) {
+		if res.Errors == nil {
+			res.Errors = make(map[string]string)
+		}
+		res.Errors[mac] = err.Error()
+	}
+	for _, s := range er.MACs {
+		mac, err := net.ParseMAC(s)
+		if err != nil {
+			fail(s, err)
+
+			continue
+		}
+		jctx, j, err := h.jobManager.CreateFromDHCP(ctx, mac, nil, "", "")
+		if err != nil {
+			fail(s, err)
+
+			continue
+		}
+		b, err := render(jctx, j.Preview())
+		if err != nil {
+			fail(s, err)
+
+			continue
+		}
+		res.Configs[s] = string(b)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(&res); err != nil {
+		mainlog.Error(errors.Wrap(err, "encoding export response"))
+	}
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/tinkerbell/boots/client"
+	"github.com/tinkerbell/boots/conf"
+	"github.com/tinkerbell/boots/ipxe"
+	"github.com/tinkerbell/boots/job"
+)
+
+// macJobManager creates the jobs of the machines it holds by MAC.
+type macJobManager map[string]*job.Job
+
+func (m macJobManager) CreateFromRemoteAddr(ctx context.Context, _ string) (context.Context, *job.Job, error) {
+	return ctx, nil, client.ErrNotFound
+}
+
+func (m macJobManager) CreateFromDHCP(ctx context.Context, mac net.HardwareAddr, _ net.IP, _, _ string) (context.Context, *job.Job, error) {
+	j, ok := m[mac.String()]
+	if !ok {
+		return ctx, nil, client.ErrNotFound
+	}
+
+	return ctx, j, nil
+}
+
+func TestServeExport(t *testing.T) {
+	defer func(serve bool, max int, token string) {
+		conf.ServeExport, conf.ExportMaxMachines, conf.MetricsAuthToken = serve, max, token
+	}(conf.ServeExport, conf.ExportMaxMachines, conf.MetricsAuthToken)
+	conf.ServeExport, conf.ExportMaxMachines, conf.MetricsAuthToken = true, 3, "s3cr3t"
+
+	i := job.NewInstallers()
+	i.RegisterDistro("alpine", func(_ context.Context, j job.Job, s *ipxe.Script) { s.Echo("alpine " + j.Hostname()) })
+
+	m := macJobManager{}
+	macs := []string{"00:00:00:00:00:01", "00:00:00:00:00:02", "00:00:00:00:00:03"}
+	for _, mac := range macs {
+		mock := job.NewMock(t, "c3.small.x86", "ewr1")
+		mock.SetMAC(mac)
+		mock.SetHostname("host-" + mac[len(mac)-2:])
+		mock.SetOSDistro("alpine")
+		mock.SetReporter(client.NewNoOpReporter(mainlog.Logger))
+		j := mock.Job()
+		m[mac] = &j
+	}
+	s := &BootsHTTPServer{jobManager: m}
+
+	export := func(body string) *http.Response {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("POST", "http://example.com/_packet/export", strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer s3cr3t")
+		s.handler(i, "", nil).ServeHTTP(w, req)
+
+		return w.Result()
+	}
+
+	resp := export(`{"macs":["` + strings.Join(macs, `","`) + `"]}`)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("unexpected status, want: %d, got: %d", http.StatusOK, resp.StatusCode)
+	}
+	var res exportResponse
+	if err := json.NewDecoder(resp.Body).Decode(&res); err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Configs) != 3 || len(res.Errors) != 0 {
+		t.Fatalf("unexpected export: %+v", res)
+	}
+	for _, mac := range macs {
+		if want := "echo alpine host-" + mac[len(mac)-2:] + "\n"; !strings.HasSuffix(res.Configs[mac], want) {
+			t.Fatalf("unexpected config of %s, want suffix: %q, got: %q", mac, want, res.Configs[mac])
+		}
+	}
+
+	for name, body := range map[string]string{
+		"too many machines": `{"macs":["00:00:00:00:00:01","00:00:00:00:00:02","00:00:00:00:00:03","00:00:00:00:00:04"]}`,
+		"no machines":       `{"macs":[]}`,
+		"unknown config":    `{"macs":["00:00:00:00:00:01"],"config":"autoyast"}`,
+	} {
+		t.Run(name, func(t *testing.T) {
+			if resp := export(body); resp.StatusCode != http.StatusBadRequest {
+				t.Fatalf("unexpected status, want: %d, got: %d", http.StatusBadRequest, resp.StatusCode)
+			}
+		})
+	}
+}
+
+func TestServeExportRequiresCredentials(t *testing.T) {
+	defer func(serve bool, token, user, pass string) {
+		conf.ServeExport = serve
+		conf.MetricsAuthToken, conf.MetricsAuthUsername, conf.MetricsAuthPassword = token, user, pass
+	}(conf.ServeExport, conf.MetricsAuthToken, conf.MetricsAuthUsername, conf.MetricsAuthPassword)
+	conf.ServeExport = true
+	conf.MetricsAuthToken, conf.MetricsAuthUsername, conf.MetricsAuthPassword = "", "", ""
+
+	s := &BootsHTTPServer{jobManager: macJobManager{}}
+	w := httptest.NewRecorder()
+	s.handler(job.NewInstallers(), "", nil).ServeHTTP(w, httptest.NewRequest("POST", "http://example.com/_packet/export", strings.NewReader(`{"macs":["00:00:00:00:00:01"]}`)))
+	if got := w.Result().StatusCode; got == http.StatusOK {
+		t.Fatalf("export served without credentials, got: %d", got)
+	}
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"net/http"
+	"path"
+	"sync"
+	"time"
+
+	"github.com/tinkerbell/boots/conf"
+	"github.com/tinkerbell/boots/ipxe"
+	"github.com/tinkerbell/boots/job"
+)
+
+// pxeDenials holds when boots first and last saw each machine, by its primary
+// NIC, not allowed to PXE boot.
+var pxeDenials = &denials{seen: map[string]denial{}}
+
+type denial struct {
+	first, last time.Time
+}
+
+type denials struct {
+	sync.Mutex
+	seen map[string]denial
+}
+
+// observe records a denial of key at now and reports whether now is within
+// grace of its first one. Keys not denied for longer than grace are forgotten.
+func (d *denials) observe(key string, now time.Time, grace time.Duration) bool {
+	d.Lock()
+	defer d.Unlock()
+
+	for k, s := range d.seen {
+		if now.Sub(s.last) > grace {
+			delete(d.seen, k)
+		}
+	}
+	s, ok := d.seen[key]
+	if !ok {
+		s.first = now
+	}
+	s.last = now
+	d.seen[key] = s
+
+	return now.Sub(s.first) <= grace
+}
+
+// forget drops the denial of key, so it gets a grace period again the next
+// time it is not allowed to PXE boot.
+func (d *denials) forget(key string) {
+	d.Lock()
+	delete(d.seen, key)
+	d.Unlock()
+}
+
+// pxeHalting serves, within conf.AllowPXEGracePeriod of boots first seeing j
+// not allowed to PXE boot, an iPXE script exiting to the next boot device in
+// place of the iPXE boot script requested, and reports whether it did. Past the
+// grace period, and for other files such as grub.cfg or script signatures,
+// pxeAllowed responds 404.
+func pxeHalting(w http.ResponseWriter, req *http.Request, j *job.Job, now time.Time) bool {
+	key := j.PrimaryNIC().String()
+	if j.AllowPXE() {
+		pxeDenials.forget(key)
+
+		return false
+	}
+	if path.Ext(req.URL.Path) != ".ipxe" {
+		return false
+	}
+	if !pxeDenials.observe(key, now, conf.AllowPXEGracePeriod) {
+		return false
+	}
+	mainlog.With("client", req.RemoteAddr, "mac", key).Info("allow_pxe: false, serving the halting script")
+	s := ipxe.NewScript()
+	s.Echo("this machine is no longer allowed to PXE boot, halting; do not retry")
+	s.AppendString("exit")
+	_, _ = w.Write(s.Bytes())
+
+	return true
+}
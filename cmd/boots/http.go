@@ -3,6 +3,8 @@ package main
 import (
 	"bytes"
 	"context"
+	"crypto/subtle"
+	"crypto/tls"
 	"encoding/json"
 	"io"
 	"net"
@@ -10,10 +12,12 @@ import (
 	"net/http/pprof"
 	"runtime"
 	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/pkg/errors"
-	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/sebest/xff"
 	"github.com/tinkerbell/boots/client"
@@ -23,7 +27,9 @@ import (
 	"github.com/tinkerbell/boots/installers/vmware"
 	"github.com/tinkerbell/boots/job"
 	"github.com/tinkerbell/boots/metrics"
+	"github.com/tinkerbell/boots/timeline"
 	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type BootsHTTPServer struct {
@@ -31,6 +37,12 @@ type BootsHTTPServer struct {
 	reporter       client.Reporter
 	finder         client.HardwareFinder
 	jobManager     job.Manager
+	eventLimiter   *eventLimiter
+
+	draining       int32 // set once Drain is called
+	selfTestFailed int32 // set when a critical installer fails its self-test
+	mu             sync.Mutex
+	server         *http.Server
 }
 
 func (s *BootsHTTPServer) serveHealthchecker(rev string, start time.Time) http.HandlerFunc {
@@ -52,50 +64,432 @@ func (s *BootsHTTPServer) serveHealthchecker(rev string, start time.Time) http.H
 	}
 }
 
+// probeMirror sends a HEAD request to url, the mirror counts as reachable if
+// it responds within timeout with anything but a server error.
+func probeMirror(ctx context.Context, url string, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, url, nil)
+	if err != nil {
+		return errors.Wrap(err, "create mirror probe")
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return errors.Wrap(err, "probe mirror")
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= http.StatusInternalServerError {
+		return errors.Errorf("mirror responded %s", resp.Status)
+	}
+
+	return nil
+}
+
 // otelFuncWrapper takes a route and an http handler function, wraps the function
 // with otelhttp, and returns the route again and http.Handler all set for mux.Handle().
+// The function is returned as is when conf.OtelDisabled is set.
 func otelFuncWrapper(route string, h func(w http.ResponseWriter, req *http.Request)) (string, http.Handler) {
+	if conf.OtelDisabled {
+		return route, http.HandlerFunc(h)
+	}
+
 	return route, otelhttp.WithRouteTag(route, http.HandlerFunc(h))
 }
 
+// spanName names the span of requests served by h, which would otherwise carry
+// the generic name given to its otelhttp handler.
+func spanName(name string, h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		trace.SpanFromContext(req.Context()).SetName(name)
+		h(w, req)
+	}
+}
+
+// allowMethods responds 405 with an Allow header to requests to route with a
+// method other than methods, or the ones of the HTTP_ROUTE_METHODS entry of
+// route when there is one.
+func allowMethods(route string, h http.HandlerFunc, methods ...string) http.HandlerFunc {
+	if m, ok := conf.HTTPRouteMethods[route]; ok {
+		methods = strings.Split(m, ",")
+		for i := range methods {
+			methods[i] = strings.ToUpper(strings.TrimSpace(methods[i]))
+		}
+	}
+	allow := strings.Join(methods, ", ")
+
+	return func(w http.ResponseWriter, req *http.Request) {
+		for _, m := range methods {
+			if req.Method == m {
+				h(w, req)
+
+				return
+			}
+		}
+		w.Header().Set("Allow", allow)
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// serveHead answers HEAD requests with the status and headers h renders for
+// them, Content-Length included, without the body. Handlers are expected to
+// render HEAD like GET, skipping the side effects of a real boot.
+func serveHead(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodHead {
+			h(w, req)
+
+			return
+		}
+		hw := &headWriter{ResponseWriter: w}
+		h(hw, req)
+		hw.flush()
+	}
+}
+
+// headWriter counts the body written to it instead of writing it, the status
+// is held back until flush sets Content-Length.
+type headWriter struct {
+	http.ResponseWriter
+	code int
+	n    int
+}
+
+func (hw *headWriter) WriteHeader(code int) {
+	if hw.code == 0 {
+		hw.code = code
+	}
+}
+
+func (hw *headWriter) Write(b []byte) (int, error) {
+	hw.WriteHeader(http.StatusOK)
+	hw.n += len(b)
+
+	return len(b), nil
+}
+
+func (hw *headWriter) flush() {
+	if hw.code == 0 {
+		hw.code = http.StatusOK
+	}
+	if hw.code == http.StatusOK {
+		hw.Header().Set("Content-Length", strconv.Itoa(hw.n))
+	}
+	hw.ResponseWriter.WriteHeader(hw.code)
+}
+
+// serveTimeline serves the timeline of the machine of the mac query parameter.
+func serveTimeline(w http.ResponseWriter, req *http.Request) {
+	mac, err := net.ParseMAC(req.URL.Query().Get("mac"))
+	if err != nil {
+		http.Error(w, "invalid mac: "+err.Error(), http.StatusBadRequest)
+
+		return
+	}
+	events := timeline.Events(mac)
+	if events == nil {
+		events = []timeline.Event{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(events); err != nil {
+		mainlog.With("mac", mac).Error(errors.Wrap(err, "encoding timeline"))
+	}
+}
+
+// metricsAuth requires the configured metrics bearer token or basic auth
+// credentials on requests to h, responding 401 otherwise. Without any
+// configured credentials requests are passed through as is.
+func metricsAuth(h http.Handler) http.Handler {
+	if !metricsAuthConfigured() {
+		return h
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if metricsAuthorized(req) {
+			h.ServeHTTP(w, req)
+
+			return
+		}
+		if conf.MetricsAuthUsername != "" || conf.MetricsAuthPassword != "" {
+			w.Header().Set("WWW-Authenticate", `Basic realm="boots"`)
+		}
+		w.WriteHeader(http.StatusUnauthorized)
+	})
+}
+
+// metricsAuthConfigured reports whether metrics credentials are configured.
+func metricsAuthConfigured() bool {
+	return conf.MetricsAuthToken != "" || conf.MetricsAuthUsername != "" || conf.MetricsAuthPassword != ""
+}
+
+func metricsAuthorized(req *http.Request) bool {
+	auth := req.Header.Get("Authorization")
+	if conf.MetricsAuthToken != "" && strings.HasPrefix(auth, "Bearer ") &&
+		subtle.ConstantTimeCompare([]byte(strings.TrimPrefix(auth, "Bearer ")), []byte(conf.MetricsAuthToken)) == 1 {
+		return true
+	}
+	if conf.MetricsAuthUsername != "" || conf.MetricsAuthPassword != "" {
+		if user, pass, ok := req.BasicAuth(); ok &&
+			subtle.ConstantTimeCompare([]byte(user), []byte(conf.MetricsAuthUsername)) == 1 &&
+			subtle.ConstantTimeCompare([]byte(pass), []byte(conf.MetricsAuthPassword)) == 1 {
+			return true
+		}
+	}
+
+	return false
+}
+
 type jobHandler struct {
-	i          job.Installers
-	jobManager job.Manager
+	i              job.Installers
+	jobManager     job.Manager
+	workflowFinder client.WorkflowFinder
 }
 
 // ServeHTTP sets up all the HTTP routes using a stdlib mux and starts the http
-// server, which will block. App functionality is instrumented in Prometheus and
-// OpenTelemetry. Optionally configures X-Forwarded-For support.
-func (s *BootsHTTPServer) ServeHTTP(i job.Installers, addr string, ipxePattern string, ipxeHandler func(http.ResponseWriter, *http.Request)) {
+// server, also over HTTPS with conf.HTTPSBind, which will block until ctx is
+// done and the server is drained, or Drain shuts it down. App functionality is
+// instrumented in Prometheus and OpenTelemetry. Optionally configures
+// X-Forwarded-For support.
+func (s *BootsHTTPServer) ServeHTTP(ctx context.Context, i job.Installers, addr string, ipxePattern string, ipxeHandler func(http.ResponseWriter, *http.Request)) error {
+	h := s.handler(i, ipxePattern, ipxeHandler)
+
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return errors.Wrap(err, "listen http")
+	}
+	// HTTP and HTTPS connections count against the same conf.HTTPMaxConns.
+	limit := newConnLimit(conf.HTTPMaxConns)
+	listeners := []net.Listener{limit.listener(l)}
+	if conf.HTTPSBind != "" {
+		cfg, err := tlsConfig(conf.HTTPSCertFile, conf.HTTPSKeyFile, conf.HTTPSMinVersion)
+		if err != nil {
+			l.Close()
+
+			return err
+		}
+		tl, err := net.Listen("tcp", conf.HTTPSBind)
+		if err != nil {
+			l.Close()
+
+			return errors.Wrap(err, "listen https")
+		}
+		mainlog.With("addr", conf.HTTPSBind).Info("serving https")
+		listeners = append(listeners, tls.NewListener(limit.listener(tl), cfg))
+	}
+
+	return s.serve(ctx, h, listeners...)
+}
+
+// serve serves h on listeners until Drain shuts the server down, drained as
+// configured by conf.HTTPDrainDelay and conf.HTTPShutdownTimeout once ctx is done.
+func (s *BootsHTTPServer) serve(ctx context.Context, h http.Handler, listeners ...net.Listener) error {
+	srv := s.httpServer()
+	srv.Handler = h
+	served := make(chan error, len(listeners))
+	for _, l := range listeners {
+		go func(l net.Listener) { served <- srv.Serve(l) }(l)
+	}
+
+	done := ctx.Done()
+	for pending := len(listeners); pending > 0; {
+		select {
+		case err := <-served:
+			if err != nil && !errors.Is(err, http.ErrServerClosed) {
+				return errors.Wrap(err, "serve http")
+			}
+			pending--
+		case <-done:
+			done = nil
+			mainlog.Info("draining http for shutdown")
+			drainCtx, cancel := context.WithTimeout(context.Background(), conf.HTTPDrainDelay+conf.HTTPShutdownTimeout)
+			err := s.Drain(drainCtx, conf.HTTPDrainDelay)
+			cancel()
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// httpServer returns the server shared by serve and Drain, so that a server
+// drained before it is served does not start serving.
+func (s *BootsHTTPServer) httpServer() *http.Server {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.server == nil {
+		s.server = &http.Server{}
+	}
+
+	return s.server
+}
+
+// Drain fails readiness checks for delay while requests are still served, so
+// load balancers stop sending new ones, then shuts the server down waiting for
+// in-flight requests until ctx is done.
+func (s *BootsHTTPServer) Drain(ctx context.Context, delay time.Duration) error {
+	atomic.StoreInt32(&s.draining, 1)
+	if delay > 0 {
+		mainlog.With("delay", delay.String()).Info("draining http")
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+		}
+	}
+
+	return errors.Wrap(s.httpServer().Shutdown(ctx), "shutdown http")
+}
+
+// SelfTestInstallers renders the boot script of every enabled installer for a
+// synthetic job, logging and counting failures. The server is never reported
+// ready if one of conf.InstallerSelfTestCritical fails.
+func (s *BootsHTTPServer) SelfTestInstallers(ctx context.Context, i job.Installers) {
+	for _, f := range i.SelfTest(ctx, mainlog.Logger) {
+		metrics.InstallerSelfTestFailures.WithLabelValues(f.Kind, f.Name).Inc()
+		l := mainlog.With("installer", f.Name, "kind", f.Kind)
+		if _, ok := conf.InstallerSelfTestCritical[f.Name]; ok {
+			atomic.StoreInt32(&s.selfTestFailed, 1)
+			l.Error(errors.WithMessage(f.Err, "critical installer failed self-test, not becoming ready"))
+
+			continue
+		}
+		l.Error(errors.WithMessage(f.Err, "installer failed self-test"))
+	}
+}
+
+// serveReadyz reports the server ready until it starts draining for shutdown,
+// unless a critical installer failed its self-test, with
+// conf.ReadyzProbeBackends a backend can not be reached, or with
+// conf.OsieMirrorProbe the osie mirror at conf.OsieVendorServicesURL can not be
+// reached. Unreachable backends and the mirror are listed in the JSON body.
+func (s *BootsHTTPServer) serveReadyz(w http.ResponseWriter, req *http.Request) {
+	if atomic.LoadInt32(&s.draining) == 1 || atomic.LoadInt32(&s.selfTestFailed) == 1 {
+		w.WriteHeader(http.StatusServiceUnavailable)
+
+		return
+	}
+	if !conf.ReadyzProbeBackends && !osieMirrorProbed() {
+		w.WriteHeader(http.StatusOK)
+
+		return
+	}
+
+	failed := s.probeBackends(req.Context())
+	w.Header().Set("Content-Type", "application/json")
+	if len(failed) > 0 {
+		mainlog.With("failed", failed).Info("backends unreachable, not ready")
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	res := struct {
+		Ready  bool              `json:"ready"`
+		Failed map[string]string `json:"failed,omitempty"`
+	}{Ready: len(failed) == 0, Failed: failed}
+	if err := json.NewEncoder(w).Encode(&res); err != nil {
+		mainlog.Error(errors.Wrap(err, "marshaling readiness json"))
+	}
+}
+
+// probeBackends returns the errors of the backends that can not be reached,
+// by backend.
+func (s *BootsHTTPServer) probeBackends(ctx context.Context) map[string]string {
+	failed := make(map[string]string)
+	if osieMirrorProbed() {
+		if err := probeMirror(ctx, conf.OsieVendorServicesURL, conf.OsieMirrorProbeTimeout); err != nil {
+			failed["osie_mirror"] = err.Error()
+		}
+	}
+	if !conf.ReadyzProbeBackends {
+		return failed
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, conf.ReadyzProbeTimeout)
+	defer cancel()
+	if s.finder != nil {
+		if _, err := s.finder.ByIP(ctx, conf.ReadyzProbeIP); err != nil && !errors.Is(err, client.ErrNotFound) && !client.IsAmbiguous(err) {
+			failed["hardware_finder"] = err.Error()
+		}
+	}
+	if s.reporter != nil {
+		if err := client.PingReporter(ctx, s.reporter); err != nil {
+			failed["reporter"] = err.Error()
+		}
+	}
+
+	return failed
+}
+
+// osieMirrorProbed reports whether readiness checks probe the osie mirror.
+func osieMirrorProbed() bool {
+	return conf.OsieMirrorProbe && conf.OsieVendorServicesURL != ""
+}
+
+// handler returns the handler of all the HTTP routes.
+func (s *BootsHTTPServer) handler(i job.Installers, ipxePattern string, ipxeHandler func(http.ResponseWriter, *http.Request)) http.Handler {
 	mux := http.NewServeMux()
-	jh := jobHandler{i: i, jobManager: s.jobManager}
-	mux.Handle(otelFuncWrapper("/", jh.serveJobFile))
+	jh := jobHandler{i: i, jobManager: s.jobManager, workflowFinder: s.workflowFinder}
+	jobFileMethods := []string{http.MethodGet, http.MethodHead}
+	if conf.InstallerMenu {
+		// the installer menu POSTs its selection back
+		jobFileMethods = append(jobFileMethods, http.MethodPost)
+	}
+	mux.Handle(otelFuncWrapper("/", allowMethods("/", serveHead(jh.serveJobFile), jobFileMethods...)))
 	if ipxeHandler != nil {
-		mux.Handle(otelFuncWrapper(ipxePattern, ipxeHandler))
+		if !conf.IPXEBinariesSkipAllowPXE {
+			ipxeHandler = jh.allowPXE(ipxeHandler)
+		}
+		mux.Handle(otelFuncWrapper(ipxePattern, allowMethods(ipxePattern, spanName("ipxe binaries", ipxeHandler), http.MethodGet, http.MethodHead)))
 	}
-	mux.Handle("/metrics", promhttp.Handler())
+	mux.Handle("/metrics", metricsAuth(promhttp.Handler()))
 	mux.HandleFunc("/_packet/healthcheck", s.serveHealthchecker(GitRev, StartTime))
-	mux.HandleFunc("/_packet/pprof/", pprof.Index)
-	mux.HandleFunc("/_packet/pprof/cmdline", pprof.Cmdline)
-	mux.HandleFunc("/_packet/pprof/profile", pprof.Profile)
-	mux.HandleFunc("/_packet/pprof/symbol", pprof.Symbol)
-	mux.HandleFunc("/_packet/pprof/trace", pprof.Trace)
+	mux.Handle("/_packet/pprof/", metricsAuth(http.HandlerFunc(pprof.Index)))
+	mux.Handle("/_packet/pprof/cmdline", metricsAuth(http.HandlerFunc(pprof.Cmdline)))
+	mux.Handle("/_packet/pprof/profile", metricsAuth(http.HandlerFunc(pprof.Profile)))
+	mux.Handle("/_packet/pprof/symbol", metricsAuth(http.HandlerFunc(pprof.Symbol)))
+	mux.Handle("/_packet/pprof/trace", metricsAuth(http.HandlerFunc(pprof.Trace)))
 	mux.HandleFunc("/healthcheck", s.serveHealthchecker(GitRev, StartTime))
-	mux.Handle(otelFuncWrapper("/phone-home", s.servePhoneHome))
-	mux.Handle(otelFuncWrapper("/phone-home/key", job.ServePublicKey))
-	mux.Handle(otelFuncWrapper("/problem", s.serveProblem))
-	mux.Handle(otelFuncWrapper("/hardware-components", s.serveHardware))
+	mux.HandleFunc("/readyz", s.serveReadyz)
+	mux.Handle(otelFuncWrapper("/phone-home", allowMethods("/phone-home", s.servePhoneHome, http.MethodPost)))
+	mux.Handle(otelFuncWrapper("/phone-home/key", allowMethods("/phone-home/key", job.ServePublicKey, http.MethodGet, http.MethodHead)))
+	if conf.IPXEScriptSigningKey != "" {
+		mux.Handle(otelFuncWrapper(job.ScriptSigningKeyPath, allowMethods(job.ScriptSigningKeyPath, job.ServeScriptSigningKey, http.MethodGet, http.MethodHead)))
+	}
+	mux.Handle(otelFuncWrapper("/problem", allowMethods("/problem", s.serveProblem, http.MethodPost)))
+	mux.Handle(otelFuncWrapper("/hardware-components", allowMethods("/hardware-components", s.serveHardware, http.MethodPost)))
+	if conf.ServeMetadata {
+		mux.Handle(otelFuncWrapper(job.MetadataPath, allowMethods(job.MetadataPath, s.serveMetadata, http.MethodGet, http.MethodHead)))
+	}
+	if conf.ServeNetworkConfig {
+		mux.Handle(otelFuncWrapper(job.NetworkConfigPath, allowMethods(job.NetworkConfigPath, s.serveNetworkConfig, http.MethodGet, http.MethodHead)))
+	}
+	if conf.ServeSSHKeys {
+		mux.Handle(otelFuncWrapper(job.SSHKeysPath, allowMethods(job.SSHKeysPath, s.serveSSHKeys, http.MethodGet, http.MethodHead)))
+	}
+	if conf.ServeVerify {
+		mux.Handle(otelFuncWrapper(job.VerifyPath, allowMethods(job.VerifyPath, s.serveVerify, http.MethodPost)))
+	}
+	if conf.ServeExport {
+		// exports carry root password crypts, never serve them unauthenticated
+		if metricsAuthConfigured() {
+			mux.Handle("/_packet/export", metricsAuth(http.HandlerFunc(jh.serveExport)))
+		} else {
+			mainlog.Error(errors.New("not serving /_packet/export, HTTP_EXPORT requires METRICS_AUTH_TOKEN or METRICS_AUTH_USERNAME/PASSWORD"))
+		}
+	}
+	if conf.TimelineSize > 0 {
+		mux.Handle("/_packet/timeline", metricsAuth(http.HandlerFunc(serveTimeline)))
+	}
 
 	// Events endpoint used to forward customer generated custom events from a running device (instance) to packet API
-	mux.Handle(otelFuncWrapper("/events", func(w http.ResponseWriter, req *http.Request) {
-		code, err := serveEvents(EventServerForReporterFinder(s.reporter, s.finder), w, req)
+	mux.Handle(otelFuncWrapper("/events", allowMethods("/events", func(w http.ResponseWriter, req *http.Request) {
+		code, err := serveEvents(EventServerForReporterFinder(s.reporter, s.finder), s.eventLimiter, w, req)
 		if err == nil {
 			return
 		}
 		if code != http.StatusOK {
 			mainlog.Error(err)
 		}
-	}))
+	}, http.MethodPost)))
 
 	httpHandlers := make(map[string]http.HandlerFunc)
 	// register flatcar endpoints
@@ -105,11 +499,14 @@ func (s *BootsHTTPServer) ServeHTTP(i job.Installers, addr string, ipxePattern s
 
 	// register Installer handlers
 	for path, fn := range httpHandlers {
-		mux.Handle(path, otelhttp.WithRouteTag(path, fn))
+		mux.Handle(otelFuncWrapper(path, allowMethods(path, serveHead(fn), http.MethodGet, http.MethodHead)))
 	}
 
 	// wrap the mux with an OpenTelemetry interceptor
-	otelHandler := otelhttp.NewHandler(mux, "boots-http")
+	var otelHandler http.Handler = mux
+	if !conf.OtelDisabled {
+		otelHandler = otelhttp.NewHandler(mux, "boots-http")
+	}
 
 	// add X-Forwarded-For support if trusted proxies are configured
 	var xffHandler http.Handler
@@ -123,69 +520,174 @@ func (s *BootsHTTPServer) ServeHTTP(i job.Installers, addr string, ipxePattern s
 
 		xffHandler = xffmw.Handler(&httplog.Handler{
 			Handler: otelHandler,
+			Routes:  mux,
 		})
+		if conf.LogXFF {
+			xffHandler = httplog.RecordRemoteAddr(xffHandler)
+		}
 	} else {
 		xffHandler = &httplog.Handler{
 			Handler: otelHandler,
+			Routes:  mux,
 		}
 	}
 
-	if err := http.ListenAndServe(addr, xffHandler); err != nil {
-		err = errors.Wrap(err, "listen and serve http")
-		mainlog.Fatal(err)
+	// wrapped last to see the address of the proxy rather than the client
+	return installerOverride(xffHandler)
+}
+
+// installerOverrideHeader forces the installer of the request when sent by a
+// trusted proxy, to try installers on a machine without changing its hardware record.
+const installerOverrideHeader = "X-Boots-Installer"
+
+// installerOverride honors installerOverrideHeader on requests coming from
+// conf.TrustedProxies, it is ignored from any other source.
+func installerOverride(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		name := strings.TrimSpace(req.Header.Get(installerOverrideHeader))
+		if name == "" {
+			h.ServeHTTP(w, req)
+
+			return
+		}
+		if !trustedProxy(req.RemoteAddr) {
+			mainlog.With("client", req.RemoteAddr, "installer", name).Info("ignoring " + installerOverrideHeader + " header from untrusted source")
+			h.ServeHTTP(w, req)
+
+			return
+		}
+		mainlog.With("proxy", req.RemoteAddr, "installer", name, "uri", req.RequestURI).Info("installer override requested by trusted proxy")
+		h.ServeHTTP(w, req.WithContext(job.WithInstallerOverride(req.Context(), name)))
+	})
+}
+
+// trustedProxy reports whether remoteAddr is in conf.TrustedProxies.
+func trustedProxy(remoteAddr string) bool {
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		host = remoteAddr
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return false
 	}
+	for _, cidr := range conf.TrustedProxies {
+		if _, n, err := net.ParseCIDR(cidr); err == nil && n.Contains(ip) {
+			return true
+		}
+	}
+
+	return false
 }
 
 func (h *jobHandler) serveJobFile(w http.ResponseWriter, req *http.Request) {
-	labels := prometheus.Labels{"from": "http", "op": "file"}
-	metrics.JobsTotal.With(labels).Inc()
-	metrics.JobsInProgress.With(labels).Inc()
-	defer metrics.JobsInProgress.With(labels).Dec()
-	timer := prometheus.NewTimer(metrics.JobDuration.With(labels))
-	defer timer.ObserveDuration()
+	// HEAD requests only probe availability, they are not boots to account for
+	var jm *jobMetrics
+	if req.Method != http.MethodHead {
+		jm = startJobMetrics("http", "file")
+	}
+	defer jm.done()
 
+	// the lookup goes first, its outcome may end or start an outage
 	ctx, j, err := h.jobManager.CreateFromRemoteAddr(req.Context(), req.RemoteAddr)
+	if backendOutage(time.Now()) {
+		serveBackendOutage(w, req)
+
+		return
+	}
 	if err != nil {
-		w.WriteHeader(http.StatusNotFound)
+		w.WriteHeader(jobNotFoundStatus(err, http.StatusNotFound))
 		mainlog.With("client", req.RemoteAddr).Error(err, "no job found for client address")
 
 		return
 	}
-	// This gates serving PXE file by
-	// 1. the existence of a hardware record in tink server
-	// AND
-	// 2. the network.interfaces[].netboot.allow_pxe value, in the tink server hardware record, equal to true
-	// This allows serving custom ipxe scripts, starting up into OSIE or other installation environments
-	// without a tink workflow present.
+	jm.resolved(j)
+	timeline.Record(j.PrimaryNIC(), "http", req.Method+" "+req.URL.Path)
+	if conf.AllowPXEGracePeriod > 0 && pxeHalting(w, req, j, time.Now()) {
+		return
+	}
+	if !pxeAllowed(w, req, j) {
+		return
+	}
+
+	if h.awaitingConfig(ctx, j) {
+		ctx = job.WithAwaitingConfig(ctx)
+	}
+
+	// otel: send a req.Clone with the updated context from the job's hw data
+	j.ServeFile(w, req.Clone(ctx), h.i)
+}
+
+// awaitingConfig reports whether j should get the awaiting configuration
+// holding script, when enabled and it has no operating system nor active
+// workflow. Failing to get its workflows serves the usual script.
+func (h *jobHandler) awaitingConfig(ctx context.Context, j *job.Job) bool {
+	if !conf.AwaitingConfigScript || j.HasOS() {
+		return false
+	}
+	if !j.CanWorkflow() || h.workflowFinder == nil {
+		return true
+	}
+	active, err := h.workflowFinder.HasActiveWorkflow(ctx, j.HardwareID())
+	if err != nil {
+		j.With("error", err).Info("failed to get workflows")
+
+		return false
+	}
+
+	return !active
+}
+
+// pxeAllowed gates serving PXE files by
+// 1. the existence of a hardware record in tink server
+// AND
+// 2. the network.interfaces[].netboot.allow_pxe value, in the tink server hardware record, equal to true
+// This allows serving custom ipxe scripts, starting up into OSIE or other installation environments
+// without a tink workflow present. It responds 404 to requests of machines that may not PXE boot.
+func pxeAllowed(w http.ResponseWriter, req *http.Request, j *job.Job) bool {
 	if !j.AllowPXE() {
 		w.WriteHeader(http.StatusNotFound)
 		mainlog.With("client", req.RemoteAddr).Info("the hardware data for this machine, or lack there of, does not allow it to pxe; allow_pxe: false")
 
-		return
+		return false
 	}
 
-	// otel: send a req.Clone with the updated context from the job's hw data
-	j.ServeFile(w, req.Clone(ctx), h.i)
+	return true
+}
+
+// allowPXE applies the allow_pxe gate of serveJobFile to next, which serves
+// the iPXE binaries chained from DHCP.
+func (h *jobHandler) allowPXE(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		_, j, err := h.jobManager.CreateFromRemoteAddr(req.Context(), req.RemoteAddr)
+		if err != nil {
+			w.WriteHeader(jobNotFoundStatus(err, http.StatusNotFound))
+			mainlog.With("client", req.RemoteAddr).Error(err, "no job found for client address")
+
+			return
+		}
+		if !pxeAllowed(w, req, j) {
+			return
+		}
+		next(w, req)
+	}
 }
 
 func (s *BootsHTTPServer) serveHardware(w http.ResponseWriter, req *http.Request) {
 	ctx := req.Context()
-	labels := prometheus.Labels{"from": "http", "op": "hardware-components"}
-	metrics.JobsTotal.With(labels).Inc()
-	metrics.JobsInProgress.With(labels).Inc()
-	defer metrics.JobsInProgress.With(labels).Dec()
-	timer := prometheus.NewTimer(metrics.JobDuration.With(labels))
-	defer timer.ObserveDuration()
+	jm := startJobMetrics("http", "hardware-components")
+	defer jm.done()
 
 	ctx, j, err := s.jobManager.CreateFromRemoteAddr(ctx, req.RemoteAddr)
 	if err != nil {
-		w.WriteHeader(http.StatusNotFound)
+		w.WriteHeader(jobNotFoundStatus(err, http.StatusNotFound))
 		mainlog.With("client", req.RemoteAddr, "error", err).Info("no job found for client address")
 
 		return
 	}
+	jm.resolved(j)
 
-	if j.CanWorkflow() {
+	if j.CanWorkflow() && j.WorkflowExpected() {
 		activeWorkflows, err := s.workflowFinder.HasActiveWorkflow(ctx, j.HardwareID())
 		if err != nil {
 			w.WriteHeader(http.StatusNotFound)
@@ -205,59 +707,135 @@ func (s *BootsHTTPServer) serveHardware(w http.ResponseWriter, req *http.Request
 }
 
 func (s *BootsHTTPServer) servePhoneHome(w http.ResponseWriter, req *http.Request) {
-	labels := prometheus.Labels{"from": "http", "op": "phone-home"}
-	metrics.JobsTotal.With(labels).Inc()
-	metrics.JobsInProgress.With(labels).Inc()
-	defer metrics.JobsInProgress.With(labels).Dec()
-	timer := prometheus.NewTimer(metrics.JobDuration.With(labels))
-	defer timer.ObserveDuration()
+	jm := startJobMetrics("http", "phone-home")
+	defer jm.done()
 
 	_, j, err := s.jobManager.CreateFromRemoteAddr(req.Context(), req.RemoteAddr)
 	if err != nil {
-		w.WriteHeader(http.StatusOK)
+		w.WriteHeader(jobNotFoundStatus(err, http.StatusOK))
 		mainlog.With("client", req.RemoteAddr, "error", err).Info("no job found for client address")
 
 		return
 	}
+	jm.resolved(j)
+	timeline.Record(j.PrimaryNIC(), "http", req.Method+" "+req.URL.Path)
+	if !s.eventLimiter.allow("phone-home", eventMachineID(j)) {
+		w.WriteHeader(http.StatusTooManyRequests)
+		j.Info("phone-home rate limit exceeded")
+
+		return
+	}
 	j.ServePhoneHomeEndpoint(w, req)
 }
 
 func (s *BootsHTTPServer) serveProblem(w http.ResponseWriter, req *http.Request) {
 	ctx := req.Context()
-	labels := prometheus.Labels{"from": "http", "op": "problem"}
-	metrics.JobsTotal.With(labels).Inc()
-	metrics.JobsInProgress.With(labels).Inc()
-	defer metrics.JobsInProgress.With(labels).Dec()
-	timer := prometheus.NewTimer(metrics.JobDuration.With(labels))
-	defer timer.ObserveDuration()
+	jm := startJobMetrics("http", "problem")
+	defer jm.done()
 
 	_, j, err := s.jobManager.CreateFromRemoteAddr(ctx, req.RemoteAddr)
 	if err != nil {
-		w.WriteHeader(http.StatusNotFound)
+		w.WriteHeader(jobNotFoundStatus(err, problemNotFoundStatus()))
 		mainlog.With("client", req.RemoteAddr, "error", err).Info("no job found for client address")
 
 		return
 	}
+	jm.resolved(j)
 
-	if j.CanWorkflow() && s.workflowFinder != nil {
+	if j.CanWorkflow() && j.WorkflowExpected() && s.workflowFinder != nil {
 		activeWorkflows, err := s.workflowFinder.HasActiveWorkflow(ctx, j.HardwareID())
 		if err != nil {
-			w.WriteHeader(http.StatusNotFound)
+			w.WriteHeader(problemNotFoundStatus())
 			j.With("error", err).Info("failed to get workflows")
 
 			return
 		}
 		if !activeWorkflows {
-			w.WriteHeader(http.StatusNotFound)
+			w.WriteHeader(problemNotFoundStatus())
 			j.Info("no active workflows")
 
 			return
 		}
 	}
 
+	if !s.eventLimiter.allow("problem", eventMachineID(j)) {
+		w.WriteHeader(http.StatusTooManyRequests)
+		j.Info("problem rate limit exceeded")
+
+		return
+	}
 	j.ServeProblemEndpoint(w, req)
 }
 
+// jobNotFoundStatus returns status for a request no job could be created for
+// because of err, 409 if its address matches more than one hardware record or
+// 503 if its cached hardware is too old to be served while the backend fails.
+func jobNotFoundStatus(err error, status int) int {
+	if client.IsAmbiguous(err) {
+		return http.StatusConflict
+	}
+	if errors.Is(err, client.ErrStaleHardware) {
+		return http.StatusServiceUnavailable
+	}
+
+	return status
+}
+
+// problemNotFoundStatus returns the status code of a /problem request that is
+// not forwarded, some device agents give up reporting on anything but a 2xx.
+func problemNotFoundStatus() int {
+	if conf.ProblemAlwaysOK {
+		return http.StatusOK
+	}
+
+	return http.StatusNotFound
+}
+
+func (s *BootsHTTPServer) serveMetadata(w http.ResponseWriter, req *http.Request) {
+	_, j, err := s.jobManager.CreateFromRemoteAddr(req.Context(), req.RemoteAddr)
+	if err != nil {
+		w.WriteHeader(jobNotFoundStatus(err, http.StatusNotFound))
+		mainlog.With("client", req.RemoteAddr, "error", err).Info("no job found for client address")
+
+		return
+	}
+	j.ServeMetadata(w, req)
+}
+
+func (s *BootsHTTPServer) serveVerify(w http.ResponseWriter, req *http.Request) {
+	_, j, err := s.jobManager.CreateFromRemoteAddr(req.Context(), req.RemoteAddr)
+	if err != nil {
+		w.WriteHeader(jobNotFoundStatus(err, http.StatusNotFound))
+		mainlog.With("client", req.RemoteAddr, "error", err).Info("no job found for client address")
+
+		return
+	}
+	timeline.Record(j.PrimaryNIC(), "http", req.Method+" "+req.URL.Path)
+	j.ServeVerifyEndpoint(w, req)
+}
+
+func (s *BootsHTTPServer) serveNetworkConfig(w http.ResponseWriter, req *http.Request) {
+	_, j, err := s.jobManager.CreateFromRemoteAddr(req.Context(), req.RemoteAddr)
+	if err != nil {
+		w.WriteHeader(jobNotFoundStatus(err, http.StatusNotFound))
+		mainlog.With("client", req.RemoteAddr, "error", err).Info("no job found for client address")
+
+		return
+	}
+	j.ServeNetworkConfig(w, req)
+}
+
+func (s *BootsHTTPServer) serveSSHKeys(w http.ResponseWriter, req *http.Request) {
+	_, j, err := s.jobManager.CreateFromRemoteAddr(req.Context(), req.RemoteAddr)
+	if err != nil {
+		w.WriteHeader(jobNotFoundStatus(err, http.StatusNotFound))
+		mainlog.With("client", req.RemoteAddr, "error", err).Info("no job found for client address")
+
+		return
+	}
+	j.ServeSSHKeys(w, req)
+}
+
 func readClose(r io.ReadCloser) (b []byte, err error) {
 	b, err = io.ReadAll(r)
 	err = errors.Wrap(err, "read data")
@@ -267,28 +845,44 @@ func readClose(r io.ReadCloser) (b []byte, err error) {
 }
 
 type eventsServer interface {
-	GetInstanceIDFromIP(context.Context, net.IP) (string, error)
+	GetMachineFromIP(context.Context, net.IP) (eventMachine, error)
 	PostInstanceEvent(context.Context, string, io.Reader) (string, error)
 }
 
+// eventMachine is the instance events are forwarded to, along with the
+// fingerprint of its hardware.
+type eventMachine struct {
+	instanceID string
+	serial     string
+	assetTag   string
+}
+
 type es struct {
 	reporter client.Reporter
 	finder   client.HardwareFinder
 }
 
-func (s *es) GetInstanceIDFromIP(ctx context.Context, ip net.IP) (string, error) {
+func (s *es) GetMachineFromIP(ctx context.Context, ip net.IP) (eventMachine, error) {
 	d, err := s.finder.ByIP(ctx, ip)
 	if err != nil {
-		return "", err
+		return eventMachine{}, err
 	}
 	if d.Instance() == nil {
-		return "", nil
+		return eventMachine{}, nil
+	}
+	m := eventMachine{instanceID: d.Instance().ID}
+	if h := d.Hardware(); h != nil {
+		m.serial, m.assetTag = h.HardwareSerial(), h.HardwareAssetTag()
 	}
 
-	return d.Instance().ID, nil
+	return m, nil
 }
 
 func (s *es) PostInstanceEvent(ctx context.Context, id string, r io.Reader) (string, error) {
+	if s.reporter == nil {
+		return client.NewLocalReporter(mainlog.Logger, conf.LogUnreportedEvents).PostInstanceEvent(ctx, id, r)
+	}
+
 	return s.reporter.PostInstanceEvent(ctx, id, r)
 }
 
@@ -296,8 +890,8 @@ func EventServerForReporterFinder(reporter client.Reporter, finder client.Hardwa
 	return &es{reporter, finder}
 }
 
-// Forward user generated events to Packet API.
-func serveEvents(es eventsServer, w http.ResponseWriter, req *http.Request) (int, error) {
+// Forward user generated events to Packet API, up to the rate allowed by limiter.
+func serveEvents(es eventsServer, limiter *eventLimiter, w http.ResponseWriter, req *http.Request) (int, error) {
 	host, _, err := net.SplitHostPort(req.RemoteAddr)
 	if err != nil {
 		w.WriteHeader(http.StatusBadRequest)
@@ -312,13 +906,20 @@ func serveEvents(es eventsServer, w http.ResponseWriter, req *http.Request) (int
 		return http.StatusOK, errors.New("no device found for client address")
 	}
 
-	deviceID, err := es.GetInstanceIDFromIP(req.Context(), ip)
+	machine, err := es.GetMachineFromIP(req.Context(), ip)
+	deviceID := machine.instanceID
 	if err != nil || deviceID == "" {
 		w.WriteHeader(http.StatusOK)
 
 		return http.StatusOK, errors.New("no device found for client address")
 	}
 
+	if !limiter.allow("event", deviceID) {
+		w.WriteHeader(http.StatusTooManyRequests)
+
+		return http.StatusTooManyRequests, errors.New("userEvent rate limit exceeded")
+	}
+
 	b, err := readClose(req.Body)
 	if err != nil {
 		w.WriteHeader(http.StatusBadRequest)
@@ -343,14 +944,28 @@ func serveEvents(es eventsServer, w http.ResponseWriter, req *http.Request) (int
 	}
 
 	e := struct {
-		Code    string `json:"type"`
-		State   string `json:"state"`
-		Message string `json:"body"`
+		Code     string            `json:"type"`
+		State    string            `json:"state"`
+		Message  string            `json:"body"`
+		Serial   string            `json:"hardware_serial,omitempty"`
+		AssetTag string            `json:"hardware_asset_tag,omitempty"`
+		Headers  map[string]string `json:"headers,omitempty"`
 	}{
 		Code:    "user." + strconv.Itoa(res.Code),
 		State:   res.State,
 		Message: res.Message,
 	}
+	if conf.EventFingerprint {
+		e.Serial, e.AssetTag = machine.serial, machine.assetTag
+	}
+	for _, name := range conf.EventForwardHeaders {
+		if v := req.Header.Get(name); v != "" {
+			if e.Headers == nil {
+				e.Headers = make(map[string]string)
+			}
+			e.Headers[name] = v
+		}
+	}
 	payload, err := json.Marshal(e)
 	if err != nil {
 		// TODO(mmlb): this should be 500
@@ -2,27 +2,58 @@ package main
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
+	"fmt"
 	"io"
 	"io/ioutil"
 	"net"
 	"net/http"
 	"net/http/httptest"
+	"sort"
+	"strconv"
 	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
+
+	"github.com/equinix-labs/otel-init-go/otelinit"
+	"github.com/gammazero/workerpool"
+	"github.com/google/go-cmp/cmp"
+	dhcp4 "github.com/packethost/dhcp4-go"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/tinkerbell/boots/client"
+	"github.com/tinkerbell/boots/client/cacher"
+	"github.com/tinkerbell/boots/conf"
+	"github.com/tinkerbell/boots/installers/flatcar"
+	"github.com/tinkerbell/boots/installers/vmware"
+	"github.com/tinkerbell/boots/ipxe"
+	"github.com/tinkerbell/boots/job"
+	"github.com/tinkerbell/boots/metrics"
+	"github.com/tinkerbell/boots/timeline"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
 )
 
 type tclient struct {
-	id      string
-	getErr  error
-	postErr error
+	id       string
+	serial   string
+	assetTag string
+	getErr   error
+	postErr  error
+	posted   *[]byte
 }
 
-func (c tclient) GetInstanceIDFromIP(context.Context, net.IP) (string, error) {
-	return c.id, c.getErr
+func (c tclient) GetMachineFromIP(context.Context, net.IP) (eventMachine, error) {
+	return eventMachine{instanceID: c.id, serial: c.serial, assetTag: c.assetTag}, c.getErr
 }
 
-func (c tclient) PostInstanceEvent(context.Context, string, io.Reader) (string, error) {
+func (c tclient) PostInstanceEvent(_ context.Context, _ string, r io.Reader) (string, error) {
+	if c.posted != nil {
+		*c.posted, _ = io.ReadAll(r)
+	}
+
 	return "", c.postErr
 }
 
@@ -94,7 +125,7 @@ func TestServeEvents(t *testing.T) {
 		req.Body = ioutil.NopCloser(strings.NewReader(test.body))
 		w := httptest.NewRecorder()
 
-		_, err := serveEvents(c, w, req)
+		_, err := serveEvents(c, nil, w, req)
 
 		resp := w.Result()
 		body, _ := ioutil.ReadAll(resp.Body)
@@ -115,3 +146,1174 @@ func TestServeEvents(t *testing.T) {
 		}
 	}
 }
+
+type tjobManager struct {
+	j   *job.Job
+	err error
+}
+
+func (m tjobManager) CreateFromRemoteAddr(ctx context.Context, _ string) (context.Context, *job.Job, error) {
+	return ctx, m.j, m.err
+}
+
+func (m tjobManager) CreateFromDHCP(ctx context.Context, _ net.HardwareAddr, _ net.IP, _, _ string) (context.Context, *job.Job, error) {
+	return ctx, m.j, m.err
+}
+
+// tfinder finds the same machine for any address.
+type tfinder struct {
+	d client.Discoverer
+}
+
+func (f tfinder) ByIP(context.Context, net.IP) (client.Discoverer, error) {
+	return f.d, nil
+}
+
+func (f tfinder) ByMAC(context.Context, net.HardwareAddr, net.IP, string) (client.Discoverer, error) {
+	return f.d, nil
+}
+
+func TestNilReporter(t *testing.T) {
+	defer func(logEvents bool) { conf.LogUnreportedEvents = logEvents }(conf.LogUnreportedEvents)
+
+	for _, logEvents := range []bool{false, true} {
+		t.Run(fmt.Sprintf("log=%t", logEvents), func(t *testing.T) {
+			conf.LogUnreportedEvents = logEvents
+
+			// the mock job has no reporter either
+			mock := job.NewMock(t, "c3.small.x86", "ewr1")
+			mock.SetInstanceID("id")
+			j := mock.Job()
+			d := &cacher.DiscoveryCacher{HardwareCacher: &cacher.HardwareCacher{Instance: &client.Instance{ID: "id"}}}
+			s := &BootsHTTPServer{jobManager: tjobManager{j: &j}, finder: tfinder{d: d}}
+
+			for path, body := range map[string]string{
+				"/events":     `{"code":1,"state":"running","message":"hello"}`,
+				"/phone-home": `{"type":"provisioning.104.01"}`,
+			} {
+				req := httptest.NewRequest("POST", "http://example.com"+path, strings.NewReader(body))
+				req.RemoteAddr = "10.0.0.1:4242"
+				w := httptest.NewRecorder()
+				s.handler(job.NewInstallers(), "", nil).ServeHTTP(w, req)
+				if got := w.Result().StatusCode; got != http.StatusOK {
+					t.Fatalf("unexpected %s status, want: %d, got: %d", path, http.StatusOK, got)
+				}
+			}
+		})
+	}
+}
+
+func TestServeProblem(t *testing.T) {
+	defer func(alwaysOK bool) { conf.ProblemAlwaysOK = alwaysOK }(conf.ProblemAlwaysOK)
+
+	for _, test := range []struct {
+		name     string
+		alwaysOK bool
+		job      bool
+		code     int
+	}{
+		{name: "no job", code: http.StatusNotFound},
+		{name: "job", job: true, code: http.StatusOK},
+		{name: "always ok, no job", alwaysOK: true, code: http.StatusOK},
+		{name: "always ok, job", alwaysOK: true, job: true, code: http.StatusOK},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			conf.ProblemAlwaysOK = test.alwaysOK
+
+			m := tjobManager{err: errors.New("no job")}
+			if test.job {
+				mock := job.NewMock(t, "c3.small.x86", "ewr1")
+				mock.SetReporter(client.NewNoOpReporter(mainlog.Logger))
+				j := mock.Job()
+				m = tjobManager{j: &j}
+			}
+			s := &BootsHTTPServer{jobManager: m}
+
+			req := httptest.NewRequest("POST", "http://example.com/problem", strings.NewReader(`{"problem":"memory"}`))
+			w := httptest.NewRecorder()
+			s.serveProblem(w, req)
+
+			if code := w.Result().StatusCode; code != test.code {
+				t.Fatalf("unexpected response code, want: %d, got: %d", test.code, code)
+			}
+		})
+	}
+}
+
+func TestServeAmbiguousHardware(t *testing.T) {
+	defer func(alwaysOK bool) { conf.ProblemAlwaysOK = alwaysOK }(conf.ProblemAlwaysOK)
+	conf.ProblemAlwaysOK = true
+
+	err := fmt.Errorf("discovering from ip address: %w", &client.AmbiguousHardwareError{Key: "ip 192.0.2.1"})
+	s := &BootsHTTPServer{jobManager: tjobManager{err: err}}
+	for name, serve := range map[string]http.HandlerFunc{
+		"problem":    s.serveProblem,
+		"phone-home": s.servePhoneHome,
+	} {
+		t.Run(name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "http://example.com/"+name, strings.NewReader(`{"problem":"memory"}`))
+			w := httptest.NewRecorder()
+			serve(w, req)
+
+			if code := w.Result().StatusCode; code != http.StatusConflict {
+				t.Fatalf("unexpected response code, want: %d, got: %d", http.StatusConflict, code)
+			}
+		})
+	}
+}
+
+func TestServeStaleHardware(t *testing.T) {
+	err := fmt.Errorf("discovering from ip address: %w", client.ErrStaleHardware)
+	s := &BootsHTTPServer{jobManager: tjobManager{err: err}}
+	w := httptest.NewRecorder()
+	s.handler(job.NewInstallers(), "/ipxe/", nil).ServeHTTP(w, httptest.NewRequest("GET", "http://example.com/auto.ipxe", nil))
+	if code := w.Result().StatusCode; code != http.StatusServiceUnavailable {
+		t.Fatalf("unexpected response code, want: %d, got: %d", http.StatusServiceUnavailable, code)
+	}
+}
+
+type tworkflowFinder bool
+
+func (f tworkflowFinder) HasActiveWorkflow(context.Context, client.HardwareID) (bool, error) {
+	return bool(f), nil
+}
+
+func TestServeNoWorkflowExpected(t *testing.T) {
+	defer func(keys map[string]struct{}) { conf.CustomDataKeys = keys }(conf.CustomDataKeys)
+
+	for _, test := range []struct {
+		name       string
+		customData interface{}
+		keys       map[string]struct{}
+		noWorkflow bool
+		noInstance bool
+		code       int
+	}{
+		{name: "workflow expected", code: http.StatusNotFound},
+		{name: "no workflow expected", customData: map[string]interface{}{"no_workflow": true}, code: http.StatusOK},
+		{name: "no_workflow false", customData: map[string]interface{}{"no_workflow": false}, code: http.StatusNotFound},
+		{name: "no_workflow filtered by CUSTOM_DATA_KEYS", customData: map[string]interface{}{"no_workflow": true}, keys: map[string]struct{}{"kickstart": {}}, code: http.StatusOK},
+		{name: "hardware no_workflow", noWorkflow: true, code: http.StatusOK},
+		{name: "hardware no_workflow without instance", noWorkflow: true, noInstance: true, code: http.StatusOK},
+		{name: "no instance", noInstance: true, code: http.StatusNotFound},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			conf.CustomDataKeys = test.keys
+
+			mock := job.NewMock(t, "c3.small.x86", "ewr1")
+			mock.SetReporter(client.NewNoOpReporter(mainlog.Logger))
+			mock.SetAllowWorkflow(true)
+			mock.SetCustomData(test.customData)
+			mock.SetNoWorkflow(test.noWorkflow)
+			if test.noInstance {
+				mock.DropInstance()
+			}
+			j := mock.Job()
+			s := &BootsHTTPServer{jobManager: tjobManager{j: &j}, workflowFinder: tworkflowFinder(false)}
+
+			for path, serve := range map[string]http.HandlerFunc{
+				"/problem":             s.serveProblem,
+				"/hardware-components": s.serveHardware,
+			} {
+				body := `{"problem":"memory"}`
+				if path == "/hardware-components" {
+					body = `{"components":[]}`
+				}
+				req := httptest.NewRequest("POST", "http://example.com"+path, strings.NewReader(body))
+				w := httptest.NewRecorder()
+				serve(w, req)
+
+				if code := w.Result().StatusCode; code != test.code {
+					t.Fatalf("%s: unexpected response code, want: %d, got: %d", path, test.code, code)
+				}
+			}
+		})
+	}
+}
+
+func TestJobMetricsFacility(t *testing.T) {
+	for _, test := range []struct {
+		name     string
+		job      bool
+		facility string
+	}{
+		{name: "no job", facility: metrics.UnknownFacility},
+		{name: "job", job: true, facility: "ewr1"},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			m := tjobManager{err: errors.New("no job")}
+			if test.job {
+				mock := job.NewMock(t, "c3.small.x86", test.facility)
+				mock.SetReporter(client.NewNoOpReporter(mainlog.Logger))
+				j := mock.Job()
+				m = tjobManager{j: &j}
+			}
+			s := &BootsHTTPServer{jobManager: m}
+
+			started := metrics.JobLabels("http", "problem", metrics.UnknownFacility)
+			labels := metrics.JobLabels("http", "problem", test.facility)
+			total := testutil.ToFloat64(metrics.JobsTotal.With(started))
+			completed := testutil.ToFloat64(metrics.JobsCompleted.With(labels))
+
+			req := httptest.NewRequest("POST", "http://example.com/problem", strings.NewReader(`{"problem":"memory"}`))
+			s.serveProblem(httptest.NewRecorder(), req)
+
+			if got := testutil.ToFloat64(metrics.JobsTotal.With(started)) - total; got != 1 {
+				t.Fatalf("unexpected jobs_total increase, want: 1, got: %v", got)
+			}
+			if got := testutil.ToFloat64(metrics.JobsCompleted.With(labels)) - completed; got != 1 {
+				t.Fatalf("unexpected jobs_completed_total increase for facility %q, want: 1, got: %v", test.facility, got)
+			}
+			if got := testutil.ToFloat64(metrics.JobsInProgress.With(labels)); got != 0 {
+				t.Fatalf("unexpected jobs_in_progress for facility %q, want: 0, got: %v", test.facility, got)
+			}
+		})
+	}
+}
+
+func TestMetricsAuth(t *testing.T) {
+	defer func(token, user, pass string) {
+		conf.MetricsAuthToken, conf.MetricsAuthUsername, conf.MetricsAuthPassword = token, user, pass
+	}(conf.MetricsAuthToken, conf.MetricsAuthUsername, conf.MetricsAuthPassword)
+
+	for _, test := range []struct {
+		name     string
+		token    string
+		user     string
+		pass     string
+		setup    func(req *http.Request)
+		code     int
+		basicHdr bool
+	}{
+		{name: "no auth configured", code: http.StatusOK},
+		{name: "token missing", token: "secret", code: http.StatusUnauthorized},
+		{
+			name: "token wrong", token: "secret", code: http.StatusUnauthorized,
+			setup: func(req *http.Request) { req.Header.Set("Authorization", "Bearer wrong") },
+		},
+		{
+			name: "token without bearer scheme", token: "secret", code: http.StatusUnauthorized,
+			setup: func(req *http.Request) { req.Header.Set("Authorization", "secret") },
+		},
+		{
+			name: "token", token: "secret", code: http.StatusOK,
+			setup: func(req *http.Request) { req.Header.Set("Authorization", "Bearer secret") },
+		},
+		{name: "basic missing", user: "prom", pass: "secret", code: http.StatusUnauthorized, basicHdr: true},
+		{
+			name: "basic wrong password", user: "prom", pass: "secret", code: http.StatusUnauthorized, basicHdr: true,
+			setup: func(req *http.Request) { req.SetBasicAuth("prom", "wrong") },
+		},
+		{
+			name: "basic", user: "prom", pass: "secret", code: http.StatusOK,
+			setup: func(req *http.Request) { req.SetBasicAuth("prom", "secret") },
+		},
+		{
+			name: "basic with token configured", token: "token", user: "prom", pass: "secret", code: http.StatusOK,
+			setup: func(req *http.Request) { req.SetBasicAuth("prom", "secret") },
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			conf.MetricsAuthToken, conf.MetricsAuthUsername, conf.MetricsAuthPassword = test.token, test.user, test.pass
+
+			h := metricsAuth(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+				w.WriteHeader(http.StatusOK)
+			}))
+			req := httptest.NewRequest("GET", "http://example.com/metrics", nil)
+			if test.setup != nil {
+				test.setup(req)
+			}
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, req)
+
+			resp := w.Result()
+			if resp.StatusCode != test.code {
+				t.Fatalf("unexpected response code, want: %d, got: %d", test.code, resp.StatusCode)
+			}
+			if got := resp.Header.Get("WWW-Authenticate") != ""; got != test.basicHdr {
+				t.Fatalf("unexpected WWW-Authenticate header presence, want: %v, got: %v", test.basicHdr, got)
+			}
+		})
+	}
+}
+
+func TestServeEventsFingerprint(t *testing.T) {
+	defer func(fingerprint bool) { conf.EventFingerprint = fingerprint }(conf.EventFingerprint)
+
+	for _, test := range []struct {
+		name     string
+		enabled  bool
+		serial   string
+		assetTag string
+		want     string
+	}{
+		{
+			name: "fingerprint", enabled: true, serial: "S3R1AL", assetTag: "A55ET",
+			want: `{"type":"user.1","state":"running","body":"hello","hardware_serial":"S3R1AL","hardware_asset_tag":"A55ET"}`,
+		},
+		{
+			name: "no fingerprint in hardware", enabled: true,
+			want: `{"type":"user.1","state":"running","body":"hello"}`,
+		},
+		{
+			name: "disabled", serial: "S3R1AL", assetTag: "A55ET",
+			want: `{"type":"user.1","state":"running","body":"hello"}`,
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			conf.EventFingerprint = test.enabled
+
+			var posted []byte
+			c := tclient{id: "id", serial: test.serial, assetTag: test.assetTag, posted: &posted}
+			req := httptest.NewRequest("POST", "http://example.com/events", strings.NewReader(`{"code":1,"state":"running","message":"hello"}`))
+			req.RemoteAddr = "10.0.0.1:42"
+			w := httptest.NewRecorder()
+
+			if _, err := serveEvents(c, nil, w, req); err != nil {
+				t.Fatal(err)
+			}
+			if string(posted) != test.want {
+				t.Fatalf("unexpected event payload, want: %s, got: %s", test.want, posted)
+			}
+		})
+	}
+}
+
+func TestServeEventsForwardHeaders(t *testing.T) {
+	defer func(names []string) { conf.EventForwardHeaders = names }(conf.EventForwardHeaders)
+
+	for _, test := range []struct {
+		name    string
+		names   []string
+		headers map[string]string
+		want    string
+	}{
+		{
+			name:    "configured headers",
+			names:   []string{"X-Trace-Id", "X-Agent-Version"},
+			headers: map[string]string{"X-Trace-Id": "abc123", "X-Agent-Version": "1.2.3", "X-Other": "dropped"},
+			want:    `{"type":"user.1","state":"running","body":"hello","headers":{"X-Agent-Version":"1.2.3","X-Trace-Id":"abc123"}}`,
+		},
+		{
+			name:    "absent header",
+			names:   []string{"X-Trace-Id", "X-Agent-Version"},
+			headers: map[string]string{"x-trace-id": "abc123"},
+			want:    `{"type":"user.1","state":"running","body":"hello","headers":{"X-Trace-Id":"abc123"}}`,
+		},
+		{
+			name:    "no configured headers",
+			headers: map[string]string{"X-Trace-Id": "abc123"},
+			want:    `{"type":"user.1","state":"running","body":"hello"}`,
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			conf.EventForwardHeaders = test.names
+
+			var posted []byte
+			c := tclient{id: "id", posted: &posted}
+			req := httptest.NewRequest("POST", "http://example.com/events", strings.NewReader(`{"code":1,"state":"running","message":"hello"}`))
+			req.RemoteAddr = "10.0.0.1:42"
+			for name, value := range test.headers {
+				req.Header.Set(name, value)
+			}
+			w := httptest.NewRecorder()
+
+			if _, err := serveEvents(c, nil, w, req); err != nil {
+				t.Fatal(err)
+			}
+			if string(posted) != test.want {
+				t.Fatalf("unexpected event payload, want: %s, got: %s", test.want, posted)
+			}
+		})
+	}
+}
+
+func TestReadyzOsieMirror(t *testing.T) {
+	defer func(probe, backends bool, url string, timeout time.Duration) {
+		conf.OsieMirrorProbe, conf.ReadyzProbeBackends, conf.OsieVendorServicesURL, conf.OsieMirrorProbeTimeout = probe, backends, url, timeout
+	}(conf.OsieMirrorProbe, conf.ReadyzProbeBackends, conf.OsieVendorServicesURL, conf.OsieMirrorProbeTimeout)
+	conf.ReadyzProbeBackends = false
+	conf.OsieMirrorProbeTimeout = 100 * time.Millisecond
+
+	reachable := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodHead {
+			t.Errorf("unexpected probe method: %s", req.Method)
+		}
+	}))
+	defer reachable.Close()
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer failing.Close()
+	hanging := make(chan struct{})
+	slow := httptest.NewServer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) { <-hanging }))
+	defer slow.Close()
+	defer close(hanging)
+	closed := httptest.NewServer(http.NotFoundHandler())
+	closed.Close()
+
+	for _, test := range []struct {
+		name  string
+		probe bool
+		url   string
+		code  int
+	}{
+		{name: "disabled", url: closed.URL, code: http.StatusOK},
+		{name: "reachable", probe: true, url: reachable.URL, code: http.StatusOK},
+		{name: "server error", probe: true, url: failing.URL, code: http.StatusServiceUnavailable},
+		{name: "timeout", probe: true, url: slow.URL, code: http.StatusServiceUnavailable},
+		{name: "unreachable", probe: true, url: closed.URL, code: http.StatusServiceUnavailable},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			conf.OsieMirrorProbe, conf.OsieVendorServicesURL = test.probe, test.url
+
+			w := httptest.NewRecorder()
+			s := &BootsHTTPServer{}
+			s.serveReadyz(w, httptest.NewRequest("GET", "/readyz", nil))
+			if got := w.Result().StatusCode; got != test.code {
+				t.Fatalf("unexpected status, want: %d, got: %d", test.code, got)
+			}
+			if test.code == http.StatusOK {
+				return
+			}
+			var res struct {
+				Failed map[string]string `json:"failed"`
+			}
+			if err := json.NewDecoder(w.Result().Body).Decode(&res); err != nil {
+				t.Fatal(err)
+			}
+			if res.Failed["osie_mirror"] == "" {
+				t.Fatalf("missing mirror probe error: %+v", res)
+			}
+		})
+	}
+
+	// liveness does not depend on the mirror
+	conf.OsieMirrorProbe, conf.OsieVendorServicesURL = true, closed.URL
+	w := httptest.NewRecorder()
+	(&BootsHTTPServer{}).serveHealthchecker("rev", time.Now())(w, httptest.NewRequest("GET", "http://example.com/healthcheck", nil))
+	if got := w.Result().StatusCode; got != http.StatusOK {
+		t.Fatalf("unexpected healthcheck status, want: %d, got: %d", http.StatusOK, got)
+	}
+	if strings.Contains(w.Body.String(), "mirror") {
+		t.Fatalf("unexpected mirror status in healthcheck: %s", w.Body.String())
+	}
+}
+
+func TestDrain(t *testing.T) {
+	mock := job.NewMock(t, "c3.small.x86", "ewr1")
+	mock.SetReporter(client.NewNoOpReporter(mainlog.Logger))
+	j := mock.Job()
+	s := &BootsHTTPServer{jobManager: tjobManager{j: &j}}
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	served := make(chan error)
+	go func() { served <- s.serve(context.Background(), s.handler(job.NewInstallers(), "", nil), l) }()
+
+	url := "http://" + l.Addr().String()
+	get := func(path string) int {
+		resp, err := http.Post(url+path, "application/json", strings.NewReader(`{"problem":"memory"}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+
+		return resp.StatusCode
+	}
+
+	if code := get("/readyz"); code != http.StatusOK {
+		t.Fatalf("unexpected readiness before draining, want: %d, got: %d", http.StatusOK, code)
+	}
+
+	drained := make(chan error)
+	go func() { drained <- s.Drain(context.Background(), 500*time.Millisecond) }()
+	deadline := time.Now().Add(time.Second)
+	for get("/readyz") != http.StatusServiceUnavailable {
+		if time.Now().After(deadline) {
+			t.Fatal("readiness did not fail while draining")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if code := get("/problem"); code != http.StatusOK {
+		t.Fatalf("unexpected job response while draining, want: %d, got: %d", http.StatusOK, code)
+	}
+
+	if err := <-drained; err != nil {
+		t.Fatal(err)
+	}
+	if err := <-served; err != nil {
+		t.Fatal(err)
+	}
+	if _, err := http.Get(url + "/readyz"); err == nil {
+		t.Fatal("server still serving after draining")
+	}
+}
+
+func TestServeShutdown(t *testing.T) {
+	defer func(delay, timeout time.Duration) {
+		conf.HTTPDrainDelay, conf.HTTPShutdownTimeout = delay, timeout
+	}(conf.HTTPDrainDelay, conf.HTTPShutdownTimeout)
+	conf.HTTPDrainDelay, conf.HTTPShutdownTimeout = 0, 5*time.Second
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	started, release := make(chan struct{}), make(chan struct{})
+	var requests int32
+	h := http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		// only the first request is held in flight
+		if atomic.AddInt32(&requests, 1) == 1 {
+			close(started)
+			<-release
+		}
+		_, _ = w.Write([]byte("auto.ipxe"))
+	})
+	s := &BootsHTTPServer{}
+	ctx, cancel := context.WithCancel(context.Background())
+	served := make(chan error)
+	go func() { served <- s.serve(ctx, h, l) }()
+
+	url := "http://" + l.Addr().String() + "/auto.ipxe"
+	inFlight := make(chan error)
+	go func() {
+		resp, err := http.Get(url)
+		if err == nil {
+			var body []byte
+			body, err = io.ReadAll(resp.Body)
+			resp.Body.Close()
+			if err == nil && string(body) != "auto.ipxe" {
+				err = fmt.Errorf("unexpected body: %q", body)
+			}
+		}
+		inFlight <- err
+	}()
+	<-started
+
+	cancel()
+	deadline := time.Now().Add(time.Second)
+	for {
+		resp, err := http.Get(url)
+		if err != nil {
+			break
+		}
+		resp.Body.Close()
+		if time.Now().After(deadline) {
+			t.Fatal("new connections still accepted after shutdown")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	close(release)
+
+	if err := <-inFlight; err != nil {
+		t.Fatalf("in-flight request dropped: %v", err)
+	}
+	if err := <-served; err != nil {
+		t.Fatal(err)
+	}
+}
+
+// probeFinder answers every lookup with err.
+type probeFinder struct {
+	err error
+}
+
+func (f probeFinder) ByIP(context.Context, net.IP) (client.Discoverer, error) {
+	return nil, f.err
+}
+
+func (f probeFinder) ByMAC(context.Context, net.HardwareAddr, net.IP, string) (client.Discoverer, error) {
+	return nil, f.err
+}
+
+// pingReporter is a reporter whose backend reachability is err.
+type pingReporter struct {
+	client.Reporter
+	err error
+}
+
+func (r pingReporter) Ping(context.Context) error {
+	return r.err
+}
+
+func TestReadyzProbeBackends(t *testing.T) {
+	defer func(probe bool) { conf.ReadyzProbeBackends = probe }(conf.ReadyzProbeBackends)
+
+	unreachable := errors.New("connection refused")
+	tests := []struct {
+		name      string
+		probe     bool
+		finderErr error
+		pingErr   error
+		code      int
+		failed    []string
+	}{
+		{name: "probes disabled", finderErr: unreachable, pingErr: unreachable, code: http.StatusOK},
+		{name: "reachable", probe: true, code: http.StatusOK},
+		{name: "sentinel not found", probe: true, finderErr: client.ErrNotFound, code: http.StatusOK},
+		{name: "finder unreachable", probe: true, finderErr: unreachable, code: http.StatusServiceUnavailable, failed: []string{"hardware_finder"}},
+		{name: "reporter unreachable", probe: true, pingErr: unreachable, code: http.StatusServiceUnavailable, failed: []string{"reporter"}},
+		{name: "both unreachable", probe: true, finderErr: unreachable, pingErr: unreachable, code: http.StatusServiceUnavailable, failed: []string{"hardware_finder", "reporter"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conf.ReadyzProbeBackends = tt.probe
+			s := &BootsHTTPServer{
+				finder:   probeFinder{err: tt.finderErr},
+				reporter: client.NewInstrumentedReporter(pingReporter{Reporter: client.NewNoOpReporter(mainlog.Logger), err: tt.pingErr}),
+			}
+
+			w := httptest.NewRecorder()
+			s.serveReadyz(w, httptest.NewRequest("GET", "/readyz", nil))
+			if got := w.Result().StatusCode; got != tt.code {
+				t.Fatalf("unexpected status, want: %d, got: %d", tt.code, got)
+			}
+			if !tt.probe {
+				return
+			}
+			var res struct {
+				Ready  bool              `json:"ready"`
+				Failed map[string]string `json:"failed"`
+			}
+			if err := json.NewDecoder(w.Result().Body).Decode(&res); err != nil {
+				t.Fatal(err)
+			}
+			var failed []string
+			for dependency := range res.Failed {
+				failed = append(failed, dependency)
+			}
+			sort.Strings(failed)
+			if res.Ready != (len(tt.failed) == 0) || strings.Join(failed, ",") != strings.Join(tt.failed, ",") {
+				t.Fatalf("unexpected readiness, want failed: %v, got: %+v", tt.failed, res)
+			}
+		})
+	}
+}
+
+func TestSelfTestInstallers(t *testing.T) {
+	defer func(critical map[string]struct{}) { conf.InstallerSelfTestCritical = critical }(conf.InstallerSelfTestCritical)
+
+	tests := []struct {
+		name     string
+		critical map[string]struct{}
+		code     int
+	}{
+		{name: "critical failure", critical: map[string]struct{}{"flatcar": {}}, code: http.StatusServiceUnavailable},
+		{name: "other failure", critical: map[string]struct{}{"vmware": {}}, code: http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conf.InstallerSelfTestCritical = tt.critical
+
+			i := job.NewInstallers()
+			i.RegisterDistro("flatcar", func(context.Context, job.Job, *ipxe.Script) { panic("missing template") })
+			i.RegisterDistro("vmware", func(_ context.Context, _ job.Job, s *ipxe.Script) { s.Echo("vmware") })
+
+			failures := metrics.InstallerSelfTestFailures.WithLabelValues("distro", "flatcar")
+			before := testutil.ToFloat64(failures)
+			s := &BootsHTTPServer{}
+			s.SelfTestInstallers(context.Background(), i)
+			if got := testutil.ToFloat64(failures) - before; got != 1 {
+				t.Fatalf("unexpected self-test failures counted, want: 1, got: %v", got)
+			}
+			if got := testutil.ToFloat64(metrics.InstallerSelfTestFailures.WithLabelValues("distro", "vmware")); got != 0 {
+				t.Fatalf("working installer counted as failed: %v", got)
+			}
+
+			w := httptest.NewRecorder()
+			s.serveReadyz(w, httptest.NewRequest("GET", "/readyz", nil))
+			if got := w.Result().StatusCode; got != tt.code {
+				t.Fatalf("unexpected readiness, want: %d, got: %d", tt.code, got)
+			}
+		})
+	}
+}
+
+func TestInstallerOverride(t *testing.T) {
+	defer func(proxies []string) { conf.TrustedProxies = proxies }(conf.TrustedProxies)
+	conf.TrustedProxies = []string{"10.0.0.0/24"}
+
+	i := job.NewInstallers()
+	for _, distro := range []string{"alpine", "flatcar"} {
+		distro := distro
+		i.RegisterDistro(distro, func(_ context.Context, _ job.Job, s *ipxe.Script) { s.Echo(distro + " installer") })
+	}
+
+	for _, test := range []struct {
+		name       string
+		remoteAddr string
+		override   string
+		want       string
+	}{
+		{name: "no override", remoteAddr: "10.0.0.1:4242", want: "alpine"},
+		{name: "trusted source", remoteAddr: "10.0.0.1:4242", override: "flatcar", want: "flatcar"},
+		{name: "untrusted source", remoteAddr: "192.168.1.1:4242", override: "flatcar", want: "alpine"},
+		{name: "unknown installer", remoteAddr: "10.0.0.1:4242", override: "nope", want: "alpine"},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			mock := job.NewMock(t, "c3.small.x86", "ewr1")
+			mock.SetOSDistro("alpine")
+			mock.SetAllowPXE(true)
+			j := mock.Job()
+			s := &BootsHTTPServer{jobManager: tjobManager{j: &j}}
+
+			req := httptest.NewRequest("GET", "http://example.com/auto.ipxe", nil)
+			req.RemoteAddr = test.remoteAddr
+			if test.override != "" {
+				req.Header.Set(installerOverrideHeader, test.override)
+			}
+			w := httptest.NewRecorder()
+			s.handler(i, "", nil).ServeHTTP(w, req)
+
+			body, _ := io.ReadAll(w.Result().Body)
+			if want := "echo " + test.want + " installer\n"; !strings.HasSuffix(string(body), want) {
+				t.Fatalf("unexpected boot script, want suffix: %q, got: %q", want, body)
+			}
+		})
+	}
+}
+
+func TestAllowPXEGate(t *testing.T) {
+	defer func(skip bool) { conf.IPXEBinariesSkipAllowPXE = skip }(conf.IPXEBinariesSkipAllowPXE)
+
+	i := job.NewInstallers()
+	i.RegisterDistro("alpine", func(_ context.Context, _ job.Job, s *ipxe.Script) { s.Echo("alpine installer") })
+	binaries := func(w http.ResponseWriter, _ *http.Request) { _, _ = w.Write([]byte("ipxe.efi")) }
+
+	for _, test := range []struct {
+		name     string
+		allowPXE bool
+		skip     bool
+		script   int
+		binary   int
+	}{
+		{name: "allowed", allowPXE: true, script: http.StatusOK, binary: http.StatusOK},
+		{name: "disallowed", script: http.StatusNotFound, binary: http.StatusNotFound},
+		{name: "disallowed binaries exempt", skip: true, script: http.StatusNotFound, binary: http.StatusOK},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			conf.IPXEBinariesSkipAllowPXE = test.skip
+
+			mock := job.NewMock(t, "c3.small.x86", "ewr1")
+			mock.SetOSDistro("alpine")
+			mock.SetAllowPXE(test.allowPXE)
+			j := mock.Job()
+			s := &BootsHTTPServer{jobManager: tjobManager{j: &j}}
+			h := s.handler(i, "/ipxe/", binaries)
+
+			for path, want := range map[string]int{"/auto.ipxe": test.script, "/ipxe/ipxe.efi": test.binary} {
+				w := httptest.NewRecorder()
+				h.ServeHTTP(w, httptest.NewRequest("GET", "http://example.com"+path, nil))
+				if got := w.Result().StatusCode; got != want {
+					t.Fatalf("unexpected %s status, want: %d, got: %d", path, want, got)
+				}
+			}
+		})
+	}
+}
+
+func TestAllowPXEGracePeriod(t *testing.T) {
+	defer func(grace time.Duration) { conf.AllowPXEGracePeriod = grace }(conf.AllowPXEGracePeriod)
+
+	i := job.NewInstallers()
+	i.RegisterDistro("alpine", func(_ context.Context, _ job.Job, s *ipxe.Script) { s.Echo("alpine installer") })
+
+	for _, test := range []struct {
+		name   string
+		path   string
+		grace  time.Duration
+		status int
+		halt   bool
+	}{
+		{name: "no grace period", path: "/auto.ipxe", status: http.StatusNotFound},
+		{name: "within grace period", path: "/auto.ipxe", grace: time.Minute, status: http.StatusOK, halt: true},
+		{name: "grub.cfg within grace period", path: "/grub.cfg", grace: time.Minute, status: http.StatusNotFound},
+		{name: "signature within grace period", path: "/auto.ipxe.sig", grace: time.Minute, status: http.StatusNotFound},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			conf.AllowPXEGracePeriod = test.grace
+			pxeDenials = &denials{seen: map[string]denial{}}
+
+			mock := job.NewMock(t, "c3.small.x86", "ewr1")
+			mock.SetOSDistro("alpine")
+			mock.SetAllowPXE(false)
+			j := mock.Job()
+			s := &BootsHTTPServer{jobManager: tjobManager{j: &j}}
+
+			w := httptest.NewRecorder()
+			s.handler(i, "", nil).ServeHTTP(w, httptest.NewRequest("GET", "http://example.com"+test.path, nil))
+			if got := w.Result().StatusCode; got != test.status {
+				t.Fatalf("unexpected status, want: %d, got: %d", test.status, got)
+			}
+			body, _ := io.ReadAll(w.Result().Body)
+			if halt := strings.Contains(string(body), "do not retry"); halt != test.halt {
+				t.Fatalf("unexpected halting script, want: %v, got: %q", test.halt, body)
+			}
+		})
+	}
+}
+
+func TestDenialsGraceExpires(t *testing.T) {
+	d := &denials{seen: map[string]denial{}}
+	now := time.Now()
+
+	if !d.observe("00:00:ba:dd:be:ef", now, time.Minute) {
+		t.Fatal("first denial not within the grace period")
+	}
+	if !d.observe("00:00:ba:dd:be:ef", now.Add(30*time.Second), time.Minute) {
+		t.Fatal("denial in the grace period not within it")
+	}
+	if d.observe("00:00:ba:dd:be:ef", now.Add(90*time.Second), time.Minute) {
+		t.Fatal("denial past the grace period within it")
+	}
+	if !d.observe("00:00:ba:dd:be:ef", now.Add(4*time.Minute), time.Minute) {
+		t.Fatal("denial long after the last one not within a new grace period")
+	}
+	if !d.observe("00:00:ba:dd:be:ef", now.Add(4*time.Minute+45*time.Second), time.Minute) {
+		t.Fatal("denial in the new grace period not within it")
+	}
+	if d.observe("00:00:ba:dd:be:ef", now.Add(5*time.Minute+30*time.Second), time.Minute) {
+		t.Fatal("denial past the new grace period within it")
+	}
+	d.forget("00:00:ba:dd:be:ef")
+	if !d.observe("00:00:ba:dd:be:ef", now.Add(6*time.Minute), time.Minute) {
+		t.Fatal("denial after being allowed again not within a new grace period")
+	}
+}
+
+// treporter records the kinds of the hardware events posted through it.
+type treporter struct {
+	client.Reporter
+	kinds *[]string
+}
+
+func (r treporter) PostHardwareEvent(_ context.Context, _ string, body io.Reader) (string, error) {
+	var e client.Event
+	if err := json.NewDecoder(body).Decode(&e); err != nil {
+		return "", err
+	}
+	*r.kinds = append(*r.kinds, e.Type)
+
+	return "", nil
+}
+
+func TestAwaitingConfig(t *testing.T) {
+	defer func(enabled bool) { conf.AwaitingConfigScript = enabled }(conf.AwaitingConfigScript)
+	conf.AwaitingConfigScript = true
+
+	i := job.NewInstallers()
+	i.RegisterDistro("alpine", func(_ context.Context, _ job.Job, s *ipxe.Script) { s.Echo("alpine installer") })
+	i.RegisterDefaultInstaller(func(_ context.Context, _ job.Job, s *ipxe.Script) { s.Echo("default installer") })
+
+	for _, test := range []struct {
+		name     string
+		distro   string
+		workflow bool
+		awaiting bool
+	}{
+		{name: "no os nor workflow", awaiting: true},
+		{name: "no os with an active workflow", workflow: true},
+		{name: "os set", distro: "alpine"},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			var kinds []string
+			mock := job.NewMock(t, "c3.small.x86", "ewr1")
+			mock.SetOSDistro(test.distro)
+			mock.SetAllowPXE(true)
+			mock.SetAllowWorkflow(true)
+			mock.SetReporter(treporter{Reporter: client.NewNoOpReporter(mainlog.Logger), kinds: &kinds})
+			j := mock.Job()
+			s := &BootsHTTPServer{jobManager: tjobManager{j: &j}, workflowFinder: tworkflowFinder(test.workflow)}
+
+			w := httptest.NewRecorder()
+			s.handler(i, "/ipxe/", nil).ServeHTTP(w, httptest.NewRequest("GET", "http://example.com/auto.ipxe", nil))
+			if got := w.Result().StatusCode; got != http.StatusOK {
+				t.Fatalf("unexpected status, want: %d, got: %d", http.StatusOK, got)
+			}
+			script := w.Body.String()
+			if got := strings.Contains(script, conf.AwaitingConfigMessage) && strings.Contains(script, "reboot"); got != test.awaiting {
+				t.Fatalf("awaiting configuration script served: %v, want: %v\n%s", got, test.awaiting, script)
+			}
+			if test.awaiting && strings.Contains(script, "installer") {
+				t.Fatalf("awaiting configuration script boots an installer:\n%s", script)
+			}
+
+			want := []string(nil)
+			if test.awaiting {
+				want = []string{"waiting"}
+			}
+			if fmt.Sprint(kinds) != fmt.Sprint(want) {
+				t.Fatalf("unexpected events posted, want: %v, got: %v", want, kinds)
+			}
+		})
+	}
+}
+
+func TestOtelDisabled(t *testing.T) {
+	defer func(disabled bool) { conf.OtelDisabled = disabled }(conf.OtelDisabled)
+	conf.OtelDisabled = true
+	t.Setenv("OTEL_EXPORTER_OTLP_ENDPOINT", "localhost:4317")
+
+	provider := otel.GetTracerProvider()
+	ctx, shutdown := initOpenTelemetry(context.Background())
+	defer shutdown(ctx)
+	if _, ok := otelinit.ConfigFromContext(ctx); ok {
+		t.Fatal("OpenTelemetry was initialized")
+	}
+	if otel.GetTracerProvider() != provider {
+		t.Fatal("a tracer provider was configured")
+	}
+
+	i := job.NewInstallers()
+	i.RegisterDistro("alpine", func(_ context.Context, _ job.Job, s *ipxe.Script) { s.Echo("alpine installer") })
+	mock := job.NewMock(t, "c3.small.x86", "ewr1")
+	mock.SetOSDistro("alpine")
+	mock.SetAllowPXE(true)
+	j := mock.Job()
+	s := &BootsHTTPServer{jobManager: tjobManager{j: &j}}
+	h := s.handler(i, "/ipxe/", nil)
+
+	for path, want := range map[string]string{"/auto.ipxe": "alpine installer", "/_packet/healthcheck": "git_rev"} {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest("GET", "http://example.com"+path, nil))
+		if got := w.Result().StatusCode; got != http.StatusOK {
+			t.Fatalf("unexpected %s status, want: %d, got: %d", path, http.StatusOK, got)
+		}
+		if !strings.Contains(w.Body.String(), want) {
+			t.Fatalf("expected %q in %s response:\n%s", want, path, w.Body.String())
+		}
+	}
+}
+
+func TestServeSSHKeys(t *testing.T) {
+	defer func(serve bool) { conf.ServeSSHKeys = serve }(conf.ServeSSHKeys)
+	conf.ServeSSHKeys = true
+
+	mock := job.NewMock(t, "c3.small.x86", "ewr1")
+	mock.SetSSHKeys("ssh-ed25519 AAAA1 alice", "ssh-rsa AAAA2 bob")
+	withKeys := mock.Job()
+	noKeys := job.NewMock(t, "c3.small.x86", "ewr1").Job()
+
+	for _, test := range []struct {
+		name string
+		jm   job.Manager
+		code int
+		body string
+	}{
+		{name: "keys", jm: tjobManager{j: &withKeys}, code: http.StatusOK, body: "ssh-ed25519 AAAA1 alice\nssh-rsa AAAA2 bob\n"},
+		{name: "no keys", jm: tjobManager{j: &noKeys}, code: http.StatusNotFound},
+		{name: "unknown client", jm: tjobManager{err: errors.New("no job")}, code: http.StatusNotFound},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			s := &BootsHTTPServer{jobManager: test.jm}
+			w := httptest.NewRecorder()
+			s.handler(job.NewInstallers(), "/ipxe/", nil).ServeHTTP(w, httptest.NewRequest("GET", "http://example.com"+job.SSHKeysPath, nil))
+			if got := w.Result().StatusCode; got != test.code {
+				t.Fatalf("unexpected status, want: %d, got: %d", test.code, got)
+			}
+			if got := w.Body.String(); got != test.body {
+				t.Fatalf("unexpected body, want: %q, got: %q", test.body, got)
+			}
+		})
+	}
+}
+
+func TestInstallerSpanName(t *testing.T) {
+	defer func(disabled bool) { conf.OtelDisabled = disabled }(conf.OtelDisabled)
+	conf.OtelDisabled = false
+
+	recorder := tracetest.NewSpanRecorder()
+	defer otel.SetTracerProvider(otel.GetTracerProvider())
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+
+	mock := job.NewMock(t, "c3.small.x86", "ewr1")
+	mock.SetOSSlug("vmware_esxi_7_0")
+	j := mock.Job()
+	s := &BootsHTTPServer{jobManager: tjobManager{j: &j}}
+	h := s.handler(job.NewInstallers(), "/ipxe/", nil)
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "http://example.com"+vmware.KickstartPath, nil))
+	if got := w.Result().StatusCode; got != http.StatusOK {
+		t.Fatalf("unexpected status, want: %d, got: %d", http.StatusOK, got)
+	}
+
+	spans := recorder.Ended()
+	if len(spans) != 1 {
+		t.Fatalf("expected 1 span, got: %d", len(spans))
+	}
+	if want, got := "vmware kickstart vmware_esxi_7_0", spans[0].Name(); got != want {
+		t.Fatalf("unexpected span name, want: %q, got: %q", want, got)
+	}
+}
+
+func TestServeHead(t *testing.T) {
+	mock := job.NewMock(t, "c3.small.x86", "ewr1")
+	mock.SetOSSlug("vmware_esxi_7_0")
+	j := mock.Job()
+	s := &BootsHTTPServer{jobManager: tjobManager{j: &j}}
+	h := s.handler(job.NewInstallers(), "/ipxe/", nil)
+
+	get := httptest.NewRecorder()
+	h.ServeHTTP(get, httptest.NewRequest("GET", "http://example.com"+vmware.KickstartPath, nil))
+	head := httptest.NewRecorder()
+	h.ServeHTTP(head, httptest.NewRequest("HEAD", "http://example.com"+vmware.KickstartPath, nil))
+
+	if got := head.Result().StatusCode; got != get.Result().StatusCode {
+		t.Fatalf("unexpected HEAD status, want: %d, got: %d", get.Result().StatusCode, got)
+	}
+	if want, got := strconv.Itoa(get.Body.Len()), head.Header().Get("Content-Length"); got != want || want == "0" {
+		t.Fatalf("unexpected HEAD Content-Length, want: %s, got: %s", want, got)
+	}
+	if head.Body.Len() != 0 {
+		t.Fatalf("unexpected HEAD body:\n%s", head.Body.String())
+	}
+}
+
+func TestServeHeadSkipsEvents(t *testing.T) {
+	defer func(enabled bool) { conf.AwaitingConfigScript = enabled }(conf.AwaitingConfigScript)
+	conf.AwaitingConfigScript = true
+
+	var kinds []string
+	mock := job.NewMock(t, "c3.small.x86", "ewr1")
+	mock.SetAllowPXE(true)
+	mock.SetAllowWorkflow(true)
+	mock.SetReporter(treporter{Reporter: client.NewNoOpReporter(mainlog.Logger), kinds: &kinds})
+	j := mock.Job()
+	s := &BootsHTTPServer{jobManager: tjobManager{j: &j}, workflowFinder: tworkflowFinder(false)}
+
+	w := httptest.NewRecorder()
+	s.handler(job.NewInstallers(), "/ipxe/", nil).ServeHTTP(w, httptest.NewRequest("HEAD", "http://example.com/auto.ipxe", nil))
+	if got := w.Result().StatusCode; got != http.StatusOK {
+		t.Fatalf("unexpected status, want: %d, got: %d", http.StatusOK, got)
+	}
+	if w.Header().Get("Content-Length") == "" || w.Body.Len() != 0 {
+		t.Fatalf("unexpected HEAD response, Content-Length: %q, body:\n%s", w.Header().Get("Content-Length"), w.Body.String())
+	}
+	if len(kinds) != 0 {
+		t.Fatalf("unexpected events posted: %v", kinds)
+	}
+}
+
+func TestTimeline(t *testing.T) {
+	defer func(size int) { conf.TimelineSize = size }(conf.TimelineSize)
+	conf.TimelineSize = 16
+	timeline.Init(conf.TimelineSize, 8)
+	defer timeline.Init(0, 0)
+
+	mock := job.NewMock(t, "c3.small.x86", "ewr1")
+	mock.SetMAC("00:00:ba:dd:be:ef")
+	mock.SetNetwork(net.ParseIP("10.20.0.10"), net.ParseIP("255.255.255.0"), net.ParseIP("10.20.0.1"))
+	mock.SetOSDistro("alpine")
+	mock.SetAllowPXE(true)
+	j := mock.Job()
+
+	d := dhcpHandler{
+		pool:         workerpool.New(1),
+		nextServer:   net.ParseIP("192.168.0.2"),
+		bootsBaseURL: "192.168.0.2",
+		jobmanager:   tjobManager{j: &j},
+	}
+	defer d.pool.Stop()
+	req := dhcp4.NewPacket(dhcp4.BootRequest)
+	req.HLen()[0] = byte(len(j.PrimaryNIC()))
+	copy(req.CHAddr(), j.PrimaryNIC())
+	req.SetMessageType(dhcp4.MessageTypeDiscover)
+	req.SetString(dhcp4.OptionClassID, "PXEClient")
+	req.SetString(dhcp4.OptionUserClass, "Tinkerbell")
+	w := make(treplyWriter, 1)
+	d.serve(w, &req)
+	select {
+	case <-w:
+	case <-time.After(5 * time.Second):
+		t.Fatal("no reply")
+	}
+
+	i := job.NewInstallers()
+	i.RegisterDistro("alpine", func(_ context.Context, _ job.Job, s *ipxe.Script) { s.Echo("alpine installer") })
+	s := &BootsHTTPServer{jobManager: tjobManager{j: &j}}
+	h := s.handler(i, "/ipxe/", nil)
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "http://example.com/auto.ipxe", nil))
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", "http://example.com/_packet/timeline?mac=00:00:ba:dd:be:ef", nil))
+	if got := rec.Result().StatusCode; got != http.StatusOK {
+		t.Fatalf("unexpected status, want: %d, got: %d", http.StatusOK, got)
+	}
+	var events []timeline.Event
+	if err := json.NewDecoder(rec.Body).Decode(&events); err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, e := range events {
+		got = append(got, e.Source+": "+e.Message)
+	}
+	want := []string{
+		"dhcp: received DHCPDISCOVER giaddr=0.0.0.0",
+		`dhcp: sent DHCPOFFER yiaddr=10.20.0.10 file="http://192.168.0.2/auto.ipxe"`,
+		"http: GET /auto.ipxe",
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatal(diff)
+	}
+}
+
+func TestMethodAllowlist(t *testing.T) {
+	defer func(metadata, keys bool) { conf.ServeMetadata, conf.ServeSSHKeys = metadata, keys }(conf.ServeMetadata, conf.ServeSSHKeys)
+	conf.ServeMetadata, conf.ServeSSHKeys = true, true
+
+	s := &BootsHTTPServer{jobManager: tjobManager{err: errors.New("no job")}}
+	h := s.handler(job.NewInstallers(), "/ipxe/", func(w http.ResponseWriter, _ *http.Request) { w.WriteHeader(http.StatusOK) })
+	for _, test := range []struct {
+		path, method, allow string
+	}{
+		{path: "/auto.ipxe", method: "PUT", allow: "GET, HEAD"},
+		{path: "/ipxe/ipxe.efi", method: "DELETE", allow: "GET, HEAD"},
+		{path: vmware.KickstartPath, method: "POST", allow: "GET, HEAD"},
+		{path: flatcar.IgnitionPathFlatcar, method: "TRACE", allow: "GET, HEAD"},
+		{path: job.MetadataPath, method: "PUT", allow: "GET, HEAD"},
+		{path: job.SSHKeysPath, method: "POST", allow: "GET, HEAD"},
+		{path: "/phone-home/key", method: "DELETE", allow: "GET, HEAD"},
+		{path: "/events", method: "GET", allow: "POST"},
+		{path: "/phone-home", method: "PUT", allow: "POST"},
+		{path: "/problem", method: "TRACE", allow: "POST"},
+		{path: "/hardware-components", method: "DELETE", allow: "POST"},
+	} {
+		t.Run(test.method+" "+test.path, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, httptest.NewRequest(test.method, "http://example.com"+test.path, nil))
+			if got := w.Result().StatusCode; got != http.StatusMethodNotAllowed {
+				t.Fatalf("unexpected status, want: %d, got: %d", http.StatusMethodNotAllowed, got)
+			}
+			if got := w.Result().Header.Get("Allow"); got != test.allow {
+				t.Fatalf("unexpected Allow header, want: %q, got: %q", test.allow, got)
+			}
+		})
+	}
+}
+
+func TestMethodAllowlistOverride(t *testing.T) {
+	defer func(methods map[string]string) { conf.HTTPRouteMethods = methods }(conf.HTTPRouteMethods)
+	conf.HTTPRouteMethods = map[string]string{"/problem": "post, put"}
+
+	h := allowMethods("/problem", func(w http.ResponseWriter, _ *http.Request) { w.WriteHeader(http.StatusOK) }, http.MethodPost)
+	for method, code := range map[string]int{
+		"POST":   http.StatusOK,
+		"PUT":    http.StatusOK,
+		"DELETE": http.StatusMethodNotAllowed,
+	} {
+		w := httptest.NewRecorder()
+		h(w, httptest.NewRequest(method, "http://example.com/problem", nil))
+		if got := w.Result().StatusCode; got != code {
+			t.Fatalf("%s: unexpected status, want: %d, got: %d", method, code, got)
+		}
+	}
+	w := httptest.NewRecorder()
+	h(w, httptest.NewRequest("DELETE", "http://example.com/problem", nil))
+	if got := w.Result().Header.Get("Allow"); got != "POST, PUT" {
+		t.Fatalf("unexpected Allow header, want: %q, got: %q", "POST, PUT", got)
+	}
+}
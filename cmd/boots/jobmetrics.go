@@ -0,0 +1,56 @@
+package main
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/tinkerbell/boots/job"
+	"github.com/tinkerbell/boots/metrics"
+)
+
+// jobMetrics records the job metrics of a single request. Requests count
+// towards jobs_total when they start, so under the unknown facility, and as in
+// progress under the unknown facility until their job is resolved. A nil
+// jobMetrics records nothing.
+type jobMetrics struct {
+	from, op string
+	labels   prometheus.Labels
+	start    time.Time
+}
+
+func startJobMetrics(from, op string) *jobMetrics {
+	m := &jobMetrics{
+		from:   from,
+		op:     op,
+		labels: metrics.JobLabels(from, op, metrics.UnknownFacility),
+		start:  time.Now(),
+	}
+	metrics.JobsTotal.With(m.labels).Inc()
+	metrics.JobsInProgress.With(m.labels).Inc()
+
+	return m
+}
+
+// resolved moves the request to the facility of j.
+func (m *jobMetrics) resolved(j *job.Job) {
+	if m == nil {
+		return
+	}
+	facility := j.FacilityCode()
+	if facility == "" {
+		facility = metrics.UnknownFacility
+	}
+	labels := metrics.JobLabels(m.from, m.op, facility)
+	metrics.JobsInProgress.With(m.labels).Dec()
+	metrics.JobsInProgress.With(labels).Inc()
+	m.labels = labels
+}
+
+func (m *jobMetrics) done() {
+	if m == nil {
+		return
+	}
+	metrics.JobsInProgress.With(m.labels).Dec()
+	metrics.JobsCompleted.With(m.labels).Inc()
+	metrics.JobDuration.With(m.labels).Observe(time.Since(m.start).Seconds())
+}
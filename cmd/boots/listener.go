@@ -0,0 +1,68 @@
+package main
+
+import (
+	"net"
+	"sync"
+)
+
+// connLimit bounds the concurrent connections of the listeners sharing it to
+// its capacity, nil is unlimited.
+type connLimit chan struct{}
+
+// newConnLimit returns a limit of n concurrent connections, a limit below 1 is
+// unlimited.
+func newConnLimit(n int) connLimit {
+	if n < 1 {
+		return nil
+	}
+
+	return make(connLimit, n)
+}
+
+// listener limits l to the connections left in c, counting them against the
+// other listeners of c.
+func (c connLimit) listener(l net.Listener) net.Listener {
+	if c == nil {
+		return l
+	}
+
+	return &limitListener{Listener: l, sem: c}
+}
+
+// limitListener accepts connections while there is room in sem, closing the
+// connections accepted beyond that instead of queueing them.
+type limitListener struct {
+	net.Listener
+	sem connLimit
+}
+
+func (l *limitListener) Accept() (net.Conn, error) {
+	for {
+		c, err := l.Listener.Accept()
+		if err != nil {
+			return nil, err
+		}
+
+		select {
+		case l.sem <- struct{}{}:
+			return &limitConn{Conn: c, release: func() { <-l.sem }}, nil
+		default:
+			mainlog.With("remote", c.RemoteAddr().String(), "limit", cap(l.sem)).Info("refusing http connection, too many open connections")
+			c.Close()
+		}
+	}
+}
+
+// limitConn frees its slot in the listener limit once closed.
+type limitConn struct {
+	net.Conn
+	release func()
+	once    sync.Once
+}
+
+func (c *limitConn) Close() error {
+	err := c.Conn.Close()
+	c.once.Do(c.release)
+
+	return err
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestLimitListener(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	l := newConnLimit(2).listener(ln)
+	defer l.Close()
+
+	accepted := make(chan net.Conn)
+	go func() {
+		for {
+			c, err := l.Accept()
+			if err != nil {
+				close(accepted)
+
+				return
+			}
+			accepted <- c
+		}
+	}()
+
+	dial := func() net.Conn {
+		c, err := net.Dial("tcp", ln.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return c
+	}
+	// refused reports whether the server closed c without accepting it.
+	refused := func(c net.Conn) bool {
+		c.SetReadDeadline(time.Now().Add(time.Second))
+		_, err := c.Read(make([]byte, 1))
+
+		return err == io.EOF
+	}
+
+	var server []net.Conn
+	for i := 0; i < 2; i++ {
+		c := dial()
+		defer c.Close()
+		server = append(server, <-accepted)
+	}
+
+	for i := 0; i < 2; i++ {
+		c := dial()
+		defer c.Close()
+		if !refused(c) {
+			t.Fatalf("connection %d beyond the limit was not refused", i)
+		}
+	}
+
+	// closing twice must only free a single slot
+	server[0].Close()
+	server[0].Close()
+	c := dial()
+	defer c.Close()
+	select {
+	case sc := <-accepted:
+		sc.Close()
+	case <-time.After(time.Second):
+		t.Fatal("connection not accepted after another was closed")
+	}
+	server[1].Close()
+}
+
+func TestLimitListenerUnlimited(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	if l := newConnLimit(0).listener(ln); l != ln {
+		t.Fatal("listener wrapped without a limit")
+	}
+}
+
+func TestConnLimitShared(t *testing.T) {
+	limit := newConnLimit(1)
+	var listeners []net.Listener
+	for i := 0; i < 2; i++ {
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		l := limit.listener(ln)
+		defer l.Close()
+		listeners = append(listeners, l)
+	}
+
+	accept := func(l net.Listener) <-chan net.Conn {
+		accepted := make(chan net.Conn, 1)
+		go func() {
+			if c, err := l.Accept(); err == nil {
+				accepted <- c
+			}
+		}()
+
+		return accepted
+	}
+	dial := func(l net.Listener) net.Conn {
+		c, err := net.Dial("tcp", l.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return c
+	}
+
+	first := accept(listeners[0])
+	c := dial(listeners[0])
+	defer c.Close()
+	sc := <-first
+
+	// the second listener has no room left while the first holds the limit
+	second := accept(listeners[1])
+	refused := dial(listeners[1])
+	defer refused.Close()
+	refused.SetReadDeadline(time.Now().Add(time.Second))
+	if _, err := refused.Read(make([]byte, 1)); err != io.EOF {
+		t.Fatalf("connection beyond the shared limit was not refused: %v", err)
+	}
+
+	sc.Close()
+	c2 := dial(listeners[1])
+	defer c2.Close()
+	select {
+	case sc := <-second:
+		sc.Close()
+	case <-time.After(time.Second):
+		t.Fatal("connection not accepted after the other listener freed the limit")
+	}
+}
@@ -22,6 +22,7 @@ import (
 	"github.com/peterbourgon/ff/v3"
 	"github.com/peterbourgon/ff/v3/ffcli"
 	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/tinkerbell/boots/client"
 	"github.com/tinkerbell/boots/client/cacher"
 	"github.com/tinkerbell/boots/client/kubernetes"
@@ -36,9 +37,12 @@ import (
 	"github.com/tinkerbell/boots/installers/flatcar"
 	"github.com/tinkerbell/boots/installers/osie"
 	"github.com/tinkerbell/boots/installers/vmware"
+	"github.com/tinkerbell/boots/installers/wipe"
 	"github.com/tinkerbell/boots/job"
 	"github.com/tinkerbell/boots/metrics"
 	"github.com/tinkerbell/boots/syslog"
+	"github.com/tinkerbell/boots/tftp"
+	"github.com/tinkerbell/boots/timeline"
 	"github.com/tinkerbell/ipxedust"
 	"github.com/tinkerbell/ipxedust/ihttp"
 	"go.uber.org/zap"
@@ -51,7 +55,7 @@ var (
 	apiBaseURL            = env.URL("API_BASE_URL", "https://api.packet.net")
 	provisionerEngineName = env.Get("PROVISIONER_ENGINE_NAME", "packet")
 
-	mainlog log.Logger
+	mainlog job.RedactingLogger
 
 	GitRev    = "unknown (use make)"
 	StartTime = time.Now()
@@ -103,16 +107,16 @@ func main() {
 
 	// this flag.Set is needed to support how the log level is set in github.com/packethost/pkg/log
 	_ = flag.Set("log-level", cfg.logLevel)
-	l, err := log.Init("github.com/tinkerbell/boots")
+	l, err := initLog()
 	if err != nil {
 		panic(nil)
 	}
 	defer l.Close()
-	mainlog = l.Package("main")
+	mainlog = job.NewRedactingLogger(l.Package("main"))
 
 	ctx, done := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGHUP, syscall.SIGTERM)
 	defer done()
-	ctx, otelShutdown := otelinit.InitOpenTelemetry(ctx, name)
+	ctx, otelShutdown := initOpenTelemetry(ctx)
 	defer otelShutdown(ctx)
 
 	metrics.Init(l)
@@ -122,23 +126,39 @@ func main() {
 	installers.Init(l)
 	job.Init(l)
 	syslog.Init(l)
+	tftp.Init(l)
+	timeline.Init(conf.TimelineSize, conf.TimelineMachines)
 	mainlog.With("version", GitRev).Info("starting")
 
 	reporter, err := getReporter(l)
 	if err != nil {
 		mainlog.Fatal(err)
 	}
+	reporter = client.NewInstrumentedReporter(reporter)
 	workflowFinder, finder, err := getFinders(l, cfg, reporter)
 	if err != nil {
 		mainlog.Fatal(err)
 	}
+	finder = client.NewInstrumentedHardwareFinder(finder)
+	if conf.HardwareCacheTTL > 0 {
+		finder = client.NewCachedHardwareFinder(mainlog.Logger, finder, conf.HardwareCacheTTL, conf.HardwareCacheMaxAge, conf.HardwareCacheServeStale, conf.HardwareCacheMaxEntries)
+	}
+	workflowFinder = client.NewInstrumentedWorkflowFinder(workflowFinder)
 	jobManager := job.NewCreator(l, provisionerEngineName, reporter, finder)
 
+	var syslogForwarder *syslog.Forwarder
+	if len(conf.SyslogForwardFacilities) > 0 || conf.SyslogForwardDefault != "" {
+		syslogForwarder, err = syslog.NewForwarder(syslogFacilityFinder(finder), conf.SyslogForwardFacilities, conf.SyslogForwardDefault)
+		if err != nil {
+			mainlog.Fatal(err)
+		}
+	}
+
 	go func() {
 		mainlog.With("addr", cfg.syslogAddr).Info("serving syslog")
 		err = retry.Do(
 			func() error {
-				_, err := syslog.StartReceiver(cfg.syslogAddr, 1)
+				_, err := syslog.StartReceiver(cfg.syslogAddr, conf.SyslogWorkers, conf.SyslogBufferSize, syslogForwarder)
 
 				return err
 			},
@@ -149,6 +169,14 @@ func main() {
 	}()
 
 	g, ctx := errgroup.WithContext(ctx)
+	if conf.MetricsPushURL != "" {
+		mainlog.With("url", conf.MetricsPushURL, "job", conf.MetricsPushJob, "interval", conf.MetricsPushInterval.String()).Info("pushing metrics")
+		g.Go(func() error {
+			metrics.Push(ctx, mainlog.Logger, prometheus.DefaultGatherer, conf.MetricsPushURL, conf.MetricsPushJob, conf.MetricsPushInterval)
+
+			return nil
+		})
+	}
 	lg := defaultLogger(cfg.logLevel)
 	lg = lg.WithValues("service", "github.com/tinkerbell/boots")
 	lg = lg.WithName("github.com/tinkerbell/ipxedust")
@@ -168,9 +196,19 @@ func main() {
 			if ipportTFTP.Port() != 69 {
 				mainlog.With("providedPort", ipportTFTP.Port()).Fatal(fmt.Errorf("port for tftp addr must be 69"))
 			}
-			ipxe.TFTP = ipxedust.ServerSpec{
-				Addr:    ipportTFTP,
-				Timeout: cfg.ipxe.TFTPTimeout,
+			if len(conf.TFTPRoots) > 0 || conf.TFTPBlockTimeout > 0 || conf.TFTPMaxRetransmits > 0 {
+				timeout := cfg.ipxe.TFTPTimeout
+				if conf.TFTPBlockTimeout > 0 {
+					timeout = conf.TFTPBlockTimeout
+				}
+				g.Go(func() error {
+					return tftp.ListenAndServe(ctx, cfg.ipxe.TFTPAddr, timeout, conf.TFTPMaxRetransmits, conf.TFTPRoots)
+				})
+			} else {
+				ipxe.TFTP = ipxedust.ServerSpec{
+					Addr:    ipportTFTP,
+					Timeout: cfg.ipxe.TFTPTimeout,
+				}
 			}
 		}
 		nextServer = conf.PublicIPv4
@@ -207,10 +245,17 @@ func main() {
 		finder:         finder,
 		jobManager:     jobManager,
 		workflowFinder: workflowFinder,
+		eventLimiter:   newEventLimiter(conf.EventRateLimit, conf.EventRateLimitWindow),
 	}
 
+	_, httpPort, err := net.SplitHostPort(cfg.httpAddr)
+	if err != nil {
+		mainlog.Fatal(errors.Wrap(err, "invalid http-addr"))
+	}
 	dhcpServer := &BootsDHCPServer{
-		jobmanager: jobManager,
+		jobmanager:  jobManager,
+		httpPort:    httpPort,
+		ipxePattern: ipxePattern,
 	}
 
 	mainlog.With("addr", cfg.dhcpAddr).Info("serving dhcp")
@@ -220,8 +265,13 @@ func main() {
 	if err != nil {
 		mainlog.Fatal(err)
 	}
+	if conf.InstallerSelfTest {
+		httpServer.SelfTestInstallers(ctx, i)
+	}
 	mainlog.With("addr", cfg.httpAddr).Info("serving http")
-	go httpServer.ServeHTTP(i, cfg.httpAddr, ipxePattern, ipxeHandler)
+	g.Go(func() error {
+		return httpServer.ServeHTTP(ctx, i, cfg.httpAddr, ipxePattern, ipxeHandler)
+	})
 
 	<-ctx.Done()
 	mainlog.Info("boots shutting down")
@@ -231,12 +281,66 @@ func main() {
 	}
 }
 
+// initLog initializes the logger shared by mainlog and the other packages. It
+// writes JSON, or the console format when DEBUG is set, conf.LogFormat forces
+// either. log.Init only picks the format from DEBUG, which is set accordingly
+// while it runs and restored after.
+func initLog() (log.Logger, error) {
+	debug, ok := os.LookupEnv("DEBUG")
+	defer func() {
+		if ok {
+			os.Setenv("DEBUG", debug)
+		} else {
+			os.Unsetenv("DEBUG")
+		}
+	}()
+	switch conf.LogFormat {
+	case "json":
+		os.Unsetenv("DEBUG")
+	case "console":
+		os.Setenv("DEBUG", "1")
+	}
+
+	return log.Init("github.com/tinkerbell/boots")
+}
+
+// initOpenTelemetry initializes the OpenTelemetry exporter configured by the
+// OTEL_EXPORTER_OTLP_* environment variables, unless conf.OtelDisabled is set.
+func initOpenTelemetry(ctx context.Context) (context.Context, otelinit.OtelShutdown) {
+	if conf.OtelDisabled {
+		return ctx, func(context.Context) {}
+	}
+
+	return otelinit.InitOpenTelemetry(ctx, name)
+}
+
 func getFinders(l log.Logger, c *config, reporter client.Reporter) (client.WorkflowFinder, client.HardwareFinder, error) {
+	wf, hf, err := getFindersForDataModel(l, c, reporter, os.Getenv("DATA_MODEL_VERSION"))
+	if err != nil || len(conf.HardwareFinderFallbacks) == 0 {
+		return wf, hf, err
+	}
+
+	finders := []client.HardwareFinder{hf}
+	for _, dmv := range conf.HardwareFinderFallbacks {
+		if dmv == "cacher" {
+			dmv = ""
+		}
+		_, f, err := getFindersForDataModel(l, c, reporter, dmv)
+		if err != nil {
+			return nil, nil, err
+		}
+		finders = append(finders, f)
+	}
+
+	return wf, client.NewChainHardwareFinder(conf.HardwareFinderFallbackOnError, finders...), nil
+}
+
+func getFindersForDataModel(l log.Logger, c *config, reporter client.Reporter, dataModelVersion string) (client.WorkflowFinder, client.HardwareFinder, error) {
 	var hf client.HardwareFinder
 	var wf client.WorkflowFinder = &client.NoOpWorkflowFinder{}
 	var err error
 
-	switch os.Getenv("DATA_MODEL_VERSION") {
+	switch dataModelVersion {
 	case "":
 		hf, err = cacher.NewHardwareFinder(os.Getenv("FACILITY_CODE"), reporter)
 		if err != nil {
@@ -296,7 +400,44 @@ func getReporter(l log.Logger) (client.Reporter, error) {
 
 		return packet.NewReporter(l, apiBaseURL, consumer, auth)
 	default:
-		return client.NewNoOpReporter(l), nil
+		return getEventSinkReporter(l)
+	}
+}
+
+// getEventSinkReporter returns the reporter recording events to the configured
+// conf.EventSink, one doing nothing when there is none.
+func getEventSinkReporter(l log.Logger) (client.Reporter, error) {
+	switch conf.EventSink {
+	case "file":
+		if conf.EventSinkFile == "" {
+			return nil, errors.New("required envvar missing: EVENT_SINK_FILE")
+		}
+
+		return client.NewSinkReporter(l, client.NewFileSink(conf.EventSinkFile)), nil
+	case "webhook":
+		if conf.EventSinkWebhookURL == "" {
+			return nil, errors.New("required envvar missing: EVENT_SINK_WEBHOOK_URL")
+		}
+
+		return client.NewSinkReporter(l, client.NewWebhookSink(conf.EventSinkWebhookURL, conf.EventSinkWebhookTimeout)), nil
+	default:
+		return client.NewLocalReporter(l, conf.LogUnreportedEvents), nil
+	}
+}
+
+// syslogFacilityFinder resolves the facility of syslog sources through finder.
+func syslogFacilityFinder(finder client.HardwareFinder) syslog.FacilityFinder {
+	return func(ctx context.Context, ip net.IP) (string, error) {
+		d, err := finder.ByIP(ctx, ip)
+		if err != nil {
+			return "", err
+		}
+		hw := d.Hardware()
+		if hw == nil {
+			return "", errors.New("no hardware found")
+		}
+
+		return hw.HardwareFacilityCode(), nil
 	}
 }
 
@@ -476,5 +617,11 @@ func (cf *config) registerInstallers() (job.Installers, error) {
 	i.RegisterSlug("vmware_esxi_7_0_vcf", v.BootScript("vmware_esxi_7_0_vcf"))
 	i.RegisterDistro("vmware", v.BootScript("vmware"))
 
+	// register wipe for the decommission markers
+	w := wipe.Installer(extraIPXEVars)
+	for _, slug := range conf.WipeOSSlugs {
+		i.RegisterSlug(slug, w.BootScript(slug))
+	}
+
 	return i, nil
 }
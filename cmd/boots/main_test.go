@@ -1,14 +1,19 @@
 package main
 
 import (
+	"bufio"
+	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"net"
+	"os"
 	"testing"
 	"time"
 
 	"github.com/google/go-cmp/cmp"
 	"github.com/google/go-cmp/cmp/cmpopts"
+	"github.com/tinkerbell/boots/conf"
 	"github.com/tinkerbell/ipxedust"
 )
 
@@ -178,3 +183,54 @@ FLAGS
 		t.Fatal(diff)
 	}
 }
+
+func TestInitLogJSON(t *testing.T) {
+	defer func(format string) { conf.LogFormat = format }(conf.LogFormat)
+	conf.LogFormat = "json"
+	t.Setenv("DEBUG", "1")
+
+	f, err := os.CreateTemp(t.TempDir(), "log")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	stderr := os.Stderr
+	os.Stderr = f
+	l, err := initLog()
+	os.Stderr = stderr
+	if err != nil {
+		t.Fatal(err)
+	}
+	if debug := os.Getenv("DEBUG"); debug != "1" {
+		t.Errorf("DEBUG changed by initLog, want: 1, got: %q", debug)
+	}
+	l.Package("main").With("client", "10.0.0.1:42", "error", errors.New("no job")).Info("no job found for client address")
+	l.Close()
+
+	if _, err := f.Seek(0, 0); err != nil {
+		t.Fatal(err)
+	}
+	line, err := bufio.NewReader(f).ReadBytes('\n')
+	if err != nil {
+		t.Fatal(err)
+	}
+	var fields map[string]interface{}
+	if err := json.Unmarshal(line, &fields); err != nil {
+		t.Fatalf("log line is not json: %v: %s", err, line)
+	}
+	want := map[string]interface{}{
+		"level":  "info",
+		"msg":    "no job found for client address",
+		"client": "10.0.0.1:42",
+		"error":  "no job",
+		"pkg":    "main",
+	}
+	for key, value := range want {
+		if fields[key] != value {
+			t.Errorf("unexpected %q field, want: %v, got: %v", key, value, fields[key])
+		}
+	}
+	if _, ok := fields["ts"]; !ok {
+		t.Errorf("missing ts field: %s", line)
+	}
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"sync"
+	"time"
+
+	"github.com/tinkerbell/boots/job"
+)
+
+// eventLimiter limits the events a machine can have forwarded to limit per
+// window, separately for each endpoint. State is kept in memory and dropped
+// once a window has passed without events.
+type eventLimiter struct {
+	limit  int
+	window time.Duration
+	now    func() time.Time
+
+	mu        sync.Mutex
+	windows   map[string]*eventWindow
+	lastSweep time.Time
+}
+
+type eventWindow struct {
+	start time.Time
+	count int
+}
+
+func newEventLimiter(limit int, window time.Duration) *eventLimiter {
+	return &eventLimiter{
+		limit:   limit,
+		window:  window,
+		now:     time.Now,
+		windows: make(map[string]*eventWindow),
+	}
+}
+
+// allow reports whether another op event of the machine id can be forwarded.
+// A nil limiter or one with a limit below 1 allows all events.
+func (l *eventLimiter) allow(op, id string) bool {
+	if l == nil || l.limit < 1 {
+		return true
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	if now.Sub(l.lastSweep) >= l.window {
+		for key, w := range l.windows {
+			if now.Sub(w.start) >= l.window {
+				delete(l.windows, key)
+			}
+		}
+		l.lastSweep = now
+	}
+
+	key := op + "/" + id
+	w, ok := l.windows[key]
+	if !ok || now.Sub(w.start) >= l.window {
+		w = &eventWindow{start: now}
+		l.windows[key] = w
+	}
+	if w.count >= l.limit {
+		return false
+	}
+	w.count++
+
+	return true
+}
+
+// eventMachineID returns the ID events of j are limited by, its instance or
+// otherwise its hardware.
+func eventMachineID(j *job.Job) string {
+	if id := j.InstanceID(); id != "" {
+		return id
+	}
+
+	return j.HardwareID().String()
+}
+
+// packetLimiter limits the DHCP packets handled per client MAC to rate per
+// second with bursts of up to burst packets. State is kept in memory and
+// dropped once a client has been idle long enough to have a full burst again.
+type packetLimiter struct {
+	rate  float64
+	burst float64
+	now   func() time.Time
+
+	mu        sync.Mutex
+	buckets   map[string]*tokenBucket
+	lastSweep time.Time
+}
+
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+func newPacketLimiter(rate, burst int) *packetLimiter {
+	if burst < 1 {
+		burst = 1
+	}
+
+	return &packetLimiter{
+		rate:    float64(rate),
+		burst:   float64(burst),
+		now:     time.Now,
+		buckets: make(map[string]*tokenBucket),
+	}
+}
+
+// allow reports whether another packet from mac can be handled. A nil limiter
+// or one with a rate below 1 allows all packets.
+func (l *packetLimiter) allow(mac string) bool {
+	if l == nil || l.rate < 1 {
+		return true
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	refill := time.Duration(l.burst / l.rate * float64(time.Second))
+	if now.Sub(l.lastSweep) >= refill {
+		for key, b := range l.buckets {
+			if now.Sub(b.last) >= refill {
+				delete(l.buckets, key)
+			}
+		}
+		l.lastSweep = now
+	}
+
+	b, ok := l.buckets[mac]
+	if !ok {
+		b = &tokenBucket{tokens: l.burst, last: now}
+		l.buckets[mac] = b
+	}
+	b.tokens += now.Sub(b.last).Seconds() * l.rate
+	if b.tokens > l.burst {
+		b.tokens = l.burst
+	}
+	b.last = now
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+
+	return true
+}
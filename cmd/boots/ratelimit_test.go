@@ -0,0 +1,178 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gammazero/workerpool"
+	dhcp4 "github.com/packethost/dhcp4-go"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/tinkerbell/boots/client"
+	"github.com/tinkerbell/boots/job"
+	"github.com/tinkerbell/boots/metrics"
+)
+
+func TestEventLimiter(t *testing.T) {
+	now := time.Unix(0, 0)
+	l := newEventLimiter(2, time.Minute)
+	l.now = func() time.Time { return now }
+
+	for i, want := range []bool{true, true, false, false} {
+		if got := l.allow("problem", "device-1"); got != want {
+			t.Fatalf("device-1 event %d: want allowed=%v, got: %v", i, want, got)
+		}
+	}
+	if !l.allow("problem", "device-2") {
+		t.Fatal("device-2 limited by device-1 events")
+	}
+	if !l.allow("phone-home", "device-1") {
+		t.Fatal("device-1 phone-home limited by its problem events")
+	}
+
+	now = now.Add(time.Minute)
+	if !l.allow("problem", "device-1") {
+		t.Fatal("device-1 still limited after the window passed")
+	}
+	if len(l.windows) != 1 {
+		t.Fatalf("expired windows not dropped, got: %d windows", len(l.windows))
+	}
+}
+
+func TestEventLimiterDisabled(t *testing.T) {
+	var nilLimiter *eventLimiter
+	unlimited := newEventLimiter(0, time.Minute)
+	for i := 0; i < 10; i++ {
+		if !nilLimiter.allow("event", "device-1") || !unlimited.allow("event", "device-1") {
+			t.Fatalf("event %d limited without a limit", i)
+		}
+	}
+}
+
+func TestServeProblemRateLimit(t *testing.T) {
+	limiter := newEventLimiter(2, time.Hour)
+	servers := map[string]*BootsHTTPServer{}
+	for _, id := range []string{"device-1", "device-2"} {
+		mock := job.NewMock(t, "c3.small.x86", "ewr1")
+		mock.SetInstanceID(id)
+		mock.SetReporter(client.NewNoOpReporter(mainlog.Logger))
+		j := mock.Job()
+		servers[id] = &BootsHTTPServer{jobManager: tjobManager{j: &j}, eventLimiter: limiter}
+	}
+
+	problem := func(id string) int {
+		req := httptest.NewRequest("POST", "http://example.com/problem", strings.NewReader(`{"problem":"memory"}`))
+		w := httptest.NewRecorder()
+		servers[id].serveProblem(w, req)
+
+		return w.Result().StatusCode
+	}
+
+	for i, want := range []int{http.StatusOK, http.StatusOK, http.StatusTooManyRequests, http.StatusTooManyRequests} {
+		if got := problem("device-1"); got != want {
+			t.Fatalf("device-1 problem %d: unexpected response code, want: %d, got: %d", i, want, got)
+		}
+	}
+	if got := problem("device-2"); got != http.StatusOK {
+		t.Fatalf("device-2 problem: unexpected response code, want: %d, got: %d", http.StatusOK, got)
+	}
+}
+
+func TestServeEventsRateLimit(t *testing.T) {
+	limiter := newEventLimiter(1, time.Hour)
+
+	event := func(id string) int {
+		req := httptest.NewRequest("POST", "http://example.com/events", nil)
+		req.RemoteAddr = "10.0.0.1:42"
+		req.Body = ioutil.NopCloser(strings.NewReader(`{}`))
+		w := httptest.NewRecorder()
+		code, _ := serveEvents(tclient{id: id}, limiter, w, req)
+		if got := w.Result().StatusCode; got != code {
+			t.Fatalf("returned code %d does not match response code %d", code, got)
+		}
+
+		return code
+	}
+
+	if got := event("device-1"); got != http.StatusOK {
+		t.Fatalf("device-1 first event: unexpected response code, want: %d, got: %d", http.StatusOK, got)
+	}
+	if got := event("device-1"); got != http.StatusTooManyRequests {
+		t.Fatalf("device-1 second event: unexpected response code, want: %d, got: %d", http.StatusTooManyRequests, got)
+	}
+	if got := event("device-2"); got != http.StatusOK {
+		t.Fatalf("device-2 event: unexpected response code, want: %d, got: %d", http.StatusOK, got)
+	}
+}
+
+// dhcpJobManager records the MACs jobs are created for.
+type dhcpJobManager struct {
+	tjobManager
+	mu   sync.Mutex
+	macs map[string]int
+}
+
+func (m *dhcpJobManager) CreateFromDHCP(ctx context.Context, mac net.HardwareAddr, _ net.IP, _, _ string) (context.Context, *job.Job, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.macs[mac.String()]++
+
+	return ctx, nil, errors.New("no job")
+}
+
+func TestDHCPRateLimit(t *testing.T) {
+	now := time.Unix(0, 0)
+	limiter := newPacketLimiter(1, 5)
+	limiter.now = func() time.Time { return now }
+	jm := &dhcpJobManager{macs: make(map[string]int)}
+	d := dhcpHandler{pool: workerpool.New(2), jobmanager: jm, limiter: limiter}
+
+	packet := func(mac string) *dhcp4.Packet {
+		p := dhcp4.NewPacket(dhcp4.BootRequest)
+		hw, _ := net.ParseMAC(mac)
+		p.HLen()[0] = byte(len(hw))
+		copy(p.CHAddr(), hw)
+		p.SetMessageType(dhcp4.MessageTypeDiscover)
+
+		return &p
+	}
+
+	before := testutil.ToFloat64(metrics.DHCPRateLimited)
+	for i := 0; i < 50; i++ {
+		d.ServeDHCP(nil, packet("00:00:ba:dd:be:ef"))
+	}
+	d.ServeDHCP(nil, packet("00:00:ba:dd:be:f0"))
+	now = now.Add(2 * time.Second)
+	d.ServeDHCP(nil, packet("00:00:ba:dd:be:ef"))
+	d.pool.StopWait()
+
+	if got := jm.macs["00:00:ba:dd:be:ef"]; got != 6 {
+		t.Fatalf("unexpected packets handled from the flooding client, want: 6, got: %d", got)
+	}
+	if got := jm.macs["00:00:ba:dd:be:f0"]; got != 1 {
+		t.Fatalf("other client not served, got: %d packets handled", got)
+	}
+	if got := testutil.ToFloat64(metrics.DHCPRateLimited) - before; got != 45 {
+		t.Fatalf("unexpected dhcp_rate_limited_total increase, want: 45, got: %v", got)
+	}
+}
+
+func TestPacketLimiterUnlimited(t *testing.T) {
+	var l *packetLimiter
+	if !l.allow("00:00:ba:dd:be:ef") {
+		t.Fatal("nil limiter dropped a packet")
+	}
+	l = newPacketLimiter(0, 10)
+	for i := 0; i < 100; i++ {
+		if !l.allow("00:00:ba:dd:be:ef") {
+			t.Fatal("limiter without a rate dropped a packet")
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"crypto/tls"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// certCheckInterval is how often handshakes check the certificate files for changes.
+const certCheckInterval = time.Second
+
+// certReloader serves the certificate of certFile and keyFile to TLS
+// handshakes, reloading it when either file changes on disk so certificates
+// are rotated without restarting boots.
+type certReloader struct {
+	certFile, keyFile string
+
+	mu       sync.Mutex
+	cert     *tls.Certificate
+	modTimes [2]time.Time
+	checked  time.Time
+}
+
+func newCertReloader(certFile, keyFile string) (*certReloader, error) {
+	r := &certReloader{certFile: certFile, keyFile: keyFile}
+	modTimes, err := r.stat()
+	if err != nil {
+		return nil, err
+	}
+	if err := r.load(modTimes); err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+// stat returns the modification times of the certificate and key files.
+func (r *certReloader) stat() ([2]time.Time, error) {
+	var modTimes [2]time.Time
+	for i, name := range []string{r.certFile, r.keyFile} {
+		fi, err := os.Stat(name)
+		if err != nil {
+			return modTimes, errors.Wrap(err, "stat tls certificate")
+		}
+		modTimes[i] = fi.ModTime()
+	}
+
+	return modTimes, nil
+}
+
+func (r *certReloader) load(modTimes [2]time.Time) error {
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return errors.Wrap(err, "load tls certificate")
+	}
+	r.cert, r.modTimes = &cert, modTimes
+
+	return nil
+}
+
+// GetCertificate returns the certificate to use for a handshake, reloaded
+// first when its files changed. A failing reload keeps the previous one.
+func (r *certReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if now := time.Now(); now.Sub(r.checked) >= certCheckInterval {
+		r.checked = now
+		modTimes, err := r.stat()
+		if err == nil && modTimes != r.modTimes {
+			err = r.load(modTimes)
+			if err == nil {
+				mainlog.With("cert", r.certFile).Info("reloaded tls certificate")
+			}
+		}
+		if err != nil {
+			mainlog.Error(errors.WithMessage(err, "serving the previous tls certificate"))
+		}
+	}
+
+	return r.cert, nil
+}
+
+// tlsConfig returns the TLS configuration of the HTTPS server, serving the
+// certificate of certFile and keyFile as it changes on disk.
+func tlsConfig(certFile, keyFile string, minVersion uint16) (*tls.Config, error) {
+	r, err := newCertReloader(certFile, keyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	return &tls.Config{MinVersion: minVersion, GetCertificate: r.GetCertificate}, nil
+}
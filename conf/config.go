@@ -1,7 +1,10 @@
 package conf
 
 import (
+	"crypto/tls"
 	"net"
+	"net/textproto"
+	"net/url"
 	"os"
 	"strings"
 	"time"
@@ -17,18 +20,368 @@ var (
 	PublicSyslogIPv4 = mustPublicSyslogIPv4()
 	PublicSyslogFQDN = env.Get("PUBLIC_SYSLOG_FQDN", PublicSyslogIPv4.String())
 
+	// Public address and FQDN of boots for machines in a facility, comma separated
+	// lists of facility:value entries, e.g. "sjc1:boots.sjc1.example.com".
+	// See PublicFQDNFor.
+	FacilityPublicIPv4s = getFacilityPublicIPv4s()
+	FacilityPublicFQDNs = getFacilityValues("FACILITY_PUBLIC_FQDNS")
+
 	SyslogBind = env.Get("SYSLOG_BIND", PublicIPv4.String()+":514")
 	HTTPBind   = env.Get("HTTP_BIND", PublicIPv4.String()+":80")
 	BOOTPBind  = env.Get("BOOTP_BIND", PublicIPv4.String()+":67")
 
+	// Directories searched in order for files requested over TFTP, before the embedded iPXE binaries.
+	TFTPRoots = getTFTPRoots()
+	// Time the TFTP server waits for the ack of a block before sending it again,
+	// at most TFTPMaxRetransmits times. 0 keeps the -ipxe-tftp-timeout timeout
+	// and 5 retransmits. Either one being set serves TFTP with the boots server
+	// instead of the ipxedust one.
+	TFTPBlockTimeout   = mustTFTPBlockTimeout()
+	TFTPMaxRetransmits = mustTFTPMaxRetransmits()
+
+	// Syslog messages are queued for up to SyslogWorkers parsers, messages
+	// arriving while SyslogBufferSize are already queued are dropped.
+	SyslogWorkers    = env.Int("SYSLOG_WORKERS", 1)
+	SyslogBufferSize = env.Int("SYSLOG_BUFFER_SIZE", 1024)
+	// Collectors (host:port) syslog messages are forwarded to by the facility of
+	// the machine sending them, and for machines of other or unknown facilities.
+	SyslogForwardFacilities = getFacilityValues("SYSLOG_FORWARD_FACILITIES")
+	SyslogForwardDefault    = env.Get("SYSLOG_FORWARD_DEFAULT")
+
 	// Default to Google Public DNS.
 	DHCPLeaseTime = env.Duration("DHCP_LEASE_TIME", (2 * 24 * time.Hour))
 	DNSServers    = ParseIPv4s(env.Get("DNS_SERVERS", "8.8.8.8,8.8.4.4"))
+	// DHCP renewal (T1, option 58) and rebinding (T2, option 59) times, default
+	// to 0.5 and 0.875 of the lease time. See DHCPRenewalTimes.
+	DHCPRenewalTime, DHCPRebindingTime = mustDHCPRenewalTimes()
+	// Hand the boot script instead of the Tinkerbell iPXE binary to clients already
+	// running a stock iPXE (user-class "iPXE"), rather than chainloading iPXE again.
+	IPXEUserClassScript = env.Bool("DHCP_IPXE_USER_CLASS_SCRIPT", false)
+	// Values of DHCP options 66 (TFTP server name) and 67 (bootfile name),
+	// default to the next server address and the boot file of the reply. The
+	// bootfile name only replaces the one of replies to PXE firmware, iPXE and
+	// HTTP Boot clients prefer option 67 over the file field.
+	DHCPServerName   = env.Get("DHCP_TFTP_SERVER_NAME")
+	DHCPBootfileName = env.Get("DHCP_BOOTFILE_NAME")
+	// Hand firmware HTTP Boot clients the TFTP path of the iPXE binary in the
+	// file field, their HTTP URL staying in option 67, for firmware falling back
+	// to TFTP from the next server when HTTP Boot fails.
+	DHCPHTTPBootTFTPFallback = env.Bool("DHCP_HTTP_BOOT_TFTP_FALLBACK", false)
+	// Extra routes handed out as DHCP classless static routes (option 121).
+	DHCPStaticRoutes = mustStaticRoutes()
+	// Whether replies honor the broadcast flag of the request (respect-flag),
+	// are always broadcast (always-broadcast) or ignore the flag (always-unicast).
+	// Replies to relayed requests always go to the relay, and replies to clients
+	// without an address yet are broadcast regardless.
+	DHCPReplyBroadcast = getDHCPReplyBroadcast()
+	// Packets per second handled from a single client MAC, with bursts of up
+	// to DHCPRateLimitBurst, excess packets are dropped. 0 means no limit.
+	DHCPRateLimit      = env.Int("DHCP_RATE_LIMIT", 0)
+	DHCPRateLimitBurst = env.Int("DHCP_RATE_LIMIT_BURST", 10)
+	// Address of boots for machines of relayed subnets, handed out as the next
+	// server and the host auto.ipxe is chained from to requests whose relay
+	// address (giaddr) is in the subnet. See ParseDHCPSubnets and DHCPSubnetFor.
+	DHCPSubnets = mustDHCPSubnets()
 
 	ignoredOUIs = getIgnoredMACs()
 	ignoredGIs  = getIgnoredGIs()
 
+	// Installers, by the name they are registered under, that are disabled or
+	// only allowed in some facilities.
+	DisabledInstallers  = getDisabledInstallers()
+	InstallerFacilities = getInstallerFacilities()
+	// Serve an iPXE script explaining that the installer is unavailable and
+	// rebooting after InstallerUnavailableRebootDelay, instead of a 404. Any
+	// {installer} in InstallerUnavailableMessage is replaced by its name.
+	InstallerUnavailableScript      = env.Bool("INSTALLER_UNAVAILABLE_SCRIPT", false)
+	InstallerUnavailableMessage     = env.Get("INSTALLER_UNAVAILABLE_MESSAGE", "installer {installer} is temporarily unavailable, contact ops")
+	InstallerUnavailableRebootDelay = env.Duration("INSTALLER_UNAVAILABLE_REBOOT_DELAY", 5*time.Minute)
+	// Serve an iPXE script holding machines allowed to PXE boot that have no
+	// operating system and no active workflow yet: it phones home "waiting" and
+	// reboots after AwaitingConfigRetryDelay to try again, instead of booting
+	// the default operating system.
+	AwaitingConfigScript     = env.Bool("AWAITING_CONFIG_SCRIPT", false)
+	AwaitingConfigMessage    = env.Get("AWAITING_CONFIG_MESSAGE", "waiting for an operating system or workflow to be assigned")
+	AwaitingConfigRetryDelay = env.Duration("AWAITING_CONFIG_RETRY_DELAY", time.Minute)
+	// Let machines whose instance CustomData "boot.installers" lists several
+	// installers boot a different one at a time: the "boot.installer" one set
+	// by an admin or else the one selected from an iPXE menu, shown for
+	// InstallerMenuTimeout and POSTed back to auto.ipxe, defaulting to the first.
+	InstallerMenu        = env.Bool("INSTALLER_MENU", false)
+	InstallerMenuTimeout = env.Duration("INSTALLER_MENU_TIMEOUT", 10*time.Second)
+	// Render the boot script of every enabled installer for a synthetic job on
+	// startup, logging failures. Boots never becomes ready if one of the
+	// InstallerSelfTestCritical installers fails.
+	InstallerSelfTest         = env.Bool("INSTALLER_SELF_TEST", false)
+	InstallerSelfTestCritical = getInstallerSelfTestCritical()
+	// How the VMware installer matches the boot drive hint against disks,
+	// one of exact, prefix, substring or serial. serial installs onto the one
+	// disk whose device name holds the hint as a whole token, failing the
+	// install unless exactly one disk does.
+	VMwareBootDriveHintMatch = getBootDriveHintMatch()
+
+	// Log format, json or console, defaults to json unless DEBUG is set.
+	LogFormat = getLogFormat()
+	// Log fields, matched case-insensitively, whose values are masked in the
+	// logs of boots and its jobs, comma separated, in addition to
+	// defaultLogRedactFields.
+	LogRedactFields = getLogRedactFields()
+
 	TrustedProxies = parseTrustedProxies()
+	// Hostnames, IPs and CIDRs the iPXE script URLs machines are chained to must
+	// point at, e.g. "boot.example.com,10.0.0.0/8". Empty allows any host. The
+	// osie base URL and flatcar boot slots of machines are held to it too, and
+	// inline custom iPXE scripts are refused while it is set.
+	ChainAllowedHosts = getChainAllowedHosts()
+	// Serve the iPXE binaries over HTTP to any client, instead of only to
+	// machines whose hardware record allows them to PXE boot.
+	IPXEBinariesSkipAllowPXE = env.Bool("HTTP_IPXE_BINARIES_SKIP_ALLOW_PXE", false)
+	// Disable OpenTelemetry: no exporter is initialized and HTTP handlers are
+	// served without the otelhttp instrumentation.
+	OtelDisabled = env.Bool("OTEL_DISABLED", false)
+	// Log the raw remote address, X-Forwarded-For chain and resolved client address of requests.
+	LogXFF = env.Bool("HTTP_LOG_XFF", false)
+	// Maximum number of concurrent HTTP connections, over HTTP and HTTPS
+	// together, connections accepted beyond it are closed right away. 0 means
+	// no limit.
+	HTTPMaxConns = env.Int("HTTP_MAX_CONNS", 0)
+	// Also serve the HTTP routes over HTTPS on HTTPSBind, empty only serves
+	// HTTP, with the PEM certificate and key of HTTPSCertFile and HTTPSKeyFile,
+	// reloaded when they change on disk. HTTPSMinVersion is the minimum TLS
+	// version accepted, from 1.0 to 1.3.
+	HTTPSBind       = env.Get("HTTPS_BIND")
+	HTTPSCertFile   = env.Get("HTTPS_CERT_FILE")
+	HTTPSKeyFile    = env.Get("HTTPS_KEY_FILE")
+	HTTPSMinVersion = mustHTTPSMinVersion()
+	// Methods allowed on HTTP routes, a semicolon separated list of route:methods
+	// entries overriding the defaults of the route, e.g.
+	// "/auto.ipxe:GET;/problem:POST,PUT". Other methods get a 405.
+	HTTPRouteMethods = getSemicolonValues("HTTP_ROUTE_METHODS")
+	// Stop serving boot files once the hardware or workflow finder has been
+	// failing for BackendOutageTimeout since its last success, responding 503
+	// or, with BackendOutageScript, an iPXE script rebooting the machine after
+	// BackendOutageRetryDelay. Serving resumes on the next successful call.
+	// 0 never stops serving.
+	BackendOutageTimeout    = env.Duration("BACKEND_OUTAGE_TIMEOUT", 0)
+	BackendOutageScript     = env.Bool("BACKEND_OUTAGE_SCRIPT", false)
+	BackendOutageRetryDelay = env.Duration("BACKEND_OUTAGE_RETRY_DELAY", time.Minute)
+	// On shutdown /readyz fails for HTTPDrainDelay while requests are still
+	// served, then in-flight requests get up to HTTPShutdownTimeout to finish.
+	HTTPDrainDelay      = env.Duration("HTTP_DRAIN_DELAY", 0)
+	HTTPShutdownTimeout = env.Duration("HTTP_SHUTDOWN_TIMEOUT", 10*time.Second)
+	// Also fail /readyz when the hardware backend, probed by looking
+	// ReadyzProbeIP up, or the reporter can not be reached within
+	// ReadyzProbeTimeout. Hardware not found counts as reachable.
+	ReadyzProbeBackends = env.Bool("READYZ_PROBE_BACKENDS", false)
+	ReadyzProbeIP       = net.ParseIP(env.Get("READYZ_PROBE_IP", "0.0.0.0"))
+	ReadyzProbeTimeout  = env.Duration("READYZ_PROBE_TIMEOUT", 2*time.Second)
+	// Maximum number of /events, /phone-home and /problem requests forwarded per
+	// machine and endpoint within EventRateLimitWindow, 0 means no limit.
+	EventRateLimit       = env.Int("EVENT_RATE_LIMIT", 0)
+	EventRateLimitWindow = env.Duration("EVENT_RATE_LIMIT_WINDOW", time.Minute)
+	// Where the events, phone-homes and problems of machines are recorded when
+	// not reporting them to the Packet API: nowhere (""), appended to the file
+	// EventSinkFile (file) or POSTed to EventSinkWebhookURL (webhook).
+	EventSink               = getEventSink()
+	EventSinkFile           = env.Get("EVENT_SINK_FILE")
+	EventSinkWebhookURL     = env.Get("EVENT_SINK_WEBHOOK_URL")
+	EventSinkWebhookTimeout = env.Duration("EVENT_SINK_WEBHOOK_TIMEOUT", 5*time.Second)
+	// Log the events, phone-homes and problems of machines when there is no
+	// reporter configured to forward them to, they are dropped silently otherwise.
+	LogUnreportedEvents = env.Bool("LOG_UNREPORTED_EVENTS", false)
+	// Add the hardware serial number and asset tag, when known, to forwarded
+	// events and problems as hardware_serial and hardware_asset_tag.
+	EventFingerprint = env.Bool("EVENT_FINGERPRINT", false)
+	// Names of the request headers copied into the events forwarded from /events,
+	// as a headers object, e.g. "X-Trace-Id,X-Agent-Version". Headers missing
+	// from a request are skipped.
+	EventForwardHeaders = getEventForwardHeaders()
+	// Embed a nonce tied to the machine in served boot scripts as the boots_nonce
+	// iPXE variable, /phone-home and /problem requests without an unexpired one
+	// are refused, so stale cached scripts stop working after IPXENonceTTL. The
+	// osie, flatcar, vmware and wipe installers pass it on to the booted OS.
+	IPXENonce    = env.Bool("IPXE_NONCE", false)
+	IPXENonceTTL = env.Duration("IPXE_NONCE_TTL", time.Hour)
+	// Number of times served boot scripts try fetching each kernel, initrd and
+	// chained script before dropping to the iPXE shell, waiting
+	// IPXEFetchRetryDelay between attempts.
+	IPXEFetchAttempts   = env.Int("IPXE_FETCH_ATTEMPTS", 1)
+	IPXEFetchRetryDelay = env.Duration("IPXE_FETCH_RETRY_DELAY", 5*time.Second)
+	// Echo each boot stage, such as fetching the kernel or chaining an
+	// installer, to the console from served boot scripts.
+	IPXEVerbose = env.Bool("IPXE_VERBOSE", false)
+	// Respond 200 instead of 404 to /problem requests that have no job or active workflow to report to.
+	ProblemAlwaysOK = env.Bool("HTTP_PROBLEM_ALWAYS_OK", false)
+
+	// Credentials required to scrape /metrics and the pprof endpoints, either
+	// a bearer token or basic auth. Neither being set leaves them open.
+	MetricsAuthToken    = env.Get("METRICS_AUTH_TOKEN")
+	MetricsAuthUsername = env.Get("METRICS_AUTH_USERNAME")
+	MetricsAuthPassword = env.Get("METRICS_AUTH_PASSWORD")
+
+	// Label the job metrics with the facility of the job, multiplying their
+	// cardinality by the number of facilities served. jobs_total counts jobs
+	// as they start, before their facility is known, so always under
+	// "unknown"; jobs_completed_total carries the facility.
+	MetricsFacilityLabel = env.Bool("METRICS_FACILITY_LABEL", false)
+
+	// Prometheus Pushgateway the metrics served on /metrics are also pushed
+	// to every MetricsPushInterval, grouped under the MetricsPushJob job, for
+	// networks Prometheus can not scrape. Empty only serves /metrics.
+	MetricsPushURL      = env.Get("METRICS_PUSH_URL")
+	MetricsPushJob      = env.Get("METRICS_PUSH_JOB", "boots")
+	MetricsPushInterval = mustMetricsPushInterval()
+
+	// Upper bound of the random delay applied before looking up the hardware of
+	// an HTTP request, spreads the backend load of machines booting together.
+	LookupJitter = env.Duration("LOOKUP_JITTER", 0)
+
+	// What to do when more than one hardware record matches the address of a
+	// machine: refuse to serve it (error) or use the record with the lowest ID
+	// (lowest-id). Both log the IDs of the records.
+	HardwareConflictPolicy = getHardwareConflictPolicy()
+	// Share one backend lookup between the concurrent DHCP or HTTP requests of
+	// a machine looking its hardware up by the same MAC or IP.
+	CoalesceHardwareLookups = env.Bool("COALESCE_HARDWARE_LOOKUPS", false)
+	// Time a shared lookup has to answer, apart from the requests waiting on it.
+	HardwareLookupTimeout = env.Duration("HARDWARE_LOOKUP_TIMEOUT", 10*time.Second)
+	// Look DHCP clients up by the SMBIOS uuid of their option 97 before their
+	// MAC, for machines sharing a MAC such as cloned VMs or replaced NICs.
+	DHCPUUIDFirst = env.Bool("DHCP_UUID_FIRST", false)
+
+	// Whether machines whose hardware record has no allow_pxe field for the
+	// interface they boot from may PXE boot.
+	AllowPXEDefault = env.Bool("ALLOW_PXE_DEFAULT", false)
+	// For how long after boots first sees a machine no longer allowed to PXE
+	// boot it is served an iPXE script telling it is halting and exiting to
+	// the next boot device, instead of a 404 that machines mid-retry report as
+	// a failure. 0 always responds 404.
+	AllowPXEGracePeriod = env.Duration("ALLOW_PXE_GRACE_PERIOD", 0)
+
+	// Operating system used to pick the installer of machines whose hardware record has none.
+	DefaultOSSlug   = env.Get("DEFAULT_OS_SLUG")
+	DefaultOSDistro = env.Get("DEFAULT_OS_DISTRO")
+
+	// Crypted root password of vmware installs whose instance has neither a
+	// password nor a rootpwcrypt CustomData field, a comma separated list of
+	// facility:crypt entries and the one for other facilities.
+	// See RootPasswordCryptFor.
+	FacilityRootPasswordCrypts = getFacilityValues("FACILITY_ROOTPW_CRYPTS")
+	DefaultRootPasswordCrypt   = env.Get("DEFAULT_ROOTPW_CRYPT")
+	// Refuse vmware installs left without any root password: their boot script
+	// drops to the iPXE shell and their kickstart is not rendered.
+	VMwareRequireRootPassword = env.Bool("VMWARE_REQUIRE_ROOTPW", false)
+
+	// Top level instance CustomData keys installers honor, a comma separated
+	// list, e.g. "os_version,rootpwcrypt". Other keys are ignored and logged
+	// when the job is created. Empty honors every key.
+	CustomDataKeys = getCustomDataKeys()
+
+	// Emit the extra iPXE variables of the custom iPXE installer once per name,
+	// keeping the last value, and/or sorted by name instead of in flag order.
+	IPXEVarsDedup = env.Bool("IPXE_VARS_DEDUP", false)
+	IPXEVarsSort  = env.Bool("IPXE_VARS_SORT", false)
+	// packet_plan value of custom iPXE scripts of hardware without a plan slug,
+	// the variable is left unset when empty.
+	CustomIPXEEmptyPlan = env.Get("CUSTOM_IPXE_EMPTY_PLAN")
+	// Boot scripts larger than this many bytes, which some firmware can not
+	// handle, are replaced by one dropping to the iPXE shell, 0 means no limit.
+	IPXEScriptMaxSize = env.Int("IPXE_SCRIPT_MAX_SIZE", 1<<20)
+	// Path of a PEM encoded PKCS#8 RSA private key signing the iPXE boot scripts
+	// served, and of its PEM encoded code signing certificate chain, signer
+	// first. The CMS signature of the last <name>.ipxe served to a machine is
+	// served at <name>.ipxe.sig, for the iPXE imgverify command, and the chain
+	// at /ipxe-signing-key. Empty disables signing.
+	IPXEScriptSigningKey  = env.Get("IPXE_SCRIPT_SIGNING_KEY")
+	IPXEScriptSigningCert = env.Get("IPXE_SCRIPT_SIGNING_CERT")
+	// How long the signature of a boot script stays available after the
+	// script is served, machines fetch it right after the script.
+	IPXEScriptSignatureTTL = env.Duration("IPXE_SCRIPT_SIGNATURE_TTL", 10*time.Minute)
+
+	// Serve EC2-style instance metadata to machines under /2009-04-04/.
+	ServeMetadata = env.Bool("HTTP_METADATA", false)
+	// Serve the instance userdata verbatim as the metadata user-data, instead of a generated cloud-config.
+	MetadataRawUserData = env.Bool("HTTP_METADATA_RAW_USERDATA", false)
+	// Serve machines a cloud-init network-config configuring their interfaces
+	// statically with their address under /network-config.
+	ServeNetworkConfig = env.Bool("HTTP_NETWORK_CONFIG", false)
+	// Serve machines the SSH public keys of their instance, one per line, under /ssh-keys.
+	ServeSSHKeys = env.Bool("HTTP_SSH_KEYS", false)
+	// Accept reports of the operating system installed machines run under
+	// /verify, posting an event when it is not the one served.
+	ServeVerify = env.Bool("HTTP_VERIFY", false)
+
+	// Serve the generated configs of a list of machines under /_packet/export,
+	// behind the metrics credentials, at most ExportMaxMachines per request.
+	// It is not served when no metrics credentials are configured.
+	ServeExport       = env.Bool("HTTP_EXPORT", false)
+	ExportMaxMachines = env.Int("HTTP_EXPORT_MAX_MACHINES", 50)
+
+	// Hardware backends, named by their DATA_MODEL_VERSION ("cacher" for the default one),
+	// to query in order when the primary backend does not find a machine.
+	HardwareFinderFallbacks = getHardwareFinderFallbacks()
+	// Query the fallback backends on errors other than not found instead of failing the lookup.
+	HardwareFinderFallbackOnError = env.Bool("HARDWARE_FINDER_FALLBACK_ON_ERROR", false)
+	// Reuse hardware found by the backends for HardwareCacheTTL before looking it
+	// up again, 0 disables the cache. While the backends fail, cached hardware
+	// keeps being served, logged and counted as stale, until it is
+	// HardwareCacheMaxAge old, then lookups fail and boot files are answered
+	// with a 503 instead of a very stale record. Without
+	// HardwareCacheServeStale lookups fail as soon as the backends do. At most
+	// HardwareCacheMaxEntries lookups are cached, the oldest evicted first, 0
+	// means no limit.
+	HardwareCacheTTL        = env.Duration("HARDWARE_CACHE_TTL", 0)
+	HardwareCacheMaxAge     = env.Duration("HARDWARE_CACHE_MAX_AGE", 24*time.Hour)
+	HardwareCacheServeStale = env.Bool("HARDWARE_CACHE_SERVE_STALE", true)
+	HardwareCacheMaxEntries = env.Int("HARDWARE_CACHE_MAX_ENTRIES", 10000)
+
+	// Scheme forced on the OSIE and installer artifact URLs of machines in a facility,
+	// a comma separated list of facility:scheme entries, e.g. "ewr1:http".
+	OsieURLSchemes = getOsieURLSchemes()
+
+	// Kernel console of flatcar installs on arm machines by facility or plan, a
+	// semicolon separated list of facility:console or plan:console entries, e.g.
+	// "sjc1:ttyS0,115200;c3.large.arm:ttyAMA0,115200". See FlatcarARMConsoleFor.
+	FlatcarARMConsoles = getFlatcarARMConsoles()
+
+	// Default OS version of installers by facility, used over the version of
+	// the OS slug unless the instance pins one, a semicolon separated list of
+	// facility:distro=version,... entries, e.g.
+	// "ewr1:flatcar=stable,vmware=7.0U2a;sjc1:flatcar=lts".
+	FacilityOSVersions = getFacilityOSVersions()
+
+	// Facility of machines whose hardware record has none, by the network of
+	// their address, a comma separated list of cidr=facility entries, e.g.
+	// "10.0.0.0/16=ewr1,10.1.0.0/16=sjc1". The most specific network wins.
+	FacilityNetworks = getFacilityNetworks()
+	// Add a random comment to the install.service unit of every served flatcar
+	// ignition config, so caches between boots and machines never hand out a
+	// previous config. Ignition configs are always served with Cache-Control: no-store.
+	FlatcarIgnitionCacheBust = env.Bool("FLATCAR_IGNITION_CACHE_BUST", false)
+	// Merge the generated flatcar ignition config into the one at the instance
+	// CustomData "flatcar.ignition_url". The URL is only fetched when
+	// CHAIN_ALLOWED_HOSTS is set, and must point at one of its hosts.
+	FlatcarRemoteIgnition = env.Bool("FLATCAR_REMOTE_IGNITION", false)
+
+	// Extra kernel args of the osie and flatcar installers by plan, a semicolon
+	// separated list of plan:args entries, e.g.
+	// "c3.large.arm:iommu.passthrough=1;m3.large.x86:hugepages=16 default_hugepagesz=1G".
+	PlanKernelArgs = getSemicolonValues("PLAN_KERNEL_ARGS")
+	// Kernel log level, 0 to 7, osie boots with unless the instance CustomData
+	// of the machine overrides it, empty leaves the kernel default.
+	OSIELogLevel = mustOSIELogLevel()
+
+	// systemctl action ending flatcar installs, one of reboot, poweroff or halt.
+	FlatcarPostInstallAction = getFlatcarPostInstallAction()
+
+	// Content installers fetch from URLs in the metadata of machines, such as
+	// the flatcar ignition_url, must be served over one of RemoteFetchSchemes by
+	// a host allowed by CHAIN_ALLOWED_HOSTS, within RemoteFetchTimeout and be at
+	// most RemoteFetchMaxSize bytes. Nothing is fetched while CHAIN_ALLOWED_HOSTS
+	// is empty, and internal addresses only when it lists them by address.
+	RemoteFetchSchemes = getRemoteFetchSchemes()
+	RemoteFetchTimeout = env.Duration("REMOTE_FETCH_TIMEOUT", 10*time.Second)
+	RemoteFetchMaxSize = int64(env.Int("REMOTE_FETCH_MAX_SIZE", 1<<20))
 
 	// Hollow auth secrets, passed into osie.
 	HollowClientID            = env.Get("HOLLOW_CLIENT_ID")
@@ -36,6 +389,30 @@ var (
 
 	// Vendor services url, used by osie to proxy requests for OS image artifacts.
 	OsieVendorServicesURL = env.Get("OSIE_VENDOR_SERVICES_URL")
+	// Configure net0, the first iPXE network device, of machines booting osie
+	// with the address of their hardware record before fetching its artifacts.
+	OsieStaticNetwork = env.Bool("OSIE_STATIC_NETWORK", false)
+	// Also fail /readyz when OsieVendorServicesURL can not be reached within
+	// OsieMirrorProbeTimeout.
+	OsieMirrorProbe        = env.Bool("OSIE_MIRROR_PROBE", false)
+	OsieMirrorProbeTimeout = env.Duration("OSIE_MIRROR_PROBE_TIMEOUT", 2*time.Second)
+	// Keep the last TimelineSize DHCP, TFTP and HTTP interactions with each of
+	// up to TimelineMachines machines, served by /_packet/timeline. 0 disables
+	// the timeline.
+	TimelineSize     = env.Int("TIMELINE_SIZE", 0)
+	TimelineMachines = env.Int("TIMELINE_MACHINES", 1024)
+	// Keep up to RenderCacheSize rendered kickstart and ignition configs for
+	// RenderCacheTTL, served again to jobs with the same render key. 0 disables
+	// the cache.
+	RenderCacheSize = env.Int("RENDER_CACHE_SIZE", 0)
+	RenderCacheTTL  = env.Duration("RENDER_CACHE_TTL", 30*time.Second)
+
+	// Machines whose OS slug is one of WipeOSSlugs are being decommissioned and
+	// boot the wipe environment at WipeImageURL, MirrorBaseURL/misc/wipe by
+	// default, which erases their disks with the first of WipeMethods that works.
+	WipeOSSlugs  = getWipeOSSlugs()
+	WipeImageURL = env.Get("WIPE_IMAGE_URL")
+	WipeMethods  = env.Get("WIPE_METHODS", "nvme-format,blkdiscard,ata-secure-erase")
 )
 
 func mustPublicIPv4() net.IP {
@@ -67,6 +444,79 @@ func mustPublicIPv4() net.IP {
 	panic(err)
 }
 
+// getFacilityValues parses the comma separated list of facility:value entries
+// in the environment variable name. Values may contain colons, e.g. host:port.
+func getFacilityValues(name string) map[string]string {
+	entries := os.Getenv(name)
+	if entries == "" {
+		return nil
+	}
+
+	m := make(map[string]string)
+	for _, entry := range strings.Split(entries, ",") {
+		parts := strings.SplitN(strings.TrimSpace(entry), ":", 2)
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			panic("invalid entry in " + name + " entry=" + entry)
+		}
+		m[parts[0]] = parts[1]
+	}
+
+	return m
+}
+
+func getFacilityPublicIPv4s() map[string]net.IP {
+	values := getFacilityValues("FACILITY_PUBLIC_IPV4S")
+	if values == nil {
+		return nil
+	}
+
+	m := make(map[string]net.IP, len(values))
+	for facility, value := range values {
+		ip := net.ParseIP(value).To4()
+		if ip == nil {
+			panic("invalid ipv4 address in FACILITY_PUBLIC_IPV4S ip=" + value)
+		}
+		m[facility] = ip
+	}
+
+	return m
+}
+
+// PublicIPv4For returns the public address of boots for machines in facility,
+// PublicIPv4 unless FACILITY_PUBLIC_IPV4S has one for it.
+func PublicIPv4For(facility string) net.IP {
+	if ip, ok := FacilityPublicIPv4s[facility]; ok {
+		return ip
+	}
+
+	return PublicIPv4
+}
+
+// PublicFQDNFor returns the public FQDN of boots for machines in facility,
+// the FACILITY_PUBLIC_FQDNS or FACILITY_PUBLIC_IPV4S entry of the facility
+// and otherwise PublicFQDN.
+func PublicFQDNFor(facility string) string {
+	if fqdn, ok := FacilityPublicFQDNs[facility]; ok {
+		return fqdn
+	}
+	if ip, ok := FacilityPublicIPv4s[facility]; ok {
+		return ip.String()
+	}
+
+	return PublicFQDN
+}
+
+// RootPasswordCryptFor returns the crypted root password installs in facility
+// fall back to, the FACILITY_ROOTPW_CRYPTS entry of the facility and otherwise
+// DefaultRootPasswordCrypt.
+func RootPasswordCryptFor(facility string) string {
+	if crypt, ok := FacilityRootPasswordCrypts[facility]; ok {
+		return crypt
+	}
+
+	return DefaultRootPasswordCrypt
+}
+
 func mustPublicSyslogIPv4() net.IP {
 	if s, ok := os.LookupEnv("PUBLIC_SYSLOG_IP"); ok {
 		if a := net.ParseIP(s).To4(); a != nil {
@@ -91,6 +541,139 @@ func ParseIPv4s(str string) (ips []net.IP) {
 	return
 }
 
+// StaticRoute is a route to Destination through Router, handed out to DHCP clients.
+type StaticRoute struct {
+	Destination *net.IPNet
+	Router      net.IP
+}
+
+// ParseStaticRoutes parses a comma separated list of destination:router
+// routes, e.g. "10.10.0.0/16:192.168.1.1,10.20.0.0/16:192.168.1.2".
+func ParseStaticRoutes(str string) ([]StaticRoute, error) {
+	var routes []StaticRoute
+	for _, s := range strings.Split(str, ",") {
+		s = strings.TrimSpace(s)
+		if s == "" {
+			continue
+		}
+		parts := strings.Split(s, ":")
+		if len(parts) != 2 {
+			return nil, errors.Errorf("invalid static route %q, want destination:router", s)
+		}
+		_, dst, err := net.ParseCIDR(parts[0])
+		if err != nil || dst.IP.To4() == nil {
+			return nil, errors.Errorf("invalid static route destination %q, want an IPv4 cidr", parts[0])
+		}
+		router := net.ParseIP(parts[1]).To4()
+		if router == nil {
+			return nil, errors.Errorf("invalid static route router %q, want an IPv4 address", parts[1])
+		}
+		routes = append(routes, StaticRoute{Destination: dst, Router: router})
+	}
+
+	return routes, nil
+}
+
+func mustStaticRoutes() []StaticRoute {
+	routes, err := ParseStaticRoutes(os.Getenv("DHCP_STATIC_ROUTES"))
+	if err != nil {
+		panic(errors.Wrap(err, "invalid DHCP_STATIC_ROUTES"))
+	}
+
+	return routes
+}
+
+// DHCPRenewalTimes returns the T1 and T2 times for a lease of the given
+// duration, the configured ones or 0.5 and 0.875 of lease otherwise. An error
+// is returned unless T1 < T2 < lease.
+func DHCPRenewalTimes(lease time.Duration) (t1, t2 time.Duration, err error) {
+	return renewalTimes(DHCPRenewalTime, DHCPRebindingTime, lease)
+}
+
+func renewalTimes(t1, t2, lease time.Duration) (time.Duration, time.Duration, error) {
+	if t1 == 0 {
+		t1 = lease / 2
+	}
+	if t2 == 0 {
+		t2 = lease * 7 / 8
+	}
+	if t1 <= 0 || t1 >= t2 || t2 >= lease {
+		return 0, 0, errors.Errorf("renewal time %s and rebinding time %s do not satisfy T1 < T2 < lease time %s", t1, t2, lease)
+	}
+
+	return t1, t2, nil
+}
+
+func mustDHCPRenewalTimes() (time.Duration, time.Duration) {
+	t1 := env.Duration("DHCP_RENEWAL_TIME", 0)
+	t2 := env.Duration("DHCP_REBINDING_TIME", 0)
+	if _, _, err := renewalTimes(t1, t2, DHCPLeaseTime); err != nil {
+		panic(errors.Wrap(err, "invalid DHCP_RENEWAL_TIME or DHCP_REBINDING_TIME"))
+	}
+
+	return t1, t2
+}
+
+// DHCPSubnet is the address of boots, Server, for machines in Subnet.
+type DHCPSubnet struct {
+	Subnet *net.IPNet
+	Server net.IP
+}
+
+// ParseDHCPSubnets parses a comma separated list of subnet:server entries,
+// e.g. "10.10.0.0/24:10.10.0.2,10.20.0.0/24:10.20.0.2".
+func ParseDHCPSubnets(str string) ([]DHCPSubnet, error) {
+	var subnets []DHCPSubnet
+	for _, s := range strings.Split(str, ",") {
+		s = strings.TrimSpace(s)
+		if s == "" {
+			continue
+		}
+		parts := strings.Split(s, ":")
+		if len(parts) != 2 {
+			return nil, errors.Errorf("invalid dhcp subnet %q, want subnet:server", s)
+		}
+		_, subnet, err := net.ParseCIDR(parts[0])
+		if err != nil || subnet.IP.To4() == nil {
+			return nil, errors.Errorf("invalid dhcp subnet %q, want an IPv4 cidr", parts[0])
+		}
+		server := net.ParseIP(parts[1]).To4()
+		if server == nil {
+			return nil, errors.Errorf("invalid dhcp subnet server %q, want an IPv4 address", parts[1])
+		}
+		subnets = append(subnets, DHCPSubnet{Subnet: subnet, Server: server})
+	}
+
+	return subnets, nil
+}
+
+func mustDHCPSubnets() []DHCPSubnet {
+	subnets, err := ParseDHCPSubnets(os.Getenv("DHCP_SUBNETS"))
+	if err != nil {
+		panic(errors.Wrap(err, "invalid DHCP_SUBNETS"))
+	}
+
+	return subnets
+}
+
+// DHCPSubnetFor returns the most specific of DHCPSubnets containing the relay
+// address giaddr, false for requests that were not relayed or from subnets
+// that are not configured.
+func DHCPSubnetFor(giaddr net.IP) (DHCPSubnet, bool) {
+	var match DHCPSubnet
+	if giaddr == nil || giaddr.IsUnspecified() {
+		return match, false
+	}
+	bits := -1
+	for _, s := range DHCPSubnets {
+		if ones, _ := s.Subnet.Mask.Size(); s.Subnet.Contains(giaddr) && ones > bits {
+			match, bits = s, ones
+		}
+	}
+
+	return match, bits >= 0
+}
+
 func getIgnoredMACs() map[string]struct{} {
 	macs := os.Getenv("TINK_IGNORED_OUIS")
 	if macs == "" {
@@ -156,6 +739,343 @@ func ShouldIgnoreGI(ip string) bool {
 	return ok
 }
 
+func getDisabledInstallers() map[string]struct{} {
+	names := os.Getenv("INSTALLERS_DISABLED")
+	if names == "" {
+		return nil
+	}
+
+	m := make(map[string]struct{})
+	for _, name := range strings.Split(names, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			m[name] = struct{}{}
+		}
+	}
+
+	return m
+}
+
+func getEventForwardHeaders() []string {
+	var names []string
+	for _, name := range strings.Split(env.Get("EVENT_FORWARD_HEADERS"), ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			names = append(names, textproto.CanonicalMIMEHeaderKey(name))
+		}
+	}
+
+	return names
+}
+
+func getInstallerSelfTestCritical() map[string]struct{} {
+	names := os.Getenv("INSTALLER_SELF_TEST_CRITICAL")
+	if names == "" {
+		return nil
+	}
+
+	m := make(map[string]struct{})
+	for _, name := range strings.Split(names, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			m[name] = struct{}{}
+		}
+	}
+
+	return m
+}
+
+func getLogFormat() string {
+	format := env.Get("LOG_FORMAT")
+	switch format {
+	case "", "json", "console":
+		return format
+	}
+	panic("invalid LOG_FORMAT format=" + format)
+}
+
+func getBootDriveHintMatch() string {
+	match := env.Get("VMWARE_BOOT_DRIVE_HINT_MATCH", "prefix")
+	switch match {
+	case "exact", "prefix", "substring", "serial":
+		return match
+	}
+	panic("invalid VMWARE_BOOT_DRIVE_HINT_MATCH match=" + match)
+}
+
+func getDHCPReplyBroadcast() string {
+	policy := env.Get("DHCP_REPLY_BROADCAST", "respect-flag")
+	switch policy {
+	case "respect-flag", "always-broadcast", "always-unicast":
+		return policy
+	}
+	panic("invalid DHCP_REPLY_BROADCAST policy=" + policy)
+}
+
+func getEventSink() string {
+	sink := env.Get("EVENT_SINK")
+	switch sink {
+	case "", "file", "webhook":
+		return sink
+	}
+	panic("invalid EVENT_SINK sink=" + sink)
+}
+
+func getHardwareConflictPolicy() string {
+	policy := env.Get("HARDWARE_CONFLICT_POLICY", "error")
+	switch policy {
+	case "error", "lowest-id":
+		return policy
+	}
+	panic("invalid HARDWARE_CONFLICT_POLICY policy=" + policy)
+}
+
+func getOsieURLSchemes() map[string]string {
+	entries := os.Getenv("OSIE_URL_SCHEMES")
+	if entries == "" {
+		return nil
+	}
+
+	m := make(map[string]string)
+	for _, entry := range strings.Split(entries, ",") {
+		parts := strings.Split(strings.TrimSpace(entry), ":")
+		if len(parts) != 2 || parts[0] == "" || (parts[1] != "http" && parts[1] != "https") {
+			panic("invalid entry in OSIE_URL_SCHEMES entry=" + entry)
+		}
+		m[parts[0]] = parts[1]
+	}
+
+	return m
+}
+
+func getFlatcarPostInstallAction() string {
+	action := env.Get("FLATCAR_POST_INSTALL_ACTION", "reboot")
+	switch action {
+	case "reboot", "poweroff", "halt":
+		return action
+	}
+	panic("invalid FLATCAR_POST_INSTALL_ACTION action=" + action)
+}
+
+func getRemoteFetchSchemes() map[string]struct{} {
+	m := make(map[string]struct{})
+	for _, scheme := range strings.Split(env.Get("REMOTE_FETCH_SCHEMES", "http,https"), ",") {
+		switch scheme = strings.TrimSpace(scheme); scheme {
+		case "":
+			continue
+		case "http", "https":
+			m[scheme] = struct{}{}
+		default:
+			panic("invalid scheme in REMOTE_FETCH_SCHEMES scheme=" + scheme)
+		}
+	}
+
+	return m
+}
+
+func getFacilityOSVersions() map[string]map[string]string {
+	entries := getSemicolonValues("FACILITY_OS_VERSIONS")
+	if entries == nil {
+		return nil
+	}
+
+	m := make(map[string]map[string]string, len(entries))
+	for facility, versions := range entries {
+		m[facility] = make(map[string]string)
+		for _, v := range strings.Split(versions, ",") {
+			parts := strings.SplitN(strings.TrimSpace(v), "=", 2)
+			if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+				panic("invalid entry in FACILITY_OS_VERSIONS entry=" + facility + ":" + versions)
+			}
+			m[facility][parts[0]] = parts[1]
+		}
+	}
+
+	return m
+}
+
+func getFlatcarARMConsoles() map[string]string {
+	return getSemicolonValues("FLATCAR_ARM_CONSOLES")
+}
+
+// getSemicolonValues parses the environment variable name, a semicolon
+// separated list of key:value entries for values that may contain commas.
+func getSemicolonValues(name string) map[string]string {
+	entries := os.Getenv(name)
+	if entries == "" {
+		return nil
+	}
+
+	m := make(map[string]string)
+	for _, entry := range strings.Split(entries, ";") {
+		parts := strings.SplitN(strings.TrimSpace(entry), ":", 2)
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			panic("invalid entry in " + name + " entry=" + entry)
+		}
+		m[parts[0]] = parts[1]
+	}
+
+	return m
+}
+
+// FlatcarARMConsoleFor returns the kernel console of flatcar installs on arm
+// machines of plan in facility, the FLATCAR_ARM_CONSOLES entry of the plan,
+// then the one of the facility and otherwise ttyAMA0,115200.
+func FlatcarARMConsoleFor(facility, plan string) string {
+	if console, ok := FlatcarARMConsoles[plan]; ok {
+		return console
+	}
+	if console, ok := FlatcarARMConsoles[facility]; ok {
+		return console
+	}
+
+	return "ttyAMA0,115200"
+}
+
+// FacilityNetwork is a FACILITY_NETWORKS entry.
+type FacilityNetwork struct {
+	Network  *net.IPNet
+	Facility string
+}
+
+func getFacilityNetworks() []FacilityNetwork {
+	entries := os.Getenv("FACILITY_NETWORKS")
+	if entries == "" {
+		return nil
+	}
+
+	var networks []FacilityNetwork
+	for _, entry := range strings.Split(entries, ",") {
+		parts := strings.SplitN(strings.TrimSpace(entry), "=", 2)
+		if len(parts) != 2 || parts[1] == "" {
+			panic("invalid entry in FACILITY_NETWORKS entry=" + entry)
+		}
+		_, n, err := net.ParseCIDR(parts[0])
+		if err != nil {
+			panic(errors.Wrap(err, "invalid network in FACILITY_NETWORKS entry="+entry))
+		}
+		networks = append(networks, FacilityNetwork{Network: n, Facility: parts[1]})
+	}
+
+	return networks
+}
+
+// FacilityForIP returns the facility of the most specific FACILITY_NETWORKS
+// network containing ip, empty if there is none.
+func FacilityForIP(ip net.IP) string {
+	facility, best := "", -1
+	for _, fn := range FacilityNetworks {
+		if !fn.Network.Contains(ip) {
+			continue
+		}
+		if ones, _ := fn.Network.Mask.Size(); ones > best {
+			facility, best = fn.Facility, ones
+		}
+	}
+
+	return facility
+}
+
+// PlanKernelArgsFor returns the PLAN_KERNEL_ARGS entry of plan, empty if it has none.
+func PlanKernelArgsFor(plan string) string {
+	return strings.TrimSpace(PlanKernelArgs[plan])
+}
+
+// getInstallerFacilities parses INSTALLER_FACILITIES, a comma separated list
+// of installer:facility[:facility...] entries restricting an installer to facilities.
+func getInstallerFacilities() map[string]map[string]struct{} {
+	entries := os.Getenv("INSTALLER_FACILITIES")
+	if entries == "" {
+		return nil
+	}
+
+	m := make(map[string]map[string]struct{})
+	for _, entry := range strings.Split(entries, ",") {
+		parts := strings.Split(strings.TrimSpace(entry), ":")
+		if len(parts) < 2 || parts[0] == "" {
+			panic("invalid entry in INSTALLER_FACILITIES entry=" + entry)
+		}
+		facilities := make(map[string]struct{})
+		for _, facility := range parts[1:] {
+			facilities[facility] = struct{}{}
+		}
+		m[parts[0]] = facilities
+	}
+
+	return m
+}
+
+// InstallerAvailable reports whether the installer registered as name is
+// enabled and allowed in facility.
+func InstallerAvailable(name, facility string) bool {
+	if _, ok := DisabledInstallers[name]; ok {
+		return false
+	}
+	facilities, ok := InstallerFacilities[name]
+	if !ok {
+		return true
+	}
+	_, ok = facilities[facility]
+
+	return ok
+}
+
+func getChainAllowedHosts() (hosts []string) {
+	for _, host := range strings.Split(os.Getenv("CHAIN_ALLOWED_HOSTS"), ",") {
+		host = strings.TrimSpace(host)
+		if host == "" {
+			continue
+		}
+		if strings.Contains(host, "/") {
+			if _, _, err := net.ParseCIDR(host); err != nil {
+				panic("invalid cidr in CHAIN_ALLOWED_HOSTS cidr=" + host)
+			}
+		}
+		hosts = append(hosts, host)
+	}
+
+	return hosts
+}
+
+// ChainHostAllowed reports whether iPXE scripts may chain to URLs of host, by
+// name or by address.
+func ChainHostAllowed(host string) bool {
+	if len(ChainAllowedHosts) == 0 {
+		return true
+	}
+
+	ip := net.ParseIP(host)
+	for _, allowed := range ChainAllowedHosts {
+		if _, cidr, err := net.ParseCIDR(allowed); err == nil {
+			if ip != nil && cidr.Contains(ip) {
+				return true
+			}
+
+			continue
+		}
+		if allowedIP := net.ParseIP(allowed); allowedIP != nil {
+			if allowedIP.Equal(ip) {
+				return true
+			}
+
+			continue
+		}
+		if strings.EqualFold(allowed, host) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ChainURLAllowed reports whether rawURL parses and points at a host allowed by
+// ChainHostAllowed.
+func ChainURLAllowed(rawURL string) bool {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return false
+	}
+
+	return ChainHostAllowed(u.Hostname())
+}
+
 func parseTrustedProxies() (result []string) {
 	trustedProxies := os.Getenv("TRUSTED_PROXIES")
 	for _, cidr := range strings.Split(trustedProxies, ",") {
@@ -182,3 +1102,132 @@ func parseTrustedProxies() (result []string) {
 
 	return result
 }
+
+func getTFTPRoots() []string {
+	var roots []string
+	for _, root := range strings.Split(os.Getenv("TFTP_ROOTS"), ",") {
+		if root = strings.TrimSpace(root); root != "" {
+			roots = append(roots, root)
+		}
+	}
+
+	return roots
+}
+
+func mustTFTPBlockTimeout() time.Duration {
+	d := env.Duration("TFTP_BLOCK_TIMEOUT", 0)
+	if d != 0 && (d < 100*time.Millisecond || d > time.Minute) {
+		panic("TFTP_BLOCK_TIMEOUT must be between 100ms and 1m")
+	}
+
+	return d
+}
+
+func mustTFTPMaxRetransmits() int {
+	n := env.Int("TFTP_MAX_RETRANSMITS", 0)
+	if n < 0 || n > 50 {
+		panic("TFTP_MAX_RETRANSMITS must be between 0 and 50")
+	}
+
+	return n
+}
+
+func getCustomDataKeys() map[string]struct{} {
+	var keys map[string]struct{}
+	for _, key := range strings.Split(os.Getenv("CUSTOM_DATA_KEYS"), ",") {
+		if key = strings.TrimSpace(key); key == "" {
+			continue
+		}
+		if keys == nil {
+			keys = make(map[string]struct{})
+		}
+		keys[key] = struct{}{}
+	}
+
+	return keys
+}
+
+func getWipeOSSlugs() []string {
+	var slugs []string
+	for _, slug := range strings.Split(env.Get("WIPE_OS_SLUGS", "decommission"), ",") {
+		if slug = strings.TrimSpace(slug); slug != "" {
+			slugs = append(slugs, slug)
+		}
+	}
+
+	return slugs
+}
+
+func getHardwareFinderFallbacks() []string {
+	fallbacks := os.Getenv("HARDWARE_FINDER_FALLBACKS")
+	if fallbacks == "" {
+		return nil
+	}
+
+	var result []string
+	for _, dmv := range strings.Split(fallbacks, ",") {
+		switch dmv = strings.TrimSpace(dmv); dmv {
+		case "":
+			continue
+		case "cacher", "1", "standalone", "kubernetes":
+			result = append(result, dmv)
+		default:
+			panic("invalid data model version in HARDWARE_FINDER_FALLBACKS dmv=" + dmv)
+		}
+	}
+
+	return result
+}
+
+func mustMetricsPushInterval() time.Duration {
+	d := env.Duration("METRICS_PUSH_INTERVAL", 15*time.Second)
+	if d <= 0 {
+		panic("METRICS_PUSH_INTERVAL must be positive")
+	}
+
+	return d
+}
+
+// defaultLogRedactFields are the log fields always masked, the secrets
+// installers handle.
+var defaultLogRedactFields = []string{"rootpwcrypt", "password", "password_hash", "pwhash", "crypted_root_password", "token", "private_key", "ssh_private_key"}
+
+func getLogRedactFields() map[string]struct{} {
+	fields := make(map[string]struct{})
+	for _, field := range append(defaultLogRedactFields, strings.Split(os.Getenv("LOG_REDACT_FIELDS"), ",")...) {
+		if field = strings.ToLower(strings.TrimSpace(field)); field != "" {
+			fields[field] = struct{}{}
+		}
+	}
+
+	return fields
+}
+
+func mustHTTPSMinVersion() uint16 {
+	versions := map[string]uint16{
+		"1.0": tls.VersionTLS10,
+		"1.1": tls.VersionTLS11,
+		"1.2": tls.VersionTLS12,
+		"1.3": tls.VersionTLS13,
+	}
+	v, ok := versions[env.Get("HTTPS_MIN_VERSION", "1.2")]
+	if !ok {
+		panic("HTTPS_MIN_VERSION must be one of 1.0, 1.1, 1.2 or 1.3")
+	}
+
+	return v
+}
+
+func mustOSIELogLevel() string {
+	level := env.Get("OSIE_LOG_LEVEL")
+	if level != "" && !ValidKernelLogLevel(level) {
+		panic("OSIE_LOG_LEVEL must be between 0 and 7")
+	}
+
+	return level
+}
+
+// ValidKernelLogLevel reports whether level is a kernel log level, 0 to 7.
+func ValidKernelLogLevel(level string) bool {
+	return len(level) == 1 && level[0] >= '0' && level[0] <= '7'
+}
@@ -0,0 +1,59 @@
+package conf
+
+import (
+	"net"
+	"testing"
+)
+
+func TestPublicFQDNFor(t *testing.T) {
+	defer func(fqdn string, ip net.IP, fqdns map[string]string, ips map[string]net.IP) {
+		PublicFQDN, PublicIPv4, FacilityPublicFQDNs, FacilityPublicIPv4s = fqdn, ip, fqdns, ips
+	}(PublicFQDN, PublicIPv4, FacilityPublicFQDNs, FacilityPublicIPv4s)
+
+	PublicFQDN, PublicIPv4 = "boots.example.com", net.ParseIP("192.168.1.1").To4()
+	t.Setenv("FACILITY_PUBLIC_FQDNS", "ewr1:boots.ewr1.example.com:8080")
+	t.Setenv("FACILITY_PUBLIC_IPV4S", "ewr1:10.1.0.1,sjc1:10.2.0.1")
+	FacilityPublicFQDNs = getFacilityValues("FACILITY_PUBLIC_FQDNS")
+	FacilityPublicIPv4s = getFacilityPublicIPv4s()
+
+	tests := []struct {
+		facility string
+		fqdn     string
+		ip       string
+	}{
+		{facility: "ewr1", fqdn: "boots.ewr1.example.com:8080", ip: "10.1.0.1"},
+		{facility: "sjc1", fqdn: "10.2.0.1", ip: "10.2.0.1"},
+		{facility: "ams1", fqdn: "boots.example.com", ip: "192.168.1.1"},
+		{facility: "", fqdn: "boots.example.com", ip: "192.168.1.1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.facility, func(t *testing.T) {
+			if got := PublicFQDNFor(tt.facility); got != tt.fqdn {
+				t.Errorf("PublicFQDNFor(%q) = %q, want: %q", tt.facility, got, tt.fqdn)
+			}
+			if got := PublicIPv4For(tt.facility).String(); got != tt.ip {
+				t.Errorf("PublicIPv4For(%q) = %q, want: %q", tt.facility, got, tt.ip)
+			}
+		})
+	}
+}
+
+func TestFlatcarARMConsoleFor(t *testing.T) {
+	defer func(consoles map[string]string) { FlatcarARMConsoles = consoles }(FlatcarARMConsoles)
+
+	t.Setenv("FLATCAR_ARM_CONSOLES", "sjc1:ttyS0,115200; c3.large.arm:ttyAMA0,9600")
+	FlatcarARMConsoles = getFlatcarARMConsoles()
+
+	tests := []struct {
+		facility, plan, want string
+	}{
+		{facility: "sjc1", plan: "c2.large.arm", want: "ttyS0,115200"},
+		{facility: "sjc1", plan: "c3.large.arm", want: "ttyAMA0,9600"},
+		{facility: "ewr1", plan: "c2.large.arm", want: "ttyAMA0,115200"},
+	}
+	for _, tt := range tests {
+		if got := FlatcarARMConsoleFor(tt.facility, tt.plan); got != tt.want {
+			t.Errorf("FlatcarARMConsoleFor(%q, %q) = %q, want: %q", tt.facility, tt.plan, got, tt.want)
+		}
+	}
+}
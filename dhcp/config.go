@@ -6,6 +6,7 @@ import (
 
 	dhcp4 "github.com/packethost/dhcp4-go"
 	"github.com/pkg/errors"
+	"github.com/tinkerbell/boots/conf"
 )
 
 type Config struct {
@@ -48,6 +49,20 @@ func (c *Config) Gateway() net.IP {
 	return gw
 }
 
+// DNSServers returns the IPv4 DNS servers set by SetDNSServers.
+func (c *Config) DNSServers() []net.IP {
+	b, ok := c.opts.GetOption(dhcp4.OptionDomainServer)
+	if !ok {
+		return nil
+	}
+	ips := make([]net.IP, 0, len(b)/4)
+	for i := 0; i+4 <= len(b); i += 4 {
+		ips = append(ips, net.IP(b[i:i+4]))
+	}
+
+	return ips
+}
+
 func (c *Config) Hostname() string {
 	hn, ok := c.opts.GetString(dhcp4.OptionHostname)
 	if !ok {
@@ -76,8 +91,21 @@ func (c *Config) Setup(address, netmask, gateway net.IP) {
 	}
 }
 
+// SetLeaseTime sets the lease time along with the renewal (T1) and rebinding
+// (T2) times, which are left to the client if they do not fit the lease.
 func (c *Config) SetLeaseTime(d time.Duration) {
 	c.opts.SetDuration(dhcp4.OptionAddressTime, d)
+	if d <= 0 {
+		return
+	}
+	t1, t2, err := conf.DHCPRenewalTimes(d)
+	if err != nil {
+		dhcplog.With("lease", d).Error(err)
+
+		return
+	}
+	c.opts.SetDuration(dhcp4.OptionRenewalTime, t1)
+	c.opts.SetDuration(dhcp4.OptionRebindingTime, t2)
 }
 
 func (c *Config) SetHostname(s string) {
@@ -119,6 +147,41 @@ func (c *Config) SetDNSServers(ips []net.IP) {
 	c.opts.SetOption(dhcp4.OptionDomainServer, b)
 }
 
+// SetClasslessStaticRoutes sets option 121 to routes, encoded as described in RFC 3442.
+// Clients ignore option 3 when option 121 is present, so a default route through the
+// gateway is added unless routes already has one.
+func (c *Config) SetClasslessStaticRoutes(routes []conf.StaticRoute) {
+	if len(routes) == 0 {
+		return
+	}
+	var b []byte
+	hasDefault := false
+	for _, r := range routes {
+		dst := r.Destination.IP.To4()
+		router := r.Router.To4()
+		if dst == nil || router == nil {
+			dhcplog.With("destination", r.Destination, "router", r.Router).Info("skipping non IPv4 static route")
+
+			continue
+		}
+		ones, _ := r.Destination.Mask.Size()
+		if ones == 0 {
+			hasDefault = true
+		}
+		b = append(b, byte(ones))
+		b = append(b, dst[:(ones+7)/8]...)
+		b = append(b, router...)
+	}
+	if len(b) == 0 {
+		return
+	}
+	if gw := c.Gateway().To4(); gw != nil && !hasDefault {
+		b = append(b, 0)
+		b = append(b, gw...)
+	}
+	c.opts.SetOption(dhcp4.OptionClasslessStaticRouteOption, b)
+}
+
 // SetOpt43SubOpt sets an option 43 sub-option. If option 43 is already set, the sub-option is appended.
 func (c *Config) SetOpt43SubOpt(subOpt dhcp4.Option, s string) {
 	if s == "" {
@@ -0,0 +1,149 @@
+package dhcp
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	dhcp4 "github.com/packethost/dhcp4-go"
+	"github.com/tinkerbell/boots/conf"
+)
+
+// decodeClasslessStaticRoutes decodes an RFC 3442 option 121 value.
+func decodeClasslessStaticRoutes(t *testing.T, b []byte) []string {
+	t.Helper()
+
+	var routes []string
+	for len(b) > 0 {
+		ones := int(b[0])
+		n := (ones + 7) / 8
+		if ones > 32 || len(b) < 1+n+4 {
+			t.Fatalf("truncated option 121: %v", b)
+		}
+		dst := make(net.IP, 4)
+		copy(dst, b[1:1+n])
+		router := net.IP(b[1+n : 1+n+4])
+		routes = append(routes, (&net.IPNet{IP: dst, Mask: net.CIDRMask(ones, 32)}).String()+":"+router.String())
+		b = b[1+n+4:]
+	}
+
+	return routes
+}
+
+func TestSetClasslessStaticRoutes(t *testing.T) {
+	tests := map[string]struct {
+		routes  string
+		gateway net.IP
+		want    []string
+	}{
+		"unconfigured": {
+			gateway: net.ParseIP("192.168.1.1"),
+		},
+		"routes without gateway": {
+			routes: "10.10.0.0/16:192.168.1.254,172.16.5.0/24:192.168.1.253",
+			want:   []string{"10.10.0.0/16:192.168.1.254", "172.16.5.0/24:192.168.1.253"},
+		},
+		"default route added from gateway": {
+			routes:  "10.10.0.0/16:192.168.1.254",
+			gateway: net.ParseIP("192.168.1.1"),
+			want:    []string{"10.10.0.0/16:192.168.1.254", "0.0.0.0/0:192.168.1.1"},
+		},
+		"configured default route kept": {
+			routes:  "0.0.0.0/0:192.168.1.2,10.0.0.0/8:192.168.1.254",
+			gateway: net.ParseIP("192.168.1.1"),
+			want:    []string{"0.0.0.0/0:192.168.1.2", "10.0.0.0/8:192.168.1.254"},
+		},
+		"odd prefix lengths": {
+			routes: "10.17.128.0/17:192.168.1.254,10.1.2.3/32:192.168.1.253,10.224.0.0/11:192.168.1.252",
+			want:   []string{"10.17.128.0/17:192.168.1.254", "10.1.2.3/32:192.168.1.253", "10.224.0.0/11:192.168.1.252"},
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			routes, err := conf.ParseStaticRoutes(tt.routes)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			c := &Config{}
+			c.Setup(net.ParseIP("192.168.1.10"), net.ParseIP("255.255.255.0"), tt.gateway)
+			c.SetClasslessStaticRoutes(routes)
+
+			b, ok := c.opts.GetOption(dhcp4.OptionClasslessStaticRouteOption)
+			if len(tt.want) == 0 {
+				if ok {
+					t.Fatalf("unexpected option 121: %v", b)
+				}
+
+				return
+			}
+			if !ok {
+				t.Fatal("option 121 not set")
+			}
+			if diff := cmp.Diff(tt.want, decodeClasslessStaticRoutes(t, b)); diff != "" {
+				t.Fatal(diff)
+			}
+		})
+	}
+}
+
+func TestSetLeaseTime(t *testing.T) {
+	defer func(t1, t2 time.Duration) {
+		conf.DHCPRenewalTime, conf.DHCPRebindingTime = t1, t2
+	}(conf.DHCPRenewalTime, conf.DHCPRebindingTime)
+
+	tests := map[string]struct {
+		lease, t1, t2         time.Duration
+		wantT1, wantT2        time.Duration
+		wantRenewalTimesUnset bool
+	}{
+		"defaults": {
+			lease:  8 * time.Hour,
+			wantT1: 4 * time.Hour, wantT2: 7 * time.Hour,
+		},
+		"configured": {
+			lease: 8 * time.Hour, t1: 6 * time.Hour, t2: 7*time.Hour + 30*time.Minute,
+			wantT1: 6 * time.Hour, wantT2: 7*time.Hour + 30*time.Minute,
+		},
+		"configured T1 only": {
+			lease: 8 * time.Hour, t1: time.Hour,
+			wantT1: time.Hour, wantT2: 7 * time.Hour,
+		},
+		"T2 beyond lease": {
+			lease: time.Hour, t1: 30 * time.Minute, t2: 2 * time.Hour,
+			wantRenewalTimesUnset: true,
+		},
+		"T1 after T2": {
+			lease: 8 * time.Hour, t1: 7 * time.Hour, t2: 6 * time.Hour,
+			wantRenewalTimesUnset: true,
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			conf.DHCPRenewalTime, conf.DHCPRebindingTime = tt.t1, tt.t2
+
+			c := &Config{}
+			c.Setup(net.ParseIP("192.168.1.10"), net.ParseIP("255.255.255.0"), nil)
+			c.SetLeaseTime(tt.lease)
+
+			if lease, _ := c.opts.GetDuration(dhcp4.OptionAddressTime); lease != tt.lease {
+				t.Fatalf("unexpected lease time, want: %s, got: %s", tt.lease, lease)
+			}
+			t1, ok1 := c.opts.GetDuration(dhcp4.OptionRenewalTime)
+			t2, ok2 := c.opts.GetDuration(dhcp4.OptionRebindingTime)
+			if tt.wantRenewalTimesUnset {
+				if ok1 || ok2 {
+					t.Fatalf("unexpected renewal times T1=%s T2=%s", t1, t2)
+				}
+
+				return
+			}
+			if t1 != tt.wantT1 || t2 != tt.wantT2 {
+				t.Fatalf("unexpected renewal times, want: T1=%s T2=%s, got: T1=%s T2=%s", tt.wantT1, tt.wantT2, t1, t2)
+			}
+		})
+	}
+}
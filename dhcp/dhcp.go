@@ -3,6 +3,7 @@ package dhcp
 import (
 	dhcp4 "github.com/packethost/dhcp4-go"
 	"github.com/pkg/errors"
+	"github.com/tinkerbell/boots/conf"
 )
 
 type Reply interface {
@@ -28,6 +29,7 @@ type Ack struct {
 }
 
 func NewAck(w dhcp4.ReplyWriter, req *dhcp4.Packet) *Ack {
+	setBroadcastFlag(req)
 	ack := dhcp4.CreateAck(req)
 	includeOption82(req, ack)
 
@@ -48,6 +50,7 @@ type Offer struct {
 }
 
 func NewOffer(w dhcp4.ReplyWriter, req *dhcp4.Packet) *Offer {
+	setBroadcastFlag(req)
 	offer := dhcp4.CreateOffer(req)
 	includeOption82(req, offer)
 
@@ -69,3 +72,14 @@ func includeOption82(req *dhcp4.Packet, res dhcp4.OptionSetter) {
 		res.SetOption(dhcp4.OptionRelayAgentInformation, opt82)
 	}
 }
+
+// setBroadcastFlag applies conf.DHCPReplyBroadcast to the broadcast flag of req,
+// which the reply copies and the reply writer sends to the broadcast address by.
+func setBroadcastFlag(req *dhcp4.Packet) {
+	switch conf.DHCPReplyBroadcast {
+	case "always-broadcast":
+		req.Flags()[0] |= 0x80
+	case "always-unicast":
+		req.Flags()[0] &^= 0x80
+	}
+}
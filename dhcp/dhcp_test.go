@@ -0,0 +1,87 @@
+package dhcp
+
+import (
+	"net"
+	"os"
+	"testing"
+
+	dhcp4 "github.com/packethost/dhcp4-go"
+	"github.com/packethost/pkg/log"
+	"github.com/tinkerbell/boots/conf"
+)
+
+func TestMain(m *testing.M) {
+	l, _ := log.Init("github.com/tinkerbell/boots")
+	Init(l)
+	os.Exit(m.Run())
+}
+
+// destWriter records where a reply would be sent, following the rules of the
+// dhcp4-go reply writer for a request received from src.
+type destWriter struct {
+	src  net.IP
+	dest net.IP
+}
+
+func (w *destWriter) WriteReply(r dhcp4.Reply) error {
+	msg := r.Message()
+	switch {
+	case !msg.GetGIAddr().Equal(net.IPv4zero):
+		w.dest = msg.GetGIAddr()
+	case w.src.Equal(net.IPv4zero) || msg.GetFlags()[0]&0x80 > 0:
+		w.dest = net.IPv4bcast
+	default:
+		w.dest = w.src
+	}
+
+	return nil
+}
+
+func TestReplyBroadcast(t *testing.T) {
+	defer func(policy string) { conf.DHCPReplyBroadcast = policy }(conf.DHCPReplyBroadcast)
+
+	client := net.ParseIP("192.168.1.20").To4()
+	relay := net.ParseIP("10.0.0.1").To4()
+	tests := map[string]struct {
+		policy    string
+		src       net.IP
+		giaddr    net.IP
+		broadcast bool
+		want      net.IP
+	}{
+		"respect-flag unicast":        {policy: "respect-flag", src: client, want: client},
+		"respect-flag broadcast":      {policy: "respect-flag", src: client, broadcast: true, want: net.IPv4bcast},
+		"always-broadcast":            {policy: "always-broadcast", src: client, want: net.IPv4bcast},
+		"always-unicast":              {policy: "always-unicast", src: client, broadcast: true, want: client},
+		"always-unicast no address":   {policy: "always-unicast", src: net.IPv4zero, broadcast: true, want: net.IPv4bcast},
+		"always-broadcast relayed":    {policy: "always-broadcast", src: relay, giaddr: relay, want: relay},
+		"respect-flag relayed":        {policy: "respect-flag", src: relay, giaddr: relay, broadcast: true, want: relay},
+		"always-unicast relayed":      {policy: "always-unicast", src: relay, giaddr: relay, broadcast: true, want: relay},
+		"always-broadcast no address": {policy: "always-broadcast", src: net.IPv4zero, want: net.IPv4bcast},
+	}
+
+	for name, tt := range tests {
+		for _, mt := range []dhcp4.MessageType{dhcp4.MessageTypeDiscover, dhcp4.MessageTypeRequest} {
+			t.Run(name+"/"+mt.String(), func(t *testing.T) {
+				conf.DHCPReplyBroadcast = tt.policy
+
+				req := dhcp4.NewPacket(dhcp4.BootRequest)
+				req.SetMessageType(mt)
+				if tt.giaddr != nil {
+					req.SetGIAddr(tt.giaddr)
+				}
+				if tt.broadcast {
+					req.Flags()[0] |= 0x80
+				}
+
+				w := &destWriter{src: tt.src}
+				if err := NewReply(w, &req).Send(); err != nil {
+					t.Fatal(err)
+				}
+				if !w.dest.Equal(tt.want) {
+					t.Fatalf("unexpected reply destination, want: %v, got: %v", tt.want, w.dest)
+				}
+			})
+		}
+	}
+}
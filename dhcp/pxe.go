@@ -2,12 +2,14 @@ package dhcp
 
 import (
 	"context"
+	"fmt"
 	"net"
 	"path"
 	"strings"
 
 	dhcp4 "github.com/packethost/dhcp4-go"
 	"github.com/pkg/errors"
+	"github.com/tinkerbell/boots/conf"
 	"github.com/tinkerbell/boots/ipxe"
 	"go.opentelemetry.io/otel/trace"
 )
@@ -107,6 +109,8 @@ func SetupPXE(ctx context.Context, rep, req *dhcp4.Packet) bool {
 	if !copyGUID(rep, req) {
 		dhcplog.With("mac", req.GetCHAddr(), "xid", req.GetXID()).Info("no client GUID provided")
 	}
+	copyClientSystem(rep, req)
+	copyClientNDI(rep, req)
 
 	/*
 		Intel's Preboot Execution Environment (PXE) Specification (1999):
@@ -158,6 +162,33 @@ func SetFilename(rep *dhcp4.Packet, filename string, nextServer net.IP, httpClie
 		dhcplog.With("mac", rep.GetCHAddr(), "xid", rep.GetXID(), "filename", filename).Fatal(err)
 	}
 	copy(file, filename) // filename: Executable (or iPXE script) to boot from.
+
+	// Some PXE stacks only read the boot server and file from options 66 and 67.
+	serverName := conf.DHCPServerName
+	if serverName == "" && nextServer.To4() != nil {
+		serverName = nextServer.String()
+	}
+	if serverName != "" {
+		rep.SetString(dhcp4.OptionServerName, serverName)
+	}
+	rep.SetString(dhcp4.OptionBootfileName, filename)
+}
+
+// SetBootfileName sets option 67 of rep to filename, leaving its file field.
+func SetBootfileName(rep *dhcp4.Packet, filename string) {
+	rep.SetString(dhcp4.OptionBootfileName, filename)
+}
+
+// SetTFTPFallback sets the file field of rep to filename, served over TFTP by
+// its next server, for HTTP Boot clients falling back to TFTP when the boot
+// file URL fails. HTTP Boot firmware reads the URL from option 67, which is
+// left as is.
+func SetTFTPFallback(rep *dhcp4.Packet, filename string) {
+	file := rep.File()
+	for i := range file {
+		file[i] = 0
+	}
+	copy(file, filename)
 }
 
 func copyGUID(rep, req *dhcp4.Packet) bool {
@@ -176,6 +207,49 @@ func copyGUID(rep, req *dhcp4.Packet) bool {
 	return false
 }
 
+// ClientUUID returns the SMBIOS UUID of the client from its option 97 GUID,
+// "" if it did not send a supported one. Like SMBIOS, the GUID holds its first
+// three fields little-endian, they are swapped to print it as dmidecode does.
+func ClientUUID(req *dhcp4.Packet) string {
+	guid, ok := req.GetOption(dhcp4.OptionUUIDGUID)
+	if !ok || len(guid) != 17 || guid[0] != 0 {
+		return ""
+	}
+	u := guid[1:]
+
+	return fmt.Sprintf("%02x%02x%02x%02x-%02x%02x-%02x%02x-%x-%x", u[3], u[2], u[1], u[0], u[5], u[4], u[7], u[6], u[8:10], u[10:16])
+}
+
+// copyClientSystem echoes the client system architectures (option 93), a list
+// of 16-bit types, some UEFI PXE stacks drop offers without it.
+func copyClientSystem(rep, req *dhcp4.Packet) {
+	arch, ok := req.GetOption(dhcp4.OptionClientSystem)
+	if !ok {
+		return
+	}
+	if len(arch) == 0 || len(arch)%2 != 0 {
+		dhcplog.With("arch", arch, "mac", req.GetCHAddr(), "xid", req.GetXID()).Error(errors.New("malformed client system architecture"))
+
+		return
+	}
+	rep.SetOption(dhcp4.OptionClientSystem, arch)
+}
+
+// copyClientNDI echoes the client network device interface (option 94), a
+// 1-byte type (always 1, UNDI) followed by the major and minor version.
+func copyClientNDI(rep, req *dhcp4.Packet) {
+	ndi, ok := req.GetOption(dhcp4.OptionClientNDI)
+	if !ok {
+		return
+	}
+	if len(ndi) != 3 || ndi[0] != 1 {
+		dhcplog.With("ndi", ndi, "mac", req.GetCHAddr(), "xid", req.GetXID()).Error(errors.New("unsupported or malformed client network interface identifier"))
+
+		return
+	}
+	rep.SetOption(dhcp4.OptionClientNDI, ndi)
+}
+
 // binaryTpFromContext extracts the binary trace id, span id, and trace flags
 // from the running span in ctx and returns a 26 byte []byte with the traceparent
 // encoded and ready to pass in opt43
@@ -0,0 +1,114 @@
+package dhcp
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"testing"
+
+	dhcp4 "github.com/packethost/dhcp4-go"
+	"github.com/tinkerbell/boots/conf"
+)
+
+func TestSetFilenameOptions(t *testing.T) {
+	defer func(serverName string) { conf.DHCPServerName = serverName }(conf.DHCPServerName)
+
+	tests := map[string]struct {
+		serverName   string
+		nextServer   net.IP
+		httpClient   bool
+		wantServer   string
+		wantBootfile string
+	}{
+		"defaults": {
+			nextServer:   net.ParseIP("192.168.1.2"),
+			wantServer:   "192.168.1.2",
+			wantBootfile: "undionly.kpxe",
+		},
+		"defaults http client": {
+			nextServer:   net.ParseIP("192.168.1.2"),
+			httpClient:   true,
+			wantServer:   "192.168.1.2",
+			wantBootfile: "http://boots.example.com/ipxe/undionly.kpxe",
+		},
+		"configured": {
+			serverName:   "tftp.example.com",
+			nextServer:   net.ParseIP("192.168.1.2"),
+			wantServer:   "tftp.example.com",
+			wantBootfile: "undionly.kpxe",
+		},
+		"no next server": {
+			wantBootfile: "undionly.kpxe",
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			conf.DHCPServerName = tt.serverName
+
+			rep := dhcp4.NewPacket(dhcp4.BootReply)
+			SetFilename(&rep, "undionly.kpxe", tt.nextServer, tt.httpClient, "boots.example.com/ipxe")
+
+			got, ok := rep.GetString(dhcp4.OptionServerName)
+			if ok != (tt.wantServer != "") || got != tt.wantServer {
+				t.Errorf("unexpected option 66, want: %q, got: %q", tt.wantServer, got)
+			}
+			if got, _ := rep.GetString(dhcp4.OptionBootfileName); got != tt.wantBootfile {
+				t.Errorf("unexpected option 67, want: %q, got: %q", tt.wantBootfile, got)
+			}
+		})
+	}
+}
+
+func TestSetupPXEOptions(t *testing.T) {
+	guid := []byte{0, 0x44, 0x45, 0x4c, 0x4c, 0x42, 0x00, 0x10, 0x30, 0x80, 0x57, 0xb3, 0xc0, 0x4f, 0x4e, 0x4d, 0x32}
+	tests := map[string]struct {
+		options  map[dhcp4.Option][]byte
+		want     map[dhcp4.Option][]byte
+		wantUUID string
+	}{
+		"uefi client": {
+			options: map[dhcp4.Option][]byte{
+				dhcp4.OptionUUIDGUID:     guid,
+				dhcp4.OptionClientSystem: {0x00, 0x07},
+				dhcp4.OptionClientNDI:    {0x01, 0x03, 0x10},
+			},
+			want: map[dhcp4.Option][]byte{
+				dhcp4.OptionUUIDGUID:     guid,
+				dhcp4.OptionClientSystem: {0x00, 0x07},
+				dhcp4.OptionClientNDI:    {0x01, 0x03, 0x10},
+			},
+			wantUUID: "4c4c4544-0042-3010-8057-b3c04f4e4d32",
+		},
+		"malformed options": {
+			options: map[dhcp4.Option][]byte{
+				dhcp4.OptionUUIDGUID:     append([]byte{0xff}, guid[1:]...),
+				dhcp4.OptionClientSystem: {0x07},
+				dhcp4.OptionClientNDI:    {0x02, 0x03, 0x10},
+				dhcp4.OptionClassID:      []byte("PXEClient:Arch:00007"),
+			},
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			req := dhcp4.NewPacket(dhcp4.BootRequest)
+			for o, v := range tt.options {
+				req.SetOption(o, v)
+			}
+			rep := dhcp4.NewPacket(dhcp4.BootReply)
+			if !SetupPXE(context.Background(), &rep, &req) {
+				t.Fatal("request not handled as a PXE client")
+			}
+
+			for _, o := range []dhcp4.Option{dhcp4.OptionUUIDGUID, dhcp4.OptionClientSystem, dhcp4.OptionClientNDI} {
+				got, ok := rep.GetOption(o)
+				want, wantOK := tt.want[o]
+				if ok != wantOK || !bytes.Equal(got, want) {
+					t.Errorf("unexpected option %d, want: %v, got: %v", o, want, got)
+				}
+			}
+			if got := ClientUUID(&req); got != tt.wantUUID {
+				t.Errorf("unexpected client uuid, want: %q, got: %q", tt.wantUUID, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,106 @@
+// Package grub generates grub.cfg files for GRUB netboot clients from the
+// iPXE scripts boots serves, so both boot the same kernel, initrd and args.
+package grub
+
+import (
+	"bufio"
+	"bytes"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// ErrNoKernel is returned for iPXE scripts that do not boot a kernel, like
+// chainloading or shell scripts, which have no grub.cfg equivalent.
+var ErrNoKernel = errors.New("ipxe script does not load a kernel")
+
+var varRegexp = regexp.MustCompile(`\$\{([^}]+)\}`)
+
+// FromIPXE returns the grub.cfg booting the kernel and initrds loaded by the
+// iPXE script, with the variables set by the script expanded.
+func FromIPXE(script []byte) ([]byte, error) {
+	vars := map[string]string{}
+	expand := func(s string) string {
+		return varRegexp.ReplaceAllStringFunc(s, func(v string) string {
+			if value, ok := vars[v[2:len(v)-1]]; ok {
+				return value
+			}
+
+			return v
+		})
+	}
+
+	var kernel []string
+	var initrds []string
+	scanner := bufio.NewScanner(bytes.NewReader(script))
+	for scanner.Scan() {
+		// drop error handling, e.g. "set iface eth0 || shell", and the retry
+		// loops around fetches, e.g. "kernel ... && goto fetch1_done ||"
+		line := scanner.Text()
+		if i := strings.Index(line, " && "); i >= 0 {
+			line = line[:i]
+		}
+		if i := strings.Index(line, " ||"); i >= 0 {
+			line = line[:i]
+		}
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+		switch fields[0] {
+		case "set":
+			vars[fields[1]] = expand(strings.Join(fields[2:], " "))
+		case "kernel":
+			kernel = strings.Fields(expand(strings.Join(fields[1:], " ")))
+		case "initrd":
+			initrds = append(initrds, expand(fields[1]))
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, errors.Wrap(err, "reading ipxe script")
+	}
+	if len(kernel) == 0 {
+		return nil, ErrNoKernel
+	}
+
+	var b bytes.Buffer
+	b.WriteString("set timeout=0\n\n")
+	b.WriteString("menuentry \"Tinkerbell Boots\" {\n")
+	b.WriteString("\tlinux " + path(kernel[0]))
+	for _, arg := range kernel[1:] {
+		b.WriteString(" " + quote(arg))
+	}
+	b.WriteString("\n")
+	if len(initrds) > 0 {
+		b.WriteString("\tinitrd")
+		for _, initrd := range initrds {
+			b.WriteString(" " + path(initrd))
+		}
+		b.WriteString("\n")
+	}
+	b.WriteString("}\n")
+
+	return b.Bytes(), nil
+}
+
+// path returns the GRUB device path of uri, e.g. (http,example.com)/vmlinuz for
+// http://example.com/vmlinuz. URIs GRUB can not fetch are returned as is.
+func path(uri string) string {
+	u, err := url.Parse(uri)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "tftp") || u.Host == "" {
+		return uri
+	}
+
+	return "(" + u.Scheme + "," + u.Host + ")" + u.RequestURI()
+}
+
+// quote single quotes arg when it has characters GRUB would interpret.
+func quote(arg string) string {
+	if !strings.ContainsAny(arg, " \t\"'\\$;|&<>{}") {
+		return arg
+	}
+
+	return "'" + strings.ReplaceAll(arg, "'", `'\''`) + "'"
+}
@@ -0,0 +1,103 @@
+package grub
+
+import (
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+func TestFromIPXE(t *testing.T) {
+	tests := map[string]struct {
+		script string
+		want   string
+		err    error
+	}{
+		"kernel and initrds": {
+			script: `#!ipxe
+
+set iface eth0 || shell
+set base-url http://mirror.example.com/flatcar
+kernel ${base-url}/vmlinuz console=ttyS1 flatcar.autologin
+initrd ${base-url}/initrd.cpio.gz
+initrd tftp://10.1.1.1/extra.img
+boot
+`,
+			want: `set timeout=0
+
+menuentry "Tinkerbell Boots" {
+	linux (http,mirror.example.com)/flatcar/vmlinuz console=ttyS1 flatcar.autologin
+	initrd (http,mirror.example.com)/flatcar/initrd.cpio.gz (tftp,10.1.1.1)/extra.img
+}
+`,
+		},
+		"retried fetches": {
+			script: `#!ipxe
+
+set base-url http://mirror.example.com/flatcar
+set fetch1_attempt:int32 0
+:fetch1
+kernel ${base-url}/vmlinuz console=ttyS1 && goto fetch1_done ||
+inc fetch1_attempt
+iseq ${fetch1_attempt} 3 && shell ||
+goto fetch1
+:fetch1_done
+set fetch2_attempt:int32 0
+:fetch2
+initrd ${base-url}/initrd.cpio.gz && goto fetch2_done ||
+inc fetch2_attempt
+iseq ${fetch2_attempt} 3 && shell ||
+goto fetch2
+:fetch2_done
+boot
+`,
+			want: `set timeout=0
+
+menuentry "Tinkerbell Boots" {
+	linux (http,mirror.example.com)/flatcar/vmlinuz console=ttyS1
+	initrd (http,mirror.example.com)/flatcar/initrd.cpio.gz
+}
+`,
+		},
+		"nested and unknown variables": {
+			script: `set host mirror.example.com
+set base-url http://${host}:8080/osie
+kernel ${base-url}/vmlinuz mac=${net0/mac} iface=${iface}
+`,
+			want: `set timeout=0
+
+menuentry "Tinkerbell Boots" {
+	linux (http,mirror.example.com:8080)/osie/vmlinuz 'mac=${net0/mac}' 'iface=${iface}'
+}
+`,
+		},
+		"unsupported scheme kept": {
+			script: "kernel https://mirror.example.com/vmlinuz\n",
+			want: `set timeout=0
+
+menuentry "Tinkerbell Boots" {
+	linux https://mirror.example.com/vmlinuz
+}
+`,
+		},
+		"chain": {
+			script: "chain --autofree http://example.com/custom.ipxe\n",
+			err:    ErrNoKernel,
+		},
+		"shell": {
+			script: "#!ipxe\n\nshell\n",
+			err:    ErrNoKernel,
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			got, err := FromIPXE([]byte(tt.script))
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("unexpected error, want: %v, got: %v", tt.err, err)
+			}
+			if string(got) != tt.want {
+				t.Fatalf("unexpected grub.cfg, want:\n%s\ngot:\n%s", tt.want, got)
+			}
+		})
+	}
+}
@@ -1,16 +1,40 @@
 package httplog
 
 import (
+	"context"
 	"net"
 	"net/http"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/tinkerbell/boots/metrics"
 )
 
 type Handler struct {
 	http.Handler
+	// Routes, when set, names the route of a request in the request metrics,
+	// usually the *http.ServeMux wrapped by Handler.
+	Routes Router
+}
+
+// Router returns the pattern of the route matching a request, as *http.ServeMux does.
+type Router interface {
+	Handler(req *http.Request) (h http.Handler, pattern string)
+}
+
+type remoteAddrKey struct{}
+
+// RecordRemoteAddr wraps h so that the remote address of each request, as seen
+// before any X-Forwarded-For processing done by h, is logged by Handler next to
+// the X-Forwarded-For chain and the resolved client address.
+func RecordRemoteAddr(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		ctx := context.WithValue(req.Context(), remoteAddrKey{}, req.RemoteAddr)
+		h.ServeHTTP(w, req.WithContext(ctx))
+	})
 }
 
 func (h *Handler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
@@ -27,12 +51,28 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 	}
 	if log {
 		httplog.With("event", "sr", "method", method, "uri", uri, "client", client).Debug()
+		if remoteAddr, ok := req.Context().Value(remoteAddrKey{}).(string); ok {
+			httplog.With("event", "xff", "uri", uri, "remote_addr", remoteAddr, "xff", req.Header.Get("X-Forwarded-For"), "client", client).Info()
+		}
 	}
 
 	res := &ResponseWriter{ResponseWriter: w}
 	h.Handler.ServeHTTP(res, req) // process the request
 	d := time.Since(start)
 
+	route := "unknown"
+	if h.Routes != nil {
+		if _, pattern := h.Routes.Handler(req); pattern != "" {
+			route = pattern
+		}
+	}
+	code := res.StatusCode
+	if code == 0 {
+		// nothing was written, net/http answers 200
+		code = http.StatusOK
+	}
+	metrics.HTTPRequestsTotal.With(prometheus.Labels{"route": route, "code": strconv.Itoa(code)}).Inc()
+
 	if log {
 		httplog.With("event", "ss", "method", method, "uri", uri, "client", client, "duration", d, "status", res.StatusCode).Info()
 	}
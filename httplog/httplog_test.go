@@ -0,0 +1,128 @@
+package httplog
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/packethost/pkg/log"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/sebest/xff"
+	"github.com/tinkerbell/boots/metrics"
+)
+
+func TestMain(m *testing.M) {
+	l, err := log.Init("github.com/tinkerbell/boots")
+	if err != nil {
+		panic(nil)
+	}
+	defer l.Close()
+	Init(l)
+	metrics.Init(l)
+	os.Exit(m.Run()) //nolint:gocritic // this seems to be the correct pattern
+}
+
+// logRecorder captures the lines logged through a log.Test logger.
+type logRecorder struct {
+	*testing.T
+	lines []string
+}
+
+func (r *logRecorder) Logf(format string, args ...interface{}) {
+	r.lines = append(r.lines, fmt.Sprintf(format, args...))
+}
+
+func TestRecordRemoteAddr(t *testing.T) {
+	tests := map[string]struct {
+		record bool
+		want   bool
+	}{
+		"enabled":  {record: true, want: true},
+		"disabled": {record: false, want: false},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			r := &logRecorder{T: t}
+			httplog = log.Test(r, "http")
+
+			xffmw, err := xff.New(xff.Options{AllowedSubnets: []string{"10.0.0.0/8"}})
+			if err != nil {
+				t.Fatal(err)
+			}
+			var h http.Handler = xffmw.Handler(&Handler{Handler: http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				w.WriteHeader(http.StatusOK)
+			})})
+			if tt.record {
+				h = RecordRemoteAddr(h)
+			}
+
+			req := httptest.NewRequest("GET", "http://example.com/auto.ipxe", nil)
+			req.RemoteAddr = "10.0.0.1:4242"
+			req.Header.Set("X-Forwarded-For", "192.168.1.5, 10.0.0.2")
+			h.ServeHTTP(httptest.NewRecorder(), req)
+
+			var found bool
+			for _, line := range r.lines {
+				if !strings.Contains(line, `"event": "xff"`) {
+					continue
+				}
+				found = true
+				for _, want := range []string{`"remote_addr": "10.0.0.1:4242"`, `"xff": "192.168.1.5, 10.0.0.2"`, `"client": "192.168.1.5"`} {
+					if !strings.Contains(line, want) {
+						t.Errorf("expected %s in %s", want, line)
+					}
+				}
+			}
+			if found != tt.want {
+				t.Fatalf("xff log line found: %v, want: %v, logged: %v", found, tt.want, r.lines)
+			}
+		})
+	}
+}
+
+func TestRequestMetrics(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/phone-home", func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	mux.HandleFunc("/problem", func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	})
+	mux.HandleFunc("/unavailable/", func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	})
+	mux.HandleFunc("/implicit", func(w http.ResponseWriter, req *http.Request) {})
+	h := &Handler{Handler: mux, Routes: mux}
+
+	requests := []struct {
+		path  string
+		route string
+		code  string
+	}{
+		{path: "/phone-home", route: "/phone-home", code: "200"},
+		{path: "/problem", route: "/problem", code: "404"},
+		{path: "/problem", route: "/problem", code: "404"},
+		{path: "/unavailable/abc", route: "/unavailable/", code: "503"},
+		{path: "/implicit", route: "/implicit", code: "200"},
+	}
+	before := map[string]float64{}
+	for _, r := range requests {
+		before[r.route+r.code] = testutil.ToFloat64(metrics.HTTPRequestsTotal.WithLabelValues(r.route, r.code))
+	}
+	want := map[string]float64{}
+	for _, r := range requests {
+		req := httptest.NewRequest("GET", "http://example.com"+r.path, nil)
+		h.ServeHTTP(httptest.NewRecorder(), req)
+		want[r.route+r.code]++
+	}
+
+	for _, r := range requests {
+		got := testutil.ToFloat64(metrics.HTTPRequestsTotal.WithLabelValues(r.route, r.code)) - before[r.route+r.code]
+		if got != want[r.route+r.code] {
+			t.Errorf("unexpected count for route=%s code=%s, want: %v, got: %v", r.route, r.code, want[r.route+r.code], got)
+		}
+	}
+}
@@ -0,0 +1,121 @@
+package installers
+
+import (
+	"bytes"
+	"container/list"
+	"sync"
+	"time"
+
+	"github.com/tinkerbell/boots/conf"
+	"github.com/tinkerbell/boots/job"
+)
+
+// renderCache holds the configs rendered by the installer handlers.
+var renderCache = NewRenderCache(conf.RenderCacheSize, conf.RenderCacheTTL)
+
+// Render returns the config named name rendered for j, reusing the one last
+// rendered for a job with the same render key within conf.RenderCacheTTL.
+func Render(name string, j job.Job, render func(*bytes.Buffer) error) ([]byte, error) {
+	return renderCache.Render(name, j, render)
+}
+
+// RenderCache keeps up to size rendered configs for ttl, evicting the least
+// recently used ones first. A nil RenderCache renders every time.
+type RenderCache struct {
+	size int
+	ttl  time.Duration
+	now  func() time.Time
+
+	mu      sync.Mutex
+	lru     *list.List // of *renderEntry, most recently used first
+	entries map[string]*list.Element
+}
+
+type renderEntry struct {
+	key     string
+	b       []byte
+	expires time.Time
+}
+
+// NewRenderCache returns a RenderCache of size entries kept for ttl, nil if
+// either is not positive.
+func NewRenderCache(size int, ttl time.Duration) *RenderCache {
+	if size <= 0 || ttl <= 0 {
+		return nil
+	}
+
+	return &RenderCache{
+		size:    size,
+		ttl:     ttl,
+		now:     time.Now,
+		lru:     list.New(),
+		entries: make(map[string]*list.Element, size),
+	}
+}
+
+// Render returns the config named name rendered for j, from the cache when
+// there. Failed renders are not cached.
+func (c *RenderCache) Render(name string, j job.Job, render func(*bytes.Buffer) error) ([]byte, error) {
+	var key string
+	if c != nil {
+		if k := j.RenderKey(); k != "" {
+			key = name + "/" + k
+		}
+	}
+	if key != "" {
+		if b, ok := c.get(key); ok {
+			return b, nil
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := render(&buf); err != nil {
+		return nil, err
+	}
+	if key != "" {
+		c.add(key, buf.Bytes())
+	}
+
+	return buf.Bytes(), nil
+}
+
+func (c *RenderCache) get(key string) ([]byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	entry, _ := e.Value.(*renderEntry)
+	if !c.now().Before(entry.expires) {
+		c.lru.Remove(e)
+		delete(c.entries, key)
+
+		return nil, false
+	}
+	c.lru.MoveToFront(e)
+
+	return entry.b, true
+}
+
+func (c *RenderCache) add(key string, b []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry := &renderEntry{key: key, b: b, expires: c.now().Add(c.ttl)}
+	if e, ok := c.entries[key]; ok {
+		e.Value = entry
+		c.lru.MoveToFront(e)
+
+		return
+	}
+	c.entries[key] = c.lru.PushFront(entry)
+	for c.lru.Len() > c.size {
+		oldest := c.lru.Back()
+		c.lru.Remove(oldest)
+		if entry, ok := oldest.Value.(*renderEntry); ok {
+			delete(c.entries, entry.key)
+		}
+	}
+}
@@ -0,0 +1,102 @@
+package installers
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/tinkerbell/boots/job"
+)
+
+// renderJob returns a vmware job with a root password, changed by set.
+func renderJob(t *testing.T, set func(*job.Mock)) job.Job {
+	t.Helper()
+
+	m := job.NewMock(t, "some.slug", "test-facility")
+	m.SetOSSlug("vmware_esxi_7_0")
+	m.SetPassword("insecure")
+	if set != nil {
+		set(&m)
+	}
+
+	return m.Job()
+}
+
+func TestRenderCache(t *testing.T) {
+	now := time.Date(2022, 3, 1, 12, 0, 0, 0, time.UTC)
+	c := NewRenderCache(8, time.Minute)
+	c.now = func() time.Time { return now }
+
+	renders := 0
+	render := func(j job.Job) {
+		t.Helper()
+		if _, err := c.Render("kickstart", j, func(buf *bytes.Buffer) error {
+			renders++
+			buf.WriteString(j.PasswordHash())
+
+			return nil
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	render(renderJob(t, nil))
+	render(renderJob(t, nil))
+	if renders != 1 {
+		t.Fatalf("identical jobs rendered %d times, want: 1", renders)
+	}
+
+	for name, set := range map[string]func(*job.Mock){
+		"CustomData password":     func(m *job.Mock) { m.SetCustomData(map[string]interface{}{"rootpwcrypt": "override"}) },
+		"bad CustomData":          func(m *job.Mock) { m.SetCustomData([]string{"test"}) },
+		"CustomData not a string": func(m *job.Mock) { m.SetCustomData(map[string]interface{}{"rootpwcrypt": 4}) },
+		"os version":              func(m *job.Mock) { m.SetOSSlug("vmware_esxi_6_7") },
+		"mac":                     func(m *job.Mock) { m.SetMAC("00:00:ba:dd:be:ef") },
+	} {
+		before := renders
+		render(renderJob(t, set))
+		if renders != before+1 {
+			t.Fatalf("job with a different %s served from the cache", name)
+		}
+	}
+
+	now = now.Add(time.Minute)
+	render(renderJob(t, nil))
+	if renders != 7 {
+		t.Fatalf("expired render served from the cache, renders: %d, want: 7", renders)
+	}
+}
+
+func TestRenderCacheEviction(t *testing.T) {
+	c := NewRenderCache(1, time.Minute)
+	renders := 0
+	render := func(j job.Job) {
+		_, _ = c.Render("kickstart", j, func(*bytes.Buffer) error {
+			renders++
+
+			return nil
+		})
+	}
+
+	render(renderJob(t, nil))
+	render(renderJob(t, func(m *job.Mock) { m.SetOSSlug("vmware_esxi_6_7") }))
+	render(renderJob(t, nil))
+	if renders != 3 {
+		t.Fatalf("evicted render served from the cache, renders: %d, want: 3", renders)
+	}
+}
+
+func TestRenderCacheDisabled(t *testing.T) {
+	c := NewRenderCache(0, time.Minute)
+	renders := 0
+	for i := 0; i < 2; i++ {
+		_, _ = c.Render("kickstart", renderJob(t, nil), func(*bytes.Buffer) error {
+			renders++
+
+			return nil
+		})
+	}
+	if renders != 2 {
+		t.Fatalf("disabled cache rendered %d times, want: 2", renders)
+	}
+}
@@ -3,3 +3,7 @@ package customipxe
 import "errors"
 
 var ErrEmptyIPXEConfig = errors.New("ipxe config URL or Script must be defined")
+
+var ErrChainHostNotAllowed = errors.New("ipxe config URL host is not allowed")
+
+var ErrScriptNotAllowed = errors.New("ipxe config Script is not allowed with chain allowed hosts")
@@ -2,10 +2,12 @@ package customipxe
 
 import (
 	"context"
+	"fmt"
+	"sort"
 	"strings"
 
-	"github.com/packethost/pkg/log"
 	"github.com/tinkerbell/boots/client"
+	"github.com/tinkerbell/boots/conf"
 	"github.com/tinkerbell/boots/ipxe"
 	"github.com/tinkerbell/boots/job"
 )
@@ -28,7 +30,7 @@ func (i installer) BootScript(string) job.BootScript {
 }
 
 func (i installer) setBootScript(_ context.Context, j job.Job, s *ipxe.Script) {
-	logger := j.Logger.With("installer", "custom_ipxe")
+	logger := j.With("installer", "custom_ipxe")
 
 	var cfg *client.InstallerData
 	switch {
@@ -43,7 +45,7 @@ func (i installer) setBootScript(_ context.Context, j job.Job, s *ipxe.Script) {
 		}
 	case strings.HasPrefix(j.UserData(), "#!ipxe"):
 		cfg = &client.InstallerData{Script: j.UserData()}
-	case j.IPXEScriptURL() != "":
+	case strings.TrimSpace(j.IPXEScriptURL()) != "":
 		cfg = &client.InstallerData{Chain: j.IPXEScriptURL()}
 	default:
 		s.Echo("Unknown ipxe configuration")
@@ -53,13 +55,43 @@ func (i installer) setBootScript(_ context.Context, j job.Job, s *ipxe.Script) {
 		return
 	}
 
-	for _, kv := range i.extraIPXEVars {
+	for _, kv := range ipxeVars(i.extraIPXEVars, conf.IPXEVarsDedup, conf.IPXEVarsSort) {
 		s.Set(kv[0], kv[1])
 	}
 	ipxeScriptFromConfig(logger, cfg, j, s)
 }
 
-func ipxeScriptFromConfig(logger log.Logger, cfg *client.InstallerData, j job.Job, s *ipxe.Script) {
+// ipxeVars returns vars in the order they are set in the script. With dedup
+// only the last definition of each name is kept, in the position of the first,
+// with sorted the definitions are ordered by name.
+func ipxeVars(vars [][]string, dedup, sorted bool) [][]string {
+	if !dedup && !sorted {
+		return vars
+	}
+
+	out := make([][]string, 0, len(vars))
+	if dedup {
+		index := make(map[string]int, len(vars))
+		for _, kv := range vars {
+			if i, ok := index[kv[0]]; ok {
+				out[i] = kv
+
+				continue
+			}
+			index[kv[0]] = len(out)
+			out = append(out, kv)
+		}
+	} else {
+		out = append(out, vars...)
+	}
+	if sorted {
+		sort.SliceStable(out, func(i, j int) bool { return out[i][0] < out[j][0] })
+	}
+
+	return out
+}
+
+func ipxeScriptFromConfig(logger job.RedactingLogger, cfg *client.InstallerData, j job.Job, s *ipxe.Script) {
 	if err := validateConfig(cfg); err != nil {
 		s.Echo(err.Error())
 		s.Shell()
@@ -70,19 +102,49 @@ func ipxeScriptFromConfig(logger log.Logger, cfg *client.InstallerData, j job.Jo
 
 	s.PhoneHome("provisioning.104.01")
 	s.Set("packet_facility", j.FacilityCode())
-	s.Set("packet_plan", j.PlanSlug())
+	switch plan := strings.TrimSpace(j.PlanSlug()); {
+	case plan != "":
+		s.Set("packet_plan", j.PlanSlug())
+	case conf.CustomIPXEEmptyPlan != "":
+		logger.With("placeholder", conf.CustomIPXEEmptyPlan).Info("hardware has no plan slug, setting packet_plan to the placeholder")
+		s.Set("packet_plan", conf.CustomIPXEEmptyPlan)
+	default:
+		logger.Info("hardware has no plan slug, leaving packet_plan unset")
+	}
+	// Expose the NIC MACs of the hardware record so scripts can pick an interface by MAC,
+	// e.g. `iseq ${net1/mac} ${packet_mac1} && set iface net1`.
+	for i, port := range j.Interfaces() {
+		if mac := port.MAC(); mac != nil {
+			s.Set(fmt.Sprintf("packet_mac%d", i), mac.String())
+		}
+	}
 
-	if cfg.Chain != "" {
-		s.Chain(cfg.Chain)
-	} else if cfg.Script != "" {
+	if chain := strings.TrimSpace(cfg.Chain); chain != "" {
+		s.Chain(chain)
+	} else if strings.TrimSpace(cfg.Script) != "" {
 		s.AppendString(strings.TrimPrefix(cfg.Script, "#!ipxe"))
 	}
 }
 
+// validateConfig rejects configs that would render an invalid chain line or
+// an empty script, treating whitespace only values as empty, and chain URLs
+// outside of conf.ChainAllowedHosts. Inline scripts can fetch from anywhere,
+// they are rejected while conf.ChainAllowedHosts is set.
 func validateConfig(c *client.InstallerData) error {
-	if c.Chain == "" && c.Script == "" {
+	chain := strings.TrimSpace(c.Chain)
+	if chain == "" && strings.TrimSpace(c.Script) == "" {
 		return ErrEmptyIPXEConfig
 	}
+	if chain == "" {
+		if len(conf.ChainAllowedHosts) > 0 {
+			return ErrScriptNotAllowed
+		}
+
+		return nil
+	}
+	if !conf.ChainURLAllowed(chain) {
+		return ErrChainHostNotAllowed
+	}
 
 	return nil
 }
@@ -4,23 +4,25 @@ import (
 	"context"
 	"os"
 	"regexp"
+	"strings"
 	"testing"
 
 	l "github.com/packethost/pkg/log"
 	"github.com/stretchr/testify/require"
 	"github.com/tinkerbell/boots/client"
+	"github.com/tinkerbell/boots/conf"
 	"github.com/tinkerbell/boots/installers"
 	"github.com/tinkerbell/boots/ipxe"
 	"github.com/tinkerbell/boots/job"
 )
 
-var testLogger l.Logger
+var testLogger job.RedactingLogger
 
 func TestMain(m *testing.M) {
 	logger, _ := l.Init("github.com/tinkerbell/boots")
 	job.Init(logger)
 	installers.Init(logger)
-	testLogger = logger
+	testLogger = job.NewRedactingLogger(logger)
 	os.Exit(m.Run())
 }
 
@@ -42,6 +44,19 @@ func TestIpxeScript(t *testing.T) {
 			shell
 			`,
 		},
+		{
+			"installer: empty script url",
+			"custom_ipxe",
+			&client.InstallerData{Chain: " "},
+			`#!ipxe
+
+			echo Tinkerbell Boots iPXE
+			set dynamic_var1 dynamic_val1
+			set dynamic_var2 dynamic_val2
+			echo ipxe config URL or Script must be defined
+			shell
+			`,
+		},
 		{
 			"valid config",
 			"custom_ipxe",
@@ -116,6 +131,17 @@ func TestIpxeScript(t *testing.T) {
 			chain --autofree http://url/path.ipxe
 			`,
 		},
+		{
+			"instance: empty ipxe script url",
+			"",
+			&client.InstallerData{Chain: " \n"},
+			`#!ipxe
+
+			echo Tinkerbell Boots iPXE
+			echo Unknown ipxe configuration
+			shell
+			`,
+		},
 		{
 			"instance: userdata script",
 			"",
@@ -250,6 +276,174 @@ func TestIpxeScriptFromConfig(t *testing.T) {
 	}
 }
 
+func TestIpxeScriptFromConfigChainAllowedHosts(t *testing.T) {
+	defer func(hosts []string) { conf.ChainAllowedHosts = hosts }(conf.ChainAllowedHosts)
+	conf.ChainAllowedHosts = []string{"boot.example.com", "10.0.0.0/8"}
+
+	testCases := []struct {
+		name    string
+		chain   string
+		allowed bool
+	}{
+		{"allowed hostname", "http://boot.example.com/path.ipxe", true},
+		{"allowed hostname case", "http://Boot.Example.com:8080/path.ipxe", true},
+		{"allowed cidr", "http://10.1.2.3/path.ipxe", true},
+		{"disallowed hostname", "http://evil.example.com/path.ipxe", false},
+		{"disallowed ip", "http://192.168.1.1/path.ipxe", false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert := require.New(t)
+			mockJob := job.NewMock(t, "test.slug", "test.facility")
+
+			s := ipxe.NewScript()
+			ipxeScriptFromConfig(testLogger, &client.InstallerData{Chain: tc.chain}, mockJob.Job(), s)
+
+			if tc.allowed {
+				assert.Contains(string(s.Bytes()), "chain --autofree "+tc.chain+"\n")
+
+				return
+			}
+			want := `#!ipxe
+
+			echo Tinkerbell Boots iPXE
+			echo ipxe config URL host is not allowed
+			shell
+			`
+			assert.Equal(dedent(want), string(s.Bytes()))
+		})
+	}
+}
+
+func TestIpxeScriptFromConfigScriptAllowedHosts(t *testing.T) {
+	defer func(hosts []string) { conf.ChainAllowedHosts = hosts }(conf.ChainAllowedHosts)
+	conf.ChainAllowedHosts = []string{"boot.example.com"}
+
+	assert := require.New(t)
+	mockJob := job.NewMock(t, "test.slug", "test.facility")
+
+	s := ipxe.NewScript()
+	ipxeScriptFromConfig(testLogger, &client.InstallerData{Script: "chain http://evil.example.com/path.ipxe"}, mockJob.Job(), s)
+
+	want := `#!ipxe
+
+	echo Tinkerbell Boots iPXE
+	echo ipxe config Script is not allowed with chain allowed hosts
+	shell
+	`
+	assert.Equal(dedent(want), string(s.Bytes()))
+}
+
+func TestIpxeScriptFromConfigInterfaceMACs(t *testing.T) {
+	assert := require.New(t)
+	mockJob := job.NewMock(t, "test.slug", "test.facility")
+	mockJob.AddInterface("eth0", "00:00:ba:dd:be:e0")
+	mockJob.AddInterface("eth1", "00:00:ba:dd:be:e1")
+
+	cfg := &client.InstallerData{Script: "iseq ${net1/mac} ${packet_mac1} && set iface net1 ||"}
+	s := ipxe.NewScript()
+	ipxeScriptFromConfig(testLogger, cfg, mockJob.Job(), s)
+
+	want := `#!ipxe
+
+	echo Tinkerbell Boots iPXE
+
+	params
+	param body Device connected to DHCP system
+	param type provisioning.104.01
+	imgfetch ${tinkerbell}/phone-home##params
+	imgfree
+
+	set packet_facility test.facility
+	set packet_plan test.slug
+	set packet_mac0 00:00:ba:dd:be:e0
+	set packet_mac1 00:00:ba:dd:be:e1
+	iseq ${net1/mac} ${packet_mac1} && set iface net1 ||
+	`
+	assert.Equal(dedent(want), string(s.Bytes()))
+}
+
+func TestIpxeScriptFromConfigEmptyPlan(t *testing.T) {
+	defer func(plan string) { conf.CustomIPXEEmptyPlan = plan }(conf.CustomIPXEEmptyPlan)
+
+	testCases := []struct {
+		name        string
+		placeholder string
+		want        string
+	}{
+		{"omitted", "", "set packet_facility test.facility\nchain --autofree http://url/path.ipxe\n"},
+		{"placeholder", "none", "set packet_facility test.facility\nset packet_plan none\nchain --autofree http://url/path.ipxe\n"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			conf.CustomIPXEEmptyPlan = tc.placeholder
+			mockJob := job.NewMock(t, "", "test.facility")
+			s := ipxe.NewScript()
+			ipxeScriptFromConfig(testLogger, &client.InstallerData{Chain: "http://url/path.ipxe"}, mockJob.Job(), s)
+
+			got := string(s.Bytes())
+			require.NotContains(t, got, "set packet_plan \n")
+			require.True(t, strings.HasSuffix(got, tc.want), "unexpected script:\n%s", got)
+		})
+	}
+}
+
+func TestIpxeVars(t *testing.T) {
+	vars := [][]string{{"b", "1"}, {"a", "1"}, {"b", "2"}, {"c", "1"}}
+
+	testCases := []struct {
+		name   string
+		dedup  bool
+		sorted bool
+		want   [][]string
+	}{
+		{"as is", false, false, [][]string{{"b", "1"}, {"a", "1"}, {"b", "2"}, {"c", "1"}}},
+		{"dedup", true, false, [][]string{{"b", "2"}, {"a", "1"}, {"c", "1"}}},
+		{"sorted", false, true, [][]string{{"a", "1"}, {"b", "1"}, {"b", "2"}, {"c", "1"}}},
+		{"dedup and sorted", true, true, [][]string{{"a", "1"}, {"b", "2"}, {"c", "1"}}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			require.Equal(t, tc.want, ipxeVars(vars, tc.dedup, tc.sorted))
+		})
+	}
+}
+
+func TestIpxeScriptVarsDedupSorted(t *testing.T) {
+	defer func(dedup, sorted bool) {
+		conf.IPXEVarsDedup, conf.IPXEVarsSort = dedup, sorted
+	}(conf.IPXEVarsDedup, conf.IPXEVarsSort)
+	conf.IPXEVarsDedup, conf.IPXEVarsSort = true, true
+
+	mockJob := job.NewMock(t, "test.slug", "test.facility")
+	mockJob.SetIPXEScriptURL("http://url/path.ipxe")
+	s := ipxe.NewScript()
+
+	extraIPXEVars := [][]string{{"var2", "val1"}, {"var1", "val1"}, {"var2", "val2"}}
+	Installer(extraIPXEVars).BootScript("")(context.Background(), mockJob.Job(), s)
+
+	want := `#!ipxe
+
+	echo Tinkerbell Boots iPXE
+	set var1 val1
+	set var2 val2
+
+	params
+	param body Device connected to DHCP system
+	param type provisioning.104.01
+	imgfetch ${tinkerbell}/phone-home##params
+	imgfree
+
+	set packet_facility test.facility
+	set packet_plan test.slug
+	chain --autofree http://url/path.ipxe
+	`
+	require.Equal(t, dedent(want), string(s.Bytes()))
+}
+
 func TestConfigValidate(t *testing.T) {
 	testCases := []struct {
 		name   string
@@ -258,6 +452,7 @@ func TestConfigValidate(t *testing.T) {
 		want   string
 	}{
 		{"error when empty", "", "", "ipxe config URL or Script must be defined"},
+		{"error when blank", " \t", "\n", "ipxe config URL or Script must be defined"},
 		{"using chain", "http://chain.url/script.ipxe", "", ""},
 		{"using script", "", "#!ipxe\necho ipxe script", ""},
 		{"using both", "http://path", "ipxe script", ""},
@@ -0,0 +1,111 @@
+package installers
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"syscall"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/tinkerbell/boots/conf"
+)
+
+// checkFetchURL returns an error unless u has one of the conf.RemoteFetchSchemes
+// and a host allowed by conf.ChainHostAllowed. Nothing is allowed while
+// conf.ChainAllowedHosts is empty.
+func checkFetchURL(u *url.URL) error {
+	if len(conf.ChainAllowedHosts) == 0 {
+		return errors.New("remote fetches are disabled, CHAIN_ALLOWED_HOSTS is not set")
+	}
+	if _, ok := conf.RemoteFetchSchemes[u.Scheme]; !ok {
+		return errors.Errorf("scheme %q is not allowed", u.Scheme)
+	}
+	if u.Host == "" {
+		return errors.New("url has no host")
+	}
+	if !conf.ChainHostAllowed(u.Hostname()) {
+		return errors.Errorf("host %q is not allowed", u.Hostname())
+	}
+
+	return nil
+}
+
+// checkFetchAddr is the net.Dialer Control of Fetch, it refuses to connect to
+// loopback, link-local, private and unspecified addresses, whatever name
+// resolved to them, unless conf.ChainAllowedHosts allows them by address.
+func checkFetchAddr(_, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return errors.Wrap(err, "parsing dial address")
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return errors.Errorf("dial address %q is not an ip", host)
+	}
+	internal := ip.IsLoopback() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsPrivate() || ip.IsUnspecified() || ip.IsInterfaceLocalMulticast()
+	if internal && !conf.ChainHostAllowed(ip.String()) {
+		return errors.Errorf("address %s is not allowed", ip)
+	}
+
+	return nil
+}
+
+// Fetch returns the content at the URL rawURL, referenced from the metadata of
+// a machine. The URL, and any it redirects to, must pass checkFetchURL, the
+// connection must pass checkFetchAddr, the fetch fails after
+// conf.RemoteFetchTimeout and when the content exceeds conf.RemoteFetchMaxSize
+// bytes.
+func Fetch(ctx context.Context, rawURL string) ([]byte, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, errors.Wrap(err, "parsing url")
+	}
+	if err := checkFetchURL(u); err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, conf.RemoteFetchTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "creating request")
+	}
+	dialer := &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second, Control: checkFetchAddr}
+	c := &http.Client{
+		// no proxy, the address dialed must be the one checked
+		Transport: &http.Transport{DialContext: dialer.DialContext},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= 10 {
+				return errors.New("stopped after 10 redirects")
+			}
+
+			return errors.Wrap(checkFetchURL(req.URL), "redirect")
+		},
+	}
+	resp, err := c.Do(req)
+	if err != nil {
+		return nil, errors.Wrap(err, "fetching")
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.Errorf("unexpected status %s", resp.Status)
+	}
+	if resp.ContentLength > conf.RemoteFetchMaxSize {
+		return nil, errors.Errorf("content exceeds %d bytes", conf.RemoteFetchMaxSize)
+	}
+
+	b, err := io.ReadAll(io.LimitReader(resp.Body, conf.RemoteFetchMaxSize+1))
+	if err != nil {
+		return nil, errors.Wrap(err, "reading")
+	}
+	if int64(len(b)) > conf.RemoteFetchMaxSize {
+		return nil, errors.Errorf("content exceeds %d bytes", conf.RemoteFetchMaxSize)
+	}
+
+	return b, nil
+}
@@ -0,0 +1,81 @@
+package installers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tinkerbell/boots/conf"
+)
+
+func TestFetch(t *testing.T) {
+	defer func(schemes map[string]struct{}, timeout time.Duration, size int64, hosts []string) {
+		conf.RemoteFetchSchemes, conf.RemoteFetchTimeout, conf.RemoteFetchMaxSize, conf.ChainAllowedHosts = schemes, timeout, size, hosts
+	}(conf.RemoteFetchSchemes, conf.RemoteFetchTimeout, conf.RemoteFetchMaxSize, conf.ChainAllowedHosts)
+	conf.RemoteFetchSchemes = map[string]struct{}{"http": {}}
+	conf.RemoteFetchTimeout = 100 * time.Millisecond
+	conf.RemoteFetchMaxSize = 16
+	conf.ChainAllowedHosts = []string{"127.0.0.0/8"}
+
+	done := make(chan struct{})
+	defer close(done)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		switch req.URL.Path {
+		case "/ok":
+			_, _ = w.Write([]byte("content"))
+		case "/slow":
+			select {
+			case <-done:
+			case <-req.Context().Done():
+			}
+		case "/large":
+			_, _ = w.Write([]byte(strings.Repeat("x", 17)))
+		case "/redirect":
+			http.Redirect(w, req, "http://boots.example.com/ok", http.StatusFound)
+		}
+	}))
+	defer srv.Close()
+
+	local := strings.Replace(srv.URL, "127.0.0.1", "localhost", 1)
+	tests := map[string]struct {
+		url   string
+		hosts []string
+		want  string
+		err   string
+	}{
+		"ok":                  {url: srv.URL + "/ok", want: "content"},
+		"no allowed hosts":    {url: srv.URL + "/ok", hosts: []string{}, err: "CHAIN_ALLOWED_HOSTS is not set"},
+		"loopback by name":    {url: local + "/ok", hosts: []string{"localhost"}, err: "is not allowed"},
+		"loopback allowed":    {url: local + "/ok", hosts: []string{"localhost", "127.0.0.1", "::1"}, want: "content"},
+		"timeout":             {url: srv.URL + "/slow", err: "context deadline exceeded"},
+		"oversize":            {url: srv.URL + "/large", err: "content exceeds 16 bytes"},
+		"disallowed scheme":   {url: strings.Replace(srv.URL, "http://", "https://", 1) + "/ok", err: `scheme "https" is not allowed`},
+		"disallowed host":     {url: "http://boots.example.com/ok", err: `host "boots.example.com" is not allowed`},
+		"disallowed redirect": {url: srv.URL + "/redirect", err: `host "boots.example.com" is not allowed`},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			conf.ChainAllowedHosts = []string{"127.0.0.0/8"}
+			if tt.hosts != nil {
+				conf.ChainAllowedHosts = tt.hosts
+			}
+			got, err := Fetch(context.Background(), tt.url)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("unexpected error, want: %q, got: %v", tt.err, err)
+				}
+
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tt.want {
+				t.Fatalf("unexpected content, want: %q, got: %q", tt.want, got)
+			}
+		})
+	}
+}
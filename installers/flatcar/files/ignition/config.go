@@ -15,20 +15,117 @@ type Config struct {
 }
 
 func (c *Config) Render(w io.Writer) error {
+	b, err := c.marshal()
+	if err != nil {
+		return err
+	}
+
+	_, err = w.Write(b)
+	if err != nil {
+		return errors.Wrap(err, "writing ignition config")
+	}
+
+	return nil
+}
+
+// RenderMerged writes c merged into the version 1 ignition config base. The
+// systemd and networkd units of c are added to those of base, replacing units
+// of the same name, and the storage and passwd of c are used when base has none.
+func (c *Config) RenderMerged(w io.Writer, base []byte) error {
+	var merged map[string]interface{}
+	if err := json.Unmarshal(base, &merged); err != nil {
+		return errors.Wrap(err, "parsing base ignition config")
+	}
+	if merged == nil {
+		return errors.New("base ignition config is not an object")
+	}
+	if v, ok := merged["ignitionVersion"]; ok && v != float64(1) {
+		return errors.Errorf("unsupported base ignition config version %v", v)
+	}
+
+	b, err := c.marshal()
+	if err != nil {
+		return err
+	}
+	var own map[string]interface{}
+	if err := json.Unmarshal(b, &own); err != nil {
+		return errors.Wrap(err, "parsing ignition config")
+	}
+
+	for _, section := range []string{"systemd", "networkd"} {
+		units, err := mergeUnits(merged[section], own[section])
+		if err != nil {
+			return errors.WithMessagef(err, "merging %s units", section)
+		}
+		if units != nil {
+			merged[section] = units
+		}
+	}
+	for _, section := range []string{"storage", "passwd"} {
+		if _, ok := merged[section]; !ok && own[section] != nil {
+			merged[section] = own[section]
+		}
+	}
+	merged["ignitionVersion"] = 1
+
+	b, err = json.Marshal(merged)
+	if err != nil {
+		return errors.Wrap(err, "marshaling merged ignition config as json")
+	}
+	if _, err := w.Write(b); err != nil {
+		return errors.Wrap(err, "writing ignition config")
+	}
+
+	return nil
+}
+
+func (c *Config) marshal() ([]byte, error) {
 	v := struct {
 		Version int `json:"ignitionVersion"`
 		*Config
 	}{Version: 1, Config: c}
 
 	b, err := json.Marshal(&v)
-	if err != nil {
-		return errors.Wrap(err, "marshaling ignition config as json")
+
+	return b, errors.Wrap(err, "marshaling ignition config as json")
+}
+
+// mergeUnits returns the {"units": [...]} section with the units of base
+// followed by those of own, which replace the units of base of the same name.
+func mergeUnits(base, own interface{}) (map[string]interface{}, error) {
+	if own == nil {
+		return nil, nil
+	}
+	ownUnits := own.(map[string]interface{})["units"].([]interface{})
+	if base == nil {
+		return map[string]interface{}{"units": ownUnits}, nil
 	}
 
-	_, err = w.Write(b)
-	if err != nil {
-		return errors.Wrap(err, "writing ignition config")
+	section, ok := base.(map[string]interface{})
+	if !ok {
+		return nil, errors.New("section is not an object")
+	}
+	baseUnits, ok := section["units"].([]interface{})
+	if !ok && section["units"] != nil {
+		return nil, errors.New("units is not a list")
 	}
 
-	return nil
+	replaced := make(map[string]bool, len(ownUnits))
+	for _, u := range ownUnits {
+		name, _ := u.(map[string]interface{})["name"].(string)
+		replaced[name] = true
+	}
+	units := make([]interface{}, 0, len(baseUnits)+len(ownUnits))
+	for _, u := range baseUnits {
+		unit, ok := u.(map[string]interface{})
+		if !ok {
+			return nil, errors.New("unit is not an object")
+		}
+		if name, _ := unit["name"].(string); !replaced[name] {
+			units = append(units, u)
+		}
+	}
+	section["units"] = append(units, ownUnits...)
+
+	return section, nil
 }
@@ -1,9 +1,16 @@
 package flatcar
 
 import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
 	"fmt"
 	"net/http"
+	"net/url"
 
+	"github.com/pkg/errors"
+	"github.com/tinkerbell/boots/conf"
 	"github.com/tinkerbell/boots/installers"
 	"github.com/tinkerbell/boots/installers/flatcar/files/ignition"
 	"github.com/tinkerbell/boots/installers/flatcar/files/unit"
@@ -25,16 +32,37 @@ func buildNetworkUnits(j job.Job) (nu ignition.NetworkUnits) {
 	return
 }
 
-func buildSystemdUnits(j job.Job) (su ignition.SystemdUnits) {
+func buildSystemdUnits(j job.Job, nonce string) (su ignition.SystemdUnits) {
 	configureNetworkService(j, su.Add("systemd-networkd.service"))
 	configureNetworkService(j, su.Add("systemd-networkd-wait-online.service"))
-	configureInstaller(j, su.Add("install.service"))
+	install := su.Add("install.service")
+	configureInstaller(j, install)
+	if nonce != "" {
+		install.AddSection("Unit").AddComment("nonce " + nonce)
+	}
 
 	return
 }
 
+type ignitionNonceKey struct{}
+
+// withIgnitionNonce returns a copy of ctx rendering ignition configs with a
+// fresh random nonce, when conf.FlatcarIgnitionCacheBust is set.
+func withIgnitionNonce(ctx context.Context) (context.Context, error) {
+	if !conf.FlatcarIgnitionCacheBust {
+		return ctx, nil
+	}
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return ctx, errors.Wrap(err, "generating ignition nonce")
+	}
+
+	return context.WithValue(ctx, ignitionNonceKey{}, hex.EncodeToString(b)), nil
+}
+
 func ServeIgnitionConfig(jobManager job.Manager) func(w http.ResponseWriter, req *http.Request) {
 	return func(w http.ResponseWriter, req *http.Request) {
+		installers.SetSpanName(req.Context(), "flatcar", "ignition", nil)
 		_, j, err := jobManager.CreateFromRemoteAddr(req.Context(), req.RemoteAddr)
 		if err != nil {
 			installers.Logger("flatcar").With("client", req.RemoteAddr).Error(err)
@@ -42,13 +70,109 @@ func ServeIgnitionConfig(jobManager job.Manager) func(w http.ResponseWriter, req
 
 			return
 		}
-		c := ignition.Config{
-			Network: buildNetworkUnits(*j),
-			Systemd: buildSystemdUnits(*j),
+		installers.SetSpanName(req.Context(), "flatcar", "ignition", j)
+		ctx, err := withIgnitionNonce(req.Context())
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			j.Error(err)
+
+			return
+		}
+		render := func(buf *bytes.Buffer) error { return renderIgnitionConfig(ctx, *j, buf) }
+		var b []byte
+		if cacheable(*j) {
+			b, err = installers.Render("flatcar/ignition", *j, render)
+		} else {
+			var buf bytes.Buffer
+			err = render(&buf)
+			b = buf.Bytes()
 		}
-		if err := c.Render(w); err != nil {
+		if err != nil {
 			w.WriteHeader(http.StatusInternalServerError)
 			j.Error(err, "unable to render ignition config")
+
+			return
+		}
+		w.Header().Set("Cache-Control", "no-store")
+		_, _ = w.Write(b)
+	}
+}
+
+// cacheable reports whether the ignition config of j may be served from the
+// render cache. Cache busted configs carry their own nonce, and remote configs,
+// or the generated one served alone when they fail, may change between fetches.
+func cacheable(j job.Job) bool {
+	return !conf.FlatcarIgnitionCacheBust && ignitionURL(j) == ""
+}
+
+// IgnitionConfig returns the ignition config served to j.
+func IgnitionConfig(ctx context.Context, j job.Job) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := renderIgnitionConfig(ctx, j, &buf); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// renderIgnitionConfig writes the ignition config of j, merged into the one
+// at the instance CustomData "flatcar.ignition_url" if set and
+// conf.FlatcarRemoteIgnition is enabled. The generated config is written
+// alone if that one can not be fetched or merged.
+func renderIgnitionConfig(ctx context.Context, j job.Job, w *bytes.Buffer) error {
+	nonce, _ := ctx.Value(ignitionNonceKey{}).(string)
+	c := ignition.Config{
+		Network: buildNetworkUnits(j),
+		Systemd: buildSystemdUnits(j, nonce),
+	}
+
+	u := ignitionURL(j)
+	if u == "" {
+		return c.Render(w)
+	}
+	base, err := installers.Fetch(ctx, u)
+	if err == nil {
+		err = c.RenderMerged(w, base)
+		if err == nil {
+			return nil
 		}
+		w.Reset()
+	}
+	j.With("url", u).Error(errors.Wrap(err, "ignition config"), "serving the generated ignition config alone")
+
+	return c.Render(w)
+}
+
+// ignitionURL returns the http(s) URL of the instance CustomData
+// "flatcar.ignition_url", empty unless conf.FlatcarRemoteIgnition is enabled
+// and conf.ChainAllowedHosts restricts the hosts it may point at.
+func ignitionURL(j job.Job) string {
+	if !conf.FlatcarRemoteIgnition {
+		return ""
+	}
+	cd, ok := j.CustomData().(map[string]interface{})
+	if !ok {
+		return ""
+	}
+	fc, ok := cd["flatcar"].(map[string]interface{})
+	if !ok {
+		return ""
+	}
+	s, _ := fc["ignition_url"].(string)
+	if s == "" {
+		return ""
 	}
+	u, err := url.Parse(s)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		j.With("url", s).Info("ignoring invalid flatcar ignition url")
+
+		return ""
+	}
+	if len(conf.ChainAllowedHosts) == 0 {
+		j.With("url", s).Info("ignoring flatcar ignition url, CHAIN_ALLOWED_HOSTS is not set")
+
+		return ""
+	}
+
+	return s
 }
@@ -0,0 +1,193 @@
+package flatcar
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/tinkerbell/boots/conf"
+	"github.com/tinkerbell/boots/job"
+)
+
+func TestRenderIgnitionConfigRemote(t *testing.T) {
+	defer func(timeout time.Duration, remote bool, hosts []string) {
+		conf.RemoteFetchTimeout, conf.FlatcarRemoteIgnition, conf.ChainAllowedHosts = timeout, remote, hosts
+	}(conf.RemoteFetchTimeout, conf.FlatcarRemoteIgnition, conf.ChainAllowedHosts)
+	conf.RemoteFetchTimeout = time.Second
+	conf.FlatcarRemoteIgnition = true
+	conf.ChainAllowedHosts = []string{"127.0.0.0/8"}
+
+	remote := `{"ignitionVersion":1,"systemd":{"units":[{"name":"team.service","enable":true},{"name":"install.service","contents":"stale"}]},"passwd":{"users":[{"name":"core"}]}}`
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		switch req.URL.Path {
+		case "/ignition.json":
+			_, _ = w.Write([]byte(remote))
+		case "/invalid.json":
+			_, _ = w.Write([]byte(`{"ignitionVersion":2}`))
+		default:
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer srv.Close()
+
+	m := job.NewMock(t, "c3.small.x86", "ewr1")
+	var generated bytes.Buffer
+	if err := renderIgnitionConfig(context.Background(), m.Job(), &generated); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("merged", func(t *testing.T) {
+		m := job.NewMock(t, "c3.small.x86", "ewr1")
+		m.SetCustomData(map[string]interface{}{"flatcar": map[string]interface{}{"ignition_url": srv.URL + "/ignition.json"}})
+
+		var buf bytes.Buffer
+		if err := renderIgnitionConfig(context.Background(), m.Job(), &buf); err != nil {
+			t.Fatal(err)
+		}
+		var got struct {
+			Version int `json:"ignitionVersion"`
+			Systemd struct {
+				Units []struct {
+					Name     string `json:"name"`
+					Contents string `json:"contents"`
+				} `json:"units"`
+			} `json:"systemd"`
+			Passwd map[string]interface{} `json:"passwd"`
+		}
+		if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+			t.Fatal(err)
+		}
+		if got.Version != 1 || got.Passwd == nil {
+			t.Fatalf("remote config not kept: %s", buf.Bytes())
+		}
+		var names []string
+		for _, u := range got.Systemd.Units {
+			names = append(names, u.Name)
+			if u.Name == "install.service" && u.Contents == "stale" {
+				t.Fatal("remote install.service not replaced by the generated one")
+			}
+		}
+		want := []string{"team.service", "systemd-networkd.service", "systemd-networkd-wait-online.service", "install.service"}
+		if len(names) != len(want) {
+			t.Fatalf("unexpected units, want: %v, got: %v", want, names)
+		}
+		for i := range want {
+			if names[i] != want[i] {
+				t.Fatalf("unexpected units, want: %v, got: %v", want, names)
+			}
+		}
+	})
+
+	for _, tt := range []struct {
+		name   string
+		path   string
+		remote bool
+		hosts  []string
+	}{
+		{name: "fetch failure", path: "/missing.json", remote: true, hosts: []string{"127.0.0.0/8"}},
+		{name: "invalid config", path: "/invalid.json", remote: true, hosts: []string{"127.0.0.0/8"}},
+		{name: "disabled", path: "/ignition.json", hosts: []string{"127.0.0.0/8"}},
+		{name: "no allowed hosts", path: "/ignition.json", remote: true},
+		{name: "host not allowed", path: "/ignition.json", remote: true, hosts: []string{"boot.example.com"}},
+	} {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			conf.FlatcarRemoteIgnition, conf.ChainAllowedHosts = tt.remote, tt.hosts
+			m := job.NewMock(t, "c3.small.x86", "ewr1")
+			m.SetCustomData(map[string]interface{}{"flatcar": map[string]interface{}{"ignition_url": srv.URL + tt.path}})
+
+			var buf bytes.Buffer
+			if err := renderIgnitionConfig(context.Background(), m.Job(), &buf); err != nil {
+				t.Fatal(err)
+			}
+			if buf.String() != generated.String() {
+				t.Fatalf("generated config not served alone, want:\n%s\ngot:\n%s", generated.String(), buf.String())
+			}
+		})
+	}
+}
+
+func TestIgnitionConfigCacheable(t *testing.T) {
+	defer func(bust, remote bool, hosts []string) {
+		conf.FlatcarIgnitionCacheBust, conf.FlatcarRemoteIgnition, conf.ChainAllowedHosts = bust, remote, hosts
+	}(conf.FlatcarIgnitionCacheBust, conf.FlatcarRemoteIgnition, conf.ChainAllowedHosts)
+	conf.FlatcarRemoteIgnition, conf.ChainAllowedHosts = true, []string{"127.0.0.0/8"}
+
+	generated := job.NewMock(t, "c3.small.x86", "ewr1")
+	remote := job.NewMock(t, "c3.small.x86", "ewr1")
+	remote.SetCustomData(map[string]interface{}{"flatcar": map[string]interface{}{"ignition_url": "http://127.0.0.1/ignition.json"}})
+
+	tests := map[string]struct {
+		m    job.Mock
+		bust bool
+		want bool
+	}{
+		"generated":            {m: generated, want: true},
+		"generated cache bust": {m: generated, bust: true},
+		"remote":               {m: remote},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			conf.FlatcarIgnitionCacheBust = tt.bust
+			if got := cacheable(tt.m.Job()); got != tt.want {
+				t.Fatalf("unexpected cacheable, want: %v, got: %v", tt.want, got)
+			}
+		})
+	}
+}
+
+// jobManager creates the same job for any request.
+type jobManager struct {
+	j job.Job
+}
+
+func (m jobManager) CreateFromRemoteAddr(ctx context.Context, _ string) (context.Context, *job.Job, error) {
+	j := m.j
+
+	return ctx, &j, nil
+}
+
+func (m jobManager) CreateFromDHCP(ctx context.Context, _ net.HardwareAddr, _ net.IP, _, _ string) (context.Context, *job.Job, error) {
+	j := m.j
+
+	return ctx, &j, nil
+}
+
+func TestServeIgnitionConfigCacheBust(t *testing.T) {
+	defer func(bust bool) { conf.FlatcarIgnitionCacheBust = bust }(conf.FlatcarIgnitionCacheBust)
+
+	m := job.NewMock(t, "c3.small.x86", "ewr1")
+	var generated bytes.Buffer
+	if err := renderIgnitionConfig(context.Background(), m.Job(), &generated); err != nil {
+		t.Fatal(err)
+	}
+	serve := ServeIgnitionConfig(jobManager{m.Job()})
+	fetch := func() string {
+		w := httptest.NewRecorder()
+		serve(w, httptest.NewRequest("GET", "http://example.com"+IgnitionPathFlatcar, nil))
+		if got := w.Result().Header.Get("Cache-Control"); got != "no-store" {
+			t.Fatalf("unexpected Cache-Control, want: no-store, got: %q", got)
+		}
+
+		return w.Body.String()
+	}
+
+	for _, bust := range []bool{false, true} {
+		conf.FlatcarIgnitionCacheBust = bust
+		first, second := fetch(), fetch()
+		if !bust && (first != generated.String() || second != first) {
+			t.Fatalf("config changed without cache busting, want:\n%s\ngot:\n%s\n%s", generated.String(), first, second)
+		}
+		if bust && first == second {
+			t.Fatalf("consecutive fetches are identical with cache busting:\n%s", first)
+		}
+		if bust && !json.Valid([]byte(first)) {
+			t.Fatalf("cache busted config is not valid json:\n%s", first)
+		}
+	}
+}
@@ -1,6 +1,8 @@
 package flatcar
 
 import (
+	"regexp"
+	"sort"
 	"strings"
 
 	"github.com/tinkerbell/boots/conf"
@@ -8,13 +10,15 @@ import (
 	"github.com/tinkerbell/boots/job"
 )
 
-func getInstallOpts(j job.Job, channel, _ string) string {
+// getInstallOpts returns the flatcar-install options installing version,
+// "current" for the latest, of channel.
+func getInstallOpts(j job.Job, channel, version string) string {
 	base := map[bool]string{
-		true:  conf.OsieVendorServicesURL + "/flatcar/arm64-usr/" + channel,
-		false: conf.OsieVendorServicesURL + "/flatcar/amd64-usr/" + channel,
+		true:  j.ArtifactURL(conf.OsieVendorServicesURL + "/flatcar/arm64-usr/" + channel),
+		false: j.ArtifactURL(conf.OsieVendorServicesURL + "/flatcar/amd64-usr/" + channel),
 	}
 	args := []string{
-		"-V current",
+		"-V " + version,
 		"-C " + channel,
 		"-b " + base[j.IsARM()],
 	}
@@ -32,6 +36,22 @@ func getInstallOpts(j job.Job, channel, _ string) string {
 	return strings.Join(args, " ")
 }
 
+// channels are the flatcar release channels an install can be pinned to.
+var channels = map[string]bool{"alpha": true, "beta": true, "stable": true, "edge": true, "lts": true}
+
+func validChannel(channel string) bool {
+	return channels[channel]
+}
+
+// releaseVersion matches exact flatcar release versions, e.g. 3227.2.0.
+var releaseVersion = regexp.MustCompile(`^[0-9]+\.[0-9]+\.[0-9]+$`)
+
+// validVersion reports whether version is a channel or an exact release an
+// install can be pinned to.
+func validVersion(version string) bool {
+	return validChannel(version) || releaseVersion.MatchString(version)
+}
+
 func configureInstaller(j job.Job, u *ignition.SystemdUnit) {
 	u.AddSection("Unit", "Requires=systemd-networkd-wait-online.service", "After=systemd-networkd-wait-online.service")
 
@@ -43,6 +63,13 @@ func configureInstaller(j job.Job, u *ignition.SystemdUnit) {
 	if channel == "" {
 		channel = "alpha"
 	}
+	version := "current"
+	if v := j.OSVersion("flatcar", validVersion); validChannel(v) {
+		channel = v
+	} else if v != "" {
+		// an exact release, of the channel of the operating system
+		version = v
+	}
 	facilityCode = j.FacilityCode()
 	if facilityCode == "" {
 		facilityCode = conf.FacilityCode
@@ -50,12 +77,12 @@ func configureInstaller(j job.Job, u *ignition.SystemdUnit) {
 
 	var console string
 	if j.IsARM() {
-		console = "console=ttyAMA0,115200"
+		console = "console=" + conf.FlatcarARMConsoleFor(facilityCode, j.PlanSlug())
 	} else {
 		console = "console=tty0 console=ttyS1,115200n8"
 	}
 
-	installOpts := getInstallOpts(j, channel, facilityCode)
+	installOpts := getInstallOpts(j, channel, version)
 	lines := []string{
 		// Install to disk:
 		`/usr/bin/curl --retry 10 -H "Content-Type: application/json" -X POST -d '{"type":"provisioning.106"}' ${phone_home_url}`,
@@ -65,10 +92,13 @@ func configureInstaller(j job.Job, u *ignition.SystemdUnit) {
 		"/usr/bin/mount /dev/disk/by-label/OEM /oemmnt",
 		`/usr/bin/bash -c "/usr/bin/echo \"set linux_console=\\\"` + console + `\\\"\" >> /oemmnt/grub.cfg"`,
 		`/usr/bin/curl -H "Content-Type: application/json" -X POST -d '{"type":"provisioning.109"}' ${phone_home_url}`,
-		"/usr/bin/systemctl reboot",
+		"/usr/bin/systemctl " + postInstallAction(j),
 	}
 
 	s := u.AddSection("Service", "Type=oneshot")
+	for _, env := range installEnvironment(j) {
+		s.Add("Environment", env)
+	}
 	for _, line := range lines {
 		s.Add("ExecStart", line)
 	}
@@ -77,6 +107,64 @@ func configureInstaller(j job.Job, u *ignition.SystemdUnit) {
 	u.Enable()
 }
 
+// postInstallAction returns the systemctl action ending the install, the
+// instance CustomData "flatcar.post_install_action" or the configured default.
+func postInstallAction(j job.Job) string {
+	if cd, ok := j.CustomData().(map[string]interface{}); ok {
+		if fc, ok := cd["flatcar"].(map[string]interface{}); ok {
+			switch action, _ := fc["post_install_action"].(string); action {
+			case "reboot", "poweroff", "halt":
+				return action
+			}
+		}
+	}
+
+	return conf.FlatcarPostInstallAction
+}
+
+var envName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// installEnvironment returns the sorted KEY=VALUE assignments of the instance
+// CustomData "flatcar.environment" map, quoted for a systemd Environment= line.
+// Invalid names and non-string or multiline values are skipped.
+func installEnvironment(j job.Job) []string {
+	cd, ok := j.CustomData().(map[string]interface{})
+	if !ok {
+		return nil
+	}
+	fc, ok := cd["flatcar"].(map[string]interface{})
+	if !ok {
+		return nil
+	}
+	env, ok := fc["environment"].(map[string]interface{})
+	if !ok {
+		return nil
+	}
+
+	keys := make([]string, 0, len(env))
+	for k := range env {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var assignments []string
+	for _, k := range keys {
+		v, ok := env[k].(string)
+		if !envName.MatchString(k) || !ok || strings.ContainsAny(v, "\r\n") {
+			j.With("key", k).Info("skipping invalid flatcar install environment variable")
+
+			continue
+		}
+		assignment := k + "=" + strings.ReplaceAll(v, "%", "%%")
+		if strings.ContainsAny(v, " \t\"\\") {
+			assignment = `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(assignment) + `"`
+		}
+		assignments = append(assignments, assignment)
+	}
+
+	return assignments
+}
+
 func configureNetworkService(_ job.Job, u *ignition.SystemdUnit) {
 	u.Enable()
 }
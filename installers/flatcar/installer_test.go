@@ -40,6 +40,119 @@ func TestInstaller(t *testing.T) {
 	}
 }
 
+func TestInstallerEnvironment(t *testing.T) {
+	m := job.NewMock(t, "c3.small.x86", facility)
+	m.SetOSDistro("flatcar")
+	m.SetOSSlug("flatcar_alpha")
+	m.SetOSVersion("alpha")
+	m.SetCustomData(map[string]interface{}{
+		"flatcar": map[string]interface{}{
+			"environment": map[string]interface{}{
+				"SITE_MIRROR": "http://mirror.example.com/flatcar",
+				"EXTRA_ARGS":  "--verbose --retries 3",
+				"1NVALID":     "skipped",
+			},
+		},
+	})
+
+	env := []string{
+		`Environment="EXTRA_ARGS=--verbose --retries 3"`,
+		"Environment=SITE_MIRROR=http://mirror.example.com/flatcar",
+	}
+	assertLines(t, m, append(env, Exec...))
+}
+
+func TestInstallerPostInstallAction(t *testing.T) {
+	defer func(action string) { conf.FlatcarPostInstallAction = action }(conf.FlatcarPostInstallAction)
+
+	tests := map[string]struct {
+		conf       string
+		customData interface{}
+		want       string
+	}{
+		"default":                  {conf: "reboot", want: "reboot"},
+		"conf poweroff":            {conf: "poweroff", want: "poweroff"},
+		"conf halt":                {conf: "halt", want: "halt"},
+		"custom data poweroff":     {conf: "reboot", customData: map[string]interface{}{"flatcar": map[string]interface{}{"post_install_action": "poweroff"}}, want: "poweroff"},
+		"custom data overrides":    {conf: "halt", customData: map[string]interface{}{"flatcar": map[string]interface{}{"post_install_action": "reboot"}}, want: "reboot"},
+		"invalid custom data used": {conf: "reboot", customData: map[string]interface{}{"flatcar": map[string]interface{}{"post_install_action": "kexec"}}, want: "reboot"},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			conf.FlatcarPostInstallAction = tt.conf
+			m := job.NewMock(t, "c3.small.x86", facility)
+			m.SetOSDistro("flatcar")
+			m.SetOSSlug("flatcar_alpha")
+			m.SetOSVersion("alpha")
+			m.SetCustomData(tt.customData)
+
+			su := ignition.SystemdUnits{}
+			configureInstaller(m.Job(), su.Add("install.service"))
+			bytes, err := su[0].Contents.MarshalText()
+			require.NoError(t, err)
+
+			lines := strings.Split(string(bytes), "\n")
+			require.Contains(t, lines, "ExecStart=/usr/bin/systemctl "+tt.want)
+			for _, action := range []string{"reboot", "poweroff", "halt"} {
+				if action != tt.want {
+					require.NotContains(t, lines, "ExecStart=/usr/bin/systemctl "+action)
+				}
+			}
+		})
+	}
+}
+
+func TestInstallerOSVersionPin(t *testing.T) {
+	defer func(versions map[string]map[string]string) { conf.FacilityOSVersions = versions }(conf.FacilityOSVersions)
+
+	tests := map[string]struct {
+		customData interface{}
+		versions   map[string]map[string]string
+		want       string
+	}{
+		"no pin":        {want: "-V current -C beta"},
+		"channel pin":   {customData: map[string]interface{}{"os_version": "stable"}, want: "-V current -C stable"},
+		"release pin":   {customData: map[string]interface{}{"os_version": "3227.2.0"}, want: "-V 3227.2.0 -C beta"},
+		"invalid pin":   {customData: map[string]interface{}{"os_version": "nightly"}, want: "-V current -C beta"},
+		"malformed pin": {customData: map[string]interface{}{"os_version": "3227.2"}, want: "-V current -C beta"},
+		"facility default": {
+			versions: map[string]map[string]string{facility: {"flatcar": "lts"}},
+			want:     "-V current -C lts",
+		},
+		"other facility default": {
+			versions: map[string]map[string]string{"other": {"flatcar": "lts"}},
+			want:     "-V current -C beta",
+		},
+		"invalid facility default": {
+			versions: map[string]map[string]string{facility: {"flatcar": "nightly"}},
+			want:     "-V current -C beta",
+		},
+		"pin over facility default": {
+			customData: map[string]interface{}{"os_version": "stable"},
+			versions:   map[string]map[string]string{facility: {"flatcar": "lts"}},
+			want:       "-V current -C stable",
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			conf.FacilityOSVersions = tt.versions
+			m := job.NewMock(t, "c3.small.x86", facility)
+			m.SetOSDistro("flatcar")
+			m.SetOSSlug("flatcar_beta")
+			m.SetOSVersion("beta")
+			m.SetCustomData(tt.customData)
+
+			su := ignition.SystemdUnits{}
+			configureInstaller(m.Job(), su.Add("install.service"))
+			bytes, err := su[0].Contents.MarshalText()
+			require.NoError(t, err)
+			require.Contains(t, string(bytes), " "+tt.want+" ")
+		})
+	}
+}
+
 // this is the base set of starter commands for flatcar installs.
 var baseStart = []string{
 	"[Unit]",
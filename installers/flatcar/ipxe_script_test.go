@@ -2,10 +2,14 @@ package flatcar
 
 import (
 	"context"
+	"net/http/httptest"
 	"os"
+	"strings"
 	"testing"
 
 	"github.com/andreyvit/diff"
+	"github.com/packethost/pkg/log"
+	"github.com/tinkerbell/boots/client"
 	"github.com/tinkerbell/boots/conf"
 	"github.com/tinkerbell/boots/ipxe"
 	"github.com/tinkerbell/boots/job"
@@ -45,6 +49,154 @@ func TestScript(t *testing.T) {
 	}
 }
 
+func TestScriptURLScheme(t *testing.T) {
+	defer func(url string) { conf.OsieVendorServicesURL = url }(conf.OsieVendorServicesURL)
+	conf.OsieVendorServicesURL = "https://vendors.example.com"
+
+	m := job.NewMock(t, "c3.small.x86", facility)
+	m.SetOSDistro("flatcar")
+	m.SetCustomData(map[string]interface{}{"osie_url_scheme": "http"})
+
+	s := ipxe.NewScript()
+	Installer(nil).BootScript("")(context.Background(), m.Job(), s)
+
+	got := string(s.Bytes())
+	if want := "set base-url http://vendors.example.com/flatcar\n"; !strings.Contains(got, want) {
+		t.Fatalf("expected %q in iPXE script:\n%s", want, got)
+	}
+	if want := "-b http://vendors.example.com/flatcar/amd64-usr/"; !strings.Contains(getInstallOpts(m.Job(), "alpha", "current"), want) {
+		t.Fatalf("expected %q in install options", want)
+	}
+}
+
+func TestScriptFacilityPublicFQDN(t *testing.T) {
+	defer func(fqdn string, fqdns map[string]string) {
+		conf.PublicFQDN, conf.FacilityPublicFQDNs = fqdn, fqdns
+	}(conf.PublicFQDN, conf.FacilityPublicFQDNs)
+	conf.PublicFQDN = "boots.example.com"
+	conf.FacilityPublicFQDNs = map[string]string{"ewr1": "boots.ewr1.example.com", "sjc1": "boots.sjc1.example.com"}
+
+	i := job.NewInstallers()
+	i.RegisterDistro("flatcar", Installer(nil).BootScript("flatcar"))
+
+	for facility, want := range map[string]string{
+		"ewr1": "http://boots.ewr1.example.com",
+		"sjc1": "http://boots.sjc1.example.com",
+		"ams1": "http://boots.example.com",
+	} {
+		t.Run(facility, func(t *testing.T) {
+			m := job.NewMock(t, "c3.small.x86", facility)
+			m.SetOSDistro("flatcar")
+			w := httptest.NewRecorder()
+			m.Job().ServeFile(w, httptest.NewRequest("GET", "http://127.0.0.1/auto.ipxe", nil), i)
+			got := w.Body.String()
+
+			// phone_home_url is passed to the installer as ${tinkerbell}/phone-home
+			if !strings.Contains(got, "systemd.setenv=phone_home_url=${tinkerbell}/phone-home") {
+				t.Fatalf("phone_home_url not derived from tinkerbell in iPXE script:\n%s", got)
+			}
+			if line := "set tinkerbell " + want + "\n"; !strings.Contains(got, line) {
+				t.Fatalf("expected %q in iPXE script:\n%s", line, got)
+			}
+		})
+	}
+}
+
+func TestScriptARMConsole(t *testing.T) {
+	defer func(consoles map[string]string) { conf.FlatcarARMConsoles = consoles }(conf.FlatcarARMConsoles)
+	conf.FlatcarARMConsoles = map[string]string{"sjc1": "ttyS0,115200"}
+
+	for facility, want := range map[string]string{
+		"sjc1": "console=ttyS0,115200 ",
+		"ewr1": "console=ttyAMA0,115200 ",
+	} {
+		t.Run(facility, func(t *testing.T) {
+			m := job.NewMock(t, "c3.large.arm", facility)
+			m.SetOSDistro("flatcar")
+
+			s := ipxe.NewScript()
+			Installer(nil).BootScript("")(context.Background(), m.Job(), s)
+			if got := string(s.Bytes()); !strings.Contains(got, want) {
+				t.Fatalf("expected %q in iPXE script:\n%s", want, got)
+			}
+		})
+	}
+}
+
+func TestScriptPlanKernelArgs(t *testing.T) {
+	defer func(args map[string]string) { conf.PlanKernelArgs = args }(conf.PlanKernelArgs)
+	conf.PlanKernelArgs = nil
+
+	script := func(plan string) string {
+		m := job.NewMock(t, plan, facility)
+		m.SetOSDistro("flatcar")
+		s := ipxe.NewScript()
+		Installer(nil).BootScript("")(context.Background(), m.Job(), s)
+
+		return string(s.Bytes())
+	}
+	defaults := script("c3.small.x86")
+	conf.PlanKernelArgs = map[string]string{"m3.large.x86": "hugepages=16 default_hugepagesz=1G"}
+
+	if got := script("c3.small.x86"); got != defaults {
+		t.Fatalf("script of a plan without kernel args changed:\n%s", diff.LineDiff(defaults, got))
+	}
+	want := "systemd.setenv=phone_home_url=${tinkerbell}/phone-home hugepages=16 default_hugepagesz=1G\n"
+	if got := script("m3.large.x86"); !strings.Contains(got, want) {
+		t.Fatalf("expected %q in iPXE script:\n%s", want, got)
+	}
+}
+
+func TestScriptBootSlots(t *testing.T) {
+	for _, slot := range []string{"a", "b"} {
+		t.Run(slot, func(t *testing.T) {
+			m := job.NewMock(t, "c3.small.x86", facility)
+			m.SetOSDistro("flatcar")
+			m.SetCustomData(map[string]interface{}{
+				"flatcar": map[string]interface{}{
+					"slot_a_url":  "http://images.example.com/flatcar/3227.2.0",
+					"slot_b_url":  "http://images.example.com/flatcar/3227.2.1",
+					"active_slot": slot,
+				},
+			})
+
+			s := ipxe.NewScript()
+			s.Set("tinkerbell", "http://127.0.0.1")
+			Installer(nil).BootScript("")(context.Background(), m.Job(), s)
+
+			want := `#!ipxe
+
+echo Tinkerbell Boots iPXE
+set tinkerbell http://127.0.0.1
+
+params
+param body Device connected to DHCP system
+param type provisioning.104.01
+imgfetch ${tinkerbell}/phone-home##params
+imgfree
+
+set active_slot ` + slot + `
+iseq ${active_slot} b && goto slot_b ||
+:slot_a
+echo Booting flatcar slot a
+set base-url http://images.example.com/flatcar/3227.2.0
+kernel ${base-url}/flatcar_production_pxe.vmlinuz console=ttyS1,115200n8 console=tty0 vga=773 initrd=flatcar_production_pxe_image.cpio.gz bonding.max_bonds=0 flatcar.autologin flatcar.first_boot=1 flatcar.config.url=${tinkerbell}/flatcar/ignition.json systemd.setenv=phone_home_url=${tinkerbell}/phone-home
+initrd ${base-url}/flatcar_production_pxe_image.cpio.gz
+boot
+:slot_b
+echo Booting flatcar slot b
+set base-url http://images.example.com/flatcar/3227.2.1
+kernel ${base-url}/flatcar_production_pxe.vmlinuz console=ttyS1,115200n8 console=tty0 vga=773 initrd=flatcar_production_pxe_image.cpio.gz bonding.max_bonds=0 flatcar.autologin flatcar.first_boot=1 flatcar.config.url=${tinkerbell}/flatcar/ignition.json systemd.setenv=phone_home_url=${tinkerbell}/phone-home
+initrd ${base-url}/flatcar_production_pxe_image.cpio.gz
+boot
+`
+			if got := string(s.Bytes()); got != want {
+				t.Fatalf("bad iPXE script:\n%v", diff.LineDiff(want, got))
+			}
+		})
+	}
+}
+
 var pxeByPlan = map[string]struct {
 	plan   string
 	script string
@@ -98,3 +250,55 @@ boot
 `,
 	},
 }
+
+func TestScriptNonce(t *testing.T) {
+	defer func(enabled bool) { conf.IPXENonce = enabled }(conf.IPXENonce)
+	conf.IPXENonce = true
+
+	m := job.NewMock(t, "c3.small.x86", facility)
+	m.SetOSDistro("flatcar")
+	m.SetMAC("00:00:ba:dd:be:ef")
+	m.SetReporter(client.NewNoOpReporter(log.Test(t, "TestScriptNonce")))
+	i := job.NewInstallers()
+	i.RegisterDistro("flatcar", Installer(nil).BootScript(""))
+
+	script, ok := m.Job().AutoScript(context.Background(), i)
+	if !ok {
+		t.Fatal("no boot script")
+	}
+	if !strings.Contains(string(script), " systemd.setenv=phone_home_url=${tinkerbell}/phone-home?nonce=${boots_nonce}") {
+		t.Fatalf("phone_home_url without the nonce:\n%s", script)
+	}
+
+	var nonce string
+	for _, line := range strings.Split(string(script), "\n") {
+		if strings.HasPrefix(line, "set boots_nonce ") {
+			nonce = strings.TrimPrefix(line, "set boots_nonce ")
+		}
+	}
+	// install.service posts to the phone_home_url
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest("POST", "http://127.0.0.1/phone-home?nonce="+nonce, strings.NewReader(`{"type":"provisioning.109"}`))
+	req.Header.Set("Content-Type", "application/json")
+	m.Job().ServePhoneHomeEndpoint(w, req)
+	if got := w.Result().StatusCode; got != 200 {
+		t.Fatalf("phone-home with the script nonce refused, got: %d", got)
+	}
+}
+
+func TestScriptBootSlotsAllowedHosts(t *testing.T) {
+	defer func(hosts []string) { conf.ChainAllowedHosts = hosts }(conf.ChainAllowedHosts)
+	conf.ChainAllowedHosts = []string{"boot.example.com"}
+
+	m := job.NewMock(t, "c3.small.x86", facility)
+	m.SetOSDistro("flatcar")
+	m.SetCustomData(map[string]interface{}{
+		"flatcar": map[string]interface{}{
+			"slot_a_url": "http://boot.example.com/flatcar/3227.2.0",
+			"slot_b_url": "http://images.example.com/flatcar/3227.2.1",
+		},
+	})
+	if slots := bootSlots(m.Job()); slots != nil {
+		t.Fatalf("boot slots with a disallowed host used: %v", slots)
+	}
+}
@@ -2,6 +2,8 @@ package flatcar
 
 import (
 	"context"
+	"net/url"
+	"time"
 
 	"github.com/tinkerbell/boots/conf"
 	"github.com/tinkerbell/boots/ipxe"
@@ -38,7 +40,12 @@ func (i installer) setBootScript(_ context.Context, j job.Job, s *ipxe.Script) {
 	}
 
 	s.PhoneHome("provisioning.104.01")
-	s.Set("base-url", conf.OsieVendorServicesURL+"/flatcar")
+	if slots := bootSlots(j); slots != nil {
+		setSlotsBootScript(j, s, slots)
+
+		return
+	}
+	s.Set("base-url", j.ArtifactURL(conf.OsieVendorServicesURL+"/flatcar"))
 	s.Kernel("${base-url}/" + kernelPath(j))
 
 	kernelParams(j, s)
@@ -47,10 +54,80 @@ func (i installer) setBootScript(_ context.Context, j job.Job, s *ipxe.Script) {
 	s.Boot()
 }
 
+// bootSlots returns the base URLs of the A/B boot slots by slot name, from the
+// instance CustomData "flatcar.slot_a_url" and "flatcar.slot_b_url", nil unless
+// both are valid http(s) URLs of hosts allowed by conf.ChainAllowedHosts.
+func bootSlots(j job.Job) map[string]string {
+	cd, ok := j.CustomData().(map[string]interface{})
+	if !ok {
+		return nil
+	}
+	fc, ok := cd["flatcar"].(map[string]interface{})
+	if !ok {
+		return nil
+	}
+
+	slots := make(map[string]string, 2)
+	for _, slot := range []string{"a", "b"} {
+		s, _ := fc["slot_"+slot+"_url"].(string)
+		if s == "" {
+			return nil
+		}
+		u, err := url.Parse(s)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			j.With("url", s, "slot", slot).Info("ignoring flatcar boot slots with an invalid url")
+
+			return nil
+		}
+		if !conf.ChainHostAllowed(u.Hostname()) {
+			j.With("url", s, "slot", slot).Info("ignoring flatcar boot slots, host is not allowed")
+
+			return nil
+		}
+		slots[slot] = s
+	}
+
+	return slots
+}
+
+// activeSlot returns the instance CustomData "flatcar.active_slot", a by default.
+func activeSlot(j job.Job) string {
+	cd, _ := j.CustomData().(map[string]interface{})
+	fc, _ := cd["flatcar"].(map[string]interface{})
+	switch slot, _ := fc["active_slot"].(string); slot {
+	case "", "a":
+		return "a"
+	case "b":
+		return "b"
+	default:
+		j.With("active_slot", slot).Info("unknown flatcar active slot, using a")
+
+		return "a"
+	}
+}
+
+// setSlotsBootScript emits a labeled block booting the kernel and initrd of
+// each slot and jumps to the one of the active slot.
+func setSlotsBootScript(j job.Job, s *ipxe.Script, slots map[string]string) {
+	s.Set("active_slot", activeSlot(j))
+	s.IfEq("active_slot", "b", "slot_b")
+	for _, slot := range []string{"a", "b"} {
+		s.Label("slot_" + slot)
+		s.Echo("Booting flatcar slot " + slot)
+		s.Set("base-url", slots[slot])
+		s.Kernel("${base-url}/" + kernelPath(j))
+
+		kernelParams(j, s)
+
+		s.Initrd("${base-url}/" + initrdPath(j))
+		s.Boot()
+	}
+}
+
 func kernelParams(j job.Job, s *ipxe.Script) {
 	// Linux Kernel
 	if j.IsARM() {
-		s.Args("console=ttyAMA0,115200")
+		s.Args("console=" + conf.FlatcarARMConsoleFor(j.FacilityCode(), j.PlanSlug()))
 		s.Args("initrd=" + initrdPath(j))
 	} else {
 		s.Args("console=ttyS1,115200n8 console=tty0 vga=773")
@@ -67,7 +144,18 @@ func kernelParams(j job.Job, s *ipxe.Script) {
 	s.Args("flatcar.config.url=${tinkerbell}/flatcar/ignition.json")
 
 	// Environment Variables
-	s.Args("systemd.setenv=phone_home_url=${tinkerbell}/phone-home")
+	phoneHome := "${tinkerbell}/phone-home"
+	if conf.IPXENonce {
+		phoneHome += "?nonce=${boots_nonce}"
+	}
+	s.Args("systemd.setenv=phone_home_url=" + phoneHome)
+
+	if args := conf.PlanKernelArgsFor(j.PlanSlug()); args != "" {
+		s.Args(args)
+	}
+	if args := j.DebugKernelArgs(time.Now()); args != "" {
+		s.Args(args)
+	}
 }
 
 func kernelPath(j job.Job) string {
@@ -4,6 +4,7 @@ import (
 	"sync"
 
 	"github.com/packethost/pkg/log"
+	"github.com/tinkerbell/boots/job"
 )
 
 var (
@@ -15,14 +16,16 @@ func Init(l log.Logger) {
 	installerslog = l
 }
 
-func Logger(os string) log.Logger {
+// Logger returns the logger of the installer os, masking the sensitive fields
+// added to its context.
+func Logger(os string) job.RedactingLogger {
 	logger, ok := loggers.Load(os)
 	if !ok {
-		logger = installerslog.Package("installers/" + os)
+		logger = job.NewRedactingLogger(installerslog.Package("installers/" + os))
 		logger, _ = loggers.LoadOrStore(os, logger)
 	}
 
-	l, _ := logger.(log.Logger)
+	l, _ := logger.(job.RedactingLogger)
 
 	return l
 }
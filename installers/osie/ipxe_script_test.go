@@ -4,9 +4,11 @@ import (
 	"context"
 	"crypto/rand"
 	"fmt"
+	"net"
 	"os"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/andreyvit/diff"
 	"github.com/tinkerbell/boots/conf"
@@ -190,3 +192,198 @@ initrd ${base-url}/initramfs-${arch}
 boot
 `,
 }
+
+func TestScriptOSIEMode(t *testing.T) {
+	tests := map[string]struct {
+		mode   string
+		action string
+	}{
+		"default":  {mode: "", action: "install"},
+		"install":  {mode: "install", action: "install"},
+		"rescue":   {mode: "rescue", action: "rescue"},
+		"discover": {mode: "discover", action: "discover"},
+		"unknown":  {mode: "bogus", action: "install"},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			conf.OsieVendorServicesURL = "https://localhost"
+			extraIPXEVars := [][]string{{"dynamic_var1", "dynamic_val1"}, {"dynamic_var2", "dynamic_val2"}}
+
+			plan := "c3.small.x86"
+			m := job.NewMock(t, plan, facility)
+			m.SetManufacturer("supermicro")
+			m.SetOSSlug("ubuntu_16_04_image")
+			state := "provisioning"
+			m.SetState(state)
+			if tt.mode != "" {
+				m.SetCustomData(map[string]interface{}{"osie_mode": tt.mode})
+			}
+			mac := genRandMAC(t)
+			m.SetMAC(mac)
+
+			s := ipxe.NewScript()
+			s.Set("iface", "eth0")
+			s.Or("shell")
+			s.Set("tinkerbell", "http://127.0.0.1")
+			s.Set("syslog_host", "127.0.0.1")
+			s.Set("ipxe_cloud_config", "packet")
+
+			Installer("", "", "", "", "", "", true, "", extraIPXEVars).BootScript("install")(context.Background(), m.Job(), s)
+			got := string(s.Bytes())
+
+			preface := prefaces[tt.action]
+			preface = preface[:len(preface)-1] // drop extra \n at the end
+			script := fmt.Sprintf(preface+action2Plan2Body[tt.action][plan], tt.action, state, "x86_64", mac)
+			if script != got {
+				t.Fatalf("bad iPXE script:\n%v", diff.LineDiff(script, got))
+			}
+		})
+	}
+}
+
+func TestScriptPlanKernelArgs(t *testing.T) {
+	defer func(args map[string]string) { conf.PlanKernelArgs = args }(conf.PlanKernelArgs)
+	conf.PlanKernelArgs = map[string]string{"c3.large.arm": "iommu.passthrough=1 arm64.nopauth"}
+
+	for plan, want := range map[string]string{
+		"c3.large.arm": "console=ttyAMA0,115200 iommu.passthrough=1 arm64.nopauth\n",
+		"c3.small.x86": "console=ttyS1,115200\n",
+	} {
+		t.Run(plan, func(t *testing.T) {
+			m := job.NewMock(t, plan, facility)
+			m.SetOSSlug("ubuntu_16_04_image")
+			s := ipxe.NewScript()
+			Installer("", "", "", "", "", "", true, "", nil).BootScript("install")(context.Background(), m.Job(), s)
+			if got := string(s.Bytes()); !strings.Contains(got, want) {
+				t.Fatalf("expected %q in iPXE script:\n%s", want, got)
+			}
+		})
+	}
+}
+
+func TestScriptDebugKernelArgs(t *testing.T) {
+	for name, expires := range map[string]time.Duration{"active": time.Hour, "expired": -time.Hour} {
+		t.Run(name, func(t *testing.T) {
+			m := job.NewMock(t, "c3.small.x86", facility)
+			m.SetOSSlug("ubuntu_16_04_image")
+			m.SetCustomData(map[string]interface{}{
+				"debug_kernel_args":         "debug systemd.log_level=debug",
+				"debug_kernel_args_expires": time.Now().Add(expires).Format(time.RFC3339),
+			})
+			s := ipxe.NewScript()
+			Installer("", "", "", "", "", "", true, "", nil).BootScript("install")(context.Background(), m.Job(), s)
+			got := string(s.Bytes())
+			if applied := strings.Contains(got, "console=ttyS1,115200 debug systemd.log_level=debug\n"); applied != (expires > 0) {
+				t.Fatalf("unexpected debug kernel args (applied=%v) in iPXE script:\n%s", applied, got)
+			}
+		})
+	}
+}
+
+func TestScriptOSIELogLevel(t *testing.T) {
+	defer func(level string) { conf.OSIELogLevel = level }(conf.OSIELogLevel)
+
+	override := map[string]interface{}{
+		"osie_log_level":         "7",
+		"osie_log_level_expires": time.Now().Add(time.Hour).Format(time.RFC3339),
+	}
+	expired := map[string]interface{}{
+		"osie_log_level":         "7",
+		"osie_log_level_expires": time.Now().Add(-time.Hour).Format(time.RFC3339),
+	}
+	tests := []struct {
+		name       string
+		level      string
+		customData map[string]interface{}
+		want       string
+	}{
+		{name: "no level"},
+		{name: "default", level: "4", want: "loglevel=4"},
+		{name: "override", level: "4", customData: override, want: "loglevel=7"},
+		{name: "override without default", customData: override, want: "loglevel=7"},
+		{name: "expired override", level: "4", customData: expired, want: "loglevel=4"},
+		{name: "invalid override", level: "4", customData: map[string]interface{}{
+			"osie_log_level":         "debug",
+			"osie_log_level_expires": time.Now().Add(time.Hour).Format(time.RFC3339),
+		}, want: "loglevel=4"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conf.OSIELogLevel = tt.level
+
+			// the other machine of the facility keeps the default
+			target, other := job.NewMock(t, "c3.small.x86", facility), job.NewMock(t, "c3.small.x86", facility)
+			if tt.customData != nil {
+				target.SetCustomData(tt.customData)
+			}
+			var otherWant string
+			if tt.level != "" {
+				otherWant = "loglevel=" + tt.level
+			}
+			for _, machine := range []struct {
+				m    *job.Mock
+				want string
+			}{{&target, tt.want}, {&other, otherWant}} {
+				machine.m.SetOSSlug("ubuntu_16_04_image")
+				s := ipxe.NewScript()
+				Installer("", "", "", "", "", "", true, "", nil).BootScript("install")(context.Background(), machine.m.Job(), s)
+				got := string(s.Bytes())
+				if machine.want == "" {
+					if strings.Contains(got, "loglevel=") {
+						t.Fatalf("unexpected loglevel in iPXE script:\n%s", got)
+					}
+
+					continue
+				}
+				if !strings.Contains(got, " "+machine.want+" ") && !strings.Contains(got, " "+machine.want+"\n") {
+					t.Fatalf("expected %q in iPXE script:\n%s", machine.want, got)
+				}
+			}
+		})
+	}
+}
+
+func TestScriptNonce(t *testing.T) {
+	defer func(enabled bool) { conf.IPXENonce = enabled }(conf.IPXENonce)
+
+	for _, enabled := range []bool{false, true} {
+		conf.IPXENonce = enabled
+		m := job.NewMock(t, "c3.small.x86", facility)
+		m.SetMAC(genRandMAC(t))
+		i := job.NewInstallers()
+		i.RegisterDefaultInstaller(Installer("", "", "", "", "", "", true, "", nil).BootScript("install"))
+
+		script, ok := m.Job().AutoScript(context.Background(), i)
+		if !ok {
+			t.Fatal("no boot script")
+		}
+		if got := strings.Contains(string(script), " boots_nonce=${boots_nonce}"); got != enabled {
+			t.Fatalf("unexpected boots_nonce kernel arg, want: %v, got: %v\n%s", enabled, got, script)
+		}
+	}
+}
+
+func TestScriptStaticNetwork(t *testing.T) {
+	defer func(static bool) { conf.OsieStaticNetwork = static }(conf.OsieStaticNetwork)
+
+	for _, static := range []bool{false, true} {
+		conf.OsieStaticNetwork = static
+		m := job.NewMock(t, "c3.small.x86", facility)
+		m.SetMAC(genRandMAC(t))
+		m.SetNetwork(net.ParseIP("192.168.1.10"), net.ParseIP("255.255.255.0"), net.ParseIP("192.168.1.1"))
+		i := job.NewInstallers()
+		i.RegisterDefaultInstaller(Installer("", "", "", "", "", "", true, "", nil).BootScript("install"))
+
+		script, ok := m.Job().AutoScript(context.Background(), i)
+		if !ok {
+			t.Fatal("no boot script")
+		}
+		want := "set net0/ip 192.168.1.10\nset net0/netmask 255.255.255.0\nset net0/gateway 192.168.1.1\nifopen net0\n"
+		if got := strings.Contains(string(script), want); got != static {
+			t.Fatalf("unexpected static network config, want: %v, got: %v\n%s", static, got, script)
+		}
+		if static && strings.Index(string(script), want) > strings.Index(string(script), "\nkernel ") {
+			t.Fatalf("static network configured after fetching the kernel:\n%s", script)
+		}
+	}
+}
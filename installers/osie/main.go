@@ -3,6 +3,7 @@ package osie
 import (
 	"context"
 	"strings"
+	"time"
 
 	"github.com/tinkerbell/boots/conf"
 	"github.com/tinkerbell/boots/ipxe"
@@ -10,6 +11,13 @@ import (
 	"go.opentelemetry.io/otel/trace"
 )
 
+// OSIE modes that can be requested per job, see job.Job.OSIEMode.
+const (
+	modeInstall  = "install"
+	modeRescue   = "rescue"
+	modeDiscover = "discover"
+)
+
 type installer struct {
 	osieURL string
 	// defaultParams are passed to iPXE'd kernel always
@@ -98,10 +106,17 @@ func (i installer) install(ctx context.Context, j job.Job, s *ipxe.Script) {
 		s.Set(kv[0], kv[1])
 	}
 
-	if j.Rescue() {
+	switch mode := j.OSIEMode(); {
+	case j.Rescue(), mode == modeRescue:
 		i.rescue(ctx, j, s)
 
 		return
+	case mode == modeDiscover:
+		i.setDiscover(ctx, j, s)
+
+		return
+	case mode != "" && mode != modeInstall:
+		j.With("osie_mode", mode).Info("unknown osie mode, using install")
 	}
 
 	typ := "provisioning.104.01"
@@ -131,6 +146,11 @@ func (i installer) discover(ctx context.Context, j job.Job, s *ipxe.Script) {
 		s.Set(kv[0], kv[1])
 	}
 
+	i.setDiscover(ctx, j, s)
+}
+
+// setDiscover generates the ipxe boot script for booting into osie in hardware discovery mode.
+func (i installer) setDiscover(ctx context.Context, j job.Job, s *ipxe.Script) {
 	s.Set("action", "discover")
 	s.Set("state", j.HardwareState())
 
@@ -140,7 +160,10 @@ func (i installer) discover(ctx context.Context, j job.Job, s *ipxe.Script) {
 func (i installer) setBootScript(ctx context.Context, action string, j job.Job, s *ipxe.Script) {
 	s.Set("arch", j.Arch())
 	s.Set("bootdevmac", j.PrimaryNIC().String())
-	s.Set("base-url", osieBaseURL(i.osieURL, i.osieFullURLOverride, j))
+	s.Set("base-url", j.ArtifactURL(osieBaseURL(i.osieURL, i.osieFullURLOverride, j)))
+	if conf.OsieStaticNetwork {
+		j.StaticNetwork(s)
+	}
 	s.Kernel("${base-url}/" + kernelPath(j))
 	i.kernelParams(ctx, action, j.HardwareState(), j, s)
 	s.Initrd("${base-url}/" + initrdPath(j))
@@ -178,6 +201,10 @@ func (i installer) kernelParams(ctx context.Context, action, _ string, j job.Job
 
 	s.Args("packet_bootdev_mac=${bootdevmac}")
 	s.Args("facility=" + j.FacilityCode())
+	if conf.IPXENonce {
+		// sent back by osie with its phone-home and problem reports
+		s.Args("boots_nonce=${boots_nonce}")
+	}
 
 	switch j.PlanSlug() {
 	case "c2.large.arm", "c2.large.anbox", "c3.large.arm":
@@ -216,6 +243,16 @@ func (i installer) kernelParams(ctx context.Context, action, _ string, j job.Job
 		console = "ttyS1"
 	}
 	s.Args("console=" + console + ",115200")
+
+	if level := j.OSIELogLevel(time.Now()); level != "" {
+		s.Args("loglevel=" + level)
+	}
+	if args := conf.PlanKernelArgsFor(j.PlanSlug()); args != "" {
+		s.Args(args)
+	}
+	if args := j.DebugKernelArgs(time.Now()); args != "" {
+		s.Args(args)
+	}
 }
 
 func kernelPath(j job.Job) string {
@@ -244,7 +281,10 @@ func osieBaseURL(osieURL string, osieFullURLOverride string, j job.Job) string {
 		return osieFullURLOverride
 	}
 	if u := j.OSIEBaseURL(); u != "" {
-		return u
+		if conf.ChainURLAllowed(u) {
+			return u
+		}
+		j.With("url", u).Info("ignoring osie base url of the hardware, host is not allowed")
 	}
 	if isCustomOSIE(j) {
 		return osieURL + "/" + j.OSIEVersion()
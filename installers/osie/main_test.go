@@ -1,10 +1,14 @@
 package osie
 
 import (
+	"net"
 	"os"
 	"testing"
 
 	l "github.com/packethost/pkg/log"
+	"github.com/tinkerbell/boots/client"
+	"github.com/tinkerbell/boots/client/standalone"
+	"github.com/tinkerbell/boots/conf"
 	"github.com/tinkerbell/boots/job"
 )
 
@@ -13,3 +17,35 @@ func TestMain(m *testing.M) {
 	job.Init(logger)
 	os.Exit(m.Run())
 }
+
+func TestOSIEBaseURLAllowedHosts(t *testing.T) {
+	defer func(hosts []string) { conf.ChainAllowedHosts = hosts }(conf.ChainAllowedHosts)
+
+	mac, _ := net.ParseMAC("00:00:ba:dd:be:ef")
+	var addr client.MACAddr
+	copy(addr[:], mac)
+	d := &standalone.DiscoverStandalone{HardwareStandalone: standalone.HardwareStandalone{
+		Network: client.Network{Interfaces: []client.NetworkInterface{{
+			DHCP:    client.DHCP{MAC: &addr},
+			Netboot: client.Netboot{OSIE: client.OSIE{BaseURL: "http://osie.example.com/v1"}},
+		}}},
+	}}
+	j := job.NewMockFromDiscovery(d, mac).Job()
+
+	tests := map[string]struct {
+		hosts []string
+		want  string
+	}{
+		"no allowed hosts": {want: "http://osie.example.com/v1"},
+		"allowed":          {hosts: []string{"osie.example.com"}, want: "http://osie.example.com/v1"},
+		"not allowed":      {hosts: []string{"boot.example.com"}, want: "http://install.example.com/current"},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			conf.ChainAllowedHosts = tt.hosts
+			if got := osieBaseURL("http://install.example.com", "", j); got != tt.want {
+				t.Fatalf("unexpected osie base url, want: %q, got: %q", tt.want, got)
+			}
+		})
+	}
+}
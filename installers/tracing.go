@@ -0,0 +1,22 @@
+package installers
+
+import (
+	"context"
+
+	"github.com/tinkerbell/boots/job"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// SetSpanName names the span of ctx after the installer and the config it
+// serves, followed by the operating system slug of j when known, e.g.
+// "vmware kickstart vmware_esxi_7_0". Machine identifiers are left out to keep
+// the number of span names low.
+func SetSpanName(ctx context.Context, installer, config string, j *job.Job) {
+	name := installer + " " + config
+	if j != nil {
+		if os := j.OperatingSystem(); os != nil && os.Slug != "" {
+			name += " " + os.Slug
+		}
+	}
+	trace.SpanFromContext(ctx).SetName(name)
+}
@@ -115,3 +115,44 @@ boot
 `,
 	},
 }
+
+func TestScriptOSVersionPin(t *testing.T) {
+	defer func(versions map[string]map[string]string) { conf.FacilityOSVersions = versions }(conf.FacilityOSVersions)
+
+	tests := map[string]struct {
+		customData interface{}
+		versions   map[string]map[string]string
+		want       string
+	}{
+		"no pin":      {want: "esxi-6.5.0"},
+		"valid pin":   {customData: map[string]interface{}{"os_version": "7.0U2a"}, want: "esxi-7.0U2a"},
+		"invalid pin": {customData: map[string]interface{}{"os_version": "9.9"}, want: "esxi-6.5.0"},
+		"facility default": {
+			versions: map[string]map[string]string{facility: {"vmware": "7.0.0"}},
+			want:     "esxi-7.0.0",
+		},
+		"pin over facility default": {
+			customData: map[string]interface{}{"os_version": "7.0U2a"},
+			versions:   map[string]map[string]string{facility: {"vmware": "7.0.0"}},
+			want:       "esxi-7.0U2a",
+		},
+	}
+
+	bs := Installer(nil).BootScript("vmware_esxi_6_5")
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			conf.FacilityOSVersions = tt.versions
+			m := job.NewMock(t, "c3.small.x86", facility)
+			m.SetMAC("00:00:ba:dd:be:ef")
+			m.SetCustomData(tt.customData)
+
+			s := ipxe.NewScript()
+			bs(context.Background(), m.Job(), s)
+
+			want := "set base-url " + conf.OsieVendorServicesURL + "/vmware/" + tt.want + "\n"
+			if got := string(s.Bytes()); !strings.Contains(got, want) {
+				t.Fatalf("missing %q in script:\n%s", want, got)
+			}
+		})
+	}
+}
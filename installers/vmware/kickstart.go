@@ -1,9 +1,12 @@
 package vmware
 
 import (
+	"bytes"
 	"io"
 	"math"
 	"net/http"
+	"net/url"
+	"strings"
 	"text/template"
 
 	"github.com/pkg/errors"
@@ -14,6 +17,7 @@ import (
 
 func ServeKickstart(jobManager job.Manager) func(w http.ResponseWriter, req *http.Request) {
 	return func(w http.ResponseWriter, req *http.Request) {
+		installers.SetSpanName(req.Context(), "vmware", "kickstart", nil)
 		_, j, err := jobManager.CreateFromRemoteAddr(req.Context(), req.RemoteAddr)
 		if err != nil {
 			installers.Logger("vmware").With("client", req.RemoteAddr).Error(err, "retrieved job is empty")
@@ -21,15 +25,49 @@ func ServeKickstart(jobManager job.Manager) func(w http.ResponseWriter, req *htt
 
 			return
 		}
-		if err := genKickstart(*j, w); err != nil {
+		installers.SetSpanName(req.Context(), "vmware", "kickstart", j)
+		var b []byte
+		if nonce := req.URL.Query().Get("nonce"); nonce != "" {
+			// the nonce changes with every boot, never cache it
+			var buf bytes.Buffer
+			err = genKickstart(*j, nonce, &buf)
+			b = buf.Bytes()
+		} else {
+			b, err = installers.Render("vmware/kickstart", *j, func(buf *bytes.Buffer) error { return genKickstart(*j, "", buf) })
+		}
+		if err != nil {
 			w.WriteHeader(http.StatusInternalServerError)
 			j.Error(err)
+
+			return
 		}
+		_, _ = w.Write(b)
+	}
+}
+
+// Kickstart returns the kickstart served to j.
+func Kickstart(j job.Job) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := genKickstart(j, "", &buf); err != nil {
+		return nil, err
 	}
+
+	return buf.Bytes(), nil
 }
 
-func genKickstart(j job.Job, writer io.Writer) error {
-	return errors.Wrap(tmpl.Execute(writer, j), "generating kickstart template")
+// genKickstart writes the kickstart of j, phoning home with nonce when set.
+func genKickstart(j job.Job, nonce string, writer io.Writer) error {
+	t := tmpl
+	if nonce != "" {
+		var err error
+		if t, err = tmpl.Clone(); err != nil {
+			return errors.Wrap(err, "cloning kickstart template")
+		}
+		path := "/phone-home?nonce=" + url.QueryEscape(nonce)
+		t.Funcs(template.FuncMap{"phone_home_path": func(job.Job) string { return path }})
+	}
+
+	return errors.Wrap(t.Execute(writer, j), "generating kickstart template")
 }
 
 func mustParseNew(name, text string) *template.Template {
@@ -42,7 +80,9 @@ vmaccepteula
 # Set the root password for the DCUI and Tech Support Mode
 rootpw --iscrypted {{ rootpw . }}
 # The install media is in the CD-ROM drive
-{{- if (firstDisk .) }}
+{{- if (serialDisk .) }}
+%include /tmp/installdisk
+{{- else if (firstDisk .) }}
 install --firstdisk="{{ firstDisk . }}" --overwritevmfs
 {{- else }}
 install --firstdisk --overwritevmfs
@@ -272,11 +312,11 @@ esxcli system settings kernel set -s tty2Port -v com2
 chmod +x /tmp/customize.sh
 sh /tmp/customize.sh > /var/log/firstboot-customize.log
 # Phone home to Packet for device activation
-echo "Tinkerbell: {{ tink_host }}" > /tmp/firstboot-packet.log
+echo "Tinkerbell: {{ tink_host $ }}" > /tmp/firstboot-packet.log
 echo "UUID: $uuid" >> /tmp/firstboot-packet.log
 BODY='{"instance_id":"$uuid"}'
 BODY_LEN=$( echo -n ${BODY} | wc -c )
-echo -ne "POST /phone-home HTTP/1.0\r\nHost: {{ tink_host }}\r\nContent-Type: application/json\r\nContent-Length: ${BODY_LEN}\r\n\r\n${BODY}" | nc -i 3 {{ tink_host }} 80 > /tmp/firstboot-phone-home.log
+echo -ne "POST {{ phone_home_path $ }} HTTP/1.0\r\nHost: {{ tink_host $ }}\r\nContent-Type: application/json\r\nContent-Length: ${BODY_LEN}\r\n\r\n${BODY}" | nc -i 3 {{ tink_host $ }} 80 > /tmp/firstboot-phone-home.log
 reboot
 
 %post --interpreter=busybox
@@ -338,10 +378,10 @@ echo "nameserver 147.75.207.207" > /etc/resolv.conf
 chmod +x /tmp/customize-pi.sh
 sh /tmp/customize-pi.sh > /tmp/customize-pi.log
 sleep 60
-echo "Tinkerbell: {{ tink_host }}" > /tmp/post-packet.log
+echo "Tinkerbell: {{ tink_host $ }}" > /tmp/post-packet.log
 BODY='{"type":"provisioning.109"}'
 BODY_LEN=$( echo -n ${BODY} | wc -c )
-echo -ne "POST /phone-home HTTP/1.0\r\nHost: {{ tink_host }}\r\nContent-Type: application/json\r\nContent-Length: ${BODY_LEN}\r\n\r\n${BODY}" | nc -i 3 {{ tink_host }} 80 > /tmp/post-phone-home.log
+echo -ne "POST {{ phone_home_path $ }} HTTP/1.0\r\nHost: {{ tink_host $ }}\r\nContent-Type: application/json\r\nContent-Length: ${BODY_LEN}\r\n\r\n${BODY}" | nc -i 3 {{ tink_host $ }} 80 > /tmp/post-phone-home.log
 
 %post --interpreter=busybox --ignorefailure=true
 echo "Packet installation postinstall executed" > /packet-pi-ks.log
@@ -356,13 +396,51 @@ BOOTOPTIONS=$(/sbin/bootOption -o)
 echo $BOOTOPTIONS > /cmdline-bootoption
 echo $BOOTOPTIONS > /tmp/pre-bootoptions
 sleep 30
-`)
+{{ with serialDisk . }}
+%pre --interpreter=busybox
+# Install onto the one disk whose device name holds the boot drive hint as a
+# whole token, e.g. t10.ATA_____MODEL_____SERIAL. Without exactly one match
+# /tmp/installdisk is never written and the install fails.
+HINT={{ shellQuote . }}
+MATCH=""
+COUNT=0
+for DISK in /vmfs/devices/disks/*; do
+	NAME=${DISK##*/}
+	case "$NAME" in
+	*:* | vml.*) continue ;;
+	esac
+	for TOKEN in $(echo "$NAME" | tr '._' '  '); do
+		if [ "$TOKEN" = "$HINT" ]; then
+			MATCH=$NAME
+			COUNT=$((COUNT + 1))
+			break
+		fi
+	done
+done
+if [ "$COUNT" -eq 1 ]; then
+	echo "install --disk=$MATCH --overwritevmfs" > /tmp/installdisk
+else
+	echo "boot drive hint $HINT matched $COUNT disks" > /tmp/installdisk-error
+fi
+{{ end }}{{ with preScript . }}
+%pre --interpreter=busybox
+{{ . }}{{ end }}`)
 
 var helpers = template.FuncMap{
-	"vmnic":     vmnic,
-	"rootpw":    rootpw,
-	"firstDisk": firstDisk,
-	"tink_host": func() string { return conf.PublicFQDN },
+	"vmnic":      vmnic,
+	"rootpw":     requiredRootpw,
+	"firstDisk":  firstDisk,
+	"serialDisk": serialDisk,
+	"shellQuote": shellQuote,
+	"preScript":  preScript,
+	"tink_host":  tinkHost,
+	// overridden by genKickstart for nonces
+	"phone_home_path": func(job.Job) string { return "/phone-home" },
+}
+
+// tinkHost returns the host machines in the facility of j reach boots at.
+func tinkHost(j job.Job) string {
+	return conf.PublicFQDNFor(j.FacilityCode())
 }
 
 func vmnic(j job.Job) string {
@@ -379,21 +457,109 @@ func rootpw(j job.Job) string {
 			pass = override
 		}
 	}
+	if pass == "" {
+		pass = conf.RootPasswordCryptFor(j.FacilityCode())
+		if pass != "" {
+			j.With("facility", j.FacilityCode()).Info("no root password set, using the facility default")
+		}
+	}
 
 	return pass
 }
 
+// ErrNoRootPassword is returned rendering the kickstart of a job without any
+// root password when conf.VMwareRequireRootPassword is set.
+var ErrNoRootPassword = errors.New("no root password for the instance, its CustomData or its facility")
+
+// requiredRootpw returns the root password of j, ErrNoRootPassword when it has
+// none and one is required.
+func requiredRootpw(j job.Job) (string, error) {
+	pass := rootpw(j)
+	if pass == "" && conf.VMwareRequireRootPassword {
+		return "", ErrNoRootPassword
+	}
+
+	return pass, nil
+}
+
+// preScript returns the body of an additional %pre section provided through the
+// CustomData field `kickstart.pre_script`. Lines starting with `%` are indented so
+// that they cannot open a new kickstart section.
+func preScript(j job.Job) string {
+	cd, ok := j.CustomData().(map[string]interface{})
+	if !ok {
+		return ""
+	}
+	ks, ok := cd["kickstart"].(map[string]interface{})
+	if !ok {
+		return ""
+	}
+	script, ok := ks["pre_script"].(string)
+	if !ok || strings.TrimSpace(script) == "" {
+		return ""
+	}
+
+	lines := strings.Split(strings.TrimRight(strings.ReplaceAll(script, "\r\n", "\n"), "\n"), "\n")
+	for i, line := range lines {
+		if strings.HasPrefix(line, "%") {
+			lines[i] = " " + line
+		}
+	}
+
+	return strings.Join(lines, "\n") + "\n"
+}
+
 // firstDisk returns which disk to install onto - normally provided via metadata.
+// ESXi matches each comma separated --firstdisk entry against the disk driver,
+// model and vendor in turn.
 func firstDisk(j job.Job) string {
 	// Always respect the boot drive hint if one is provided
 	if hint := j.BootDriveHint(); hint != "" {
-		// Truncating hint to 16 characters to match VMware kickstart limitation.
-		return hint[:int(math.Min(16, float64(len(hint))))]
+		switch conf.VMwareBootDriveHintMatch {
+		case "exact":
+			return hint
+		case "substring":
+			// Match on any word of the hint, so e.g. both the model and the
+			// vendor of "KXG60ZNV256G TOSHIBA" are tried.
+			words := strings.Fields(hint)
+			for i, word := range words {
+				words[i] = truncateHint(word)
+			}
+
+			return strings.Join(words, ",")
+		case "serial":
+			// serialDisk selects the disk.
+			return ""
+		default:
+			return truncateHint(hint)
+		}
 	}
 
 	return equinixPlanDisk(j.PlanSlug(), j.PlanVersionSlug())
 }
 
+// serialDisk returns the boot drive hint when hints are matched by serial.
+// The kickstart then installs onto the single disk whose device name contains
+// the hint as a whole token, rather than the first disk that merely shares a
+// driver, model or vendor prefix with it.
+func serialDisk(j job.Job) string {
+	if conf.VMwareBootDriveHintMatch != "serial" {
+		return ""
+	}
+
+	return j.BootDriveHint()
+}
+
+// shellQuote single quotes s for use as one word in a shell script.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// truncateHint truncates hint to 16 characters to match VMware kickstart limitation.
+func truncateHint(hint string) string {
+	return hint[:int(math.Min(16, float64(len(hint))))]
+}
+
 // equinixPlanDisk is an Equinix-specific fallback used to return the first disk if it wasn't provided via metadata
 // TODO: Remove this function once the metadata is plumbed through everywhere.
 func equinixPlanDisk(slug string, version string) string {
@@ -1,16 +1,26 @@
 package vmware
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
 	"strings"
 	"testing"
 
 	"github.com/hexops/gotextdiff"
 	"github.com/hexops/gotextdiff/myers"
 	"github.com/hexops/gotextdiff/span"
+	"github.com/packethost/pkg/log"
+	"github.com/tinkerbell/boots/client"
 	"github.com/tinkerbell/boots/conf"
+	"github.com/tinkerbell/boots/ipxe"
 	"github.com/tinkerbell/boots/job"
 )
 
@@ -55,6 +65,130 @@ func TestFirstDisk(t *testing.T) {
 	}
 }
 
+func TestFirstDiskMatch(t *testing.T) {
+	defer func(match string) { conf.VMwareBootDriveHintMatch = match }(conf.VMwareBootDriveHintMatch)
+
+	tests := []struct {
+		match string
+		slug  string
+		hint  string
+		first string
+	}{
+		{match: "prefix", slug: "n3.xlarge.x86", hint: "KXG60ZNV256G TOSHIBA", first: "KXG60ZNV256G TOS"},
+		{match: "exact", slug: "n3.xlarge.x86", hint: "KXG60ZNV256G TOSHIBA", first: "KXG60ZNV256G TOSHIBA"},
+		{match: "substring", slug: "n3.xlarge.x86", hint: "KXG60ZNV256G TOSHIBA", first: "KXG60ZNV256G,TOSHIBA"},
+		{match: "substring", slug: "n3.xlarge.x86", hint: "Micron_5100_MTFDDAK480TCB  SSD", first: "Micron_5100_MTFD,SSD"},
+		{match: "exact", slug: "c3.medium.x86", first: "vmw_ahci,lsi_mr3,lsi_msgpt3"},
+		{match: "serial", slug: "n3.xlarge.x86", hint: "18081C6B8E2E", first: ""},
+		{match: "serial", slug: "c3.medium.x86", first: "vmw_ahci,lsi_mr3,lsi_msgpt3"},
+	}
+
+	for _, tc := range tests {
+		t.Run(fmt.Sprintf("%s/%q+%q", tc.match, tc.slug, tc.hint), func(t *testing.T) {
+			conf.VMwareBootDriveHintMatch = tc.match
+
+			m := job.NewMock(t, tc.slug, facility)
+			m.SetBootDriveHint(tc.hint)
+			if got := firstDisk(m.Job()); got != tc.first {
+				t.Errorf("firstDisk(%+v) = %q, want: %q", tc, got, tc.first)
+			}
+		})
+	}
+}
+
+func TestSerialDisk(t *testing.T) {
+	defer func(match string) { conf.VMwareBootDriveHintMatch = match }(conf.VMwareBootDriveHintMatch)
+	conf.VMwareBootDriveHintMatch = "serial"
+
+	sh, err := exec.LookPath("sh")
+	if err != nil {
+		t.Skip("no sh to run the pre script with")
+	}
+
+	disks := []string{
+		"t10.ATA_____Micron_5100_MTFDDAK480TCB_________________18081C6B8E2E",
+		"t10.ATA_____Micron_5100_MTFDDAK480TCB_________________18081C6B8E2E:1",
+		"t10.ATA_____Micron_5100_MTFDDAK480TCB_________________18081C6B8E2EX",
+		"t10.ATA_____Micron_5100_MTFDDAK480TCB_________________18081C6B8E2F",
+		"vml.0100000000313830383143364238453245",
+	}
+	tests := []struct {
+		hint string
+		disk string
+	}{
+		{hint: "18081C6B8E2E", disk: disks[0]},
+		{hint: "18081C6B8E2F", disk: disks[3]},
+		{hint: "18081C6B8E2", disk: ""},
+		{hint: "Micron", disk: ""},
+		{hint: "ATA", disk: ""},
+		{hint: "MTFDDAK480TCB", disk: ""},
+		{hint: "'; touch pwned; '", disk: ""},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.hint, func(t *testing.T) {
+			m := job.NewMock(t, "n3.xlarge.x86", facility)
+			m.SetOSSlug("vmware_esxi_7_0")
+			m.SetPassword("password")
+			m.SetMAC("00:00:ba:dd:be:ef")
+			m.SetBootDriveHint(tc.hint)
+
+			var w strings.Builder
+			if err := genKickstart(m.Job(), "", &w); err != nil {
+				t.Fatal(err)
+			}
+			ks := w.String()
+			if !strings.Contains(ks, "\n%include /tmp/installdisk\n") || strings.Contains(ks, "--firstdisk") {
+				t.Fatalf("kickstart does not install onto the resolved disk:\n%s", ks)
+			}
+
+			start := strings.Index(ks, "HINT=")
+			end := strings.Index(ks[start:], "\nfi\n")
+			if start < 0 || end < 0 {
+				t.Fatalf("no serial %%pre script in kickstart:\n%s", ks)
+			}
+
+			dir := t.TempDir()
+			devices := filepath.Join(dir, "disks")
+			if err := os.Mkdir(devices, 0o755); err != nil {
+				t.Fatal(err)
+			}
+			for _, disk := range disks {
+				if err := ioutil.WriteFile(filepath.Join(devices, disk), nil, 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			script := ks[start : start+end+len("\nfi\n")]
+			script = strings.ReplaceAll(script, "/tmp/", dir+"/")
+			script = strings.ReplaceAll(script, "/vmfs/devices/disks", devices)
+
+			cmd := exec.Command(sh, "-c", script)
+			cmd.Dir = dir
+			if out, err := cmd.CombinedOutput(); err != nil {
+				t.Fatalf("running %%pre script: %v: %s", err, out)
+			}
+			if _, err := os.Stat(filepath.Join(dir, "pwned")); err == nil {
+				t.Fatal("hint was run as a command")
+			}
+
+			got, err := ioutil.ReadFile(filepath.Join(dir, "installdisk"))
+			if tc.disk == "" {
+				if err == nil {
+					t.Fatalf("hint %q selected a disk: %s", tc.hint, got)
+				}
+
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := "install --disk=" + tc.disk + " --overwritevmfs\n"; string(got) != want {
+				t.Fatalf("want: %q, got: %q", want, got)
+			}
+		})
+	}
+}
+
 func TestScriptKickstart(t *testing.T) {
 	manufacturers := []string{"supermicro", "dell"}
 	versions := []string{"vmware_esxi_6_0", "vmware_esxi_6_5", "vmware_esxi_6_7", "vmware_esxi_7_0", "vmware_esxi_7_0U2a"}
@@ -110,7 +244,7 @@ func TestScriptKickstart(t *testing.T) {
 							m.SetBootDriveHint(dc.hint)
 
 							var w strings.Builder
-							genKickstart(m.Job(), &w)
+							genKickstart(m.Job(), "", &w)
 
 							got := w.String()
 
@@ -170,7 +304,7 @@ func TestRootpw(t *testing.T) {
 			m.SetCustomData(tc.customData)
 
 			var w strings.Builder
-			genKickstart(m.Job(), &w)
+			genKickstart(m.Job(), "", &w)
 
 			got := w.String()
 			want := fmt.Sprintf("rootpw --iscrypted %s", tc.want)
@@ -181,3 +315,225 @@ func TestRootpw(t *testing.T) {
 		})
 	}
 }
+
+func TestRootpwFacilityDefault(t *testing.T) {
+	defer func(facilities map[string]string, def string) {
+		conf.FacilityRootPasswordCrypts, conf.DefaultRootPasswordCrypt = facilities, def
+	}(conf.FacilityRootPasswordCrypts, conf.DefaultRootPasswordCrypt)
+	conf.FacilityRootPasswordCrypts = map[string]string{"test-facility": "$6$facility"}
+	conf.DefaultRootPasswordCrypt = "$6$default"
+
+	testCases := []struct {
+		name       string
+		facility   string
+		password   bool
+		customData interface{}
+		want       string
+	}{
+		{name: "facility default", facility: "test-facility", want: "$6$facility"},
+		{name: "global default", facility: "other-facility", want: "$6$default"},
+		{name: "instance password wins", facility: "test-facility", password: true, want: "insecure"},
+		{name: "CustomData wins", facility: "test-facility", customData: map[string]interface{}{"rootpwcrypt": "override"}, want: "override"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			m := job.NewMock(t, "some.slug", tc.facility)
+			if tc.password {
+				m.SetPassword("insecure")
+			}
+			m.SetCustomData(tc.customData)
+
+			if got := rootpw(m.Job()); got != tc.want {
+				t.Errorf("unexpected root password, want: %q, got: %q", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestRootpwRequired(t *testing.T) {
+	defer func(facilities map[string]string, def string, required bool) {
+		conf.FacilityRootPasswordCrypts, conf.DefaultRootPasswordCrypt, conf.VMwareRequireRootPassword = facilities, def, required
+	}(conf.FacilityRootPasswordCrypts, conf.DefaultRootPasswordCrypt, conf.VMwareRequireRootPassword)
+	conf.FacilityRootPasswordCrypts = map[string]string{"test-facility": "$6$facility"}
+	conf.DefaultRootPasswordCrypt = ""
+
+	testCases := []struct {
+		name     string
+		facility string
+		required bool
+		want     string
+	}{
+		{name: "enforced without password fails", facility: "other-facility", required: true},
+		{name: "enforced with facility fallback", facility: "test-facility", required: true, want: "$6$facility"},
+		{name: "not enforced without password", facility: "other-facility", want: ""},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			conf.VMwareRequireRootPassword = tc.required
+			m := job.NewMock(t, "some.slug", tc.facility)
+
+			var w strings.Builder
+			err := genKickstart(m.Job(), "", &w)
+			s := ipxe.NewScript()
+			Installer(nil).BootScript("vmware_esxi_6_5")(context.Background(), m.Job(), s)
+			script := string(s.Bytes())
+
+			if tc.required && tc.want == "" {
+				if !errors.Is(err, ErrNoRootPassword) {
+					t.Fatalf("unexpected error, want: %v, got: %v", ErrNoRootPassword, err)
+				}
+				if !strings.Contains(script, "echo vmware install refused") || strings.Contains(script, "kernel ") {
+					t.Fatalf("expected an error script, got:\n%s", script)
+				}
+
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := "rootpw --iscrypted " + tc.want + "\n"; !strings.Contains(w.String(), want) {
+				t.Fatalf("missing %q in kickstart:\n%s", want, w.String())
+			}
+			if !strings.Contains(script, "kernel ") {
+				t.Fatalf("expected an install script, got:\n%s", script)
+			}
+		})
+	}
+}
+
+func TestRootpwCustomDataKeys(t *testing.T) {
+	defer func(keys map[string]struct{}) { conf.CustomDataKeys = keys }(conf.CustomDataKeys)
+	conf.CustomDataKeys = map[string]struct{}{"kickstart": {}}
+
+	m := job.NewMock(t, "some.slug", "test-facility")
+	m.SetPassword("insecure")
+	m.SetCustomData(map[string]interface{}{"rootpwcrypt": "override"})
+
+	if got := rootpw(m.Job()); got != "insecure" {
+		t.Fatalf("disallowed rootpwcrypt honored, want: %q, got: %q", "insecure", got)
+	}
+}
+
+func TestPreScript(t *testing.T) {
+	testCases := []struct {
+		name       string
+		customData interface{}
+		golden     string
+	}{
+		{
+			"no CustomData",
+			nil,
+			"testdata/ks_.txt",
+		},
+		{
+			"CustomData without kickstart",
+			map[string]interface{}{"rootpwcrypt": "insecure"},
+			"testdata/ks_.txt",
+		},
+		{
+			"non-string pre_script",
+			map[string]interface{}{"kickstart": map[string]interface{}{"pre_script": 4}},
+			"testdata/ks_.txt",
+		},
+		{
+			"pre_script",
+			map[string]interface{}{"kickstart": map[string]interface{}{
+				"pre_script": "#!/bin/sh\r\n%wipe\r\ndd if=/dev/zero of=/dev/disks/mpx.vmhba0:C0:T1:L0 bs=1M count=10\r\n",
+			}},
+			"testdata/ks_pre_script.txt",
+		},
+	}
+
+	conf.PublicIPv4 = net.ParseIP("127.0.0.1")
+	conf.PublicFQDN = "boots-test.example.com"
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			m := job.NewMock(t, "", facility)
+			m.SetOSSlug("vmware_esxi_7_0")
+			m.SetPassword("password")
+			m.SetMAC("00:00:ba:dd:be:ef")
+			m.SetCustomData(tc.customData)
+
+			var w strings.Builder
+			if err := genKickstart(m.Job(), "", &w); err != nil {
+				t.Fatal(err)
+			}
+			got := w.String()
+
+			bs, err := ioutil.ReadFile(tc.golden)
+			if err != nil {
+				t.Fatalf("readfile: %v", err)
+			}
+			want := string(bs)
+
+			if got != want {
+				edits := myers.ComputeEdits(span.URI("want"), want, got)
+				change := gotextdiff.ToUnified("want", "got", want, edits)
+				t.Errorf("unexpected diff:\n%s", change)
+			}
+		})
+	}
+}
+
+// jobManager creates the same job for any request.
+type jobManager struct {
+	j job.Job
+}
+
+func (m jobManager) CreateFromRemoteAddr(ctx context.Context, _ string) (context.Context, *job.Job, error) {
+	j := m.j
+
+	return ctx, &j, nil
+}
+
+func (m jobManager) CreateFromDHCP(ctx context.Context, _ net.HardwareAddr, _ net.IP, _, _ string) (context.Context, *job.Job, error) {
+	j := m.j
+
+	return ctx, &j, nil
+}
+
+func TestKickstartNonce(t *testing.T) {
+	defer func(enabled bool) { conf.IPXENonce = enabled }(conf.IPXENonce)
+	conf.IPXENonce = true
+
+	m := job.NewMock(t, "c3.small.x86", facility)
+	m.SetOSSlug("vmware_esxi_7_0")
+	m.SetMAC("00:00:ba:dd:be:ef")
+	m.SetPassword("insecure")
+	m.SetReporter(client.NewNoOpReporter(log.Test(t, "TestKickstartNonce")))
+	i := job.NewInstallers()
+	i.RegisterSlug("vmware_esxi_7_0", Installer(nil).BootScript("vmware_esxi_7_0"))
+
+	script, ok := m.Job().AutoScript(context.Background(), i)
+	if !ok {
+		t.Fatal("no boot script")
+	}
+	var nonce string
+	for _, line := range strings.Split(string(script), "\n") {
+		if strings.HasPrefix(line, "set boots_nonce ") {
+			nonce = strings.TrimPrefix(line, "set boots_nonce ")
+		}
+	}
+	if !strings.Contains(string(script), " ks=${tinkerbell}"+KickstartPath+"?nonce=${boots_nonce} ") {
+		t.Fatalf("ks url without the nonce:\n%s", script)
+	}
+
+	// the installer fetches the ks url with the nonce iPXE substituted
+	w := httptest.NewRecorder()
+	ServeKickstart(jobManager{m.Job()})(w, httptest.NewRequest("GET", "http://127.0.0.1"+KickstartPath+"?nonce="+nonce, nil))
+	ks := w.Body.String()
+	if n := strings.Count(ks, "POST /phone-home?nonce="+nonce+" HTTP/1.0"); n != 2 {
+		t.Fatalf("unexpected phone-homes with the nonce, want: 2, got: %d\n%s", n, ks)
+	}
+
+	w = httptest.NewRecorder()
+	req := httptest.NewRequest("POST", "http://127.0.0.1/phone-home?nonce="+nonce, strings.NewReader(`{"type":"provisioning.109"}`))
+	req.Header.Set("Content-Type", "application/json")
+	m.Job().ServePhoneHomeEndpoint(w, req)
+	if got := w.Result().StatusCode; got != http.StatusOK {
+		t.Fatalf("phone-home with the kickstart nonce refused, got: %d", got)
+	}
+}
@@ -53,17 +53,46 @@ func (i installer) BootScript(slug string) job.BootScript {
 	}
 
 	return func(ctx context.Context, j job.Job, s *ipxe.Script) {
-		script(i, j, s, path)
+		basePath := path
+		if v := j.OSVersion("vmware", validVersion); v != "" {
+			basePath = versionPath(v)
+		}
+		script(i, j, s, basePath)
 	}
 }
 
+// versionPath returns the artifacts path of the ESXi version, e.g. esxi-6.7.0
+// for 6.7.0.
+func versionPath(version string) string {
+	return "esxi-" + version
+}
+
+// validVersion reports whether artifacts of the ESXi version are published.
+func validVersion(version string) bool {
+	path := versionPath(version)
+	for _, p := range slug2Paths {
+		if p == path {
+			return true
+		}
+	}
+
+	return false
+}
+
 func script(i installer, j job.Job, s *ipxe.Script, basePath string) {
+	if _, err := requiredRootpw(j); err != nil {
+		s.Echo("vmware install refused: " + err.Error())
+		s.Shell()
+		j.Error(err)
+
+		return
+	}
 	for _, kv := range i.extraIPXEVars {
 		s.Set(kv[0], kv[1])
 	}
 
 	s.PhoneHome("provisioning.104.01")
-	s.Set("base-url", conf.OsieVendorServicesURL+"/vmware/"+basePath)
+	s.Set("base-url", j.ArtifactURL(conf.OsieVendorServicesURL+"/vmware/"+basePath))
 	if j.IsUEFI() {
 		s.Kernel("${base-url}/efi/boot/bootx64.efi -c ${base-url}/boot.cfg")
 	} else {
@@ -75,7 +104,12 @@ func script(i installer, j job.Job, s *ipxe.Script, basePath string) {
 }
 
 func kernelParams(j job.Job, s *ipxe.Script) {
-	s.Args("ks=${tinkerbell}/vmware/ks-esxi.cfg")
+	ks := "${tinkerbell}" + KickstartPath
+	if conf.IPXENonce {
+		// echoed into the phone-home requests of the kickstart
+		ks += "?nonce=${boots_nonce}"
+	}
+	s.Args("ks=" + ks)
 
 	vmnic := j.PrimaryNIC().String()
 	s.Args("netdevice=" + vmnic)
@@ -0,0 +1,81 @@
+package wipe
+
+import (
+	"context"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/andreyvit/diff"
+	"github.com/tinkerbell/boots/ipxe"
+	"github.com/tinkerbell/boots/job"
+)
+
+func TestScript(t *testing.T) {
+	tests := map[string]struct {
+		plan       string
+		customData interface{}
+		golden     string
+	}{
+		"all disks": {
+			plan:   "c3.small.x86",
+			golden: "testdata/wipe_all.ipxe",
+		},
+		"listed disks": {
+			plan: "c3.large.arm",
+			customData: map[string]interface{}{
+				"wipe": map[string]interface{}{"disks": []interface{}{"/dev/nvme0n1", "sda", "/dev/sdb"}},
+			},
+			golden: "testdata/wipe_disks.ipxe",
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			m := job.NewMock(t, tc.plan, "ewr1")
+			m.SetOSSlug("decommission")
+			m.SetCustomData(tc.customData)
+
+			s := ipxe.NewScript()
+			s.Set("iface", "eth0")
+			s.Or("shell")
+			s.Set("tinkerbell", "http://127.0.0.1")
+			s.Set("syslog_host", "127.0.0.1")
+
+			i := installer{imageURL: "http://127.0.0.1/misc/wipe", extraIPXEVars: [][]string{{"dynamic_var1", "dynamic_val1"}}}
+			i.BootScript("decommission")(context.Background(), m.Job(), s)
+			got := string(s.Bytes())
+
+			bs, err := ioutil.ReadFile(tc.golden)
+			if err != nil {
+				t.Fatalf("readfile: %v", err)
+			}
+			if want := string(bs); got != want {
+				t.Fatalf("bad iPXE script:\n%v", diff.LineDiff(want, got))
+			}
+		})
+	}
+}
+
+func TestScriptRetry(t *testing.T) {
+	m := job.NewMock(t, "c3.small.x86", "ewr1")
+	m.SetOSSlug("decommission")
+
+	s := ipxe.NewScript()
+	s.Retry(3, 0)
+	i := installer{imageURL: "http://127.0.0.1/misc/wipe"}
+	i.BootScript("decommission")(context.Background(), m.Job(), s)
+
+	var kernel string
+	for _, line := range strings.Split(string(s.Bytes()), "\n") {
+		if strings.HasPrefix(line, ":") && strings.Contains(line, " ") {
+			t.Fatalf("kernel args appended to label: %q", line)
+		}
+		if strings.HasPrefix(line, "kernel ") {
+			kernel = line
+		}
+	}
+	if !strings.HasSuffix(kernel, " console=tty0 console=ttyS1,115200 && goto fetch1_done ||") || !strings.Contains(kernel, " ip=dhcp ") {
+		t.Fatalf("kernel args not on the retried kernel line: %q", kernel)
+	}
+}
@@ -0,0 +1,103 @@
+package wipe
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/tinkerbell/boots/conf"
+	"github.com/tinkerbell/boots/ipxe"
+	"github.com/tinkerbell/boots/job"
+)
+
+type installer struct {
+	imageURL      string
+	extraIPXEVars [][]string
+}
+
+// Installer boots decommissioned machines into the wipe environment, which
+// securely erases their disks and phones home once done so boots disables PXE
+// and marks the machine.
+func Installer(dynamicIPXEVars [][]string) job.BootScripter {
+	i := installer{
+		imageURL:      conf.WipeImageURL,
+		extraIPXEVars: dynamicIPXEVars,
+	}
+	if i.imageURL == "" {
+		i.imageURL = conf.MirrorBaseURL + "/misc/wipe"
+	}
+
+	return i
+}
+
+func (i installer) BootScript(string) job.BootScript {
+	return i.setBootScript
+}
+
+func (i installer) setBootScript(_ context.Context, j job.Job, s *ipxe.Script) {
+	for _, kv := range i.extraIPXEVars {
+		s.Set(kv[0], kv[1])
+	}
+
+	s.PhoneHome("provisioning.104.01")
+	s.Set("arch", j.Arch())
+	s.Set("base-url", j.ArtifactURL(i.imageURL))
+	s.Kernel("${base-url}/vmlinuz-${arch}")
+
+	kernelParams(j, s)
+
+	s.Initrd("${base-url}/initramfs-${arch}")
+	s.Boot()
+}
+
+func kernelParams(j job.Job, s *ipxe.Script) {
+	s.Args("ip=dhcp")
+	s.Args("tinkerbell=${tinkerbell}")
+	s.Args("syslog_host=${syslog_host}")
+	s.Args("facility=" + j.FacilityCode())
+	s.Args("wipe.disks=" + strings.Join(disks(j), ","))
+	s.Args("wipe.methods=" + conf.WipeMethods)
+
+	// Posted by the wipe environment with an empty body once all disks are
+	// erased, which boots reports as the phone-home of the machine.
+	phoneHome := "${tinkerbell}/phone-home"
+	if conf.IPXENonce {
+		phoneHome += "?nonce=${boots_nonce}"
+	}
+	s.Args("wipe.phone_home_url=" + phoneHome)
+
+	s.Args("initrd=initramfs-${arch}")
+	if j.IsARM() {
+		s.Args("console=ttyAMA0,115200")
+	} else {
+		s.Args("console=tty0 console=ttyS1,115200")
+	}
+
+	if args := conf.PlanKernelArgsFor(j.PlanSlug()); args != "" {
+		s.Args(args)
+	}
+	if args := j.DebugKernelArgs(time.Now()); args != "" {
+		s.Args(args)
+	}
+}
+
+// disks returns the devices to erase, the instance CustomData "wipe.disks"
+// list or all disks found by the wipe environment, as hardware records carry
+// no disk inventory.
+func disks(j job.Job) []string {
+	cd, _ := j.CustomData().(map[string]interface{})
+	wc, _ := cd["wipe"].(map[string]interface{})
+	list, _ := wc["disks"].([]interface{})
+
+	var disks []string
+	for _, d := range list {
+		if s, ok := d.(string); ok && strings.HasPrefix(s, "/dev/") {
+			disks = append(disks, s)
+		}
+	}
+	if len(disks) == 0 {
+		return []string{"all"}
+	}
+
+	return disks
+}
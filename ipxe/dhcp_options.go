@@ -77,6 +77,14 @@ func IsTinkerbellIPXE(req *dhcp4.Packet) bool {
 	return string(uc) == "Tinkerbell"
 }
 
+// IsIPXEUserClass returns bool depending on if the DHCP request originated from a stock iPXE binary,
+// which sets its user-class (opt 77) to "iPXE".
+func IsIPXEUserClass(req *dhcp4.Packet) bool {
+	uc, _ := req.GetOption(dhcp4.OptionUserClass)
+
+	return string(uc) == "iPXE"
+}
+
 // IsIPXE returns bool depending on if the request originated with a version of iPXE.
 func IsIPXE(req *dhcp4.Packet) bool {
 	if om := GetEncapsulatedOptions(req); om != nil && HasFeature(om, FeatureHTTP) {
@@ -1,9 +1,23 @@
 package ipxe
 
-import "fmt"
+import (
+	"fmt"
+	"net"
+	"strings"
+	"time"
+)
 
 type Script struct {
 	buf []byte
+
+	attempts   int
+	retryDelay time.Duration
+	fetches    int
+	verbose    bool
+
+	// end of the script after the last retried fetch, and where args of its
+	// line go, so that Args extends that line instead of its done label
+	fetchEnd, fetchArgsAt int
 }
 
 func NewScript() *Script {
@@ -14,6 +28,17 @@ func NewScript() *Script {
 }
 
 func (s *Script) Args(args ...string) {
+	if s.fetchEnd > 0 && s.fetchEnd == len(s.buf) {
+		var b []byte
+		for _, arg := range args {
+			b = append(append(b, ' '), arg...)
+		}
+		s.buf = append(s.buf[:s.fetchArgsAt], append(b, s.buf[s.fetchArgsAt:]...)...)
+		s.fetchArgsAt += len(b)
+		s.fetchEnd = len(s.buf)
+
+		return
+	}
 	s.buf = s.buf[:len(s.buf)-1]
 
 	for _, arg := range args {
@@ -43,8 +68,8 @@ imgfree
 
 // Chain - Chainload another iPXE script.
 func (s *Script) Chain(uri string) {
-	s.buf = append(append(s.buf, "chain --autofree "...), uri...)
-	s.buf = append(s.buf, '\n')
+	s.stage("chaining " + uri)
+	s.fetch("chain --autofree " + uri)
 }
 
 func (s *Script) DHCP() {
@@ -52,6 +77,7 @@ func (s *Script) DHCP() {
 }
 
 func (s *Script) Boot() {
+	s.stage("booting")
 	s.buf = append(s.buf, "boot\n"...)
 }
 
@@ -60,23 +86,58 @@ func (s *Script) Bytes() []byte {
 }
 
 func (s *Script) Initrd(uri string, args ...string) {
-	s.buf = append(append(s.buf, "initrd "...), uri...)
+	s.stage("fetching initrd " + uri)
+	s.fetch(strings.Join(append([]string{"initrd", uri}, args...), " "))
+}
 
-	for _, arg := range args {
-		s.buf = append(append(s.buf, ' '), arg...)
-	}
+func (s *Script) Kernel(uri string, args ...string) {
+	s.stage("fetching kernel " + uri)
+	s.fetch(strings.Join(append([]string{"kernel", uri}, args...), " "))
+}
 
-	s.buf = append(s.buf, '\n')
+// Retry makes the kernel, initrd and chain lines that follow try up to attempts
+// times, sleeping delay between attempts, before dropping to the shell. They
+// are tried once when attempts is below 2. Args still extends them.
+func (s *Script) Retry(attempts int, delay time.Duration) {
+	s.attempts, s.retryDelay = attempts, delay
 }
 
-func (s *Script) Kernel(uri string, args ...string) {
-	s.buf = append(append(s.buf, "kernel "...), uri...)
+// Verbose makes the kernel, initrd, chain and boot lines that follow echo the
+// boot stage they start, so console operators can follow progress.
+func (s *Script) Verbose(verbose bool) {
+	s.verbose = verbose
+}
 
-	for _, arg := range args {
-		s.buf = append(append(s.buf, ' '), arg...)
+// stage echoes message in verbose scripts. It goes before the line of the
+// stage, Args extends the last line of the script.
+func (s *Script) stage(message string) {
+	if s.verbose {
+		s.Echo(message)
 	}
+}
 
-	s.buf = append(s.buf, '\n')
+// fetch appends line, wrapped in a loop retrying it when it fails if Retry was set.
+func (s *Script) fetch(line string) {
+	if s.attempts < 2 {
+		s.AppendString(line)
+
+		return
+	}
+
+	s.fetches++
+	label := fmt.Sprintf("fetch%d", s.fetches)
+	s.Set(label+"_attempt:int32", "0")
+	s.AppendString(":" + label)
+	s.fetchArgsAt = len(s.buf) + len(line)
+	s.AppendString(line + " && goto " + label + "_done ||")
+	s.AppendString("inc " + label + "_attempt")
+	s.AppendString(fmt.Sprintf("iseq ${%s_attempt} %d && shell ||", label, s.attempts))
+	if secs := int(s.retryDelay.Seconds()); secs > 0 {
+		s.Sleep(secs)
+	}
+	s.AppendString("goto " + label)
+	s.AppendString(":" + label + "_done")
+	s.fetchEnd = len(s.buf)
 }
 
 func (s *Script) Or(line string) {
@@ -85,8 +146,39 @@ func (s *Script) Or(line string) {
 	s.buf = append(s.buf, '\n')
 }
 
+// Prompt waits up to timeout for a key press and jumps to the label target when
+// none was pressed, so that unattended machines keep booting. When a key is
+// pressed the script continues with the next line.
+func (s *Script) Prompt(timeout time.Duration, target string) {
+	s.buf = append(s.buf, fmt.Sprintf("prompt --timeout %d Press any key to interrupt automatic boot || goto %s\n", timeout.Milliseconds(), target)...)
+}
+
+// Label marks the current position of the script as name, a target for Goto and IfEq.
+func (s *Script) Label(name string) {
+	s.buf = append(append(s.buf, ':'), name...)
+	s.buf = append(s.buf, '\n')
+}
+
+// Goto jumps to the label target.
+func (s *Script) Goto(target string) {
+	s.buf = append(append(s.buf, "goto "...), target...)
+	s.buf = append(s.buf, '\n')
+}
+
+// IfEq jumps to the label target when the variable name equals value, the
+// script continues with the next line otherwise.
+func (s *Script) IfEq(name, value, target string) {
+	s.buf = append(s.buf, fmt.Sprintf("iseq ${%s} %s && goto %s ||\n", name, value, target)...)
+}
+
+// Reboot restarts the machine.
+func (s *Script) Reboot() {
+	s.buf = append(s.buf, "reboot\n"...)
+}
+
 func (s *Script) Reset() {
 	s.buf = append(s.buf[:0], "#!ipxe\n\n"...)
+	s.fetches, s.fetchEnd, s.fetchArgsAt = 0, 0, 0
 	s.Echo("Tinkerbell Boots iPXE")
 }
 
@@ -102,10 +194,24 @@ func (s *Script) Set(name, value string) {
 	s.buf = append(s.buf, '\n')
 }
 
+// StaticIP configures iface with a static address instead of DHCP and opens
+// it. The gateway line is left out when gateway is nil.
+func (s *Script) StaticIP(iface string, ip, netmask, gateway net.IP) {
+	s.Set(iface+"/ip", ip.String())
+	s.Set(iface+"/netmask", netmask.String())
+	if gateway != nil {
+		s.Set(iface+"/gateway", gateway.String())
+	}
+	s.buf = append(append(s.buf, "ifopen "...), iface...)
+	s.buf = append(s.buf, '\n')
+}
+
+// Shell drops to the interactive iPXE shell.
 func (s *Script) Shell() {
 	s.buf = append(s.buf, "shell\n"...)
 }
 
+// Sleep pauses the script for value seconds.
 func (s *Script) Sleep(value int) {
 	s.buf = append(s.buf, fmt.Sprintf("sleep %d\n", value)...)
 }
@@ -0,0 +1,156 @@
+package ipxe
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/andreyvit/diff"
+)
+
+func TestPrompt(t *testing.T) {
+	s := NewScript()
+	s.Prompt(5*time.Second, "install")
+	s.Shell()
+	s.AppendString(":install")
+	s.Boot()
+
+	want := `#!ipxe
+
+echo Tinkerbell Boots iPXE
+prompt --timeout 5000 Press any key to interrupt automatic boot || goto install
+shell
+:install
+boot
+`
+	if got := string(s.Bytes()); got != want {
+		t.Fatalf("bad iPXE script:\n%v", diff.LineDiff(want, got))
+	}
+}
+
+func TestScriptLines(t *testing.T) {
+	tests := map[string]struct {
+		build func(s *Script)
+		want  string
+	}{
+		"sleep":  {build: func(s *Script) { s.Sleep(30) }, want: "sleep 30\n"},
+		"reboot": {build: (*Script).Reboot, want: "reboot\n"},
+		"shell":  {build: (*Script).Shell, want: "shell\n"},
+		"sleep then reboot": {
+			build: func(s *Script) {
+				s.Sleep(300)
+				s.Reboot()
+			},
+			want: "sleep 300\nreboot\n",
+		},
+		"label": {build: func(s *Script) { s.Label("slot_a") }, want: ":slot_a\n"},
+		"goto":  {build: func(s *Script) { s.Goto("slot_a") }, want: "goto slot_a\n"},
+		"if eq": {
+			build: func(s *Script) { s.IfEq("active_slot", "b", "slot_b") },
+			want:  "iseq ${active_slot} b && goto slot_b ||\n",
+		},
+		"static ip without gateway": {
+			build: func(s *Script) {
+				s.StaticIP("net0", net.ParseIP("10.0.0.5"), net.ParseIP("255.255.255.0"), nil)
+			},
+			want: "set net0/ip 10.0.0.5\nset net0/netmask 255.255.255.0\nifopen net0\n",
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			s := NewScript()
+			tt.build(s)
+
+			want := "#!ipxe\n\necho Tinkerbell Boots iPXE\n" + tt.want
+			if got := string(s.Bytes()); got != want {
+				t.Fatalf("bad iPXE script:\n%v", diff.LineDiff(want, got))
+			}
+		})
+	}
+}
+
+func TestRetry(t *testing.T) {
+	s := NewScript()
+	s.Retry(3, 5*time.Second)
+	s.Kernel("${base-url}/vmlinuz", "console=ttyS0")
+	s.Args("ip=dhcp")
+	s.Args("initrd=initrd", "quiet")
+	s.Initrd("${base-url}/initrd")
+	s.Boot()
+
+	want := `#!ipxe
+
+echo Tinkerbell Boots iPXE
+set fetch1_attempt:int32 0
+:fetch1
+kernel ${base-url}/vmlinuz console=ttyS0 ip=dhcp initrd=initrd quiet && goto fetch1_done ||
+inc fetch1_attempt
+iseq ${fetch1_attempt} 3 && shell ||
+sleep 5
+goto fetch1
+:fetch1_done
+set fetch2_attempt:int32 0
+:fetch2
+initrd ${base-url}/initrd && goto fetch2_done ||
+inc fetch2_attempt
+iseq ${fetch2_attempt} 3 && shell ||
+sleep 5
+goto fetch2
+:fetch2_done
+boot
+`
+	if got := string(s.Bytes()); got != want {
+		t.Fatalf("bad iPXE script:\n%v", diff.LineDiff(want, got))
+	}
+
+	s = NewScript()
+	s.Retry(1, 5*time.Second)
+	s.Chain("http://example.com/boot.ipxe")
+	want = "#!ipxe\n\necho Tinkerbell Boots iPXE\nchain --autofree http://example.com/boot.ipxe\n"
+	if got := string(s.Bytes()); got != want {
+		t.Fatalf("bad iPXE script:\n%v", diff.LineDiff(want, got))
+	}
+}
+
+func TestVerbose(t *testing.T) {
+	build := func(verbose bool) string {
+		s := NewScript()
+		s.Verbose(verbose)
+		s.Kernel("${base-url}/vmlinuz", "console=ttyS0")
+		s.Args("ip=dhcp")
+		s.Initrd("${base-url}/initrd")
+		s.Chain("${base-url}/installer.ipxe")
+		s.Boot()
+
+		return string(s.Bytes())
+	}
+
+	want := `#!ipxe
+
+echo Tinkerbell Boots iPXE
+kernel ${base-url}/vmlinuz console=ttyS0 ip=dhcp
+initrd ${base-url}/initrd
+chain --autofree ${base-url}/installer.ipxe
+boot
+`
+	if got := build(false); got != want {
+		t.Fatalf("bad iPXE script:\n%v", diff.LineDiff(want, got))
+	}
+
+	want = `#!ipxe
+
+echo Tinkerbell Boots iPXE
+echo fetching kernel ${base-url}/vmlinuz
+kernel ${base-url}/vmlinuz console=ttyS0 ip=dhcp
+echo fetching initrd ${base-url}/initrd
+initrd ${base-url}/initrd
+echo chaining ${base-url}/installer.ipxe
+chain --autofree ${base-url}/installer.ipxe
+echo booting
+boot
+`
+	if got := build(true); got != want {
+		t.Fatalf("bad iPXE script:\n%v", diff.LineDiff(want, got))
+	}
+}
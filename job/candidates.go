@@ -0,0 +1,109 @@
+package job
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/pkg/errors"
+	"github.com/tinkerbell/boots/conf"
+	"github.com/tinkerbell/boots/ipxe"
+)
+
+// InstallerChoiceField is the form field of the installer selected from the
+// installer menu, POSTed back to auto.ipxe.
+const InstallerChoiceField = "installer"
+
+type installerChoiceKey struct{}
+
+// WithInstallerChoice returns a copy of ctx choosing name among the candidate
+// installers of the job, for the boot of the request selecting it.
+func WithInstallerChoice(ctx context.Context, name string) context.Context {
+	return context.WithValue(ctx, installerChoiceKey{}, name)
+}
+
+// installerCandidates returns the installers of the instance CustomData
+// "boot.installers" list, along with the "boot.installer" one chosen by an admin.
+func (j Job) installerCandidates() ([]string, string) {
+	cd, _ := j.CustomData().(map[string]interface{})
+	boot, _ := cd["boot"].(map[string]interface{})
+	list, _ := boot["installers"].([]interface{})
+	choice, _ := boot["installer"].(string)
+
+	var candidates []string
+	for _, c := range list {
+		if s, ok := c.(string); ok && s != "" {
+			candidates = append(candidates, s)
+		}
+	}
+
+	return candidates, choice
+}
+
+// byName returns the BootScript registered as name, as an installer, slug or distro.
+func (i Installers) byName(name string) (BootScript, bool) {
+	for _, registered := range []map[string]BootScript{i.ByInstaller, i.BySlug, i.ByDistro} {
+		if f, ok := registered[name]; ok {
+			return f, true
+		}
+	}
+
+	return nil, false
+}
+
+// candidateScript returns, with conf.InstallerMenu and j having more than one
+// registered candidate installer, the BootScript of the chosen one, the choice
+// of the request first, along with the name it is registered under. With no
+// valid choice it is the installer menu, registered under no name. It reports
+// false when j has no candidates to choose from.
+func (i Installers) candidateScript(ctx context.Context, j Job) (string, BootScript, bool) {
+	if !conf.InstallerMenu {
+		return "", nil, false
+	}
+	listed, choice := j.installerCandidates()
+	var candidates []string
+	for _, c := range listed {
+		if _, ok := i.byName(c); !ok {
+			j.With("installer", c).Error(errors.New("ignoring unknown candidate installer"))
+
+			continue
+		}
+		candidates = append(candidates, c)
+	}
+	if len(candidates) < 2 {
+		return "", nil, false
+	}
+
+	if selected, _ := ctx.Value(installerChoiceKey{}).(string); selected != "" {
+		choice = selected
+	}
+	if choice != "" {
+		for _, c := range candidates {
+			if c == choice {
+				f, _ := i.byName(c)
+				j.With("installer", c, "candidates", candidates).Info("booting the chosen candidate installer")
+
+				return c, f, true
+			}
+		}
+		j.With("installer", choice, "candidates", candidates).Error(errors.New("ignoring choice of an installer that is not a candidate"))
+	}
+	j.With("candidates", candidates).Info("no candidate installer chosen, providing the installer menu")
+
+	return "", installerMenu(candidates), true
+}
+
+// installerMenu returns a BootScript showing a menu of the candidates for
+// conf.InstallerMenuTimeout, defaulting to the first, and POSTing the
+// selection back to auto.ipxe as InstallerChoiceField.
+func installerMenu(candidates []string) BootScript {
+	return func(_ context.Context, _ Job, s *ipxe.Script) {
+		s.AppendString("menu Select the installer to boot")
+		for _, c := range candidates {
+			s.AppendString("item " + c + " " + c)
+		}
+		s.AppendString(fmt.Sprintf("choose --default %s --timeout %d %s", candidates[0], conf.InstallerMenuTimeout.Milliseconds(), InstallerChoiceField))
+		s.AppendString("params")
+		s.AppendString("param " + InstallerChoiceField + " ${" + InstallerChoiceField + "}")
+		s.Chain("${tinkerbell}/auto.ipxe##params")
+	}
+}
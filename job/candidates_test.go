@@ -0,0 +1,89 @@
+package job
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/tinkerbell/boots/conf"
+	"github.com/tinkerbell/boots/ipxe"
+)
+
+func TestInstallerCandidates(t *testing.T) {
+	defer func(menu bool) { conf.InstallerMenu = menu }(conf.InstallerMenu)
+
+	i := NewInstallers()
+	i.RegisterDistro("flatcar", func(_ context.Context, _ Job, s *ipxe.Script) { s.Echo("flatcar installer") })
+	i.RegisterSlug("vmware_esxi_7_0", func(_ context.Context, _ Job, s *ipxe.Script) { s.Echo("vmware installer") })
+	i.RegisterInstaller("rescue", func(_ context.Context, _ Job, s *ipxe.Script) { s.Echo("rescue installer") })
+
+	menu := "item vmware_esxi_7_0 vmware_esxi_7_0\nitem rescue rescue\n"
+	tests := []struct {
+		name     string
+		disabled bool
+		listed   []interface{}
+		admin    string
+		selected string
+		want     string
+	}{
+		{name: "disabled", disabled: true, listed: []interface{}{"vmware_esxi_7_0", "rescue"}, selected: "rescue", want: "echo flatcar installer\n"},
+		{name: "no candidates", selected: "rescue", want: "echo flatcar installer\n"},
+		{name: "single known candidate", listed: []interface{}{"vmware_esxi_7_0", "bogus"}, want: "echo flatcar installer\n"},
+		{name: "menu", listed: []interface{}{"vmware_esxi_7_0", "rescue"}, want: menu},
+		{name: "menu selected first", listed: []interface{}{"vmware_esxi_7_0", "rescue"}, selected: "vmware_esxi_7_0", want: "echo vmware installer\n"},
+		{name: "menu selected second", listed: []interface{}{"vmware_esxi_7_0", "rescue"}, selected: "rescue", want: "echo rescue installer\n"},
+		{name: "admin chose first", listed: []interface{}{"vmware_esxi_7_0", "rescue"}, admin: "vmware_esxi_7_0", want: "echo vmware installer\n"},
+		{name: "admin chose second", listed: []interface{}{"vmware_esxi_7_0", "rescue"}, admin: "rescue", want: "echo rescue installer\n"},
+		{name: "menu selection over admin choice", listed: []interface{}{"vmware_esxi_7_0", "rescue"}, admin: "rescue", selected: "vmware_esxi_7_0", want: "echo vmware installer\n"},
+		{name: "not a candidate", listed: []interface{}{"vmware_esxi_7_0", "rescue"}, selected: "flatcar", want: menu},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conf.InstallerMenu = !tt.disabled
+
+			m := NewMock(t, "c3.small.x86", "ewr1")
+			m.SetOSDistro("flatcar")
+			boot := map[string]interface{}{}
+			if tt.listed != nil {
+				boot["installers"] = tt.listed
+			}
+			if tt.admin != "" {
+				boot["installer"] = tt.admin
+			}
+			m.SetCustomData(map[string]interface{}{"boot": boot})
+
+			req := httptest.NewRequest(http.MethodGet, "/auto.ipxe", nil)
+			if tt.selected != "" {
+				form := url.Values{InstallerChoiceField: {tt.selected}}
+				req = httptest.NewRequest(http.MethodPost, "/auto.ipxe", strings.NewReader(form.Encode()))
+				req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			}
+			w := httptest.NewRecorder()
+			m.Job().ServeFile(w, req, i)
+
+			body, _ := io.ReadAll(w.Result().Body)
+			if !strings.Contains(string(body), tt.want) {
+				t.Fatalf("unexpected script, want: %q, got: %q", tt.want, body)
+			}
+		})
+	}
+}
+
+func TestInstallerMenu(t *testing.T) {
+	s := ipxe.NewScript()
+	installerMenu([]string{"vmware_esxi_7_0", "rescue"})(context.Background(), Job{}, s)
+
+	want := "menu Select the installer to boot\n" +
+		"item vmware_esxi_7_0 vmware_esxi_7_0\n" +
+		"item rescue rescue\n" +
+		"choose --default vmware_esxi_7_0 --timeout 10000 installer\n" +
+		"params\n" +
+		"param installer ${installer}\n"
+	if got := string(s.Bytes()); !strings.Contains(got, want) || !strings.Contains(got, "chain --autofree ${tinkerbell}/auto.ipxe##params") {
+		t.Fatalf("unexpected menu, want: %q, got: %q", want, got)
+	}
+}
@@ -1,6 +1,7 @@
 package job
 
 import (
+	"bytes"
 	"context"
 	"fmt"
 	"strings"
@@ -8,8 +9,10 @@ import (
 	dhcp4 "github.com/packethost/dhcp4-go"
 	"github.com/pkg/errors"
 	"github.com/tinkerbell/boots/client"
+	"github.com/tinkerbell/boots/conf"
 	"github.com/tinkerbell/boots/dhcp"
 	"github.com/tinkerbell/boots/ipxe"
+	"github.com/tinkerbell/boots/timeline"
 	"go.opentelemetry.io/otel/trace"
 )
 
@@ -58,6 +61,10 @@ func (j Job) ServeDHCP(ctx context.Context, w dhcp4.ReplyWriter, req *dhcp4.Pack
 	if err := reply.Send(); err != nil {
 		return false, err
 	}
+	rep := reply.Packet()
+	file := string(bytes.TrimRight(rep.File(), "\x00"))
+	timeline.Record(j.mac, "dhcp", fmt.Sprintf("sent %s yiaddr=%s file=%q", rep.GetMessageType(), rep.GetYIAddr(), file))
+	timeline.Offered(rep.GetYIAddr(), j.mac)
 
 	return true, nil
 }
@@ -80,7 +87,7 @@ func (j Job) configureDHCP(ctx context.Context, rep, req *dhcp4.Packet) bool {
 			j.With("dhcp", isUEFI, "job", j.IsUEFI()).Info("uefi mismatch, using dhcp")
 		}
 
-		isTinkerbellIPXE := ipxe.IsTinkerbellIPXE(req)
+		isTinkerbellIPXE := ipxe.IsTinkerbellIPXE(req) || (conf.IPXEUserClassScript && ipxe.IsIPXEUserClass(req))
 		if isTinkerbellIPXE {
 			ipxe.Setup(rep)
 		}
@@ -165,6 +172,12 @@ func (j Job) setPXEFilename(rep *dhcp4.Packet, isTinkerbellIPXE, isARM, isUEFI,
 	}
 
 	dhcp.SetFilename(rep, filename, j.NextServer, isHTTPClient, httpPrefix)
+	if !isTinkerbellIPXE && !isHTTPClient && conf.DHCPBootfileName != "" {
+		dhcp.SetBootfileName(rep, conf.DHCPBootfileName)
+	}
+	if isHTTPClient && !isTinkerbellIPXE && conf.DHCPHTTPBootTFTPFallback {
+		dhcp.SetTFTPFallback(rep, filename)
+	}
 }
 
 // VLANID returns the VLAN ID for the job.
@@ -2,7 +2,9 @@ package job
 
 import (
 	"bytes"
+	"context"
 	"fmt"
+	"net"
 	"testing"
 
 	dhcp4 "github.com/packethost/dhcp4-go"
@@ -127,6 +129,136 @@ func TestSetPXEFilename(t *testing.T) {
 	}
 }
 
+func TestSetPXEFilenameHTTPClient(t *testing.T) {
+	defer func(fallback bool) { conf.DHCPHTTPBootTFTPFallback = fallback }(conf.DHCPHTTPBootTFTPFallback)
+
+	url := "http://192.168.0.2/ipxe/ipxe.efi"
+	for _, fallback := range []bool{false, true} {
+		t.Run(fmt.Sprintf("fallback=%v", fallback), func(t *testing.T) {
+			conf.DHCPHTTPBootTFTPFallback = fallback
+			m := NewMock(t, "c3.small.x86", "ewr1")
+			m.SetAllowPXE(true)
+			j := m.Job()
+			j.NextServer = net.ParseIP("192.168.0.2")
+			j.IpxeBaseURL = "192.168.0.2/ipxe"
+
+			rep := dhcp4.NewPacket(dhcp4.BootReply)
+			j.setPXEFilename(&rep, false, false, true, true)
+
+			want := url
+			if fallback {
+				want = "ipxe.efi"
+			}
+			if got := string(bytes.TrimRight(rep.File(), "\x00")); got != want {
+				t.Fatalf("unexpected filename, want: %q, got: %q", want, got)
+			}
+			if got := net.IP(rep.SIAddr()).String(); got != "192.168.0.2" {
+				t.Fatalf("unexpected next server, want: 192.168.0.2, got: %q", got)
+			}
+			if got, _ := rep.GetString(dhcp4.OptionClassID); got != "HTTPClient" {
+				t.Fatalf("unexpected vendor class, want: HTTPClient, got: %q", got)
+			}
+			if got, _ := rep.GetString(dhcp4.OptionServerName); got != "192.168.0.2" {
+				t.Fatalf("unexpected option 66, want: 192.168.0.2, got: %q", got)
+			}
+			if got, _ := rep.GetString(dhcp4.OptionBootfileName); got != url {
+				t.Fatalf("unexpected option 67, want: %q, got: %q", url, got)
+			}
+		})
+	}
+}
+
+func TestSetPXEFilenameBootfileName(t *testing.T) {
+	defer func(name string) { conf.DHCPBootfileName = name }(conf.DHCPBootfileName)
+	conf.DHCPBootfileName = "custom.efi"
+
+	tests := map[string]struct {
+		isTinkerbellIPXE bool
+		isHTTPClient     bool
+		want             string
+		file             string
+	}{
+		"pxe firmware":     {want: "custom.efi", file: "ipxe.efi"},
+		"http boot client": {isHTTPClient: true, want: "http://192.168.0.2/ipxe/ipxe.efi"},
+		"tinkerbell ipxe":  {isTinkerbellIPXE: true, want: "http://192.168.0.2/auto.ipxe"},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			m := NewMock(t, "c3.small.x86", "ewr1")
+			m.SetAllowPXE(true)
+			j := m.Job()
+			j.NextServer = net.ParseIP("192.168.0.2")
+			j.IpxeBaseURL = "192.168.0.2/ipxe"
+			j.BootsBaseURL = "192.168.0.2"
+
+			rep := dhcp4.NewPacket(dhcp4.BootReply)
+			j.setPXEFilename(&rep, tt.isTinkerbellIPXE, false, true, tt.isHTTPClient)
+
+			if got, _ := rep.GetString(dhcp4.OptionBootfileName); got != tt.want {
+				t.Fatalf("unexpected option 67, want: %q, got: %q", tt.want, got)
+			}
+			if got := string(bytes.TrimRight(rep.File(), "\x00")); tt.file != "" && got != tt.file {
+				t.Fatalf("unexpected filename, want: %q, got: %q", tt.file, got)
+			}
+		})
+	}
+}
+
+func TestConfigureDHCPUserClass(t *testing.T) {
+	conf.PublicFQDN = "boots-testing.packet.net"
+	defer func(v bool) { conf.IPXEUserClassScript = v }(conf.IPXEUserClassScript)
+
+	for _, tt := range []struct {
+		name      string
+		userClass string
+		enabled   bool
+		filename  string
+	}{
+		{name: "bare PXE", filename: "undionly.kpxe"},
+		{name: "bare PXE enabled", enabled: true, filename: "undionly.kpxe"},
+		{name: "tinkerbell iPXE", userClass: "Tinkerbell", filename: "http://" + conf.PublicFQDN + "/auto.ipxe"},
+		{name: "stock iPXE", userClass: "iPXE", filename: "undionly.kpxe"},
+		{name: "stock iPXE enabled", userClass: "iPXE", enabled: true, filename: "http://" + conf.PublicFQDN + "/auto.ipxe"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			conf.IPXEUserClassScript = tt.enabled
+
+			instance := &client.Instance{ID: "$instance_id", AllowPXE: true}
+			j := Job{
+				Logger: joblog.With("name", tt.name),
+				hardware: &cacher.HardwareCacher{
+					ID:       "$hardware_id",
+					PlanSlug: "c3.small.x86",
+					Arch:     "x86_64",
+					Instance: instance,
+				},
+				instance:     instance,
+				NextServer:   conf.PublicIPv4,
+				IpxeBaseURL:  conf.PublicFQDN + "/ipxe",
+				BootsBaseURL: conf.PublicFQDN,
+			}
+			j.dhcp.Setup(net.ParseIP("192.168.1.10"), net.ParseIP("255.255.255.0"), net.ParseIP("192.168.1.1"))
+
+			req := dhcp4.NewPacket(dhcp4.BootRequest)
+			req.SetString(dhcp4.OptionClassID, "PXEClient:Arch:00000:UNDI:002001")
+			req.SetUint16(dhcp4.OptionClientSystem, 0)
+			req.SetOption(dhcp4.OptionUUIDGUID, make([]byte, 17))
+			if tt.userClass != "" {
+				req.SetString(dhcp4.OptionUserClass, tt.userClass)
+			}
+
+			rep := dhcp4.NewPacket(dhcp4.BootReply)
+			if !j.configureDHCP(context.Background(), &rep, &req) {
+				t.Fatal("unable to configure DHCP")
+			}
+			filename := string(bytes.TrimRight(rep.File(), "\x00"))
+			if tt.filename != filename {
+				t.Fatalf("unexpected filename want:%q, got:%q", tt.filename, filename)
+			}
+		})
+	}
+}
+
 func TestAllowPXE(t *testing.T) {
 	for _, tt := range []struct {
 		want     bool
@@ -143,7 +275,7 @@ func TestAllowPXE(t *testing.T) {
 		t.Run(name, func(t *testing.T) {
 			j := Job{
 				hardware: &cacher.HardwareCacher{
-					AllowPXE: tt.hw,
+					AllowPXE: &tt.hw,
 				},
 				instance: &client.Instance{
 					ID:       tt.iid,
@@ -158,6 +290,54 @@ func TestAllowPXE(t *testing.T) {
 	}
 }
 
+func TestAllowPXEDefault(t *testing.T) {
+	defer func(allow bool) { conf.AllowPXEDefault = allow }(conf.AllowPXEDefault)
+
+	mac := client.MACAddr([6]byte{0x00, 0x00, 0xBA, 0xDD, 0xBE, 0xEF})
+	allow, deny := true, false
+	for _, tt := range []struct {
+		name        string
+		want        bool
+		allowPXE    *bool
+		defaultPXE  bool
+		instancePXE bool
+	}{
+		{name: "absent default false", want: false},
+		{name: "absent default true", want: true, defaultPXE: true},
+		{name: "absent default false instance true", want: true, instancePXE: true},
+		{name: "false default true", want: false, allowPXE: &deny, defaultPXE: true},
+		{name: "true default false", want: true, allowPXE: &allow},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			conf.AllowPXEDefault = tt.defaultPXE
+
+			hw := &tinkerbell.HardwareTinkerbellV1{
+				Network: client.Network{
+					Interfaces: []client.NetworkInterface{
+						{
+							DHCP:    client.DHCP{MAC: &mac},
+							Netboot: client.Netboot{AllowPXE: tt.allowPXE},
+						},
+					},
+				},
+			}
+			j := Job{
+				Logger:   joblog.With("test", tt.name),
+				mac:      mac.HardwareAddr(),
+				hardware: hw,
+				instance: &client.Instance{
+					ID:       "id",
+					AllowPXE: tt.instancePXE,
+				},
+			}
+			got := j.AllowPXE()
+			if got != tt.want {
+				t.Fatalf("unexpected return, want: %t, got %t", tt.want, got)
+			}
+		})
+	}
+}
+
 func TestAreWeProvisioner(t *testing.T) {
 	for _, tt := range []struct {
 		name              string
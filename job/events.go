@@ -10,6 +10,7 @@ import (
 
 	"github.com/pkg/errors"
 	"github.com/tinkerbell/boots/client"
+	"github.com/tinkerbell/boots/conf"
 )
 
 func (j Job) CustomPXEDone(ctx context.Context) {
@@ -24,11 +25,31 @@ func (j Job) CustomPXEDone(ctx context.Context) {
 
 	e := event{_kind: "phone-home"}
 
-	if err := e.postInstance(ctx, j.reporter, j.instance.ID); err != nil {
+	if err := e.postInstance(ctx, j.eventReporter(), j.instance.ID); err != nil {
 		j.With("os", "custom_ipxe").Error(errors.WithMessage(err, "posting phone-home event"))
 	}
 }
 
+// PostAwaitingConfig posts a "waiting" hardware event, letting the
+// orchestrator know the machine is waiting for an operating system or workflow.
+func (j Job) PostAwaitingConfig(ctx context.Context) {
+	if j.hardware == nil {
+		return
+	}
+	e, err := newEvent("waiting", conf.AwaitingConfigMessage, false)
+	if err != nil {
+		j.Error(err)
+
+		return
+	}
+	if err := e.postHardware(ctx, j.eventReporter(), j.hardware.HardwareID().String()); err != nil {
+		j.Error(errors.WithMessage(err, "posting waiting event"))
+
+		return
+	}
+	j.With("kind", e.kind()).Info("posted awaiting configuration event")
+}
+
 func (j Job) DisablePXE(ctx context.Context) {
 	if j.instance == nil {
 		j.Error(errors.New("instance is nil"))
@@ -36,7 +57,7 @@ func (j Job) DisablePXE(ctx context.Context) {
 		return
 	}
 
-	if err := j.reporter.UpdateInstance(ctx, j.instance.ID, strings.NewReader(`{"allow_pxe":false}`)); err != nil {
+	if err := j.eventReporter().UpdateInstance(ctx, j.instance.ID, strings.NewReader(`{"allow_pxe":false}`)); err != nil {
 		j.Error(errors.WithMessage(err, "disabling PXE"))
 
 		return
@@ -50,16 +71,21 @@ func (j Job) PostHardwareProblem(ctx context.Context, slug string) bool {
 		return false
 	}
 	var v struct {
-		Problem string `json:"problem"`
+		Problem  string `json:"problem"`
+		Serial   string `json:"hardware_serial,omitempty"`
+		AssetTag string `json:"hardware_asset_tag,omitempty"`
 	}
 	v.Problem = slug
+	if conf.EventFingerprint {
+		v.Serial, v.AssetTag = j.HardwareSerial(), j.HardwareAssetTag()
+	}
 	b, err := json.Marshal(&v)
 	if err != nil {
 		j.With("problem", slug).Error(errors.WithMessage(err, "encoding hardware problem request"))
 
 		return false
 	}
-	if _, err := j.reporter.PostHardwareProblem(ctx, j.hardware.HardwareID(), bytes.NewReader(b)); err != nil {
+	if _, err := j.eventReporter().PostHardwareProblem(ctx, j.hardware.HardwareID(), bytes.NewReader(b)); err != nil {
 		j.With("problem", slug).Error(errors.WithMessage(err, "posting hardware problem"))
 
 		return false
@@ -82,6 +108,9 @@ func (j Job) phoneHome(ctx context.Context, body []byte) bool {
 
 		return false
 	}
+	if e, ok := p.(*event); ok && len(e.json) > 0 {
+		e.json = j.withFingerprint(e.json)
+	}
 
 	var id string
 	var typ string
@@ -108,7 +137,7 @@ func (j Job) phoneHome(ctx context.Context, body []byte) bool {
 		post = p.postHardware
 	}
 
-	if err := post(ctx, j.reporter, id); err != nil {
+	if err := post(ctx, j.eventReporter(), id); err != nil {
 		j.With("kind", p.kind(), "type", typ).Error(err)
 
 		return false
@@ -139,7 +168,7 @@ func (j Job) postEvent(ctx context.Context, kind, body string, private bool) boo
 
 		return false
 	}
-	if err := e.postInstance(ctx, j.reporter, j.instance.ID); err != nil {
+	if err := e.postInstance(ctx, j.eventReporter(), j.instance.ID); err != nil {
 		// do not use j.Error to avoid infinite recursion
 		j.With("kind", kind).Error(err, "posting event")
 	}
@@ -152,6 +181,38 @@ func (j Job) postEvent(ctx context.Context, kind, body string, private bool) boo
 	return true
 }
 
+// withFingerprint returns the JSON object b with the hardware serial number and
+// asset tag of j added, when enabled and known. Fields already set in b are kept.
+func (j Job) withFingerprint(b []byte) []byte {
+	if !conf.EventFingerprint {
+		return b
+	}
+	fields := map[string]string{
+		"hardware_serial":    j.HardwareSerial(),
+		"hardware_asset_tag": j.HardwareAssetTag(),
+	}
+	var v map[string]interface{}
+	if err := json.Unmarshal(b, &v); err != nil || v == nil {
+		return b
+	}
+	added := false
+	for name, value := range fields {
+		if _, ok := v[name]; !ok && value != "" {
+			v[name] = value
+			added = true
+		}
+	}
+	if !added {
+		return b
+	}
+	out, err := json.Marshal(v)
+	if err != nil {
+		return b
+	}
+
+	return out
+}
+
 func posterFromJSON(b []byte) (poster, error) {
 	if len(b) == 0 {
 		return &event{_kind: "phone-home"}, nil
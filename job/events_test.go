@@ -13,6 +13,7 @@ import (
 	"github.com/tinkerbell/boots/client"
 	"github.com/tinkerbell/boots/client/cacher"
 	"github.com/tinkerbell/boots/client/packet"
+	"github.com/tinkerbell/boots/conf"
 )
 
 func TestPhoneHome(t *testing.T) {
@@ -137,3 +138,98 @@ var phoneHomeTests = map[string]struct {
 		},
 	},
 }
+
+func TestEventFingerprint(t *testing.T) {
+	defer func(fingerprint bool) { conf.EventFingerprint = fingerprint }(conf.EventFingerprint)
+
+	var reqs []req
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r.Body.Close()
+		reqs = append(reqs, req{r.Method, r.URL.String(), string(body)})
+
+		w.Write([]byte(`{"id":"event-id"}`))
+	}))
+	defer ts.Close()
+	u, err := url.Parse(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := map[string]struct {
+		enabled  bool
+		serial   string
+		assetTag string
+		post     func(j Job)
+		want     req
+	}{
+		"event": {
+			enabled: true, serial: "S3R1AL", assetTag: "A55ET",
+			post: func(j Job) { j.phoneHome(context.Background(), []byte(`{"type":"provisioning.104"}`)) },
+			want: req{"POST", "/devices/$instance_id/events", `{"hardware_asset_tag":"A55ET","hardware_serial":"S3R1AL","type":"provisioning.104"}`},
+		},
+		"event keeps sent fields": {
+			enabled: true, serial: "S3R1AL", assetTag: "A55ET",
+			post: func(j Job) {
+				j.phoneHome(context.Background(), []byte(`{"type":"provisioning.104","hardware_serial":"sent"}`))
+			},
+			want: req{"POST", "/devices/$instance_id/events", `{"hardware_asset_tag":"A55ET","hardware_serial":"sent","type":"provisioning.104"}`},
+		},
+		"event without fingerprint": {
+			enabled: true,
+			post:    func(j Job) { j.phoneHome(context.Background(), []byte(`{"type":"provisioning.104"}`)) },
+			want:    req{"POST", "/devices/$instance_id/events", `{"type":"provisioning.104"}`},
+		},
+		"event disabled": {
+			serial: "S3R1AL", assetTag: "A55ET",
+			post: func(j Job) { j.phoneHome(context.Background(), []byte(`{"type":"provisioning.104"}`)) },
+			want: req{"POST", "/devices/$instance_id/events", `{"type":"provisioning.104"}`},
+		},
+		"problem": {
+			enabled: true, serial: "S3R1AL", assetTag: "A55ET",
+			post: func(j Job) { j.PostHardwareProblem(context.Background(), "memory") },
+			want: req{"POST", "/hardware/$hardware_id/problems", `{"problem":"memory","hardware_serial":"S3R1AL","hardware_asset_tag":"A55ET"}`},
+		},
+		"problem disabled": {
+			serial: "S3R1AL", assetTag: "A55ET",
+			post: func(j Job) { j.PostHardwareProblem(context.Background(), "memory") },
+			want: req{"POST", "/hardware/$hardware_id/problems", `{"problem":"memory"}`},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			conf.EventFingerprint = test.enabled
+			reporter, err := packet.NewReporter(log.Test(t, "EventFingerprintTest"), u, "", "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			reqs = nil
+
+			instance := &client.Instance{ID: "$instance_id"}
+			j := Job{
+				Logger: joblog.With("test", name),
+				mode:   modeInstance,
+				hardware: &cacher.HardwareCacher{
+					ID:       "$hardware_id",
+					Instance: instance,
+					Serial:   test.serial,
+					AssetTag: test.assetTag,
+				},
+				instance: instance,
+				reporter: reporter,
+			}
+			test.post(j)
+
+			if len(reqs) != 1 {
+				t.Fatalf("unexpected api requests: %v", reqs)
+			}
+			if got := reqs[0]; got != test.want {
+				t.Fatalf("mismatch in api request want:%v, got:%v", test.want, got)
+			}
+		})
+	}
+}
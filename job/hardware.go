@@ -50,7 +50,7 @@ func (j Job) AddHardware(w http.ResponseWriter, req *http.Request) {
 		return
 	}
 
-	if _, err := j.reporter.PostHardwareComponent(req.Context(), j.hardware.HardwareID(), bytes.NewReader(jsonBody)); err != nil {
+	if _, err := j.eventReporter().PostHardwareComponent(req.Context(), j.hardware.HardwareID(), bytes.NewReader(jsonBody)); err != nil {
 		joblog.Error(errors.Wrap(err, "posting componenents"))
 		w.WriteHeader(http.StatusBadRequest)
 
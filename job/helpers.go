@@ -2,8 +2,13 @@ package job
 
 import (
 	"net"
+	"sort"
+	"strings"
+	"time"
 
+	"github.com/pkg/errors"
 	"github.com/tinkerbell/boots/client"
+	"github.com/tinkerbell/boots/conf"
 )
 
 var rescueOS = &client.OperatingSystem{
@@ -48,6 +53,22 @@ func (j Job) InstanceID() string {
 	return ""
 }
 
+func (j Job) Hostname() string {
+	if i := j.instance; i != nil {
+		return i.Hostname
+	}
+
+	return ""
+}
+
+func (j Job) SSHKeys() []string {
+	if i := j.instance; i != nil {
+		return i.SSHKeys
+	}
+
+	return nil
+}
+
 func (j Job) Rescue() bool {
 	if i := j.instance; i != nil {
 		return i.Rescue
@@ -96,13 +117,201 @@ func (j Job) PasswordHash() string {
 	return j.instance.PasswordHash
 }
 
-// CustomData returns instance.CustomData.
+// CustomData returns instance.CustomData, without the top level keys not in
+// conf.CustomDataKeys when set.
 func (j Job) CustomData() interface{} {
-	if i := j.instance; i != nil && i.CustomData != nil {
+	i := j.instance
+	if i == nil || i.CustomData == nil {
+		return nil
+	}
+	cd, ok := i.CustomData.(map[string]interface{})
+	if !ok || conf.CustomDataKeys == nil {
 		return i.CustomData
 	}
 
-	return nil
+	allowed := make(map[string]interface{}, len(cd))
+	for key, value := range cd {
+		if _, ok := conf.CustomDataKeys[key]; ok {
+			allowed[key] = value
+		}
+	}
+
+	return allowed
+}
+
+// ignoredCustomDataKeys returns the sorted top level instance CustomData keys
+// CustomData leaves out.
+func (j Job) ignoredCustomDataKeys() []string {
+	if j.instance == nil || conf.CustomDataKeys == nil {
+		return nil
+	}
+	cd, ok := j.instance.CustomData.(map[string]interface{})
+	if !ok {
+		return nil
+	}
+
+	var ignored []string
+	for key := range cd {
+		if _, ok := conf.CustomDataKeys[key]; !ok {
+			ignored = append(ignored, key)
+		}
+	}
+	sort.Strings(ignored)
+
+	return ignored
+}
+
+// OSIEMode returns the OSIE boot mode requested through the instance CustomData
+// "osie_mode" key. An empty string means the default install behavior applies.
+func (j Job) OSIEMode() string {
+	if cd, ok := j.CustomData().(map[string]interface{}); ok {
+		if mode, ok := cd["osie_mode"].(string); ok {
+			return mode
+		}
+	}
+
+	return ""
+}
+
+// OSVersionPin returns the OS version pinned through the instance CustomData
+// "os_version" key, preferred by installers over the plan default. Pins valid
+// does not accept are logged and ignored, returning "".
+func (j Job) OSVersionPin(valid func(string) bool) string {
+	cd, ok := j.CustomData().(map[string]interface{})
+	if !ok {
+		return ""
+	}
+	pin, ok := cd["os_version"].(string)
+	if !ok || pin == "" {
+		return ""
+	}
+	if !valid(pin) {
+		j.With("os_version", pin).Info("ignoring invalid os version pin")
+
+		return ""
+	}
+
+	return pin
+}
+
+// OSVersion returns the version the distro installer should install, the
+// instance pin of OSVersionPin, else the FACILITY_OS_VERSIONS default of the
+// facility of the job. It is "" when neither is set and valid, leaving the
+// installer to its own default.
+func (j Job) OSVersion(distro string, valid func(string) bool) string {
+	if pin := j.OSVersionPin(valid); pin != "" {
+		return pin
+	}
+	v, ok := conf.FacilityOSVersions[j.FacilityCode()][distro]
+	if !ok {
+		return ""
+	}
+	if !valid(v) {
+		j.With("facility", j.FacilityCode(), "distro", distro, "os_version", v).Info("ignoring invalid facility os version")
+
+		return ""
+	}
+
+	return v
+}
+
+// ArtifactURL returns base with its scheme replaced by the one forced for the job,
+// through the instance CustomData "osie_url_scheme" key or the OSIE_URL_SCHEMES
+// entry of its facility. Without either base is returned as is.
+func (j Job) ArtifactURL(base string) string {
+	scheme := conf.OsieURLSchemes[j.FacilityCode()]
+	if cd, ok := j.CustomData().(map[string]interface{}); ok {
+		if s, ok := cd["osie_url_scheme"].(string); ok && (s == "http" || s == "https") {
+			scheme = s
+		}
+	}
+	i := strings.Index(base, "://")
+	if scheme == "" || i < 0 {
+		return base
+	}
+
+	return scheme + base[i:]
+}
+
+// DebugKernelArgs returns the kernel args of the instance CustomData
+// "debug_kernel_args" key, appended by installers while troubleshooting a boot.
+// The override must carry an RFC 3339 "debug_kernel_args_expires" time and is
+// dropped once now is past it, so it cannot outlive the troubleshooting.
+func (j Job) DebugKernelArgs(now time.Time) string {
+	cd, ok := j.CustomData().(map[string]interface{})
+	if !ok {
+		return ""
+	}
+	args, ok := cd["debug_kernel_args"].(string)
+	if !ok || args == "" {
+		return ""
+	}
+	s, _ := cd["debug_kernel_args_expires"].(string)
+	expires, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		j.Error(errors.WithMessage(err, "parsing CustomData debug_kernel_args_expires"))
+
+		return ""
+	}
+	if !now.Before(expires) {
+		return ""
+	}
+
+	return args
+}
+
+// OSIELogLevel returns the kernel log level osie boots with, the instance
+// CustomData "osie_log_level" one while troubleshooting a machine, or else
+// conf.OSIELogLevel. Like DebugKernelArgs, the override must carry an RFC 3339
+// "osie_log_level_expires" time and is dropped once now is past it.
+func (j Job) OSIELogLevel(now time.Time) string {
+	cd, ok := j.CustomData().(map[string]interface{})
+	if !ok {
+		return conf.OSIELogLevel
+	}
+	level, ok := cd["osie_log_level"].(string)
+	if !ok || level == "" {
+		return conf.OSIELogLevel
+	}
+	if !conf.ValidKernelLogLevel(level) {
+		j.With("osie_log_level", level).Error(errors.New("ignoring CustomData osie_log_level, not between 0 and 7"))
+
+		return conf.OSIELogLevel
+	}
+	s, _ := cd["osie_log_level_expires"].(string)
+	expires, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		j.Error(errors.WithMessage(err, "parsing CustomData osie_log_level_expires"))
+
+		return conf.OSIELogLevel
+	}
+	if !now.Before(expires) {
+		return conf.OSIELogLevel
+	}
+
+	return level
+}
+
+// StaticRoutes returns the DHCP classless static routes of the job, the configured
+// DHCP_STATIC_ROUTES followed by the instance CustomData "dhcp_static_routes" ones.
+func (j Job) StaticRoutes() []conf.StaticRoute {
+	routes := conf.DHCPStaticRoutes
+	cd, ok := j.CustomData().(map[string]interface{})
+	if !ok {
+		return routes
+	}
+	s, ok := cd["dhcp_static_routes"].(string)
+	if !ok {
+		return routes
+	}
+	extra, err := conf.ParseStaticRoutes(s)
+	if err != nil {
+		j.Error(errors.WithMessage(err, "parsing CustomData dhcp_static_routes"))
+
+		return routes
+	}
+
+	return append(routes[:len(routes):len(routes)], extra...)
 }
 
 func (j Job) OperatingSystem() *client.OperatingSystem {
@@ -190,6 +399,24 @@ func (j Job) PrimaryNIC() net.HardwareAddr {
 	return j.mac
 }
 
+// HardwareSerial returns the serial number of the hardware, if known.
+func (j Job) HardwareSerial() string {
+	if h := j.hardware; h != nil {
+		return h.HardwareSerial()
+	}
+
+	return ""
+}
+
+// HardwareAssetTag returns the asset tag of the hardware, if known.
+func (j Job) HardwareAssetTag() string {
+	if h := j.hardware; h != nil {
+		return h.HardwareAssetTag()
+	}
+
+	return ""
+}
+
 // HardwareState will return (enrolled burn_in preinstallable preinstalling failed_preinstall provisionable provisioning deprovisioning in_use).
 func (j Job) HardwareState() string {
 	if h := j.hardware; h != nil && h.HardwareID() != "" {
@@ -220,6 +447,36 @@ func (j Job) CanWorkflow() bool {
 	return j.hardware.HardwareAllowWorkflow(j.mac)
 }
 
+// HasOS reports whether an operating system is set for the machine to boot.
+func (j Job) HasOS() bool {
+	if j.instance == nil {
+		return false
+	}
+	os := j.hardware.OperatingSystem()
+
+	return os != nil && (os.Installer != "" || os.Slug != "" || os.Distro != "")
+}
+
+// WorkflowExpected reports whether the machine is expected to run a workflow,
+// false when its hardware record sets no_workflow, e.g. for machines only
+// booting OSIE for discovery, or the instance CustomData "no_workflow" key is
+// true. The key is read regardless of CUSTOM_DATA_KEYS, boots itself acts on it.
+func (j Job) WorkflowExpected() bool {
+	if client.HardwareNoWorkflow(j.hardware, j.mac) {
+		return false
+	}
+	if j.instance == nil {
+		return true
+	}
+	if cd, ok := j.instance.CustomData.(map[string]interface{}); ok {
+		if noWorkflow, ok := cd["no_workflow"].(bool); ok && noWorkflow {
+			return false
+		}
+	}
+
+	return true
+}
+
 func (j Job) OSIEBaseURL() string {
 	if h := j.hardware; h != nil {
 		return j.hardware.OSIEBaseURL(j.mac)
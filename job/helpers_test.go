@@ -2,9 +2,11 @@ package job
 
 import (
 	"testing"
+	"time"
 
 	"github.com/google/go-cmp/cmp"
 	"github.com/tinkerbell/boots/client"
+	"github.com/tinkerbell/boots/conf"
 )
 
 func TestPasswordHash(t *testing.T) {
@@ -53,3 +55,135 @@ func TestPasswordHash(t *testing.T) {
 		})
 	}
 }
+
+func TestDebugKernelArgs(t *testing.T) {
+	now := time.Date(2022, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := map[string]struct {
+		customData interface{}
+		want       string
+	}{
+		"no override": {},
+		"active": {
+			customData: map[string]interface{}{
+				"debug_kernel_args":         "debug earlyprintk=serial",
+				"debug_kernel_args_expires": "2022-03-01T13:00:00Z",
+			},
+			want: "debug earlyprintk=serial",
+		},
+		"expired": {
+			customData: map[string]interface{}{
+				"debug_kernel_args":         "debug earlyprintk=serial",
+				"debug_kernel_args_expires": "2022-03-01T11:00:00Z",
+			},
+		},
+		"without expiry": {
+			customData: map[string]interface{}{"debug_kernel_args": "debug earlyprintk=serial"},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			m := NewMock(t, "c3.small.x86", "ewr1")
+			m.SetCustomData(tc.customData)
+
+			if got := m.Job().DebugKernelArgs(now); got != tc.want {
+				t.Fatalf("unexpected debug kernel args, want: %q, got: %q", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestArtifactURL(t *testing.T) {
+	defer func(schemes map[string]string) { conf.OsieURLSchemes = schemes }(conf.OsieURLSchemes)
+
+	tests := map[string]struct {
+		base       string
+		schemes    map[string]string
+		customData interface{}
+		want       string
+	}{
+		"no override": {
+			base: "https://vendors.example.com/flatcar",
+			want: "https://vendors.example.com/flatcar",
+		},
+		"facility override": {
+			base:    "https://vendors.example.com/flatcar",
+			schemes: map[string]string{"ewr1": "http"},
+			want:    "http://vendors.example.com/flatcar",
+		},
+		"other facility override": {
+			base:    "https://vendors.example.com/flatcar",
+			schemes: map[string]string{"sjc1": "http"},
+			want:    "https://vendors.example.com/flatcar",
+		},
+		"job override": {
+			base:       "http://vendors.example.com/flatcar",
+			customData: map[string]interface{}{"osie_url_scheme": "https"},
+			want:       "https://vendors.example.com/flatcar",
+		},
+		"job override wins over facility": {
+			base:       "https://vendors.example.com/flatcar",
+			schemes:    map[string]string{"ewr1": "https"},
+			customData: map[string]interface{}{"osie_url_scheme": "http"},
+			want:       "http://vendors.example.com/flatcar",
+		},
+		"invalid job override ignored": {
+			base:       "https://vendors.example.com/flatcar",
+			customData: map[string]interface{}{"osie_url_scheme": "ftp"},
+			want:       "https://vendors.example.com/flatcar",
+		},
+		"base without scheme": {
+			base:    "/flatcar",
+			schemes: map[string]string{"ewr1": "http"},
+			want:    "/flatcar",
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			conf.OsieURLSchemes = tc.schemes
+			m := NewMock(t, "c3.small.x86", "ewr1")
+			m.SetCustomData(tc.customData)
+
+			got := m.Job().ArtifactURL(tc.base)
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Fatal(diff)
+			}
+		})
+	}
+}
+
+func TestCustomDataKeys(t *testing.T) {
+	defer func(keys map[string]struct{}) { conf.CustomDataKeys = keys }(conf.CustomDataKeys)
+
+	cd := map[string]interface{}{"os_version": "stable", "rootpwcrypt": "$6$tenant"}
+	tests := map[string]struct {
+		keys    map[string]struct{}
+		want    interface{}
+		ignored []string
+	}{
+		"all honored by default": {want: cd},
+		"disallowed key ignored": {
+			keys:    map[string]struct{}{"os_version": {}},
+			want:    map[string]interface{}{"os_version": "stable"},
+			ignored: []string{"rootpwcrypt"},
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			conf.CustomDataKeys = tt.keys
+			m := NewMock(t, "c3.small.x86", "ewr1")
+			m.SetCustomData(cd)
+			j := m.Job()
+
+			if diff := cmp.Diff(tt.want, j.CustomData()); diff != "" {
+				t.Fatal(diff)
+			}
+			if diff := cmp.Diff(tt.ignored, j.ignoredCustomDataKeys()); diff != "" {
+				t.Fatal(diff)
+			}
+		})
+	}
+}
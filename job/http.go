@@ -12,16 +12,46 @@ import (
 )
 
 func (j Job) ServeFile(w http.ResponseWriter, req *http.Request, i Installers) {
+	if req.Method == http.MethodHead {
+		// render as for GET, without posting the events of a real boot
+		j = j.Preview()
+	}
+	ctx := req.Context()
+	if req.Method == http.MethodPost {
+		// the installer selected from the installer menu
+		if err := req.ParseForm(); err != nil {
+			j.Error(errors.Wrap(err, "parsing http form"))
+		} else if choice := req.PostForm.Get(InstallerChoiceField); choice != "" {
+			ctx = WithInstallerChoice(ctx, choice)
+		}
+	}
 	base := path.Base(req.URL.Path)
 
+	if base == "grub.cfg" {
+		j.serveGrubConfig(ctx, w, i)
+
+		return
+	}
+	if name := strings.TrimSuffix(base, ".ipxe"+ScriptSignatureSuffix); len(name) < len(base) {
+		j.serveScriptSignature(w, name)
+
+		return
+	}
 	if name := strings.TrimSuffix(base, ".ipxe"); len(name) < len(base) {
-		j.serveBootScript(req.Context(), w, name, i)
+		j.serveBootScript(ctx, w, name, i)
 
 		return
 	}
 }
 
 func (j Job) ServePhoneHomeEndpoint(w http.ResponseWriter, req *http.Request) {
+	if !j.validNonce(req) {
+		w.WriteHeader(http.StatusForbidden)
+		j.Info("phone-home without a valid nonce")
+
+		return
+	}
+
 	var b []byte
 
 	switch req.Header.Get("Content-Type") {
@@ -67,6 +97,13 @@ func (j Job) ServePhoneHomeEndpoint(w http.ResponseWriter, req *http.Request) {
 }
 
 func (j Job) ServeProblemEndpoint(w http.ResponseWriter, req *http.Request) {
+	if !j.validNonce(req) {
+		w.WriteHeader(http.StatusForbidden)
+		j.Info("problem without a valid nonce")
+
+		return
+	}
+
 	b, err := readClose(req.Body)
 	if err != nil {
 		j.Error(errors.WithMessage(err, "reading problem body"))
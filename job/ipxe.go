@@ -3,10 +3,13 @@ package job
 import (
 	"context"
 	"net/http"
+	"strings"
 
 	"github.com/pkg/errors"
 	"github.com/tinkerbell/boots/conf"
+	"github.com/tinkerbell/boots/grub"
 	"github.com/tinkerbell/boots/ipxe"
+	"github.com/tinkerbell/boots/metrics"
 	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/codes"
 	"go.opentelemetry.io/otel/trace"
@@ -51,6 +54,64 @@ func (i *Installers) RegisterSlug(name string, builder BootScript) {
 }
 
 func (j Job) serveBootScript(ctx context.Context, w http.ResponseWriter, name string, i Installers) {
+	script, ok := j.bootScript(ctx, name, i)
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+
+		return
+	}
+	sig, err := signScript(script)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		j.With("script", name).Error(err)
+		trace.SpanFromContext(ctx).SetStatus(codes.Error, err.Error())
+
+		return
+	}
+	j.keepScriptSignature(name, sig)
+
+	if _, err := w.Write(script); err != nil {
+		j.With("script", name).Error(errors.Wrap(err, "unable to write boot script"))
+		trace.SpanFromContext(ctx).SetStatus(codes.Error, err.Error())
+
+		return
+	}
+}
+
+// serveGrubConfig serves the grub.cfg equivalent of the auto boot script, for
+// machines netbooting with GRUB instead of iPXE.
+func (j Job) serveGrubConfig(ctx context.Context, w http.ResponseWriter, i Installers) {
+	script, ok := j.bootScript(ctx, "auto", i)
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+
+		return
+	}
+	cfg, err := grub.FromIPXE(script)
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		j.Error(errors.WithMessage(err, "generating grub.cfg"))
+		trace.SpanFromContext(ctx).SetStatus(codes.Error, err.Error())
+
+		return
+	}
+
+	if _, err := w.Write(cfg); err != nil {
+		j.Error(errors.Wrap(err, "unable to write grub.cfg"))
+		trace.SpanFromContext(ctx).SetStatus(codes.Error, err.Error())
+
+		return
+	}
+}
+
+// AutoScript returns the auto boot script of j, the one served as auto.ipxe,
+// false if there is none to serve.
+func (j Job) AutoScript(ctx context.Context, i Installers) ([]byte, bool) {
+	return j.bootScript(ctx, "auto", i)
+}
+
+// bootScript generates the named boot script of j, false if there is none to serve.
+func (j Job) bootScript(ctx context.Context, name string, i Installers) ([]byte, bool) {
 	span := trace.SpanFromContext(ctx)
 	span.SetAttributes(attribute.String("boots.script_name", name))
 
@@ -60,20 +121,45 @@ func (j Job) serveBootScript(ctx context.Context, w http.ResponseWriter, name st
 	}
 	fn, ok := scripts[name]
 	if !ok {
-		w.WriteHeader(http.StatusNotFound)
 		err := errors.Errorf("boot script %q not found", name)
 		j.With("script", name).Error(err)
 		span.SetStatus(codes.Error, err.Error())
 
-		return
+		return nil, false
+	}
+	if name == "auto" {
+		var installer string
+		installer, fn = i.autoScript(ctx, j)
+		if installer != "" && !conf.InstallerAvailable(installer, j.FacilityCode()) {
+			j.With("installer", installer, "facility", j.FacilityCode()).Info("installer is not available")
+			if !conf.InstallerUnavailableScript {
+				return nil, false
+			}
+			fn = installerUnavailable(installer)
+		}
 	}
 
 	s := ipxe.NewScript()
+	s.Retry(conf.IPXEFetchAttempts, conf.IPXEFetchRetryDelay)
+	s.Verbose(conf.IPXEVerbose)
 	s.Set("iface", j.InterfaceName(0))
 	s.Or("shell")
-	s.Set("tinkerbell", "http://"+conf.PublicFQDN)
+	s.Set("tinkerbell", "http://"+conf.PublicFQDNFor(j.FacilityCode()))
 	s.Set("syslog_host", conf.PublicSyslogFQDN)
 	s.Set("ipxe_cloud_config", "packet")
+	if conf.IPXENonce && j.preview {
+		// issuing would replace the nonce of the machine's real boot
+		s.Set("boots_nonce", previewNonce)
+	} else if conf.IPXENonce {
+		nonce, err := nonces.issue(j.mac.String(), conf.IPXENonceTTL)
+		if err != nil {
+			j.Error(err)
+			span.SetStatus(codes.Error, err.Error())
+
+			return nil, false
+		}
+		s.Set("boots_nonce", nonce)
+	}
 
 	// the trace id is enough to find otel traces in most systems
 	if sc := span.SpanContext(); sc.IsSampled() {
@@ -82,45 +168,128 @@ func (j Job) serveBootScript(ctx context.Context, w http.ResponseWriter, name st
 
 	fn(ctx, j, s)
 	script := s.Bytes()
+	if max := conf.IPXEScriptMaxSize; max > 0 && len(script) > max {
+		err := errors.Errorf("boot script of %d bytes exceeds the maximum size of %d bytes", len(script), max)
+		j.With("script", name).Error(err)
+		span.SetStatus(codes.Error, err.Error())
+		metrics.IPXEScriptsOversized.Inc()
+
+		s.Reset()
+		s.Echo("boot script too large, dropping to the shell")
+		s.Shell()
+		script = s.Bytes()
+	}
 	span.SetAttributes(attribute.String("ipxe-script", string(script)))
 
-	if _, err := w.Write(script); err != nil {
-		j.With("script", name).Error(errors.Wrap(err, "unable to write boot script"))
-		span.SetStatus(codes.Error, err.Error())
+	return script, true
+}
 
-		return
+// StaticNetwork emits the iPXE lines configuring net0, the first iPXE network
+// device, with the address of the hardware record, for installers whose
+// environment can not rely on DHCP. The iface variable names a hardware port
+// rather than an iPXE device, so it is not used. It reports false, emitting
+// nothing, when the hardware has no address.
+func (j Job) StaticNetwork(s *ipxe.Script) bool {
+	addr, netmask := j.dhcp.Address(), j.dhcp.Netmask()
+	if addr == nil || netmask == nil {
+		return false
 	}
+	s.StaticIP("net0", addr, netmask, j.dhcp.Gateway())
+
+	return true
 }
 
 func (i Installers) auto(ctx context.Context, j Job, s *ipxe.Script) {
+	_, f := i.autoScript(ctx, j)
+	f(ctx, j, s)
+}
+
+type installerOverrideKey struct{}
+
+// WithInstallerOverride returns a copy of ctx forcing auto boot scripts to the
+// installer, slug or distro registered as name, instead of the one of the job.
+func WithInstallerOverride(ctx context.Context, name string) context.Context {
+	return context.WithValue(ctx, installerOverrideKey{}, name)
+}
+
+type awaitingConfigKey struct{}
+
+// WithAwaitingConfig returns a copy of ctx serving the awaiting configuration
+// holding script as the auto boot script, for machines with no operating
+// system nor active workflow yet.
+func WithAwaitingConfig(ctx context.Context) context.Context {
+	return context.WithValue(ctx, awaitingConfigKey{}, true)
+}
+
+// autoScript returns the BootScript of the installer of j along with the name it is registered under.
+func (i Installers) autoScript(ctx context.Context, j Job) (string, BootScript) {
+	if awaiting, _ := ctx.Value(awaitingConfigKey{}).(bool); awaiting {
+		j.Info("no operating system nor active workflow, providing the awaiting configuration script")
+
+		return "", awaitingConfig
+	}
+
 	if j.instance == nil {
 		j.Info(errors.New("no device to boot, providing an iPXE shell"))
-		shell(ctx, j, s)
 
-		return
+		return "", shell
 	}
-	if f, ok := i.ByInstaller[j.hardware.OperatingSystem().Installer]; ok {
-		f(ctx, j, s)
 
-		return
+	if name, ok := ctx.Value(installerOverrideKey{}).(string); ok && name != "" {
+		if f, ok := i.byName(name); ok {
+			j.With("installer", name).Info("OVERRIDING installer selection as requested by a trusted proxy")
+
+			return name, f
+		}
+		j.With("installer", name).Error(errors.New("ignoring override to an unknown installer"))
 	}
-	if f, ok := i.BySlug[j.hardware.OperatingSystem().Slug]; ok {
-		f(ctx, j, s)
 
-		return
+	if name, f, ok := i.candidateScript(ctx, j); ok {
+		return name, f
 	}
-	if f, ok := i.ByDistro[j.hardware.OperatingSystem().Distro]; ok {
-		f(ctx, j, s)
 
-		return
+	var installer, slug, distro string
+	if os := j.hardware.OperatingSystem(); os != nil {
+		installer, slug, distro = os.Installer, os.Slug, os.Distro
+	}
+	if installer == "" && slug == "" && distro == "" {
+		slug, distro = conf.DefaultOSSlug, conf.DefaultOSDistro
+		j.With("slug", slug, "distro", distro).Info("no operating system set, using the default")
+	}
+	if f, ok := i.ByInstaller[installer]; ok {
+		return installer, f
+	}
+	if f, ok := i.BySlug[slug]; ok {
+		return slug, f
+	}
+	if f, ok := i.ByDistro[distro]; ok {
+		return distro, f
 	}
 	if i.Default != nil {
-		i.Default(ctx, j, s)
+		return "default", i.Default
+	}
+	j.With("slug", slug, "distro", distro).Error(errors.New("unsupported slug/distro"))
 
-		return
+	return "", shell
+}
+
+// installerUnavailable returns a BootScript telling the console the installer
+// is unavailable, then rebooting the machine.
+func installerUnavailable(name string) BootScript {
+	return func(_ context.Context, _ Job, s *ipxe.Script) {
+		s.Echo(strings.ReplaceAll(conf.InstallerUnavailableMessage, "{installer}", name))
+		s.Sleep(int(conf.InstallerUnavailableRebootDelay.Seconds()))
+		s.Reboot()
 	}
-	j.With("slug", j.hardware.OperatingSystem().Slug, "distro", j.hardware.OperatingSystem().Distro).Error(errors.New("unsupported slug/distro"))
-	shell(ctx, j, s)
+}
+
+// awaitingConfig phones home that the machine is waiting for its
+// configuration, then tells the console and reboots to try again later.
+func awaitingConfig(ctx context.Context, j Job, s *ipxe.Script) {
+	j.PostAwaitingConfig(ctx)
+	s.Echo(conf.AwaitingConfigMessage)
+	s.Sleep(int(conf.AwaitingConfigRetryDelay.Seconds()))
+	s.Reboot()
 }
 
 func shell(_ context.Context, _ Job, s *ipxe.Script) {
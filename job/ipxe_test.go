@@ -0,0 +1,285 @@
+package job
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/tinkerbell/boots/conf"
+	"github.com/tinkerbell/boots/ipxe"
+	"github.com/tinkerbell/boots/metrics"
+)
+
+func TestAutoDefaultOS(t *testing.T) {
+	defer func(slug, distro string) {
+		conf.DefaultOSSlug, conf.DefaultOSDistro = slug, distro
+	}(conf.DefaultOSSlug, conf.DefaultOSDistro)
+
+	tests := []struct {
+		name          string
+		osSlug        string
+		defaultSlug   string
+		defaultDistro string
+		want          string
+	}{
+		{name: "no default", want: "default"},
+		{name: "default distro", defaultDistro: "discovery", want: "discovery"},
+		{name: "default slug", defaultSlug: "ubuntu_20_04", defaultDistro: "discovery", want: "ubuntu_20_04"},
+		{name: "unknown default", defaultDistro: "bogus", want: "default"},
+		{name: "os set", osSlug: "ubuntu_20_04", defaultDistro: "discovery", want: "ubuntu_20_04"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conf.DefaultOSSlug, conf.DefaultOSDistro = tt.defaultSlug, tt.defaultDistro
+
+			var got string
+			installer := func(name string) BootScript {
+				return func(context.Context, Job, *ipxe.Script) { got = name }
+			}
+			i := NewInstallers()
+			i.RegisterDefaultInstaller(installer("default"))
+			i.RegisterDistro("discovery", installer("discovery"))
+			i.RegisterSlug("ubuntu_20_04", installer("ubuntu_20_04"))
+
+			m := NewMock(t, "c3.small.x86", "ewr1")
+			if tt.osSlug != "" {
+				m.SetOSSlug(tt.osSlug)
+			}
+			i.auto(context.Background(), m.Job(), ipxe.NewScript())
+
+			if got != tt.want {
+				t.Fatalf("unexpected installer, want: %q, got: %q", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestServeBootScriptUnavailableInstaller(t *testing.T) {
+	defer func(disabled map[string]struct{}, facilities map[string]map[string]struct{}, script bool, message string, delay time.Duration) {
+		conf.DisabledInstallers, conf.InstallerFacilities = disabled, facilities
+		conf.InstallerUnavailableScript, conf.InstallerUnavailableMessage, conf.InstallerUnavailableRebootDelay = script, message, delay
+	}(conf.DisabledInstallers, conf.InstallerFacilities, conf.InstallerUnavailableScript, conf.InstallerUnavailableMessage, conf.InstallerUnavailableRebootDelay)
+	conf.InstallerUnavailableRebootDelay = time.Minute
+	message := conf.InstallerUnavailableMessage
+
+	tests := []struct {
+		name       string
+		disabled   map[string]struct{}
+		facilities map[string]map[string]struct{}
+		script     bool
+		message    string
+		code       int
+		want       string
+	}{
+		{name: "available", code: http.StatusOK, want: "echo flatcar installer\n"},
+		{name: "allowed facility", facilities: map[string]map[string]struct{}{"flatcar": {"ewr1": {}}}, code: http.StatusOK, want: "echo flatcar installer\n"},
+		{name: "disabled", disabled: map[string]struct{}{"flatcar": {}}, code: http.StatusNotFound},
+		{name: "disallowed facility", facilities: map[string]map[string]struct{}{"flatcar": {"sjc1": {}}}, code: http.StatusNotFound},
+		{
+			name: "disabled script", disabled: map[string]struct{}{"flatcar": {}}, script: true, code: http.StatusOK,
+			want: "echo installer flatcar is temporarily unavailable, contact ops\nsleep 60\nreboot\n",
+		},
+		{
+			name: "disallowed facility script", facilities: map[string]map[string]struct{}{"flatcar": {"sjc1": {}}}, script: true, code: http.StatusOK,
+			want: "echo installer flatcar is temporarily unavailable, contact ops\nsleep 60\nreboot\n",
+		},
+		{
+			name: "format verbs in message", disabled: map[string]struct{}{"flatcar": {}}, script: true, code: http.StatusOK,
+			message: "100% of {installer} %s installs are paused",
+			want:    "echo 100% of flatcar %s installs are paused\nsleep 60\nreboot\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conf.DisabledInstallers, conf.InstallerFacilities = tt.disabled, tt.facilities
+			conf.InstallerUnavailableScript = tt.script
+			conf.InstallerUnavailableMessage = message
+			if tt.message != "" {
+				conf.InstallerUnavailableMessage = tt.message
+			}
+
+			i := NewInstallers()
+			i.RegisterDistro("flatcar", func(_ context.Context, _ Job, s *ipxe.Script) { s.Echo("flatcar installer") })
+
+			m := NewMock(t, "c3.small.x86", "ewr1")
+			m.SetOSDistro("flatcar")
+			w := httptest.NewRecorder()
+			m.Job().serveBootScript(context.Background(), w, "auto", i)
+
+			resp := w.Result()
+			if resp.StatusCode != tt.code {
+				t.Fatalf("unexpected response code, want: %d, got: %d", tt.code, resp.StatusCode)
+			}
+			body, _ := io.ReadAll(resp.Body)
+			if tt.want != "" && !strings.HasSuffix(string(body), tt.want) {
+				t.Fatalf("unexpected script, want suffix: %q, got: %q", tt.want, body)
+			}
+		})
+	}
+}
+
+func TestServeGrubConfig(t *testing.T) {
+	defer func(fqdn, syslog string) {
+		conf.PublicFQDN, conf.PublicSyslogFQDN = fqdn, syslog
+	}(conf.PublicFQDN, conf.PublicSyslogFQDN)
+	conf.PublicFQDN, conf.PublicSyslogFQDN = "boots-test.example.com", "boots-test.example.com"
+
+	i := NewInstallers()
+	i.RegisterDistro("alpine", func(_ context.Context, j Job, s *ipxe.Script) {
+		s.Set("arch", j.Arch())
+		s.Set("action", "install")
+		s.Set("base-url", "http://install.ewr1.packet.net/misc/osie/current")
+		s.Kernel("${base-url}/vmlinuz-${arch}")
+		s.Args("ip=dhcp", "modules=loop,squashfs,sd-mod,usb-storage", "alpine_repo=${base-url}/repo-${arch}/main")
+		s.Args("tinkerbell=${tinkerbell}", "syslog_host=${syslog_host}", "packet_action=${action}")
+		s.Args("console=ttyS1,115200n8", "initrd=initramfs-${arch}")
+		s.Initrd("${base-url}/initramfs-${arch}")
+		s.Boot()
+	})
+	i.RegisterDistro("custom", func(_ context.Context, _ Job, s *ipxe.Script) {
+		s.Chain("http://example.com/custom.ipxe")
+	})
+
+	t.Run("kernel", func(t *testing.T) {
+		m := NewMock(t, "c3.small.x86", "ewr1")
+		m.SetOSDistro("alpine")
+		w := httptest.NewRecorder()
+		m.Job().ServeFile(w, httptest.NewRequest("GET", "http://127.0.0.1/grub/grub.cfg", nil), i)
+
+		resp := w.Result()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("unexpected response code, want: %d, got: %d", http.StatusOK, resp.StatusCode)
+		}
+		got, _ := io.ReadAll(resp.Body)
+		want, err := os.ReadFile("testdata/grub.cfg")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != string(want) {
+			t.Fatalf("unexpected grub.cfg, want:\n%s\ngot:\n%s", want, got)
+		}
+	})
+
+	t.Run("kernel with retries", func(t *testing.T) {
+		defer func(attempts int) { conf.IPXEFetchAttempts = attempts }(conf.IPXEFetchAttempts)
+		conf.IPXEFetchAttempts = 3
+
+		m := NewMock(t, "c3.small.x86", "ewr1")
+		m.SetOSDistro("alpine")
+		w := httptest.NewRecorder()
+		m.Job().ServeFile(w, httptest.NewRequest("GET", "http://127.0.0.1/grub/grub.cfg", nil), i)
+
+		got, _ := io.ReadAll(w.Result().Body)
+		want, err := os.ReadFile("testdata/grub.cfg")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != string(want) {
+			t.Fatalf("unexpected grub.cfg, want:\n%s\ngot:\n%s", want, got)
+		}
+	})
+
+	t.Run("chain", func(t *testing.T) {
+		m := NewMock(t, "c3.small.x86", "ewr1")
+		m.SetOSDistro("custom")
+		w := httptest.NewRecorder()
+		m.Job().ServeFile(w, httptest.NewRequest("GET", "http://127.0.0.1/grub.cfg", nil), i)
+
+		if code := w.Result().StatusCode; code != http.StatusNotFound {
+			t.Fatalf("unexpected response code, want: %d, got: %d", http.StatusNotFound, code)
+		}
+	})
+}
+
+func TestStaticNetwork(t *testing.T) {
+	defer func(fqdn, syslog string) {
+		conf.PublicFQDN, conf.PublicSyslogFQDN = fqdn, syslog
+	}(conf.PublicFQDN, conf.PublicSyslogFQDN)
+	conf.PublicFQDN, conf.PublicSyslogFQDN = "boots-test.example.com", "boots-test.example.com"
+
+	i := NewInstallers()
+	i.RegisterDistro("static", func(_ context.Context, j Job, s *ipxe.Script) {
+		j.StaticNetwork(s)
+		s.Kernel("http://install.ewr1.packet.net/vmlinuz")
+		s.Boot()
+	})
+
+	t.Run("static ip", func(t *testing.T) {
+		m := NewMock(t, "c3.small.x86", "ewr1")
+		m.SetOSDistro("static")
+		m.SetNetwork(net.ParseIP("192.168.1.10"), net.ParseIP("255.255.255.0"), net.ParseIP("192.168.1.1"))
+		w := httptest.NewRecorder()
+		m.Job().serveBootScript(context.Background(), w, "auto", i)
+
+		got, _ := io.ReadAll(w.Result().Body)
+		want, err := os.ReadFile("testdata/static-network.ipxe")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != string(want) {
+			t.Fatalf("unexpected script, want:\n%s\ngot:\n%s", want, got)
+		}
+	})
+
+	t.Run("no static ip", func(t *testing.T) {
+		m := NewMock(t, "c3.small.x86", "ewr1")
+		m.SetOSDistro("static")
+		w := httptest.NewRecorder()
+		m.Job().serveBootScript(context.Background(), w, "auto", i)
+
+		got, _ := io.ReadAll(w.Result().Body)
+		if strings.Contains(string(got), "/ip ") || strings.Contains(string(got), "ifopen") {
+			t.Fatalf("unexpected static network config in script:\n%s", got)
+		}
+	})
+}
+
+func TestScriptMaxSize(t *testing.T) {
+	defer func(max int) { conf.IPXEScriptMaxSize = max }(conf.IPXEScriptMaxSize)
+	conf.IPXEScriptMaxSize = 4096
+
+	i := NewInstallers()
+	i.RegisterDistro("huge", func(_ context.Context, _ Job, s *ipxe.Script) {
+		s.Echo(strings.Repeat("x", 8192))
+		s.Boot()
+	})
+	i.RegisterDistro("small", func(_ context.Context, _ Job, s *ipxe.Script) {
+		s.Boot()
+	})
+
+	for _, tt := range []struct {
+		distro    string
+		oversized bool
+	}{
+		{distro: "huge", oversized: true},
+		{distro: "small"},
+	} {
+		t.Run(tt.distro, func(t *testing.T) {
+			m := NewMock(t, "c3.small.x86", "ewr1")
+			m.SetOSDistro(tt.distro)
+			before := testutil.ToFloat64(metrics.IPXEScriptsOversized)
+
+			script, ok := m.Job().bootScript(context.Background(), "auto", i)
+			if !ok {
+				t.Fatal("no boot script")
+			}
+			if len(script) > conf.IPXEScriptMaxSize {
+				t.Fatalf("served a script of %d bytes", len(script))
+			}
+			want := "#!ipxe\n\necho Tinkerbell Boots iPXE\necho boot script too large, dropping to the shell\nshell\n"
+			if (string(script) == want) != tt.oversized {
+				t.Fatalf("unexpected script:\n%s", script)
+			}
+			if got := testutil.ToFloat64(metrics.IPXEScriptsOversized) - before; (got == 1) != tt.oversized {
+				t.Fatalf("unexpected ipxe_scripts_oversized_total increase: %v", got)
+			}
+		})
+	}
+}
@@ -0,0 +1,34 @@
+package job
+
+import (
+	"context"
+	"math/rand"
+	"time"
+)
+
+// jitter returns a random duration in [0, max), or 0 if max is not positive.
+func jitter(max time.Duration) time.Duration {
+	if max <= 0 {
+		return 0
+	}
+
+	return time.Duration(rand.Int63n(int64(max))) //nolint:gosec // no need for a cryptographically secure delay
+}
+
+// sleepJitter waits a random duration up to max, returning early with the
+// context error if ctx is done first.
+func sleepJitter(ctx context.Context, max time.Duration) error {
+	d := jitter(max)
+	if d == 0 {
+		return nil
+	}
+
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
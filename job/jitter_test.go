@@ -0,0 +1,52 @@
+package job
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestJitter(t *testing.T) {
+	for _, max := range []time.Duration{-time.Second, 0, time.Nanosecond, time.Millisecond, time.Second} {
+		for i := 0; i < 1000; i++ {
+			d := jitter(max)
+			if d < 0 || (max > 0 && d >= max) || (max <= 0 && d != 0) {
+				t.Fatalf("jitter(%v) = %v, out of bounds", max, d)
+			}
+		}
+	}
+}
+
+func TestSleepJitter(t *testing.T) {
+	t.Run("zero", func(t *testing.T) {
+		start := time.Now()
+		for i := 0; i < 1000; i++ {
+			if err := sleepJitter(context.Background(), 0); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if elapsed := time.Since(start); elapsed > 10*time.Millisecond {
+			t.Fatalf("zero jitter took %v", elapsed)
+		}
+	})
+
+	t.Run("bounded", func(t *testing.T) {
+		max := 20 * time.Millisecond
+		start := time.Now()
+		if err := sleepJitter(context.Background(), max); err != nil {
+			t.Fatal(err)
+		}
+		// allow some scheduling slack over max
+		if elapsed := time.Since(start); elapsed > max+50*time.Millisecond {
+			t.Fatalf("jitter of at most %v took %v", max, elapsed)
+		}
+	})
+
+	t.Run("canceled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		if err := sleepJitter(ctx, time.Hour); err == nil {
+			t.Fatal("expected an error from a canceled context")
+		}
+	})
+}
@@ -12,12 +12,13 @@ import (
 	"github.com/tinkerbell/boots/conf"
 	"github.com/tinkerbell/boots/dhcp"
 	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/sync/singleflight"
 )
 
 // JobManager creates jobs.
 type Manager interface {
 	CreateFromRemoteAddr(ctx context.Context, ip string) (context.Context, *Job, error)
-	CreateFromDHCP(context.Context, net.HardwareAddr, net.IP, string) (context.Context, *Job, error)
+	CreateFromDHCP(context.Context, net.HardwareAddr, net.IP, string, string) (context.Context, *Job, error)
 }
 
 // Creator is a type that can create jobs.
@@ -26,6 +27,9 @@ type Creator struct {
 	reporter              client.Reporter
 	provisionerEngineName string
 	logger                log.Logger
+
+	// lookups coalesces concurrent hardware lookups of the same key
+	lookups singleflight.Group
 }
 
 // NewCreator returns a manager that can create jobs.
@@ -43,6 +47,7 @@ var joblog log.Logger
 func Init(l log.Logger) {
 	joblog = l.Package("job")
 	initRSA()
+	initScriptSigner()
 }
 
 // Job holds per request data.
@@ -60,6 +65,7 @@ type Job struct {
 	IpxeBaseURL           string
 	BootsBaseURL          string
 	reporter              client.Reporter
+	preview               bool
 }
 
 type Installers struct {
@@ -79,11 +85,15 @@ func NewInstallers() Installers {
 }
 
 // AllowPxe returns the value from the hardware data
-// in tink server defined at network.interfaces[].netboot.allow_pxe.
+// in tink server defined at network.interfaces[].netboot.allow_pxe,
+// conf.AllowPXEDefault when the hardware data has no such field.
 func (j Job) AllowPXE() bool {
 	if j.hardware.HardwareAllowPXE(j.mac) {
 		return true
 	}
+	if !client.HardwareAllowPXESet(j.hardware, j.mac) && conf.AllowPXEDefault {
+		return true
+	}
 	if j.InstanceID() == "" {
 		return false
 	}
@@ -91,6 +101,24 @@ func (j Job) AllowPXE() bool {
 	return j.instance.AllowPXE
 }
 
+// Preview returns a copy of j that does not report events or issue nonces, to
+// render its boot script and configs without side effects.
+func (j Job) Preview() Job {
+	j.reporter = client.NewNoOpReporter(j.Logger)
+	j.preview = true
+
+	return j
+}
+
+// eventReporter returns the reporter of j, a local one when it has none.
+func (j Job) eventReporter() client.Reporter {
+	if j.reporter == nil {
+		return client.NewLocalReporter(j.Logger, conf.LogUnreportedEvents)
+	}
+
+	return j.reporter
+}
+
 // ProvisionerEngineName returns the current provisioning engine name
 // as defined by the env var PROVISIONER_ENGINE_NAME supplied at runtime.
 func (j Job) ProvisionerEngineName() string {
@@ -98,10 +126,13 @@ func (j Job) ProvisionerEngineName() string {
 }
 
 // CreateFromDHCP looks up hardware using the MAC from cacher to create a job.
+// Hardware not found by MAC is looked up by the client's SMBIOS uuid, if any,
+// with conf.DHCPUUIDFirst the uuid is looked up first and the MAC only when no
+// hardware has it, telling apart records sharing a MAC.
 // OpenTelemetry: If a hardware record is available and has an in-band traceparent
 // specified, the returned context will have that trace set as its parent and the
 // spans will be linked.
-func (c *Creator) CreateFromDHCP(ctx context.Context, mac net.HardwareAddr, giaddr net.IP, circuitID string) (context.Context, *Job, error) {
+func (c *Creator) CreateFromDHCP(ctx context.Context, mac net.HardwareAddr, giaddr net.IP, circuitID, uuid string) (context.Context, *Job, error) {
 	j := &Job{
 		mac:                   mac,
 		start:                 time.Now(),
@@ -109,7 +140,34 @@ func (c *Creator) CreateFromDHCP(ctx context.Context, mac net.HardwareAddr, giad
 		provisionerEngineName: c.provisionerEngineName,
 		Logger:                c.logger,
 	}
-	d, err := c.finder.ByMAC(ctx, mac, giaddr, circuitID)
+	byUUID := func() (client.Discoverer, error) {
+		d, err := c.resolveConflict(client.FindByUUID(ctx, c.finder, uuid))
+		if err == nil {
+			c.logger.With("mac", mac, "uuid", uuid).Info("discovered from client uuid")
+			// settings are looked up by MAC, use the one the hardware is known by
+			j.mac = d.MAC()
+		}
+
+		return d, err
+	}
+	uuidFirst := uuid != "" && conf.DHCPUUIDFirst
+
+	var d client.Discoverer
+	var err error
+	if uuidFirst {
+		d, err = byUUID()
+	}
+	// only unknown hardware falls back, conflicts and backend errors do not
+	if !uuidFirst || errors.Is(err, client.ErrNotFound) {
+		d, err = c.resolveConflict(c.lookup(ctx, "mac "+mac.String()+" "+giaddr.String()+" "+circuitID, func(ctx context.Context) (client.Discoverer, error) {
+			return c.finder.ByMAC(ctx, mac, giaddr, circuitID)
+		}))
+		if errors.Is(err, client.ErrNotFound) && uuid != "" && !uuidFirst {
+			if ud, uerr := byUUID(); uerr == nil {
+				d, err = ud, nil
+			}
+		}
+	}
 	if err != nil {
 		return ctx, nil, errors.WithMessage(err, "discover from dhcp message")
 	}
@@ -131,6 +189,9 @@ func (c *Creator) CreateFromRemoteAddr(ctx context.Context, ip string) (context.
 	if err != nil {
 		return ctx, nil, errors.Wrap(err, "splitting host:ip")
 	}
+	if err := sleepJitter(ctx, conf.LookupJitter); err != nil {
+		return ctx, nil, errors.Wrap(err, "waiting for lookup jitter")
+	}
 
 	return c.CreateFromIP(ctx, net.ParseIP(host))
 }
@@ -149,7 +210,9 @@ func (c *Creator) CreateFromIP(ctx context.Context, ip net.IP) (context.Context,
 	}
 
 	c.logger.With("ip", ip).Info("discovering from ip")
-	d, err := c.finder.ByIP(ctx, ip)
+	d, err := c.resolveConflict(c.lookup(ctx, "ip "+ip.String(), func(ctx context.Context) (client.Discoverer, error) {
+		return c.finder.ByIP(ctx, ip)
+	}))
 	if err != nil {
 		return ctx, nil, errors.WithMessage(err, "discovering from ip address")
 	}
@@ -167,10 +230,53 @@ func (c *Creator) CreateFromIP(ctx context.Context, ip net.IP) (context.Context,
 	return ctx, j, nil
 }
 
+// lookup runs find, sharing its result with the concurrent lookups of the same
+// key when conf.CoalesceHardwareLookups is set, so machines retrying rapidly
+// cost one backend call. A shared lookup runs detached from the context of any
+// one request, keeping its trace, for up to conf.HardwareLookupTimeout. Each
+// caller gets its own copy of the Discoverer found, which setup modifies.
+func (c *Creator) lookup(ctx context.Context, key string, find func(context.Context) (client.Discoverer, error)) (client.Discoverer, error) {
+	if !conf.CoalesceHardwareLookups {
+		return find(ctx)
+	}
+	v, err, _ := c.lookups.Do(key, func() (interface{}, error) {
+		ctx, cancel := context.WithTimeout(trace.ContextWithSpanContext(context.Background(), trace.SpanContextFromContext(ctx)), conf.HardwareLookupTimeout)
+		defer cancel()
+
+		return find(ctx)
+	})
+	d, _ := v.(client.Discoverer)
+	if d != nil {
+		d = client.CopyDiscoverer(d)
+	}
+
+	return d, err
+}
+
+// resolveConflict applies conf.HardwareConflictPolicy to the result of a
+// lookup that matched more than one hardware record, others are returned as is.
+func (c *Creator) resolveConflict(d client.Discoverer, err error) (client.Discoverer, error) {
+	var amb *client.AmbiguousHardwareError
+	if !errors.As(err, &amb) {
+		return d, err
+	}
+	l := c.logger.With("key", amb.Key, "hardware.ids", amb.IDs())
+	if conf.HardwareConflictPolicy != "lowest-id" {
+		l.Error(err, "multiple hardware records match")
+
+		return nil, err
+	}
+	// the error, and its matches, may be shared by coalesced lookups
+	d = client.CopyDiscoverer(amb.Lowest())
+	l.With("hardware.id", d.Hardware().HardwareID()).Info("multiple hardware records match, using the one with the lowest id")
+
+	return d, nil
+}
+
 // MarkDeviceActive marks the device active.
 func (j Job) MarkDeviceActive(ctx context.Context) {
 	if id := j.InstanceID(); id != "" {
-		if err := j.reporter.PostInstancePhoneHome(ctx, id); err != nil {
+		if err := j.eventReporter().PostInstancePhoneHome(ctx, id); err != nil {
 			j.Error(err)
 		}
 	}
@@ -185,7 +291,7 @@ func (j Job) MarkDeviceActive(ctx context.Context) {
 func (j *Job) setup(ctx context.Context, d client.Discoverer) (context.Context, error) {
 	dh := d.Hardware()
 
-	j.Logger = j.Logger.With("mac", j.mac, "hardware.id", dh.HardwareID())
+	j.Logger = j.Logger.With(Redact("mac", j.mac, "hardware.id", dh.HardwareID())...)
 
 	// When there is a traceparent in the hw record, create a link on the current
 	// trace and replace ctx with one that is parented to the traceparent.
@@ -206,7 +312,13 @@ func (j *Job) setup(ctx context.Context, d client.Discoverer) (context.Context,
 	if j.instance == nil {
 		j.instance = &client.Instance{}
 	} else {
-		j.Logger = j.Logger.With("instance.id", j.InstanceID())
+		j.Logger = j.Logger.With(Redact("instance.id", j.InstanceID())...)
+	}
+	if ignored := j.ignoredCustomDataKeys(); len(ignored) > 0 {
+		j.With("keys", ignored).Info("ignoring CustomData keys not allowed by CUSTOM_DATA_KEYS")
+	}
+	if !client.HardwareAllowPXESet(j.hardware, j.mac) {
+		j.With("allow_pxe", conf.AllowPXEDefault).Debug("hardware has no allow_pxe, using the default")
 	}
 
 	ip := d.GetIP(j.mac)
@@ -217,6 +329,7 @@ func (j *Job) setup(ctx context.Context, d client.Discoverer) (context.Context,
 	j.dhcp.SetLeaseTime(d.LeaseTime(j.mac))
 	j.dhcp.SetDHCPServer(conf.PublicIPv4) // used for the unicast DHCPREQUEST
 	j.dhcp.SetDNSServers(d.DNSServers(j.mac))
+	j.dhcp.SetClasslessStaticRoutes(j.StaticRoutes())
 
 	hostname, err := d.Hostname()
 	if err != nil {
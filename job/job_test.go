@@ -4,11 +4,17 @@ import (
 	"context"
 	"net"
 	"os"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/packethost/pkg/log"
+	"github.com/pkg/errors"
 	"github.com/tinkerbell/boots/client"
 	"github.com/tinkerbell/boots/client/cacher"
+	"github.com/tinkerbell/boots/client/standalone"
+	"github.com/tinkerbell/boots/conf"
 	"github.com/tinkerbell/boots/httplog"
 	"github.com/tinkerbell/boots/metrics"
 )
@@ -183,3 +189,377 @@ func TestSetupWithoutInstance(t *testing.T) {
 		t.Fatalf("incorrect Hostname, want: %v, got: %v", hostname, j.dhcp.Hostname())
 	}
 }
+
+// uuidFinder finds its hardware by uuid only.
+type uuidFinder struct {
+	uuid string
+	d    client.Discoverer
+}
+
+func (f uuidFinder) ByIP(context.Context, net.IP) (client.Discoverer, error) {
+	return nil, client.ErrNotFound
+}
+
+func (f uuidFinder) ByMAC(context.Context, net.HardwareAddr, net.IP, string) (client.Discoverer, error) {
+	return nil, client.ErrNotFound
+}
+
+func (f uuidFinder) ByUUID(_ context.Context, uuid string) (client.Discoverer, error) {
+	if uuid != f.uuid {
+		return nil, client.ErrNotFound
+	}
+
+	return f.d, nil
+}
+
+func TestCreateFromDHCPByUUID(t *testing.T) {
+	mac := client.MACAddr([6]byte{0x00, 0xBA, 0xDD, 0xBE, 0xEF, 0x00})
+	uuid := "4c4c4544-0042-3010-8057-b3c04f4e4d32"
+	d := &standalone.DiscoverStandalone{HardwareStandalone: standalone.HardwareStandalone{
+		ID: uuid,
+		Network: client.Network{Interfaces: []client.NetworkInterface{{DHCP: client.DHCP{
+			MAC: &mac,
+			IP:  client.IP{Address: net.ParseIP("192.168.1.5"), Netmask: net.ParseIP("255.255.255.0")},
+		}}}},
+	}}
+	c := NewCreator(log.Test(t, "TestCreateFromDHCPByUUID"), "", client.NewNoOpReporter(joblog), uuidFinder{uuid: uuid, d: d})
+	other := net.HardwareAddr{0x02, 0x00, 0x00, 0x00, 0x00, 0x01}
+
+	_, j, err := c.CreateFromDHCP(context.Background(), other, nil, "", uuid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if j.mac.String() != mac.String() {
+		t.Fatalf("job not set up with the MAC of the hardware, want: %s, got: %s", mac, j.mac)
+	}
+
+	if _, _, err := c.CreateFromDHCP(context.Background(), other, nil, "", ""); !errors.Is(err, client.ErrNotFound) {
+		t.Fatalf("expected not found without a uuid, got: %v", err)
+	}
+	if _, _, err := c.CreateFromDHCP(context.Background(), other, nil, "", "00000000-0000-0000-0000-000000000000"); !errors.Is(err, client.ErrNotFound) {
+		t.Fatalf("expected not found for another uuid, got: %v", err)
+	}
+}
+
+// twinFinder holds hardware records sharing a MAC, told apart by their ID.
+type twinFinder []client.Discoverer
+
+func (f twinFinder) ByIP(_ context.Context, ip net.IP) (client.Discoverer, error) {
+	return nil, &client.AmbiguousHardwareError{Key: "ip " + ip.String(), Matches: f}
+}
+
+func (f twinFinder) ByMAC(_ context.Context, mac net.HardwareAddr, _ net.IP, _ string) (client.Discoverer, error) {
+	return nil, &client.AmbiguousHardwareError{Key: "mac " + mac.String(), Matches: f}
+}
+
+func (f twinFinder) ByUUID(_ context.Context, uuid string) (client.Discoverer, error) {
+	for _, d := range f {
+		if d.Hardware().HardwareID().String() == uuid {
+			return d, nil
+		}
+	}
+
+	return nil, client.ErrNotFound
+}
+
+func TestCreateFromDHCPUUIDFirst(t *testing.T) {
+	defer func(first bool, policy string) {
+		conf.DHCPUUIDFirst, conf.HardwareConflictPolicy = first, policy
+	}(conf.DHCPUUIDFirst, conf.HardwareConflictPolicy)
+	conf.HardwareConflictPolicy = "lowest-id"
+
+	mac := client.MACAddr([6]byte{0x00, 0xBA, 0xDD, 0xBE, 0xEF, 0x00})
+	hardware := func(id, ip string) client.Discoverer {
+		return &standalone.DiscoverStandalone{HardwareStandalone: standalone.HardwareStandalone{
+			ID: id,
+			Network: client.Network{Interfaces: []client.NetworkInterface{{DHCP: client.DHCP{
+				MAC: &mac,
+				IP:  client.IP{Address: net.ParseIP(ip), Netmask: net.ParseIP("255.255.255.0")},
+			}}}},
+		}}
+	}
+	const first, second = "4c4c4544-0042-3010-8057-b3c04f4e4d31", "4c4c4544-0042-3010-8057-b3c04f4e4d32"
+	c := NewCreator(log.Test(t, "TestCreateFromDHCPUUIDFirst"), "", client.NewNoOpReporter(joblog), twinFinder{hardware(first, "192.168.1.5"), hardware(second, "192.168.1.6")})
+
+	tests := []struct {
+		name      string
+		uuidFirst bool
+		uuid      string
+		want      string
+	}{
+		{name: "mac first", uuid: second, want: first},
+		{name: "uuid first", uuidFirst: true, uuid: second, want: second},
+		{name: "uuid first, unknown uuid", uuidFirst: true, uuid: "00000000-0000-0000-0000-000000000000", want: first},
+		{name: "uuid first, no uuid", uuidFirst: true, want: first},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conf.DHCPUUIDFirst = tt.uuidFirst
+			_, j, err := c.CreateFromDHCP(context.Background(), mac.HardwareAddr(), nil, "", tt.uuid)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := j.HardwareID().String(); got != tt.want {
+				t.Fatalf("unexpected hardware, want: %s, got: %s", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestCreateFromDHCPConflictNoUUIDFallback(t *testing.T) {
+	defer func(first bool, policy string) {
+		conf.DHCPUUIDFirst, conf.HardwareConflictPolicy = first, policy
+	}(conf.DHCPUUIDFirst, conf.HardwareConflictPolicy)
+	conf.DHCPUUIDFirst, conf.HardwareConflictPolicy = false, ""
+
+	mac := client.MACAddr([6]byte{0x00, 0xBA, 0xDD, 0xBE, 0xEF, 0x00})
+	hardware := func(id string) client.Discoverer {
+		return &standalone.DiscoverStandalone{HardwareStandalone: standalone.HardwareStandalone{
+			ID:      id,
+			Network: client.Network{Interfaces: []client.NetworkInterface{{DHCP: client.DHCP{MAC: &mac}}}},
+		}}
+	}
+	const first, second = "4c4c4544-0042-3010-8057-b3c04f4e4d31", "4c4c4544-0042-3010-8057-b3c04f4e4d32"
+	c := NewCreator(log.Test(t, "TestCreateFromDHCPConflictNoUUIDFallback"), "", client.NewNoOpReporter(joblog), twinFinder{hardware(first), hardware(second)})
+
+	_, _, err := c.CreateFromDHCP(context.Background(), mac.HardwareAddr(), nil, "", second)
+	if !client.IsAmbiguous(err) {
+		t.Fatalf("expected the MAC conflict, not a uuid fallback, got: %v", err)
+	}
+}
+
+// conflictFinder matches every lookup with all of its hardware.
+type conflictFinder []client.Discoverer
+
+func (f conflictFinder) ByIP(_ context.Context, ip net.IP) (client.Discoverer, error) {
+	return nil, &client.AmbiguousHardwareError{Key: "ip " + ip.String(), Matches: f}
+}
+
+func (f conflictFinder) ByMAC(_ context.Context, mac net.HardwareAddr, _ net.IP, _ string) (client.Discoverer, error) {
+	return nil, &client.AmbiguousHardwareError{Key: "mac " + mac.String(), Matches: f}
+}
+
+func TestCreateHardwareConflict(t *testing.T) {
+	defer func(policy string) { conf.HardwareConflictPolicy = policy }(conf.HardwareConflictPolicy)
+
+	mac := client.MACAddr([6]byte{0x00, 0xBA, 0xDD, 0xBE, 0xEF, 0x00})
+	hardware := func(id string) client.Discoverer {
+		return &standalone.DiscoverStandalone{HardwareStandalone: standalone.HardwareStandalone{
+			ID: id,
+			Network: client.Network{Interfaces: []client.NetworkInterface{{DHCP: client.DHCP{
+				MAC: &mac,
+				IP:  client.IP{Address: net.ParseIP("192.168.1.5"), Netmask: net.ParseIP("255.255.255.0")},
+			}}}},
+		}}
+	}
+	c := NewCreator(log.Test(t, "TestCreateHardwareConflict"), "", client.NewNoOpReporter(joblog), conflictFinder{hardware("b"), hardware("a")})
+
+	tests := []struct {
+		policy string
+		want   client.HardwareID
+	}{
+		{policy: "error"},
+		{policy: "lowest-id", want: "a"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.policy, func(t *testing.T) {
+			conf.HardwareConflictPolicy = tt.policy
+
+			for name, create := range map[string]func() (*Job, error){
+				"dhcp": func() (*Job, error) {
+					_, j, err := c.CreateFromDHCP(context.Background(), mac.HardwareAddr(), nil, "", "")
+
+					return j, err
+				},
+				"ip": func() (*Job, error) {
+					_, j, err := c.CreateFromIP(context.Background(), net.ParseIP("192.168.1.5"))
+
+					return j, err
+				},
+			} {
+				j, err := create()
+				if tt.want == "" {
+					if !client.IsAmbiguous(err) {
+						t.Fatalf("%s: expected an ambiguous hardware error, got: %v", name, err)
+					}
+
+					continue
+				}
+				if err != nil {
+					t.Fatalf("%s: %v", name, err)
+				}
+				if id := j.HardwareID(); id != tt.want {
+					t.Fatalf("%s: unexpected hardware, want: %s, got: %s", name, tt.want, id)
+				}
+			}
+		})
+	}
+}
+
+// slowFinder counts its lookups, each waiting for release, or its context to
+// be done, before answering.
+type slowFinder struct {
+	d       client.Discoverer
+	calls   int32
+	release chan struct{}
+}
+
+func (f *slowFinder) find(ctx context.Context) (client.Discoverer, error) {
+	atomic.AddInt32(&f.calls, 1)
+	select {
+	case <-f.release:
+		return f.d, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (f *slowFinder) ByIP(ctx context.Context, _ net.IP) (client.Discoverer, error) {
+	return f.find(ctx)
+}
+
+func (f *slowFinder) ByMAC(ctx context.Context, _ net.HardwareAddr, _ net.IP, _ string) (client.Discoverer, error) {
+	return f.find(ctx)
+}
+
+func TestCreateFromDHCPCoalesced(t *testing.T) {
+	defer func(coalesce bool) { conf.CoalesceHardwareLookups = coalesce }(conf.CoalesceHardwareLookups)
+	conf.CoalesceHardwareLookups = true
+
+	mac := client.MACAddr([6]byte{0x00, 0xBA, 0xDD, 0xBE, 0xEF, 0x00})
+	d := &standalone.DiscoverStandalone{HardwareStandalone: standalone.HardwareStandalone{
+		ID: "hw",
+		Network: client.Network{Interfaces: []client.NetworkInterface{{DHCP: client.DHCP{
+			MAC: &mac,
+			IP:  client.IP{Address: net.ParseIP("192.168.1.5"), Netmask: net.ParseIP("255.255.255.0")},
+		}}}},
+	}}
+	f := &slowFinder{d: d, release: make(chan struct{})}
+	c := NewCreator(log.Test(t, "TestCreateFromDHCPCoalesced"), "", client.NewNoOpReporter(joblog), f)
+
+	const n = 20
+	var wg sync.WaitGroup
+	errs := make(chan error, n)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, j, err := c.CreateFromDHCP(context.Background(), mac.HardwareAddr(), nil, "", "")
+			if err == nil && j.HardwareID() != "hw" {
+				err = errors.Errorf("unexpected hardware: %s", j.HardwareID())
+			}
+			errs <- err
+		}()
+	}
+	// let every creation start its lookup before the finder answers
+	time.Sleep(100 * time.Millisecond)
+	close(f.release)
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if calls := atomic.LoadInt32(&f.calls); calls != 1 {
+		t.Fatalf("unexpected backend calls, want: 1, got: %d", calls)
+	}
+}
+
+func TestCreateFromIPCoalescedCanceled(t *testing.T) {
+	defer func(coalesce bool) { conf.CoalesceHardwareLookups = coalesce }(conf.CoalesceHardwareLookups)
+	conf.CoalesceHardwareLookups = true
+
+	mac := client.MACAddr([6]byte{0x00, 0xBA, 0xDD, 0xBE, 0xEF, 0x01})
+	ip := net.ParseIP("192.168.1.6")
+	d := &standalone.DiscoverStandalone{HardwareStandalone: standalone.HardwareStandalone{
+		ID: "hw",
+		Network: client.Network{Interfaces: []client.NetworkInterface{{DHCP: client.DHCP{
+			MAC: &mac,
+			IP:  client.IP{Address: ip, Netmask: net.ParseIP("255.255.255.0")},
+		}}}},
+	}}
+	f := &slowFinder{d: d, release: make(chan struct{})}
+	c := NewCreator(log.Test(t, "TestCreateFromIPCoalescedCanceled"), "", client.NewNoOpReporter(joblog), f)
+
+	// the first request, whose lookup the second shares, goes away
+	ctx, cancel := context.WithCancel(context.Background())
+	first := make(chan struct{})
+	go func() {
+		defer close(first)
+		_, _, _ = c.CreateFromIP(ctx, ip)
+	}()
+	time.Sleep(50 * time.Millisecond)
+	second := make(chan error, 1)
+	go func() {
+		_, _, err := c.CreateFromIP(context.Background(), ip)
+		second <- err
+	}()
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+	time.Sleep(50 * time.Millisecond)
+	close(f.release)
+
+	if err := <-second; err != nil {
+		t.Fatalf("lookup shared with a canceled request failed: %v", err)
+	}
+	<-first
+	if calls := atomic.LoadInt32(&f.calls); calls != 1 {
+		t.Fatalf("unexpected backend calls, want: 1, got: %d", calls)
+	}
+}
+
+// macDiscoverer keeps the MAC set by Job.setup, as the cacher Discoverer does.
+type macDiscoverer struct {
+	*standalone.DiscoverStandalone
+	mac net.HardwareAddr
+}
+
+func (d *macDiscoverer) SetMAC(mac net.HardwareAddr) {
+	d.mac = mac
+}
+
+// TestCreateFromIPCoalescedRace is meant for go test -race, setup must not
+// modify the Discoverer shared by coalesced lookups.
+func TestCreateFromIPCoalescedRace(t *testing.T) {
+	defer func(coalesce bool) { conf.CoalesceHardwareLookups = coalesce }(conf.CoalesceHardwareLookups)
+	conf.CoalesceHardwareLookups = true
+
+	mac := client.MACAddr([6]byte{0x00, 0xBA, 0xDD, 0xBE, 0xEF, 0x02})
+	ip := net.ParseIP("192.168.1.7")
+	d := &macDiscoverer{DiscoverStandalone: &standalone.DiscoverStandalone{HardwareStandalone: standalone.HardwareStandalone{
+		ID: "hw",
+		Network: client.Network{Interfaces: []client.NetworkInterface{{DHCP: client.DHCP{
+			MAC: &mac,
+			IP:  client.IP{Address: ip, Netmask: net.ParseIP("255.255.255.0")},
+		}}}},
+	}}}
+	f := &slowFinder{d: d, release: make(chan struct{})}
+	c := NewCreator(log.Test(t, "TestCreateFromIPCoalescedRace"), "", client.NewNoOpReporter(joblog), f)
+
+	const n = 10
+	var wg sync.WaitGroup
+	errs := make(chan error, n)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, _, err := c.CreateFromIP(context.Background(), ip)
+			errs <- err
+		}()
+	}
+	time.Sleep(50 * time.Millisecond)
+	close(f.release)
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if d.mac != nil {
+		t.Fatalf("shared discoverer modified, mac: %s", d.mac)
+	}
+}
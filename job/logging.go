@@ -2,14 +2,172 @@ package job
 
 import (
 	"context"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/packethost/pkg/log"
+	"github.com/tinkerbell/boots/conf"
 )
 
+// Redacted replaces the secrets masked in logs.
+const Redacted = "[REDACTED]"
+
+// Redact returns the key value pairs of args, as given to log.Logger.With,
+// with the values of the keys in conf.LogRedactFields masked.
+func Redact(args ...interface{}) []interface{} {
+	redacted := make([]interface{}, len(args))
+	copy(redacted, args)
+	for i := 0; i+1 < len(redacted); i += 2 {
+		key, ok := redacted[i].(string)
+		if !ok {
+			continue
+		}
+		if _, ok := conf.LogRedactFields[strings.ToLower(key)]; ok {
+			redacted[i+1] = Redacted
+		}
+	}
+
+	return redacted
+}
+
+// RedactingLogger is a log.Logger masking the sensitive fields added to its
+// context with Redact, and its secrets from the errors and messages it logs.
+// The loggers derived from it with With and AddCallerSkip redact too.
+type RedactingLogger struct {
+	log.Logger
+	secrets []string
+}
+
+// NewRedactingLogger returns a RedactingLogger logging to l.
+func NewRedactingLogger(l log.Logger) RedactingLogger {
+	return RedactingLogger{Logger: l}
+}
+
+// With returns a copy of l with the key value pairs of args added to its
+// context, the sensitive ones masked by Redact.
+func (l RedactingLogger) With(args ...interface{}) RedactingLogger {
+	return RedactingLogger{Logger: l.Logger.With(Redact(args...)...), secrets: l.secrets}
+}
+
+// AddCallerSkip returns a copy of l skipping skip more callers.
+func (l RedactingLogger) AddCallerSkip(skip int) RedactingLogger {
+	return RedactingLogger{Logger: l.Logger.AddCallerSkip(skip), secrets: l.secrets}
+}
+
+func (l RedactingLogger) Error(err error, args ...interface{}) {
+	l.Logger.AddCallerSkip(1).Error(redactError(err, l.secrets), l.redactArgs(args)...)
+}
+
+func (l RedactingLogger) Fatal(err error, args ...interface{}) {
+	err = redactError(err, l.secrets)
+	l.Logger.AddCallerSkip(1).Error(err, l.redactArgs(args)...)
+	panic(err)
+}
+
+func (l RedactingLogger) Info(args ...interface{}) {
+	l.Logger.AddCallerSkip(1).Info(l.redactArgs(args)...)
+}
+
+func (l RedactingLogger) Debug(args ...interface{}) {
+	l.Logger.AddCallerSkip(1).Debug(l.redactArgs(args)...)
+}
+
+// redactArgs returns the message of args, as concatenated by log.Logger, with
+// the secrets of l masked, args itself when l has none.
+func (l RedactingLogger) redactArgs(args []interface{}) []interface{} {
+	if len(l.secrets) == 0 || len(args) == 0 {
+		return args
+	}
+
+	return []interface{}{redactSecrets(fmt.Sprint(args...), l.secrets)}
+}
+
+// With returns the logger of j with the key value pairs of args added to its
+// context, the sensitive ones masked by Redact, and the root password hashes
+// of j masked from what it logs.
+func (j Job) With(args ...interface{}) RedactingLogger {
+	return RedactingLogger{Logger: j.Logger, secrets: j.secrets()}.With(args...)
+}
+
+// RedactError returns err with the root password hashes of j masked from its
+// message, err itself when it has none. The masked error still unwraps to err.
+func (j Job) RedactError(err error) error {
+	return redactError(err, j.secrets())
+}
+
+func redactError(err error, secrets []string) error {
+	if err == nil || len(secrets) == 0 {
+		return err
+	}
+	r := &redactedError{err: err, secrets: secrets}
+	if r.Error() == err.Error() {
+		return err
+	}
+
+	return r
+}
+
+func redactSecrets(msg string, secrets []string) string {
+	for _, secret := range secrets {
+		msg = strings.ReplaceAll(msg, secret, Redacted)
+	}
+
+	return msg
+}
+
+// redactedError masks secrets from the message and verbose format of err.
+type redactedError struct {
+	err     error
+	secrets []string
+}
+
+func (e *redactedError) redact(msg string) string {
+	return redactSecrets(msg, e.secrets)
+}
+
+func (e *redactedError) Error() string { return e.redact(e.err.Error()) }
+
+func (e *redactedError) Unwrap() error { return e.err }
+
+// Cause returns err for errors.Cause.
+func (e *redactedError) Cause() error { return e.err }
+
+// Format formats err as is, e.g. with its stack trace for %+v, masked.
+func (e *redactedError) Format(s fmt.State, verb rune) {
+	format := "%" + string(verb)
+	if s.Flag('+') {
+		format = "%+" + string(verb)
+	}
+	_, _ = io.WriteString(s, e.redact(fmt.Sprintf(format, e.err)))
+}
+
+// secrets returns the root password hashes installers may handle for j.
+func (j Job) secrets() []string {
+	var secrets []string
+	if j.instance != nil {
+		for _, hash := range []string{j.instance.CryptedRootPassword, j.instance.PasswordHash} {
+			if hash != "" {
+				secrets = append(secrets, hash)
+			}
+		}
+	}
+	cd, _ := j.CustomData().(map[string]interface{})
+	if hash, _ := cd["rootpwcrypt"].(string); hash != "" {
+		secrets = append(secrets, hash)
+	}
+
+	return secrets
+}
+
 func (j Job) Fatal(err error, args ...interface{}) {
-	j.Logger.AddCallerSkip(1).Error(err, args...)
+	err = j.RedactError(err)
+	j.With().AddCallerSkip(1).Error(err, args...)
 	panic(err)
 }
 
 func (j Job) Error(err error, args ...interface{}) {
-	j.Logger.AddCallerSkip(1).Error(err, args...)
+	err = j.RedactError(err)
+	j.With().AddCallerSkip(1).Error(err, args...)
 	j.postEvent(context.Background(), "boots.warning", "Tinkerbell Warning: "+err.Error(), true)
 }
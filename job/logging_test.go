@@ -0,0 +1,106 @@
+package job
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/packethost/pkg/log"
+	"github.com/pkg/errors"
+)
+
+func TestRedact(t *testing.T) {
+	tests := []struct {
+		name string
+		args []interface{}
+		want []interface{}
+	}{
+		{name: "rootpwcrypt", args: []interface{}{"rootpwcrypt", "$6$salt$hash"}, want: []interface{}{"rootpwcrypt", Redacted}},
+		{name: "case insensitive", args: []interface{}{"RootPwCrypt", "$6$salt$hash"}, want: []interface{}{"RootPwCrypt", Redacted}},
+		{name: "other fields", args: []interface{}{"mac", "00:00:ba:dd:be:ef", "token", "abc"}, want: []interface{}{"mac", "00:00:ba:dd:be:ef", "token", Redacted}},
+		{name: "dangling key", args: []interface{}{"rootpwcrypt"}, want: []interface{}{"rootpwcrypt"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Redact(tt.args...); !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("unexpected fields, want: %v, got: %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestRedactError(t *testing.T) {
+	m := NewMock(t, "c3.small.x86", "ewr1")
+	m.SetPassword("")
+	m.SetCustomData(map[string]interface{}{"rootpwcrypt": "$6$salt$override"})
+	j := m.Job()
+
+	cause := errors.New("rendering rootpw insecure and $6$salt$override")
+	err := j.RedactError(errors.Wrap(cause, "generate kickstart"))
+	if msg := err.Error(); strings.Contains(msg, "insecure") || strings.Contains(msg, "$6$salt$override") {
+		t.Fatalf("password hash not redacted: %q", msg)
+	}
+	if !errors.Is(err, cause) {
+		t.Fatalf("redacted error does not unwrap to its cause: %v", err)
+	}
+	verbose := fmt.Sprintf("%+v", err)
+	if strings.Contains(verbose, "$6$salt$override") {
+		t.Fatalf("password hash not redacted from verbose error: %q", verbose)
+	}
+	if !strings.Contains(verbose, "TestRedactError") {
+		t.Fatalf("stack trace missing from verbose error: %q", verbose)
+	}
+
+	plain := errors.New("no secrets here")
+	if err := j.RedactError(plain); err != plain {
+		t.Fatalf("unexpected error, want: %v, got: %v", plain, err)
+	}
+}
+
+// logRecorder records what a log.Test logger logs.
+type logRecorder struct {
+	*testing.T
+	mu   sync.Mutex
+	logs strings.Builder
+}
+
+func (r *logRecorder) Logf(format string, args ...interface{}) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	fmt.Fprintf(&r.logs, format+"\n", args...)
+}
+
+func (r *logRecorder) String() string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.logs.String()
+}
+
+func TestRedactingLogger(t *testing.T) {
+	m := NewMock(t, "c3.small.x86", "ewr1")
+	m.SetPassword("")
+	m.SetCustomData(map[string]interface{}{"rootpwcrypt": "$6$salt$override"})
+	j := m.Job()
+
+	r := &logRecorder{T: t}
+	j.Logger = log.Test(r, "job")
+	l := j.With("mac", "00:00:ba:dd:be:ef").With("token", "abc")
+	l.Info("rendered $6$salt$override")
+	l.Error(errors.New("failed with $6$salt$override"), "rendering $6$salt$override")
+	j.Error(errors.New("failed with $6$salt$override"))
+
+	r2 := &logRecorder{T: t}
+	NewRedactingLogger(log.Test(r2, "main")).With("mac", "00:00:ba:dd:be:ef").With("token", "abc").Info("chained")
+
+	for _, logs := range []string{r.String(), r2.String()} {
+		if strings.Contains(logs, "abc") || strings.Contains(logs, "$6$salt$override") {
+			t.Fatalf("secrets not redacted from logs:\n%s", logs)
+		}
+		if !strings.Contains(logs, "00:00:ba:dd:be:ef") || !strings.Contains(logs, Redacted) {
+			t.Fatalf("unexpected logs:\n%s", logs)
+		}
+	}
+}
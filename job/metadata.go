@@ -0,0 +1,143 @@
+package job
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/tinkerbell/boots/conf"
+)
+
+// MetadataPath is the prefix of the EC2-style metadata endpoint.
+const MetadataPath = "/2009-04-04/"
+
+// ServeMetadata serves the instance metadata of the job in the EC2 metadata
+// service layout understood by cloud-init, e.g. /2009-04-04/meta-data/instance-id.
+func (j Job) ServeMetadata(w http.ResponseWriter, req *http.Request) {
+	if j.InstanceID() == "" {
+		w.WriteHeader(http.StatusNotFound)
+		j.Info("no instance to serve metadata for")
+
+		return
+	}
+
+	body, ok := j.metadata(strings.TrimPrefix(req.URL.Path, MetadataPath))
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain")
+	_, _ = w.Write([]byte(body))
+}
+
+// SSHKeysPath is the path of the SSH public keys endpoint.
+const SSHKeysPath = "/ssh-keys"
+
+// ServeSSHKeys serves the SSH public keys of the instance of the job, the ones
+// installers and the metadata use, one per line.
+func (j Job) ServeSSHKeys(w http.ResponseWriter, _ *http.Request) {
+	keys := j.SSHKeys()
+	if len(keys) == 0 {
+		w.WriteHeader(http.StatusNotFound)
+		j.Info("no ssh keys to serve")
+
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain")
+	_, _ = w.Write([]byte(strings.Join(keys, "\n") + "\n"))
+}
+
+func (j Job) metadata(p string) (string, bool) {
+	keys := j.SSHKeys()
+
+	switch p = strings.TrimSuffix(p, "/"); p {
+	case "":
+		return "meta-data\nuser-data", true
+	case "user-data":
+		return j.cloudInitUserData(), true
+	case "meta-data":
+		listing := "hostname\ninstance-id\nlocal-hostname"
+		if len(keys) > 0 {
+			listing += "\npublic-keys/"
+		}
+
+		return listing, true
+	case "meta-data/instance-id":
+		return j.InstanceID(), true
+	case "meta-data/hostname", "meta-data/local-hostname":
+		return j.Hostname(), true
+	case "meta-data/public-keys":
+		if len(keys) == 0 {
+			return "", false
+		}
+		lines := make([]string, len(keys))
+		for i := range keys {
+			lines[i] = fmt.Sprintf("%d=key-%d", i, i)
+		}
+
+		return strings.Join(lines, "\n"), true
+	}
+
+	// meta-data/public-keys/<index>[/openssh-key]
+	rest := strings.TrimPrefix(p, "meta-data/public-keys/")
+	if rest == p {
+		return "", false
+	}
+	idx, format := rest, ""
+	if i := strings.Index(rest, "/"); i >= 0 {
+		idx, format = rest[:i], rest[i+1:]
+	}
+	i, err := strconv.Atoi(idx)
+	if err != nil || i < 0 || i >= len(keys) {
+		return "", false
+	}
+	switch format {
+	case "":
+		return "openssh-key", true
+	case "openssh-key":
+		return keys[i], true
+	}
+
+	return "", false
+}
+
+// cloudInitUserData returns the cloud-init user-data document of the job. The
+// instance userdata is served verbatim when conf.MetadataRawUserData is set and
+// it is a cloud-config or a script, otherwise a cloud-config is generated.
+func (j Job) cloudInitUserData() string {
+	if conf.MetadataRawUserData {
+		ud := j.UserData()
+		if isCloudInitUserData(ud) {
+			return ud
+		}
+		if ud != "" {
+			j.Info("userdata is neither a cloud-config nor a script, serving generated user-data")
+		}
+	}
+
+	return j.generatedUserData()
+}
+
+func isCloudInitUserData(ud string) bool {
+	return strings.HasPrefix(ud, "#cloud-config") || strings.HasPrefix(ud, "#!")
+}
+
+// generatedUserData returns a cloud-config setting the hostname and ssh keys of the instance.
+func (j Job) generatedUserData() string {
+	var b strings.Builder
+	b.WriteString("#cloud-config\n")
+	if hostname := j.Hostname(); hostname != "" {
+		// quoted strings are valid YAML scalars
+		fmt.Fprintf(&b, "hostname: %s\n", strconv.Quote(hostname))
+	}
+	if keys := j.SSHKeys(); len(keys) > 0 {
+		b.WriteString("ssh_authorized_keys:\n")
+		for _, key := range keys {
+			fmt.Fprintf(&b, "  - %s\n", strconv.Quote(key))
+		}
+	}
+
+	return b.String()
+}
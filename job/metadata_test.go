@@ -0,0 +1,97 @@
+package job
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/tinkerbell/boots/conf"
+)
+
+func TestServeMetadata(t *testing.T) {
+	m := NewMock(t, "c3.small.x86", "ewr1")
+	m.SetInstanceID("$instance_id")
+	m.SetHostname("test-host")
+	m.SetSSHKeys("ssh-ed25519 AAAA0 user0", "ssh-ed25519 AAAA1 user1")
+
+	tests := []struct {
+		path string
+		code int
+		body string
+	}{
+		{path: "meta-data/instance-id", code: http.StatusOK, body: "$instance_id"},
+		{path: "meta-data/hostname", code: http.StatusOK, body: "test-host"},
+		{path: "meta-data/public-keys", code: http.StatusOK, body: "0=key-0\n1=key-1"},
+		{path: "meta-data/public-keys/0/", code: http.StatusOK, body: "openssh-key"},
+		{path: "meta-data/public-keys/0/openssh-key", code: http.StatusOK, body: "ssh-ed25519 AAAA0 user0"},
+		{path: "meta-data/public-keys/1/openssh-key", code: http.StatusOK, body: "ssh-ed25519 AAAA1 user1"},
+		{path: "meta-data/public-keys/2/openssh-key", code: http.StatusNotFound},
+		{path: "meta-data/bogus", code: http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "http://example.com"+MetadataPath+tt.path, nil)
+			w := httptest.NewRecorder()
+			m.Job().ServeMetadata(w, req)
+
+			resp := w.Result()
+			body, _ := io.ReadAll(resp.Body)
+			if resp.StatusCode != tt.code {
+				t.Fatalf("unexpected response code, want: %d, got: %d", tt.code, resp.StatusCode)
+			}
+			if string(body) != tt.body {
+				t.Fatalf("unexpected body, want: %q, got: %q", tt.body, body)
+			}
+		})
+	}
+
+	t.Run("no instance", func(t *testing.T) {
+		m := NewMock(t, "c3.small.x86", "ewr1")
+		m.DropInstance()
+		req := httptest.NewRequest("GET", "http://example.com"+MetadataPath+"meta-data/instance-id", nil)
+		w := httptest.NewRecorder()
+		m.Job().ServeMetadata(w, req)
+		if code := w.Result().StatusCode; code != http.StatusNotFound {
+			t.Fatalf("unexpected response code, want: %d, got: %d", http.StatusNotFound, code)
+		}
+	})
+}
+
+func TestServeMetadataUserData(t *testing.T) {
+	defer func(raw bool) { conf.MetadataRawUserData = raw }(conf.MetadataRawUserData)
+
+	generated := "#cloud-config\nhostname: \"test-host\"\nssh_authorized_keys:\n  - \"ssh-ed25519 AAAA0 user0\"\n"
+	tests := []struct {
+		name     string
+		raw      bool
+		userdata string
+		want     string
+	}{
+		{name: "generated", userdata: "#cloud-config\nruncmd: [reboot]\n", want: generated},
+		{name: "verbatim cloud-config", raw: true, userdata: "#cloud-config\nruncmd: [reboot]\n", want: "#cloud-config\nruncmd: [reboot]\n"},
+		{name: "verbatim script", raw: true, userdata: "#!/bin/sh\necho hello\n", want: "#!/bin/sh\necho hello\n"},
+		{name: "absent userdata", raw: true, want: generated},
+		{name: "invalid userdata", raw: true, userdata: "chain http://example.com\n", want: generated},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conf.MetadataRawUserData = tt.raw
+
+			m := NewMock(t, "c3.small.x86", "ewr1")
+			m.SetInstanceID("$instance_id")
+			m.SetHostname("test-host")
+			m.SetSSHKeys("ssh-ed25519 AAAA0 user0")
+			m.SetUserData(tt.userdata)
+
+			req := httptest.NewRequest("GET", "http://example.com"+MetadataPath+"user-data", nil)
+			w := httptest.NewRecorder()
+			m.Job().ServeMetadata(w, req)
+
+			body, _ := io.ReadAll(w.Result().Body)
+			if string(body) != tt.want {
+				t.Fatalf("unexpected user-data, want: %q, got: %q", tt.want, body)
+			}
+		})
+	}
+}
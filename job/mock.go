@@ -40,8 +40,12 @@ func NewMock(t zaptest.TestingT, slug, facility string) Mock {
 
 	mockLog := log.Test(t, "job.Mock")
 
+	return newMock(mockLog.With("mock", true, "slug", slug, "arch", arch, "uefi", uefi), slug, planVersion, facility, arch, uefi, servicesVersion)
+}
+
+func newMock(l log.Logger, slug, planVersion, facility, arch string, uefi bool, servicesVersion client.ServicesVersion) Mock {
 	return Mock{
-		Logger: mockLog.With("mock", true, "slug", slug, "arch", arch, "uefi", uefi),
+		Logger: l,
 		hardware: &cacher.HardwareCacher{
 			ID:              uuid.New().String(),
 			PlanSlug:        slug,
@@ -78,10 +82,26 @@ func (m *Mock) SetIP(ip net.IP) {
 	m.ip = ip
 }
 
+func (m *Mock) SetNetwork(addr, netmask, gateway net.IP) {
+	m.dhcp.Setup(addr, netmask, gateway)
+}
+
 func (m *Mock) SetIPXEScriptURL(url string) {
 	m.instance.IPXEScriptURL = url
 }
 
+func (m *Mock) SetInstanceID(id string) {
+	m.instance.ID = id
+}
+
+func (m *Mock) SetHostname(hostname string) {
+	m.instance.Hostname = hostname
+}
+
+func (m *Mock) SetSSHKeys(keys ...string) {
+	m.instance.SSHKeys = keys
+}
+
 func (m *Mock) SetUserData(userdata string) {
 	m.instance.UserData = userdata
 }
@@ -94,6 +114,36 @@ func (m *Mock) SetMAC(mac string) {
 	m.mac = _m
 }
 
+// AddInterface adds a data network port with the given name and MAC to the hardware.
+func (m *Mock) AddInterface(name, mac string) {
+	m.AddBondedInterface(name, mac, "")
+}
+
+// AddBondedInterface adds a data network port with the given name and MAC,
+// member of bond, to the hardware.
+func (m *Mock) AddBondedInterface(name, mac, bond string) {
+	_m, err := net.ParseMAC(mac)
+	if err != nil {
+		panic(err)
+	}
+	h, ok := m.hardware.(*cacher.HardwareCacher)
+	if !ok {
+		return
+	}
+	port := client.Port{Type: "data", Name: name}
+	addr := client.MACAddr{}
+	copy(addr[:], _m)
+	port.Data.MAC = &addr
+	port.Data.Bond = bond
+	h.NetworkPorts = append(h.NetworkPorts, port)
+}
+
+func (m *Mock) SetBondingMode(mode client.BondingMode) {
+	if h, ok := m.hardware.(*cacher.HardwareCacher); ok {
+		h.BondingMode = mode
+	}
+}
+
 func (m *Mock) SetManufacturer(slug string) {
 	hp := m.hardware
 	h, ok := hp.(*cacher.HardwareCacher)
@@ -102,6 +152,13 @@ func (m *Mock) SetManufacturer(slug string) {
 	}
 }
 
+func (m *Mock) SetFingerprint(serial, assetTag string) {
+	if h, ok := m.hardware.(*cacher.HardwareCacher); ok {
+		h.Serial = serial
+		h.AssetTag = assetTag
+	}
+}
+
 func (m *Mock) SetOSDistro(distro string) {
 	m.hardware.OperatingSystem().Distro = distro
 }
@@ -148,6 +205,31 @@ func (m *Mock) SetBootDriveHint(drive string) {
 	m.instance.BootDriveHint = drive
 }
 
+func (m *Mock) SetAllowPXE(allow bool) {
+	h, ok := m.hardware.(*cacher.HardwareCacher)
+	if ok {
+		h.AllowPXE = &allow
+	}
+}
+
+func (m *Mock) SetAllowWorkflow(allow bool) {
+	h, ok := m.hardware.(*cacher.HardwareCacher)
+	if ok {
+		h.AllowWorkflow = allow
+	}
+}
+
+func (m *Mock) SetNoWorkflow(noWorkflow bool) {
+	h, ok := m.hardware.(*cacher.HardwareCacher)
+	if ok {
+		h.NoWorkflow = noWorkflow
+	}
+}
+
+func (m *Mock) SetReporter(reporter client.Reporter) {
+	m.reporter = reporter
+}
+
 func (m *Mock) SetRescue(b bool) {
 	i := m.instance
 	i.Rescue = b
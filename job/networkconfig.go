@@ -0,0 +1,167 @@
+package job
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/tinkerbell/boots/client"
+)
+
+// NetworkConfigPath is the path of the cloud-init network-config endpoint.
+const NetworkConfigPath = "/network-config"
+
+// errNoNetworkAddress is returned by networkConfig for jobs without an address.
+var errNoNetworkAddress = errors.New("no address to serve network-config for")
+
+// bondModes maps the bonding modes of hardware records, the Linux bonding
+// driver mode numbers, to their network-config names.
+var bondModes = map[client.BondingMode]string{
+	0: "balance-rr",
+	1: "active-backup",
+	2: "balance-xor",
+	3: "broadcast",
+	4: "802.3ad",
+	5: "balance-tlb",
+	6: "balance-alb",
+}
+
+// ServeNetworkConfig serves a cloud-init network-config (version 2) document
+// configuring the interfaces of the job, their bonds and VLAN, with its address.
+func (j Job) ServeNetworkConfig(w http.ResponseWriter, _ *http.Request) {
+	body, err := j.networkConfig()
+	if errors.Is(err, errNoNetworkAddress) {
+		w.WriteHeader(http.StatusNotFound)
+		j.Info(err)
+
+		return
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		j.Error(err)
+
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain")
+	_, _ = w.Write([]byte(body))
+}
+
+// networkConfig returns the network-config of j, errNoNetworkAddress when it
+// has no address. The address is set on the interface the job was discovered
+// by, its bond if it is bonded, or the VLAN of the hardware on top of either.
+// Bonds with a mode not in bondModes are refused.
+func (j Job) networkConfig() (string, error) {
+	addr, netmask := j.dhcp.Address(), j.dhcp.Netmask()
+	if addr == nil || netmask == nil {
+		return "", errNoNetworkAddress
+	}
+
+	var ports []client.Port
+	for _, p := range j.Interfaces() {
+		if p.MAC() != nil {
+			ports = append(ports, p)
+		}
+	}
+	names := make([]string, len(ports))
+	var bonds []string
+	members := make(map[string][]string)
+	link := ""
+	for i, p := range ports {
+		names[i] = p.Name
+		if names[i] == "" {
+			names[i] = "eth" + strconv.Itoa(i)
+		}
+		if bond := p.Data.Bond; bond != "" {
+			if _, ok := members[bond]; !ok {
+				bonds = append(bonds, bond)
+			}
+			members[bond] = append(members[bond], names[i])
+		}
+		if link == "" && p.MAC().String() == j.mac.String() {
+			link = names[i]
+			if p.Data.Bond != "" {
+				link = p.Data.Bond
+			}
+		}
+	}
+	if link == "" {
+		// the hardware does not list the interface the job was discovered by
+		ports = append(ports, client.Port{Name: "eth" + strconv.Itoa(len(ports))})
+		names = append(names, ports[len(ports)-1].Name)
+		link = names[len(names)-1]
+	}
+
+	vlan := ""
+	if j.hardware != nil {
+		if id := j.VLANID(); id != "" {
+			if n, err := strconv.Atoi(id); err == nil && n > 0 && n < 4095 {
+				vlan = id
+			} else {
+				j.With("vlan", id).Error(errors.New("ignoring invalid VLAN ID"))
+			}
+		}
+	}
+
+	var b strings.Builder
+	b.WriteString("version: 2\nethernets:\n")
+	for i, p := range ports {
+		mac := p.MAC()
+		if mac == nil {
+			mac = j.mac
+		}
+		fmt.Fprintf(&b, "  %s:\n    match:\n      macaddress: %q\n    set-name: %s\n", names[i], mac, names[i])
+		if names[i] == link && vlan == "" {
+			j.writeNetworkAddress(&b, addr, netmask)
+		}
+	}
+	if len(bonds) > 0 {
+		mode, ok := bondModes[j.BondingMode()]
+		if !ok {
+			return "", errors.Errorf("unknown bonding mode %d", j.BondingMode())
+		}
+		b.WriteString("bonds:\n")
+		for _, bond := range bonds {
+			fmt.Fprintf(&b, "  %s:\n    interfaces:\n", bond)
+			for _, name := range members[bond] {
+				fmt.Fprintf(&b, "      - %s\n", name)
+			}
+			fmt.Fprintf(&b, "    parameters:\n      mode: %s\n", mode)
+			if mode == "802.3ad" {
+				b.WriteString("      lacp-rate: fast\n")
+			}
+			b.WriteString("      mii-monitor-interval: 100\n")
+			switch mode {
+			case "balance-xor", "802.3ad", "balance-tlb":
+				b.WriteString("      transmit-hash-policy: layer3+4\n")
+			}
+			if bond == link && vlan == "" {
+				j.writeNetworkAddress(&b, addr, netmask)
+			}
+		}
+	}
+	if vlan != "" {
+		fmt.Fprintf(&b, "vlans:\n  %s.%s:\n    id: %s\n    link: %s\n", link, vlan, vlan, link)
+		j.writeNetworkAddress(&b, addr, netmask)
+	}
+
+	return b.String(), nil
+}
+
+// writeNetworkAddress writes the address, gateway and DNS servers of j as
+// the settings of a network-config device.
+func (j Job) writeNetworkAddress(b *strings.Builder, addr, netmask net.IP) {
+	prefix, _ := net.IPMask(netmask.To4()).Size()
+	fmt.Fprintf(b, "    addresses:\n      - %s/%d\n", addr, prefix)
+	if gw := j.dhcp.Gateway(); gw != nil {
+		fmt.Fprintf(b, "    gateway4: %s\n", gw)
+	}
+	if dns := j.dhcp.DNSServers(); len(dns) > 0 {
+		b.WriteString("    nameservers:\n      addresses:\n")
+		for _, ip := range dns {
+			fmt.Fprintf(b, "        - %s\n", ip)
+		}
+	}
+}
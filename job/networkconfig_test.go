@@ -0,0 +1,115 @@
+package job
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/andreyvit/diff"
+	"github.com/tinkerbell/boots/client"
+)
+
+func TestServeNetworkConfig(t *testing.T) {
+	tests := []struct {
+		name   string
+		setup  func(m *Mock)
+		golden string
+	}{
+		{
+			name: "static single nic",
+			setup: func(m *Mock) {
+				m.AddInterface("eth0", "00:00:ba:dd:be:ef")
+			},
+			golden: "testdata/network-config-static.yaml",
+		},
+		{
+			name: "bonded",
+			setup: func(m *Mock) {
+				m.SetBondingMode(4)
+				m.AddBondedInterface("eth0", "00:00:ba:dd:be:ef", "bond0")
+				m.AddBondedInterface("eth1", "00:00:ba:dd:be:f0", "bond0")
+			},
+			golden: "testdata/network-config-bond.yaml",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := NewMock(t, "c3.small.x86", "ewr1")
+			m.SetMAC("00:00:ba:dd:be:ef")
+			m.SetNetwork(net.ParseIP("192.168.1.10"), net.ParseIP("255.255.255.0"), net.ParseIP("192.168.1.1"))
+			m.dhcp.SetDNSServers([]net.IP{net.ParseIP("8.8.8.8"), net.ParseIP("8.8.4.4")})
+			tt.setup(&m)
+
+			w := httptest.NewRecorder()
+			m.Job().ServeNetworkConfig(w, httptest.NewRequest("GET", "http://example.com"+NetworkConfigPath, nil))
+
+			got, _ := io.ReadAll(w.Result().Body)
+			want, err := os.ReadFile(tt.golden)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != string(want) {
+				t.Fatalf("unexpected network-config:\n%v", diff.LineDiff(string(want), string(got)))
+			}
+		})
+	}
+
+	t.Run("unknown bonding mode", func(t *testing.T) {
+		m := NewMock(t, "c3.small.x86", "ewr1")
+		m.SetMAC("00:00:ba:dd:be:ef")
+		m.SetNetwork(net.ParseIP("192.168.1.10"), net.ParseIP("255.255.255.0"), net.ParseIP("192.168.1.1"))
+		m.SetBondingMode(7)
+		m.AddBondedInterface("eth0", "00:00:ba:dd:be:ef", "bond0")
+		w := httptest.NewRecorder()
+		m.Job().ServeNetworkConfig(w, httptest.NewRequest("GET", "http://example.com"+NetworkConfigPath, nil))
+		if code := w.Result().StatusCode; code != http.StatusInternalServerError {
+			t.Fatalf("unexpected response code, want: %d, got: %d", http.StatusInternalServerError, code)
+		}
+	})
+
+	t.Run("no address", func(t *testing.T) {
+		m := NewMock(t, "c3.small.x86", "ewr1")
+		w := httptest.NewRecorder()
+		m.Job().ServeNetworkConfig(w, httptest.NewRequest("GET", "http://example.com"+NetworkConfigPath, nil))
+		if code := w.Result().StatusCode; code != http.StatusNotFound {
+			t.Fatalf("unexpected response code, want: %d, got: %d", http.StatusNotFound, code)
+		}
+	})
+}
+
+func TestNetworkConfigBondModes(t *testing.T) {
+	tests := []struct {
+		mode       client.BondingMode
+		parameters string
+	}{
+		{mode: 0, parameters: "      mode: balance-rr\n      mii-monitor-interval: 100\n"},
+		{mode: 1, parameters: "      mode: active-backup\n      mii-monitor-interval: 100\n"},
+		{mode: 2, parameters: "      mode: balance-xor\n      mii-monitor-interval: 100\n      transmit-hash-policy: layer3+4\n"},
+		{mode: 3, parameters: "      mode: broadcast\n      mii-monitor-interval: 100\n"},
+		{mode: 4, parameters: "      mode: 802.3ad\n      lacp-rate: fast\n      mii-monitor-interval: 100\n      transmit-hash-policy: layer3+4\n"},
+		{mode: 5, parameters: "      mode: balance-tlb\n      mii-monitor-interval: 100\n      transmit-hash-policy: layer3+4\n"},
+		{mode: 6, parameters: "      mode: balance-alb\n      mii-monitor-interval: 100\n"},
+	}
+	for _, tt := range tests {
+		t.Run(strconv.Itoa(int(tt.mode)), func(t *testing.T) {
+			m := NewMock(t, "c3.small.x86", "ewr1")
+			m.SetMAC("00:00:ba:dd:be:ef")
+			m.SetNetwork(net.ParseIP("192.168.1.10"), net.ParseIP("255.255.255.0"), net.ParseIP("192.168.1.1"))
+			m.SetBondingMode(tt.mode)
+			m.AddBondedInterface("eth0", "00:00:ba:dd:be:ef", "bond0")
+
+			got, err := m.Job().networkConfig()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := "    parameters:\n" + tt.parameters + "    addresses:\n"; !strings.Contains(got, want) {
+				t.Fatalf("unexpected bond parameters, want:\n%s\ngot:\n%s", want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,117 @@
+package job
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/tinkerbell/boots/conf"
+)
+
+// NonceHeader is the header machines send the boots_nonce iPXE variable of
+// their boot script in, a nonce query parameter works as well.
+const NonceHeader = "X-Boots-Nonce"
+
+// previewNonce stands in for boots_nonce in previewed scripts, it is never
+// accepted.
+const previewNonce = "preview"
+
+// nonces holds the nonces of the boot scripts served to each machine.
+var nonces = newNonceStore()
+
+// maxNoncesPerMAC bounds the unexpired nonces kept per machine, the oldest is
+// dropped first.
+const maxNoncesPerMAC = 8
+
+// nonceStore keeps short-lived nonces per MAC in memory, each valid until it
+// expires, so callbacks of an earlier render keep working after the machine
+// fetches its script again. Expired nonces are dropped when new ones are issued.
+type nonceStore struct {
+	now func() time.Time
+
+	mu    sync.Mutex
+	byMAC map[string][]nonce
+}
+
+type nonce struct {
+	value   string
+	expires time.Time
+}
+
+func newNonceStore() *nonceStore {
+	return &nonceStore{
+		now:   time.Now,
+		byMAC: make(map[string][]nonce),
+	}
+}
+
+// issue generates a new nonce for mac valid for ttl, next to its unexpired ones.
+func (s *nonceStore) issue(mac string, ttl time.Duration) (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", errors.Wrap(err, "generating nonce")
+	}
+	value := hex.EncodeToString(b)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	for m, ns := range s.byMAC {
+		unexpired := ns[:0]
+		for _, n := range ns {
+			if now.Before(n.expires) {
+				unexpired = append(unexpired, n)
+			}
+		}
+		if len(unexpired) == 0 {
+			delete(s.byMAC, m)
+		} else {
+			s.byMAC[m] = unexpired
+		}
+	}
+	ns := s.byMAC[mac]
+	if len(ns) >= maxNoncesPerMAC {
+		ns = ns[len(ns)-maxNoncesPerMAC+1:]
+	}
+	s.byMAC[mac] = append(ns, nonce{value: value, expires: now.Add(ttl)})
+
+	return value, nil
+}
+
+// valid reports whether value is an unexpired nonce of mac.
+func (s *nonceStore) valid(mac, value string) bool {
+	if value == "" {
+		return false
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	for _, n := range s.byMAC[mac] {
+		if now.Before(n.expires) && subtle.ConstantTimeCompare([]byte(n.value), []byte(value)) == 1 {
+			return true
+		}
+	}
+
+	return false
+}
+
+// validNonce reports whether req carries the unexpired nonce of a boot script
+// served to j, always true unless conf.IPXENonce is set.
+func (j Job) validNonce(req *http.Request) bool {
+	if !conf.IPXENonce {
+		return true
+	}
+	value := req.Header.Get(NonceHeader)
+	if value == "" {
+		value = req.URL.Query().Get("nonce")
+	}
+
+	return nonces.valid(j.mac.String(), value)
+}
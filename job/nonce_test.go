@@ -0,0 +1,208 @@
+package job
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/packethost/pkg/log"
+	"github.com/tinkerbell/boots/client"
+	"github.com/tinkerbell/boots/conf"
+	"github.com/tinkerbell/boots/ipxe"
+)
+
+func TestNonce(t *testing.T) {
+	defer func(enabled bool, ttl time.Duration) {
+		conf.IPXENonce, conf.IPXENonceTTL = enabled, ttl
+	}(conf.IPXENonce, conf.IPXENonceTTL)
+	defer func(now func() time.Time) { nonces.now = now }(nonces.now)
+
+	now := time.Unix(0, 0)
+	nonces.now = func() time.Time { return now }
+	conf.IPXENonceTTL = time.Minute
+
+	tests := []struct {
+		name    string
+		enabled bool
+		nonce   func(script string) string
+		elapsed time.Duration
+		code    int
+	}{
+		{name: "disabled", code: http.StatusOK},
+		{name: "valid", enabled: true, nonce: scriptNonce, code: http.StatusOK},
+		{name: "expired", enabled: true, nonce: scriptNonce, elapsed: time.Minute, code: http.StatusForbidden},
+		{name: "missing", enabled: true, code: http.StatusForbidden},
+		{name: "wrong", enabled: true, nonce: func(string) string { return "deadbeef" }, code: http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conf.IPXENonce = tt.enabled
+
+			m := NewMock(t, "c3.small.x86", "ewr1")
+			m.SetMAC("00:00:ba:dd:be:ef")
+			m.SetReporter(client.NewNoOpReporter(log.Test(t, "TestNonce")))
+			j := m.Job()
+
+			i := NewInstallers()
+			i.RegisterDistro("flatcar", func(_ context.Context, _ Job, s *ipxe.Script) { s.Echo("flatcar installer") })
+			m.SetOSDistro("flatcar")
+			script, ok := j.bootScript(context.Background(), "auto", i)
+			if !ok {
+				t.Fatal("no boot script")
+			}
+			if got := strings.Contains(string(script), "boots_nonce"); got != tt.enabled {
+				t.Fatalf("unexpected boots_nonce in script, want: %v, got: %v", tt.enabled, got)
+			}
+			now = now.Add(tt.elapsed)
+
+			for _, endpoint := range []string{"problem", "phone-home"} {
+				req := httptest.NewRequest("POST", "http://example.com/"+endpoint, strings.NewReader(`{"problem":"memory"}`))
+				if tt.nonce != nil {
+					req.Header.Set(NonceHeader, tt.nonce(string(script)))
+				}
+				w := httptest.NewRecorder()
+				if endpoint == "problem" {
+					j.ServeProblemEndpoint(w, req)
+				} else {
+					j.ServePhoneHomeEndpoint(w, req)
+				}
+				if got := w.Result().StatusCode; got != tt.code {
+					t.Fatalf("%s: unexpected response code, want: %d, got: %d", endpoint, tt.code, got)
+				}
+			}
+		})
+	}
+}
+
+func TestNonceQuery(t *testing.T) {
+	defer func(enabled bool) { conf.IPXENonce = enabled }(conf.IPXENonce)
+	conf.IPXENonce = true
+
+	m := NewMock(t, "c3.small.x86", "ewr1")
+	m.SetMAC("00:00:ba:dd:be:ef")
+	j := m.Job()
+	value, err := nonces.issue(j.mac.String(), time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !j.validNonce(httptest.NewRequest("POST", "http://example.com/problem?nonce="+value, nil)) {
+		t.Fatal("nonce query parameter not accepted")
+	}
+	other := NewMock(t, "c3.small.x86", "ewr1")
+	other.SetMAC("00:00:ba:dd:be:f0")
+	if other.Job().validNonce(httptest.NewRequest("POST", "http://example.com/problem?nonce="+value, nil)) {
+		t.Fatal("nonce accepted for another machine")
+	}
+}
+
+func TestNoncePreview(t *testing.T) {
+	defer func(enabled bool) { conf.IPXENonce = enabled }(conf.IPXENonce)
+	conf.IPXENonce = true
+
+	m := NewMock(t, "c3.small.x86", "ewr1")
+	m.SetMAC("00:00:ba:dd:be:ef")
+	m.SetOSDistro("flatcar")
+	j := m.Job()
+	i := NewInstallers()
+	i.RegisterDistro("flatcar", func(_ context.Context, _ Job, s *ipxe.Script) { s.Echo("flatcar installer") })
+
+	script, ok := j.bootScript(context.Background(), "auto", i)
+	if !ok {
+		t.Fatal("no boot script")
+	}
+	value := scriptNonce(string(script))
+
+	preview, ok := j.Preview().bootScript(context.Background(), "auto", i)
+	if !ok {
+		t.Fatal("no preview boot script")
+	}
+	if got := scriptNonce(string(preview)); got != previewNonce {
+		t.Fatalf("unexpected preview boots_nonce, want: %q, got: %q", previewNonce, got)
+	}
+	if !j.validNonce(httptest.NewRequest("POST", "http://example.com/problem?nonce="+value, nil)) {
+		t.Fatal("preview replaced the issued nonce")
+	}
+	if j.validNonce(httptest.NewRequest("POST", "http://example.com/problem?nonce="+previewNonce, nil)) {
+		t.Fatal("preview nonce accepted")
+	}
+}
+
+func TestNonceRerender(t *testing.T) {
+	defer func(enabled bool, ttl time.Duration) {
+		conf.IPXENonce, conf.IPXENonceTTL = enabled, ttl
+	}(conf.IPXENonce, conf.IPXENonceTTL)
+	defer func(now func() time.Time) { nonces.now = now }(nonces.now)
+	conf.IPXENonce, conf.IPXENonceTTL = true, time.Minute
+	now := time.Unix(0, 0)
+	nonces.now = func() time.Time { return now }
+
+	m := NewMock(t, "c3.small.x86", "ewr1")
+	m.SetMAC("00:00:ba:dd:be:f1")
+	m.SetOSDistro("flatcar")
+	m.SetReporter(client.NewNoOpReporter(log.Test(t, "TestNonceRerender")))
+	j := m.Job()
+	i := NewInstallers()
+	i.RegisterDistro("flatcar", func(_ context.Context, _ Job, s *ipxe.Script) { s.Echo("flatcar installer") })
+
+	var values []string
+	for n := 0; n < 2; n++ {
+		script, ok := j.bootScript(context.Background(), "auto", i)
+		if !ok {
+			t.Fatal("no boot script")
+		}
+		values = append(values, scriptNonce(string(script)))
+		now = now.Add(10 * time.Second)
+	}
+	if values[0] == values[1] {
+		t.Fatal("nonce reused across renders")
+	}
+
+	// the callback of the first render still works, until its own nonce expires
+	for _, value := range values {
+		w := httptest.NewRecorder()
+		j.ServePhoneHomeEndpoint(w, httptest.NewRequest("POST", "http://example.com/phone-home?nonce="+value, nil))
+		if got := w.Result().StatusCode; got != http.StatusOK {
+			t.Fatalf("unexpected response code, want: %d, got: %d", http.StatusOK, got)
+		}
+	}
+	now = now.Add(45 * time.Second)
+	if j.validNonce(httptest.NewRequest("POST", "http://example.com/phone-home?nonce="+values[0], nil)) {
+		t.Fatal("expired nonce accepted")
+	}
+	if !j.validNonce(httptest.NewRequest("POST", "http://example.com/phone-home?nonce="+values[1], nil)) {
+		t.Fatal("unexpired nonce refused")
+	}
+}
+
+func TestNonceStoreBound(t *testing.T) {
+	s := newNonceStore()
+	var values []string
+	for n := 0; n < maxNoncesPerMAC+1; n++ {
+		value, err := s.issue("00:00:ba:dd:be:ef", time.Minute)
+		if err != nil {
+			t.Fatal(err)
+		}
+		values = append(values, value)
+	}
+	if got := len(s.byMAC["00:00:ba:dd:be:ef"]); got != maxNoncesPerMAC {
+		t.Fatalf("unexpected nonces kept, want: %d, got: %d", maxNoncesPerMAC, got)
+	}
+	if s.valid("00:00:ba:dd:be:ef", values[0]) || !s.valid("00:00:ba:dd:be:ef", values[maxNoncesPerMAC]) {
+		t.Fatal("oldest nonce not dropped first")
+	}
+}
+
+// scriptNonce returns the boots_nonce set by script.
+func scriptNonce(script string) string {
+	for _, line := range strings.Split(script, "\n") {
+		if strings.HasPrefix(line, "set boots_nonce ") {
+			return strings.TrimPrefix(line, "set boots_nonce ")
+		}
+	}
+
+	return ""
+}
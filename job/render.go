@@ -0,0 +1,57 @@
+package job
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net"
+
+	"github.com/tinkerbell/boots/client"
+)
+
+// RenderKey returns a digest of everything installers render the configs of j
+// from: the hardware attributes, network and the whole instance, including its
+// password, operating system and CustomData. Jobs with the same key render the
+// same kickstart or ignition config. The key is empty, not to be cached, when
+// the CustomData cannot be encoded.
+func (j Job) RenderKey() string {
+	v := struct {
+		MAC             string
+		IP              net.IP
+		Mode            Mode
+		Facility        string
+		Plan            string
+		PlanVersion     string
+		Manufacturer    string
+		Arch            string
+		UEFI            bool
+		State           string
+		BondingMode     client.BondingMode
+		Interfaces      []client.Port
+		OperatingSystem *client.OperatingSystem
+		Instance        *client.Instance
+	}{
+		MAC:             j.mac.String(),
+		IP:              j.ip,
+		Mode:            j.mode,
+		Facility:        j.FacilityCode(),
+		Plan:            j.PlanSlug(),
+		PlanVersion:     j.PlanVersionSlug(),
+		Manufacturer:    j.Manufacturer(),
+		Arch:            j.Arch(),
+		UEFI:            j.IsUEFI(),
+		State:           j.HardwareState(),
+		BondingMode:     j.BondingMode(),
+		Interfaces:      j.Interfaces(),
+		OperatingSystem: j.OperatingSystem(),
+		Instance:        j.instance,
+	}
+	h := sha256.New()
+	if err := json.NewEncoder(h).Encode(v); err != nil {
+		j.Error(err, "encoding render key")
+
+		return ""
+	}
+
+	return hex.EncodeToString(h.Sum(nil))
+}
@@ -0,0 +1,87 @@
+package job
+
+import (
+	"context"
+	"net"
+	"sort"
+
+	"github.com/packethost/pkg/log"
+	"github.com/pkg/errors"
+	"github.com/tinkerbell/boots/client"
+	"github.com/tinkerbell/boots/conf"
+	"github.com/tinkerbell/boots/ipxe"
+)
+
+// SelfTestFailure is an installer whose boot script could not be rendered for
+// a synthetic job.
+type SelfTestFailure struct {
+	// Kind is how the installer is registered: default, installer, distro or slug.
+	Kind string
+	Name string
+	Err  error
+}
+
+// SelfTest renders the boot script of every enabled installer for a synthetic
+// job, returning the installers that panicked or rendered nothing.
+func (i Installers) SelfTest(ctx context.Context, l log.Logger) []SelfTestFailure {
+	var failures []SelfTestFailure
+	check := func(kind, name string, fn BootScript, os client.OperatingSystem) {
+		if _, ok := conf.DisabledInstallers[name]; ok {
+			return
+		}
+		if err := selfTest(ctx, l.With("installer", name, "kind", kind), fn, os); err != nil {
+			failures = append(failures, SelfTestFailure{Kind: kind, Name: name, Err: err})
+		}
+	}
+
+	if i.Default != nil {
+		check("default", "default", i.Default, client.OperatingSystem{})
+	}
+	for _, name := range sortedNames(i.ByInstaller) {
+		check("installer", name, i.ByInstaller[name], client.OperatingSystem{Installer: name})
+	}
+	for _, name := range sortedNames(i.ByDistro) {
+		check("distro", name, i.ByDistro[name], client.OperatingSystem{Distro: name})
+	}
+	for _, name := range sortedNames(i.BySlug) {
+		check("slug", name, i.BySlug[name], client.OperatingSystem{Slug: name})
+	}
+
+	return failures
+}
+
+// selfTest renders fn for a synthetic provisioning job of os.
+func selfTest(ctx context.Context, l log.Logger, fn BootScript, os client.OperatingSystem) (err error) {
+	m := newMock(l, "c3.small.x86", "", "selftest", "x86_64", false, client.ServicesVersion{})
+	m.SetMAC("00:00:00:00:00:01")
+	m.SetNetwork(net.ParseIP("192.0.2.2"), net.ParseIP("255.255.255.0"), net.ParseIP("192.0.2.1"))
+	m.SetInstanceID("self-test")
+	m.SetHostname("self-test")
+	// installers reporting to the backend must not touch real hardware
+	m.SetReporter(client.NewNoOpReporter(l))
+	*m.hardware.OperatingSystem() = os
+
+	s := ipxe.NewScript()
+	empty := len(s.Bytes())
+	defer func() {
+		if r := recover(); r != nil {
+			err = errors.Errorf("rendering boot script panicked: %v", r)
+		}
+	}()
+	fn(ctx, m.Job(), s)
+	if len(s.Bytes()) == empty {
+		return errors.New("rendered an empty boot script")
+	}
+
+	return nil
+}
+
+func sortedNames(m map[string]BootScript) []string {
+	names := make([]string, 0, len(m))
+	for name := range m {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
@@ -0,0 +1,38 @@
+package job
+
+import (
+	"context"
+	"testing"
+
+	"github.com/packethost/pkg/log"
+	"github.com/tinkerbell/boots/conf"
+	"github.com/tinkerbell/boots/ipxe"
+)
+
+func TestSelfTest(t *testing.T) {
+	defer func(disabled map[string]struct{}) { conf.DisabledInstallers = disabled }(conf.DisabledInstallers)
+	conf.DisabledInstallers = map[string]struct{}{"disabled": {}}
+
+	i := NewInstallers()
+	i.RegisterDefaultInstaller(func(_ context.Context, _ Job, s *ipxe.Script) { s.Echo("default") })
+	i.RegisterDistro("flatcar", func(_ context.Context, j Job, s *ipxe.Script) {
+		if j.OperatingSystem().Distro != "flatcar" {
+			t.Errorf("unexpected synthetic job distro: %q", j.OperatingSystem().Distro)
+		}
+		s.Echo("flatcar")
+	})
+	i.RegisterInstaller("empty", func(context.Context, Job, *ipxe.Script) {})
+	i.RegisterSlug("broken", func(context.Context, Job, *ipxe.Script) { panic("missing template") })
+	i.RegisterDistro("disabled", func(context.Context, Job, *ipxe.Script) { panic("disabled installer tested") })
+
+	failures := i.SelfTest(context.Background(), log.Test(t, "TestSelfTest"))
+	if len(failures) != 2 {
+		t.Fatalf("unexpected self-test failures, want: 2, got: %v", failures)
+	}
+	if f := failures[0]; f.Kind != "installer" || f.Name != "empty" || f.Err == nil {
+		t.Fatalf("empty installer not reported: %+v", f)
+	}
+	if f := failures[1]; f.Kind != "slug" || f.Name != "broken" || f.Err == nil {
+		t.Fatalf("panicking installer not reported: %+v", f)
+	}
+}
@@ -0,0 +1,266 @@
+package job
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/tinkerbell/boots/conf"
+)
+
+// ScriptSigningKeyPath serves the certificate chain boot script signatures
+// verify against.
+const ScriptSigningKeyPath = "/ipxe-signing-key"
+
+// ScriptSignatureSuffix follows the name of a boot script, e.g. auto.ipxe.sig,
+// to fetch the detached signature of the one last served to the machine, as
+// checked by the iPXE imgverify command.
+const ScriptSignatureSuffix = ".sig"
+
+var scriptSigner struct {
+	key   crypto.Signer
+	certs []*x509.Certificate // the signer first
+	pem   []byte
+}
+
+// scriptSignatures holds the signature of the last boot script of each name
+// served to each machine.
+var scriptSignatures = newSignatureStore()
+
+// signatureStore keeps boot script signatures in memory by MAC and script
+// name, each until conf.IPXEScriptSignatureTTL after its script was served.
+// Expired signatures are dropped when new ones are kept.
+type signatureStore struct {
+	now func() time.Time
+
+	mu    sync.Mutex
+	byKey map[string]signature
+}
+
+type signature struct {
+	sig     []byte
+	expires time.Time
+}
+
+func newSignatureStore() *signatureStore {
+	return &signatureStore{
+		now:   time.Now,
+		byKey: make(map[string]signature),
+	}
+}
+
+// keep keeps sig as the signature of the script name of mac, valid for ttl.
+func (s *signatureStore) keep(mac, name string, sig []byte, ttl time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	for key, sig := range s.byKey {
+		if !now.Before(sig.expires) {
+			delete(s.byKey, key)
+		}
+	}
+	s.byKey[mac+"/"+name] = signature{sig: sig, expires: now.Add(ttl)}
+}
+
+// get returns the unexpired signature of the script name of mac.
+func (s *signatureStore) get(mac, name string) ([]byte, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sig, ok := s.byKey[mac+"/"+name]
+	if !ok || !s.now().Before(sig.expires) {
+		return nil, false
+	}
+
+	return sig.sig, true
+}
+
+var (
+	oidData          = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 1}
+	oidSignedData    = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 2}
+	oidSHA256        = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 1}
+	oidRSAEncryption = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 1}
+)
+
+// CMS (RFC 5652) detached SignedData, without signed attributes as iPXE expects.
+type cmsContentInfo struct {
+	ContentType asn1.ObjectIdentifier
+	Content     cmsSignedData `asn1:"explicit,tag:0"`
+}
+
+type cmsSignedData struct {
+	Version          int
+	DigestAlgorithms []pkix.AlgorithmIdentifier `asn1:"set"`
+	EncapContentInfo cmsEncapContentInfo
+	Certificates     asn1.RawValue
+	SignerInfos      []cmsSignerInfo `asn1:"set"`
+}
+
+type cmsEncapContentInfo struct {
+	ContentType asn1.ObjectIdentifier
+}
+
+type cmsSignerInfo struct {
+	Version            int
+	SID                cmsIssuerAndSerialNumber
+	DigestAlgorithm    pkix.AlgorithmIdentifier
+	SignatureAlgorithm pkix.AlgorithmIdentifier
+	Signature          []byte
+}
+
+type cmsIssuerAndSerialNumber struct {
+	Issuer       asn1.RawValue
+	SerialNumber *big.Int
+}
+
+func initScriptSigner() {
+	if conf.IPXEScriptSigningKey == "" {
+		return
+	}
+	if err := loadScriptSigner(conf.IPXEScriptSigningKey, conf.IPXEScriptSigningCert); err != nil {
+		joblog.Fatal(err)
+	}
+}
+
+// loadScriptSigner reads the PEM encoded PKCS#8 RSA private key at keyPath and
+// the PEM encoded certificate chain at certPath, signer first, as the boot
+// script signing key.
+func loadScriptSigner(keyPath, certPath string) error {
+	b, err := os.ReadFile(keyPath)
+	if err != nil {
+		return errors.Wrap(err, "read script signing key")
+	}
+	block, _ := pem.Decode(b)
+	if block == nil {
+		return errors.Errorf("no PEM data in script signing key %s", keyPath)
+	}
+	k, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return errors.Wrap(err, "parse script signing key")
+	}
+	signer, ok := k.(*rsa.PrivateKey)
+	if !ok {
+		return errors.Errorf("script signing key %s is not an RSA key", keyPath)
+	}
+
+	b, err = os.ReadFile(certPath)
+	if err != nil {
+		return errors.Wrap(err, "read script signing certificate")
+	}
+	var certs []*x509.Certificate
+	for block, b = pem.Decode(b); block != nil; block, b = pem.Decode(b) {
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return errors.Wrap(err, "parse script signing certificate")
+		}
+		certs = append(certs, cert)
+	}
+
+	return setScriptSigner(signer, certs)
+}
+
+func setScriptSigner(k crypto.Signer, certs []*x509.Certificate) error {
+	if len(certs) == 0 {
+		return errors.New("no script signing certificate")
+	}
+	if pub, ok := certs[0].PublicKey.(*rsa.PublicKey); !ok || !pub.Equal(k.Public()) {
+		return errors.New("script signing certificate does not match the key")
+	}
+
+	var b []byte
+	for _, cert := range certs {
+		b = append(b, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw})...)
+	}
+	scriptSigner.key, scriptSigner.certs, scriptSigner.pem = k, certs, b
+
+	return nil
+}
+
+// signScript returns the DER encoded CMS detached signature of script, with
+// the signing certificate chain, nil when signing is disabled.
+func signScript(script []byte) ([]byte, error) {
+	if scriptSigner.key == nil {
+		return nil, nil
+	}
+
+	sum := sha256.Sum256(script)
+	sig, err := scriptSigner.key.Sign(rand.Reader, sum[:], crypto.SHA256)
+	if err != nil {
+		return nil, errors.Wrap(err, "sign boot script")
+	}
+
+	var certs []byte
+	for _, cert := range scriptSigner.certs {
+		certs = append(certs, cert.Raw...)
+	}
+	signer := scriptSigner.certs[0]
+	digest := pkix.AlgorithmIdentifier{Algorithm: oidSHA256}
+	b, err := asn1.Marshal(cmsContentInfo{
+		ContentType: oidSignedData,
+		Content: cmsSignedData{
+			Version:          1,
+			DigestAlgorithms: []pkix.AlgorithmIdentifier{digest},
+			EncapContentInfo: cmsEncapContentInfo{ContentType: oidData},
+			Certificates:     asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: certs},
+			SignerInfos: []cmsSignerInfo{{
+				Version:            1,
+				SID:                cmsIssuerAndSerialNumber{Issuer: asn1.RawValue{FullBytes: signer.RawIssuer}, SerialNumber: signer.SerialNumber},
+				DigestAlgorithm:    digest,
+				SignatureAlgorithm: pkix.AlgorithmIdentifier{Algorithm: oidRSAEncryption, Parameters: asn1.NullRawValue},
+				Signature:          sig,
+			}},
+		},
+	})
+
+	return b, errors.Wrap(err, "encode boot script signature")
+}
+
+// keepScriptSignature keeps sig as the signature of the script name last
+// served to j, previews do not replace it.
+func (j Job) keepScriptSignature(name string, sig []byte) {
+	if sig == nil || j.preview {
+		return
+	}
+	scriptSignatures.keep(j.mac.String(), name, sig, conf.IPXEScriptSignatureTTL)
+}
+
+// serveScriptSignature serves the signature of the script name last served to
+// j, 404 when there is none or it expired.
+func (j Job) serveScriptSignature(w http.ResponseWriter, name string) {
+	sig, ok := scriptSignatures.get(j.mac.String(), name)
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+
+		return
+	}
+	w.Header().Set("Content-Type", "application/pkcs7-signature")
+	_, _ = w.Write(sig)
+}
+
+// ServeScriptSigningKey serves the PEM encoded certificate chain of the boot
+// script signing key.
+func ServeScriptSigningKey(w http.ResponseWriter, _ *http.Request) {
+	if scriptSigner.pem == nil {
+		w.WriteHeader(http.StatusNotFound)
+
+		return
+	}
+	w.Header().Set("Content-Type", "application/x-pem-file")
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(scriptSigner.pem)
+}
@@ -0,0 +1,187 @@
+package job
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/tinkerbell/boots/ipxe"
+)
+
+// writeScriptSigner writes key and a self-signed code signing certificate of
+// it as PEM files, returning their paths.
+func writeScriptSigner(t *testing.T, key crypto.Signer) (string, string) {
+	t.Helper()
+
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(42),
+		Subject:      pkix.Name{CommonName: "boots script signing"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageCodeSigning},
+	}
+	cert, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, key.Public(), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	keyPath, certPath := filepath.Join(dir, "key.pem"), filepath.Join(dir, "cert.pem")
+	if err := os.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(certPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	return keyPath, certPath
+}
+
+func TestSignedBootScript(t *testing.T) {
+	defer func() { scriptSigner.key, scriptSigner.certs, scriptSigner.pem = nil, nil, nil }()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := loadScriptSigner(writeScriptSigner(t, key)); err != nil {
+		t.Fatal(err)
+	}
+
+	i := NewInstallers()
+	i.RegisterDistro("alpine", func(_ context.Context, _ Job, s *ipxe.Script) { s.Echo("alpine installer") })
+	m := NewMock(t, "c3.small.x86", "ewr1")
+	m.SetMAC("00:00:ba:dd:be:ef")
+	m.SetOSDistro("alpine")
+	w := httptest.NewRecorder()
+	m.Job().ServeFile(w, httptest.NewRequest("GET", "http://127.0.0.1/auto.ipxe", nil), i)
+	body, _ := io.ReadAll(w.Result().Body)
+
+	// a preview does not replace the signature of the served script
+	m.Job().ServeFile(httptest.NewRecorder(), httptest.NewRequest("HEAD", "http://127.0.0.1/auto.ipxe", nil), i)
+
+	w = httptest.NewRecorder()
+	m.Job().ServeFile(w, httptest.NewRequest("GET", "http://127.0.0.1/auto.ipxe.sig", nil), i)
+	if code := w.Result().StatusCode; code != http.StatusOK {
+		t.Fatalf("unexpected signature status, want: %d, got: %d", http.StatusOK, code)
+	}
+	sig, _ := io.ReadAll(w.Result().Body)
+
+	var ci cmsContentInfo
+	if rest, err := asn1.Unmarshal(sig, &ci); err != nil || len(rest) > 0 {
+		t.Fatalf("signature is not a DER ContentInfo: %v", err)
+	}
+	if !ci.ContentType.Equal(oidSignedData) || len(ci.Content.SignerInfos) != 1 {
+		t.Fatalf("unexpected signature content: %+v", ci)
+	}
+
+	// verify against the served certificate, not the key of the test
+	w = httptest.NewRecorder()
+	ServeScriptSigningKey(w, httptest.NewRequest("GET", "http://127.0.0.1"+ScriptSigningKeyPath, nil))
+	served, _ := io.ReadAll(w.Result().Body)
+	block, _ := pem.Decode(served)
+	if block == nil {
+		t.Fatalf("no PEM data in served certificate: %q", served)
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	si := ci.Content.SignerInfos[0]
+	if si.SID.SerialNumber.Cmp(cert.SerialNumber) != 0 {
+		t.Fatalf("unexpected signer serial, want: %v, got: %v", cert.SerialNumber, si.SID.SerialNumber)
+	}
+	sum := sha256.Sum256(body)
+	if err := rsa.VerifyPKCS1v15(cert.PublicKey.(*rsa.PublicKey), crypto.SHA256, sum[:], si.Signature); err != nil {
+		t.Fatalf("signature does not match the served script: %v", err)
+	}
+}
+
+func TestScriptSignerKeys(t *testing.T) {
+	defer func() { scriptSigner.key, scriptSigner.certs, scriptSigner.pem = nil, nil, nil }()
+
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := loadScriptSigner(writeScriptSigner(t, ecKey)); err == nil {
+		t.Fatal("non RSA script signing key accepted")
+	}
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyPath, _ := writeScriptSigner(t, rsaKey)
+	_, certPath := writeScriptSigner(t, other)
+	if err := loadScriptSigner(keyPath, certPath); err == nil {
+		t.Fatal("script signing certificate of another key accepted")
+	}
+}
+
+func TestUnsignedBootScript(t *testing.T) {
+	i := NewInstallers()
+	i.RegisterDistro("alpine", func(_ context.Context, _ Job, s *ipxe.Script) { s.Echo("alpine installer") })
+	m := NewMock(t, "c3.small.x86", "ewr1")
+	m.SetMAC("00:00:ba:dd:be:f0")
+	m.SetOSDistro("alpine")
+	m.Job().ServeFile(httptest.NewRecorder(), httptest.NewRequest("GET", "http://127.0.0.1/auto.ipxe", nil), i)
+
+	w := httptest.NewRecorder()
+	m.Job().ServeFile(w, httptest.NewRequest("GET", "http://127.0.0.1/auto.ipxe.sig", nil), i)
+	if code := w.Result().StatusCode; code != http.StatusNotFound {
+		t.Fatalf("unexpected signature status with signing disabled, want: %d, got: %d", http.StatusNotFound, code)
+	}
+
+	w = httptest.NewRecorder()
+	ServeScriptSigningKey(w, httptest.NewRequest("GET", "http://127.0.0.1"+ScriptSigningKeyPath, nil))
+	if code := w.Result().StatusCode; code != http.StatusNotFound {
+		t.Fatalf("unexpected status, want: %d, got: %d", http.StatusNotFound, code)
+	}
+}
+
+func TestSignatureStoreExpiry(t *testing.T) {
+	s := newSignatureStore()
+	now := time.Unix(0, 0)
+	s.now = func() time.Time { return now }
+
+	s.keep("00:00:ba:dd:be:ef", "auto.ipxe", []byte("a"), time.Minute)
+	if sig, ok := s.get("00:00:ba:dd:be:ef", "auto.ipxe"); !ok || string(sig) != "a" {
+		t.Fatalf("unexpected signature, want: %q, got: %q", "a", sig)
+	}
+
+	now = now.Add(time.Minute)
+	if _, ok := s.get("00:00:ba:dd:be:ef", "auto.ipxe"); ok {
+		t.Fatal("expired signature served")
+	}
+
+	s.keep("00:00:ba:dd:be:f0", "auto.ipxe", []byte("b"), time.Minute)
+	if got := len(s.byKey); got != 1 {
+		t.Fatalf("expired signatures kept, want: 1, got: %d", got)
+	}
+}
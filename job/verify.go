@@ -0,0 +1,100 @@
+package job
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/tinkerbell/boots/metrics"
+)
+
+// VerifyPath is the path installed machines report their operating system to.
+const VerifyPath = "/verify"
+
+// installReport is the operating system an installed machine reports.
+type installReport struct {
+	OS          string `json:"os"`
+	Version     string `json:"version"`
+	Fingerprint string `json:"fingerprint"`
+}
+
+// ServeVerifyEndpoint compares the operating system the machine reports it
+// installed with the one boots serves it, mismatches are counted and posted as
+// an install.verification.mismatch instance event. The response tells the
+// machine whether the report matched. The installed operating system never
+// gets a boot script nonce, the machine is identified by its address alone.
+func (j Job) ServeVerifyEndpoint(w http.ResponseWriter, req *http.Request) {
+	b, err := readClose(req.Body)
+	if err != nil {
+		j.Error(errors.WithMessage(err, "reading verify body"))
+		w.WriteHeader(http.StatusBadRequest)
+
+		return
+	}
+	var r installReport
+	if err := json.Unmarshal(b, &r); err != nil || r.OS == "" {
+		if err == nil {
+			err = errors.New("missing os")
+		}
+		j.Error(errors.Wrap(err, "parsing verify body as json"))
+		w.WriteHeader(http.StatusBadRequest)
+
+		return
+	}
+
+	mismatches := j.installMismatches(r)
+	if len(mismatches) > 0 {
+		for _, field := range mismatches {
+			metrics.InstallVerificationMismatches.WithLabelValues(field).Inc()
+		}
+		body := fmt.Sprintf("installed os %s %s (fingerprint %q) does not match the served %s: %s",
+			r.OS, r.Version, r.Fingerprint, j.expectedOS(), strings.Join(mismatches, ", "))
+		j.With("os", r.OS, "version", r.Version, "fingerprint", r.Fingerprint, "mismatches", mismatches).Info("install verification mismatch")
+		if j.InstanceID() != "" {
+			j.postEvent(req.Context(), "install.verification.mismatch", body, false)
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{"match": len(mismatches) == 0, "mismatches": mismatches})
+}
+
+// installMismatches returns the fields of r that differ from the operating
+// system served to j, the version is only compared when both are known.
+func (j Job) installMismatches(r installReport) []string {
+	mismatches := []string{}
+	os := j.OperatingSystem()
+	if os == nil || r.OS != os.Slug {
+		return append(mismatches, "os")
+	}
+	if want := j.expectedOSVersion(); want != "" && r.Version != "" && r.Version != want {
+		mismatches = append(mismatches, "version")
+	}
+
+	return mismatches
+}
+
+// expectedOSVersion returns the version installers serve j, the pinned or
+// facility default version over the one of the operating system.
+func (j Job) expectedOSVersion() string {
+	os := j.OperatingSystem()
+	if os == nil {
+		return ""
+	}
+	if v := j.OSVersion(os.Distro, func(string) bool { return true }); v != "" {
+		return v
+	}
+
+	return os.Version
+}
+
+func (j Job) expectedOS() string {
+	os := j.OperatingSystem()
+	if os == nil {
+		return "no os"
+	}
+
+	return strings.TrimSpace(os.Slug + " " + j.expectedOSVersion())
+}
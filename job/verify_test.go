@@ -0,0 +1,110 @@
+package job
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/tinkerbell/boots/client"
+	"github.com/tinkerbell/boots/conf"
+)
+
+// eventRecorder records the instance events posted through it.
+type eventRecorder struct {
+	client.Reporter
+	events []client.Event
+}
+
+func (r *eventRecorder) PostInstanceEvent(_ context.Context, _ string, body io.Reader) (string, error) {
+	var e client.Event
+	if err := json.NewDecoder(body).Decode(&e); err != nil {
+		return "", err
+	}
+	r.events = append(r.events, e)
+
+	return "", nil
+}
+
+func TestServeVerifyEndpoint(t *testing.T) {
+	tests := map[string]struct {
+		report     string
+		mismatches []string
+	}{
+		"match":              {report: `{"os":"flatcar_stable","version":"stable","fingerprint":"abc"}`, mismatches: []string{}},
+		"match, no version":  {report: `{"os":"flatcar_stable"}`, mismatches: []string{}},
+		"mismatched os":      {report: `{"os":"ubuntu_22_04","version":"22.04"}`, mismatches: []string{"os"}},
+		"mismatched version": {report: `{"os":"flatcar_stable","version":"alpha","fingerprint":"abc"}`, mismatches: []string{"version"}},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			r := &eventRecorder{Reporter: client.NewNoOpReporter(joblog)}
+			m := NewMock(t, "c3.small.x86", "ewr1")
+			m.SetInstanceID("instance")
+			m.SetOSDistro("flatcar")
+			m.SetOSSlug("flatcar_stable")
+			m.SetOSVersion("stable")
+			m.SetReporter(r)
+
+			w := httptest.NewRecorder()
+			m.Job().ServeVerifyEndpoint(w, httptest.NewRequest("POST", "http://127.0.0.1"+VerifyPath, strings.NewReader(tt.report)))
+			if code := w.Result().StatusCode; code != http.StatusOK {
+				t.Fatalf("unexpected status, want: %d, got: %d", http.StatusOK, code)
+			}
+			var res struct {
+				Match      bool     `json:"match"`
+				Mismatches []string `json:"mismatches"`
+			}
+			if err := json.NewDecoder(w.Body).Decode(&res); err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(tt.mismatches, res.Mismatches); diff != "" {
+				t.Fatal(diff)
+			}
+			if res.Match != (len(tt.mismatches) == 0) {
+				t.Fatalf("unexpected match: %v", res.Match)
+			}
+
+			if len(tt.mismatches) == 0 {
+				if len(r.events) != 0 {
+					t.Fatalf("unexpected events for a matching report: %+v", r.events)
+				}
+
+				return
+			}
+			if len(r.events) != 1 || r.events[0].Type != "install.verification.mismatch" {
+				t.Fatalf("expected one install.verification.mismatch event, got: %+v", r.events)
+			}
+		})
+	}
+}
+
+func TestServeVerifyEndpointBadReport(t *testing.T) {
+	m := NewMock(t, "c3.small.x86", "ewr1")
+	for _, body := range []string{"", "{", `{"version":"stable"}`} {
+		w := httptest.NewRecorder()
+		m.Job().ServeVerifyEndpoint(w, httptest.NewRequest("POST", "http://127.0.0.1"+VerifyPath, strings.NewReader(body)))
+		if code := w.Result().StatusCode; code != http.StatusBadRequest {
+			t.Fatalf("%q: unexpected status, want: %d, got: %d", body, http.StatusBadRequest, code)
+		}
+	}
+}
+
+func TestServeVerifyEndpointNonce(t *testing.T) {
+	defer func(enabled bool) { conf.IPXENonce = enabled }(conf.IPXENonce)
+	conf.IPXENonce = true
+
+	// the installed os reports long after its boot script nonce expired
+	m := NewMock(t, "c3.small.x86", "ewr1")
+	m.SetOSSlug("flatcar_stable")
+	w := httptest.NewRecorder()
+	m.Job().ServeVerifyEndpoint(w, httptest.NewRequest("POST", "http://127.0.0.1"+VerifyPath, strings.NewReader(`{"os":"flatcar_stable"}`)))
+	if code := w.Result().StatusCode; code != http.StatusOK {
+		t.Fatalf("unexpected status, want: %d, got: %d", http.StatusOK, code)
+	}
+}
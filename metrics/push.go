@@ -0,0 +1,29 @@
+package metrics
+
+import (
+	"context"
+	"time"
+
+	"github.com/packethost/pkg/log"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/push"
+)
+
+// Push pushes the metrics gathered from g to the Prometheus Pushgateway at url,
+// grouped under job, every interval until ctx is done. Failed pushes are
+// logged and retried on the next interval.
+func Push(ctx context.Context, l log.Logger, g prometheus.Gatherer, url, job string, interval time.Duration) {
+	pusher := push.New(url, job).Gatherer(g)
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		if err := pusher.Push(); err != nil {
+			l.With("url", url, "job", job).Error(err, "push metrics")
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+	}
+}
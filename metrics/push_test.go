@@ -0,0 +1,54 @@
+package metrics
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/packethost/pkg/log"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+func TestPush(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	pushed := promauto.With(registry).NewCounter(prometheus.CounterOpts{Name: "boots_test_pushed", Help: "test counter"})
+	pushed.Inc()
+
+	pushes := make(chan string, 1)
+	gateway := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		body, _ := io.ReadAll(req.Body)
+		if !strings.Contains(string(body), "boots_test_pushed") {
+			t.Errorf("pushed metrics missing the test counter: %q", body)
+		}
+		select {
+		case pushes <- req.URL.Path:
+		default:
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer gateway.Close()
+
+	l := log.Test(t, "TestPush")
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		Push(ctx, l, registry, gateway.URL, "boots-test", time.Hour)
+		close(done)
+	}()
+
+	select {
+	case path := <-pushes:
+		if want := "/metrics/job/boots-test"; path != want {
+			t.Fatalf("unexpected push path, want: %s, got: %s", want, path)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no metrics pushed")
+	}
+	cancel()
+	<-done
+}
@@ -4,10 +4,12 @@ import (
 	"github.com/packethost/pkg/log"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/tinkerbell/boots/conf"
 )
 
 var (
-	DHCPTotal *prometheus.CounterVec
+	DHCPTotal       *prometheus.CounterVec
+	DHCPRateLimited prometheus.Counter
 
 	CacherDuration           prometheus.ObserverVec
 	CacherCacheHits          *prometheus.CounterVec
@@ -20,14 +22,52 @@ var (
 
 	JobDuration    prometheus.ObserverVec
 	JobsTotal      *prometheus.CounterVec
+	JobsCompleted  *prometheus.CounterVec
 	JobsInProgress *prometheus.GaugeVec
+
+	BackendLastSuccess  *prometheus.GaugeVec
+	BackendLastFailure  *prometheus.GaugeVec
+	BackendCallDuration prometheus.ObserverVec
+	BackendCallErrors   *prometheus.CounterVec
+
+	StaleHardwareServed *prometheus.CounterVec
+
+	SyslogMessagesDropped prometheus.Counter
+
+	IPXEScriptsOversized prometheus.Counter
+
+	InstallVerificationMismatches *prometheus.CounterVec
+
+	InstallerSelfTestFailures *prometheus.CounterVec
+
+	HTTPRequestsTotal *prometheus.CounterVec
 )
 
+// UnknownFacility is the facility label of jobs that are not resolved yet, or could not be.
+const UnknownFacility = "unknown"
+
+var jobFacilityLabel bool
+
+// JobLabels returns the labels of the job metrics, facility is only included
+// when the job metrics were set up with a facility label.
+func JobLabels(from, op, facility string) prometheus.Labels {
+	labels := prometheus.Labels{"from": from, "op": op}
+	if jobFacilityLabel {
+		labels["facility"] = facility
+	}
+
+	return labels
+}
+
 func Init(log.Logger) {
 	DHCPTotal = promauto.NewCounterVec(prometheus.CounterOpts{
 		Name: "dhcp_total",
 		Help: "Number of DHCP Requests handled.",
 	}, []string{"op", "type", "giaddr"})
+	DHCPRateLimited = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "dhcp_rate_limited_total",
+		Help: "Number of DHCP packets dropped because their client exceeded the rate limit.",
+	})
 
 	labelValues := []prometheus.Labels{
 		{"op": "recv", "type": "DHCPACK", "giaddr": "0.0.0.0"},
@@ -87,40 +127,109 @@ func Init(log.Logger) {
 	initCounterLabels(HardwareDiscovers, labelValues)
 	initGaugeLabels(DiscoversInProgress, labelValues)
 
+	jobFacilityLabel = conf.MetricsFacilityLabel
+	jobLabelNames := []string{"from", "op"}
+	if jobFacilityLabel {
+		jobLabelNames = append(jobLabelNames, "facility")
+	}
 	JobDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
 		Name:    "jobs_duration_seconds",
 		Help:    "Duration taken for a job to complete.",
 		Buckets: prometheus.LinearBuckets(.01, .05, 10),
-	}, []string{"from", "op"})
+	}, jobLabelNames)
 	JobsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
 		Name: "jobs_total",
 		Help: "Number of jobs.",
-	}, []string{"from", "op"})
+	}, jobLabelNames)
+	JobsCompleted = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "jobs_completed_total",
+		Help: "Number of jobs that completed.",
+	}, jobLabelNames)
 	JobsInProgress = promauto.NewGaugeVec(prometheus.GaugeOpts{
 		Name: "jobs_in_progress",
 		Help: "Number of jobs waiting to complete.",
-	}, []string{"from", "op"})
+	}, jobLabelNames)
 
 	labelValues = []prometheus.Labels{
-		{"from": "dhcp", "op": "DHCPACK"},
-		{"from": "dhcp", "op": "DHCPDECLINE"},
-		{"from": "dhcp", "op": "DHCPDISCOVER"},
-		{"from": "dhcp", "op": "DHCPINFORM"},
-		{"from": "dhcp", "op": "DHCPNAK"},
-		{"from": "dhcp", "op": "DHCPOFFER"},
-		{"from": "dhcp", "op": "DHCPRELEASE"},
-		{"from": "dhcp", "op": "DHCPREQUEST"},
-		{"from": "http", "op": "file"},
-		{"from": "http", "op": "hardware-components"},
-		{"from": "http", "op": "phone-home"},
-		{"from": "http", "op": "problem"},
-		{"from": "http", "op": "event"},
-		{"from": "tftp", "op": "read"},
+		JobLabels("dhcp", "DHCPACK", UnknownFacility),
+		JobLabels("dhcp", "DHCPDECLINE", UnknownFacility),
+		JobLabels("dhcp", "DHCPDISCOVER", UnknownFacility),
+		JobLabels("dhcp", "DHCPINFORM", UnknownFacility),
+		JobLabels("dhcp", "DHCPNAK", UnknownFacility),
+		JobLabels("dhcp", "DHCPOFFER", UnknownFacility),
+		JobLabels("dhcp", "DHCPRELEASE", UnknownFacility),
+		JobLabels("dhcp", "DHCPREQUEST", UnknownFacility),
+		JobLabels("http", "file", UnknownFacility),
+		JobLabels("http", "hardware-components", UnknownFacility),
+		JobLabels("http", "phone-home", UnknownFacility),
+		JobLabels("http", "problem", UnknownFacility),
+		JobLabels("http", "event", UnknownFacility),
+		JobLabels("tftp", "read", UnknownFacility),
 	}
 
 	initObserverLabels(JobDuration, labelValues)
 	initCounterLabels(JobsTotal, labelValues)
+	initCounterLabels(JobsCompleted, labelValues)
 	initGaugeLabels(JobsInProgress, labelValues)
+
+	BackendLastSuccess = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "backend_last_success_timestamp_seconds",
+		Help: "Unix timestamp of the last successful backend call.",
+	}, []string{"backend"})
+	BackendLastFailure = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "backend_last_failure_timestamp_seconds",
+		Help: "Unix timestamp of the last failed backend call.",
+	}, []string{"backend"})
+
+	labelValues = []prometheus.Labels{
+		{"backend": "hardware_finder"},
+		{"backend": "workflow_finder"},
+		{"backend": "reporter"},
+	}
+	initGaugeLabels(BackendLastSuccess, labelValues)
+	initGaugeLabels(BackendLastFailure, labelValues)
+
+	// Buckets from 5ms up to about 41s, backends stalling for as long as the
+	// lookup timeouts still land in one.
+	BackendCallDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "backend_call_duration_seconds",
+		Help:    "Duration of backend calls, by backend and operation.",
+		Buckets: prometheus.ExponentialBuckets(.005, 2, 14),
+	}, []string{"backend", "op"})
+	BackendCallErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "backend_call_errors_total",
+		Help: "Number of failed backend calls, by backend and operation.",
+	}, []string{"backend", "op"})
+
+	StaleHardwareServed = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "stale_hardware_served_total",
+		Help: "Number of cached hardware records served while the backend failed, by lookup.",
+	}, []string{"lookup"})
+
+	SyslogMessagesDropped = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "syslog_messages_dropped_total",
+		Help: "Number of syslog messages dropped because the parse buffer was full.",
+	})
+
+	IPXEScriptsOversized = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "ipxe_scripts_oversized_total",
+		Help: "Number of boot scripts replaced by a shell script because they exceeded the maximum size.",
+	})
+
+	InstallVerificationMismatches = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "install_verification_mismatches_total",
+		Help: "Number of install verification reports not matching the served operating system, by field.",
+	}, []string{"field"})
+
+	InstallerSelfTestFailures = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "installer_self_test_failures_total",
+		Help: "Number of installers that failed to render a boot script in the startup self-test.",
+	}, []string{"kind", "installer"})
+
+	HTTPRequestsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "http_requests_total",
+		Help: "Number of HTTP requests served, by route and status code.",
+	}, []string{"route", "code"})
 }
 
 func initCounterLabels(m *prometheus.CounterVec, l []prometheus.Labels) {
@@ -0,0 +1,128 @@
+package syslog
+
+import (
+	"context"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// facilityCacheTTL is how long the facility of a source address is reused for
+// before it is looked up again, machines send many messages while provisioning.
+const facilityCacheTTL = time.Minute
+
+// FacilityFinder returns the facility code of the machine at ip.
+type FacilityFinder func(ctx context.Context, ip net.IP) (string, error)
+
+// Forwarder sends received messages on, unchanged, to the collector of the
+// facility of the machine they came from.
+type Forwarder struct {
+	find     FacilityFinder
+	routes   map[string]*net.UDPAddr
+	fallback *net.UDPAddr
+	conn     *net.UDPConn
+	now      func() time.Time
+
+	mu         sync.Mutex
+	facilities map[string]cachedFacility
+}
+
+type cachedFacility struct {
+	code    string
+	expires time.Time
+}
+
+// NewForwarder returns a Forwarder sending messages to the host:port collector
+// in routes by facility, or to fallback for sources of other or unresolved
+// facilities. An empty fallback drops those messages.
+func NewForwarder(find FacilityFinder, routes map[string]string, fallback string) (*Forwarder, error) {
+	f := &Forwarder{
+		find:       find,
+		routes:     make(map[string]*net.UDPAddr, len(routes)),
+		now:        time.Now,
+		facilities: make(map[string]cachedFacility),
+	}
+	for facility, addr := range routes {
+		raddr, err := net.ResolveUDPAddr("udp4", addr)
+		if err != nil {
+			return nil, errors.Wrapf(err, "resolve syslog collector address of facility %s", facility)
+		}
+		f.routes[facility] = raddr
+	}
+	if fallback != "" {
+		raddr, err := net.ResolveUDPAddr("udp4", fallback)
+		if err != nil {
+			return nil, errors.Wrap(err, "resolve default syslog collector address")
+		}
+		f.fallback = raddr
+	}
+
+	c, err := net.ListenUDP("udp4", nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "listen for forwarding syslog messages")
+	}
+	f.conn = c
+
+	return f, nil
+}
+
+// Close stops forwarding.
+func (f *Forwarder) Close() error {
+	return f.conn.Close()
+}
+
+// destination returns the collector of messages from host, nil if they are dropped.
+func (f *Forwarder) destination(host net.IP) *net.UDPAddr {
+	if addr, ok := f.routes[f.facility(host)]; ok {
+		return addr
+	}
+
+	return f.fallback
+}
+
+// facility returns the facility code of the machine at host, "" if it can not
+// be resolved.
+func (f *Forwarder) facility(host net.IP) string {
+	key := host.String()
+	now := f.now()
+
+	f.mu.Lock()
+	cached, ok := f.facilities[key]
+	f.mu.Unlock()
+	if ok && now.Before(cached.expires) {
+		return cached.code
+	}
+
+	code, err := f.find(context.Background(), host)
+	if err != nil {
+		sysloglog.With("host", key).Debug(errors.WithMessage(err, "resolving facility of syslog source"))
+		code = ""
+	}
+
+	f.mu.Lock()
+	for k, c := range f.facilities {
+		if !now.Before(c.expires) {
+			delete(f.facilities, k)
+		}
+	}
+	f.facilities[key] = cachedFacility{code: code, expires: now.Add(facilityCacheTTL)}
+	f.mu.Unlock()
+
+	return code
+}
+
+// forward sends m to its collector, a nil Forwarder forwards nothing.
+func (f *Forwarder) forward(m *message) {
+	if f == nil {
+		return
+	}
+	addr := f.destination(m.host)
+	if addr == nil {
+		return
+	}
+	if _, err := f.conn.WriteToUDP(m.buf[:m.size], addr); err != nil {
+		sysloglog.With("collector", addr.String()).Error(errors.Wrap(err, "forwarding syslog message"))
+	}
+}
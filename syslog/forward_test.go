@@ -0,0 +1,111 @@
+package syslog
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+func listenCollector(t *testing.T) *net.UDPConn {
+	t.Helper()
+
+	c, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { c.Close() })
+
+	return c
+}
+
+// received returns the next message collector got, "" if none arrived.
+func received(t *testing.T, collector *net.UDPConn) string {
+	t.Helper()
+
+	buf := make([]byte, 1024)
+	collector.SetReadDeadline(time.Now().Add(200 * time.Millisecond))
+	n, _, err := collector.ReadFromUDP(buf)
+	if err != nil {
+		return ""
+	}
+
+	return string(buf[:n])
+}
+
+func TestForwarder(t *testing.T) {
+	ewr1, sjc1, fallback := listenCollector(t), listenCollector(t), listenCollector(t)
+
+	lookups := 0
+	find := func(_ context.Context, ip net.IP) (string, error) {
+		lookups++
+		switch ip.String() {
+		case "10.0.0.1":
+			return "ewr1", nil
+		case "10.0.0.2":
+			return "sjc1", nil
+		case "10.0.0.3":
+			return "ams1", nil
+		}
+
+		return "", errors.New("no hardware found")
+	}
+	f, err := NewForwarder(find, map[string]string{
+		"ewr1": ewr1.LocalAddr().String(),
+		"sjc1": sjc1.LocalAddr().String(),
+	}, fallback.LocalAddr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	tests := []struct {
+		name string
+		host string
+		want *net.UDPConn
+	}{
+		{name: "facility ewr1", host: "10.0.0.1", want: ewr1},
+		{name: "facility sjc1", host: "10.0.0.2", want: sjc1},
+		{name: "unrouted facility", host: "10.0.0.3", want: fallback},
+		{name: "unresolved", host: "10.0.0.4", want: fallback},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body := "<30>Jan  1 00:00:00 host app: from " + tt.host
+			m := &message{host: net.ParseIP(tt.host), size: len(body)}
+			copy(m.buf[:], body)
+			f.forward(m)
+
+			for _, collector := range []*net.UDPConn{ewr1, sjc1, fallback} {
+				got := received(t, collector)
+				if collector == tt.want && got != body {
+					t.Fatalf("message not forwarded to the facility collector, want: %q, got: %q", body, got)
+				}
+				if collector != tt.want && got != "" {
+					t.Fatalf("message forwarded to another collector: %q", got)
+				}
+			}
+		})
+	}
+
+	before := lookups
+	f.forward(&message{host: net.ParseIP("10.0.0.1")})
+	if lookups != before {
+		t.Fatal("facility looked up again within the cache ttl")
+	}
+	received(t, ewr1)
+}
+
+func TestForwarderNoFallback(t *testing.T) {
+	f, err := NewForwarder(func(context.Context, net.IP) (string, error) { return "", nil }, nil, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	if addr := f.destination(net.ParseIP("10.0.0.1")); addr != nil {
+		t.Fatalf("unexpected destination without a default collector: %v", addr)
+	}
+}
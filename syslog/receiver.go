@@ -6,6 +6,7 @@ import (
 	"time"
 
 	"github.com/pkg/errors"
+	"github.com/tinkerbell/boots/metrics"
 )
 
 var syslogMessagePool = sync.Pool{
@@ -15,16 +16,24 @@ var syslogMessagePool = sync.Pool{
 type Receiver struct {
 	c *net.UDPConn
 
-	parse chan *message
+	parse   chan *message
+	forward *Forwarder
 
 	done chan struct{}
 	err  error
 }
 
-func StartReceiver(laddr string, parsers int) (*Receiver, error) {
+// StartReceiver listens for syslog messages on laddr, handing them to parsers
+// goroutines through a queue of buffer messages. Messages received while the
+// queue is full are dropped rather than stalling the UDP read loop. Parsed
+// messages are also sent on by forward, unless it is nil.
+func StartReceiver(laddr string, parsers, buffer int, forward *Forwarder) (*Receiver, error) {
 	if parsers < 1 {
 		parsers = 1
 	}
+	if buffer < 1 {
+		buffer = 1
+	}
 
 	addr, err := net.ResolveUDPAddr("udp4", laddr)
 	if err != nil {
@@ -36,11 +45,8 @@ func StartReceiver(laddr string, parsers int) (*Receiver, error) {
 		return nil, errors.Wrap(err, "listen on syslog udp address")
 	}
 
-	s := &Receiver{
-		c:     c,
-		parse: make(chan *message, parsers),
-		done:  make(chan struct{}),
-	}
+	s := newReceiver(c, buffer)
+	s.forward = forward
 
 	for i := 0; i < parsers; i++ {
 		go s.runParser()
@@ -50,6 +56,14 @@ func StartReceiver(laddr string, parsers int) (*Receiver, error) {
 	return s, nil
 }
 
+func newReceiver(c *net.UDPConn, buffer int) *Receiver {
+	return &Receiver{
+		c:     c,
+		parse: make(chan *message, buffer),
+		done:  make(chan struct{}),
+	}
+}
+
 func (r *Receiver) Done() <-chan struct{} {
 	return r.done
 }
@@ -99,8 +113,14 @@ func (r *Receiver) run() {
 		msg.time = time.Now().UTC()
 		msg.host = from.IP
 		msg.size = n
-		r.parse <- msg
-		msg = nil
+		select {
+		case r.parse <- msg:
+			msg = nil
+		default:
+			// reuse msg for the next read
+			metrics.SyslogMessagesDropped.Inc()
+			msg.reset()
+		}
 	}
 }
 
@@ -115,6 +135,7 @@ func (r *Receiver) runParser() {
 		} else {
 			sysloglog.Debug(m)
 		}
+		r.forward.forward(m)
 		m.reset()
 		syslogMessagePool.Put(m)
 	}
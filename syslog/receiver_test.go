@@ -0,0 +1,62 @@
+package syslog
+
+import (
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/packethost/pkg/log"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/tinkerbell/boots/metrics"
+)
+
+func TestMain(m *testing.M) {
+	l, err := log.Init("github.com/tinkerbell/boots")
+	if err != nil {
+		panic(nil)
+	}
+	defer l.Close()
+	Init(l)
+	metrics.Init(l)
+	os.Exit(m.Run()) //nolint:gocritic // this seems to be the correct pattern
+}
+
+func TestReceiverDropsOnOverflow(t *testing.T) {
+	c, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// no parsers are started, so only buffer messages can be queued
+	const buffer, sent = 4, 32
+	r := newReceiver(c, buffer)
+	go r.run()
+	defer c.Close()
+
+	w, err := net.DialUDP("udp4", nil, c.LocalAddr().(*net.UDPAddr))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+
+	before := testutil.ToFloat64(metrics.SyslogMessagesDropped)
+	for i := 0; i < sent; i++ {
+		if _, err := w.Write([]byte("<30>Jan  1 00:00:00 host app: flood")); err != nil {
+			t.Fatal(err)
+		}
+		// keep the kernel socket buffer from dropping the burst before the reader does
+		time.Sleep(time.Millisecond)
+	}
+
+	want := float64(sent - buffer)
+	deadline := time.Now().Add(5 * time.Second)
+	for testutil.ToFloat64(metrics.SyslogMessagesDropped)-before != want {
+		if time.Now().After(deadline) {
+			t.Fatalf("unexpected dropped messages, want: %v, got: %v", want, testutil.ToFloat64(metrics.SyslogMessagesDropped)-before)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if len(r.parse) != buffer {
+		t.Fatalf("unexpected queued messages, want: %d, got: %d", buffer, len(r.parse))
+	}
+}
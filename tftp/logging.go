@@ -0,0 +1,11 @@
+package tftp
+
+import (
+	"github.com/packethost/pkg/log"
+)
+
+var tftplog log.Logger
+
+func Init(l log.Logger) {
+	tftplog = l.Package("tftp")
+}
@@ -0,0 +1,123 @@
+// Package tftp serves iPXE binaries over TFTP from a list of directories.
+package tftp
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path"
+	"path/filepath"
+	"time"
+
+	"github.com/pin/tftp/v3"
+	"github.com/pkg/errors"
+	"github.com/tinkerbell/boots/timeline"
+	"github.com/tinkerbell/ipxedust/binary"
+)
+
+// Handler serves TFTP read requests from the first of Roots holding the
+// requested file, falling back to the iPXE binaries embedded in boots.
+type Handler struct {
+	Roots []string
+}
+
+// ListenAndServe serves TFTP read requests on addr until ctx is done, waiting
+// timeout for the ack of each block sent before sending it again, up to
+// retransmits times. Zero values use the defaults of github.com/pin/tftp.
+func ListenAndServe(ctx context.Context, addr string, timeout time.Duration, retransmits int, roots []string) error {
+	a, err := net.ResolveUDPAddr("udp", addr)
+	if err != nil {
+		return errors.Wrap(err, "resolve tftp listen address")
+	}
+	conn, err := net.ListenUDP("udp", a)
+	if err != nil {
+		return errors.Wrap(err, "listen on tftp address")
+	}
+
+	s := newServer(Handler{Roots: roots}, timeout, retransmits)
+	s.EnableSinglePort()
+	go func() {
+		<-ctx.Done()
+		conn.Close()
+		s.Shutdown()
+	}()
+	tftplog.With("addr", addr, "roots", roots).Info("serving iPXE binaries via TFTP")
+
+	return errors.Wrap(s.Serve(conn), "serve tftp")
+}
+
+func newServer(h Handler, timeout time.Duration, retransmits int) *tftp.Server {
+	s := tftp.NewServer(h.HandleRead, h.HandleWrite)
+	s.SetTimeout(timeout)
+	s.SetRetries(retransmits)
+
+	return s
+}
+
+// HandleRead sends the requested file to the client.
+func (h Handler) HandleRead(filename string, rf io.ReaderFrom) error {
+	var client net.UDPAddr
+	if t, ok := rf.(tftp.OutgoingTransfer); ok {
+		client = t.RemoteAddr()
+	}
+	l := tftplog.With("event", "get", "filename", filename, "client", client.IP)
+
+	r, source, err := h.open(filename)
+	if err != nil {
+		l.Error(err)
+		timeline.RecordIP(client.IP, "tftp", fmt.Sprintf("%s not found", filename))
+
+		return err
+	}
+	defer r.Close()
+
+	n, err := rf.ReadFrom(r)
+	if err != nil {
+		err = errors.Wrap(err, "sending file")
+		l.Error(err)
+		timeline.RecordIP(client.IP, "tftp", fmt.Sprintf("sending %s failed after %d bytes", filename, n))
+
+		return err
+	}
+	l.With("source", source, "bytes", n).Info("file served")
+	timeline.RecordIP(client.IP, "tftp", fmt.Sprintf("sent %s (%d bytes)", filename, n))
+
+	return nil
+}
+
+// HandleWrite rejects all TFTP write requests.
+func (h Handler) HandleWrite(filename string, _ io.WriterTo) error {
+	err := errors.Wrap(os.ErrPermission, "tftp writes are not supported")
+	tftplog.With("event", "put", "filename", filename).Error(err)
+
+	return err
+}
+
+// open returns the first match for filename in the roots, or the embedded
+// binary of the same name, along with where it was found.
+func (h Handler) open(filename string) (io.ReadCloser, string, error) {
+	// rooting the path before cleaning it keeps ".." from escaping the roots
+	name := path.Clean("/" + filepath.ToSlash(filename))
+	for _, root := range h.Roots {
+		p := filepath.Join(root, filepath.FromSlash(name))
+		f, err := os.Open(p)
+		if err != nil {
+			continue
+		}
+		if fi, err := f.Stat(); err != nil || fi.IsDir() {
+			f.Close()
+
+			continue
+		}
+
+		return f, p, nil
+	}
+	if content, ok := binary.Files[path.Base(name)]; ok {
+		return io.NopCloser(bytes.NewReader(content)), "embedded", nil
+	}
+
+	return nil, "", errors.Wrapf(os.ErrNotExist, "file %q not found", filename)
+}
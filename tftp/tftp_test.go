@@ -0,0 +1,155 @@
+package tftp
+
+import (
+	"bytes"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/packethost/pkg/log"
+	"github.com/pin/tftp/v3"
+	"github.com/tinkerbell/ipxedust/binary"
+)
+
+func TestMain(m *testing.M) {
+	l, err := log.Init("github.com/tinkerbell/boots")
+	if err != nil {
+		panic(nil)
+	}
+	defer l.Close()
+	Init(l)
+	os.Exit(m.Run()) //nolint:gocritic // this seems to be the correct pattern
+}
+
+func serve(t *testing.T, roots ...string) string {
+	t.Helper()
+
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := newServer(Handler{Roots: roots}, 0, 0)
+	go func() { _ = s.Serve(conn) }()
+	t.Cleanup(s.Shutdown)
+
+	return conn.LocalAddr().String()
+}
+
+func get(t *testing.T, addr, filename string) ([]byte, error) {
+	t.Helper()
+
+	c, err := tftp.NewClient(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wt, err := c.Receive(filename, "octet")
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if _, err := wt.WriteTo(&buf); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+func TestHandleRead(t *testing.T) {
+	dir := t.TempDir()
+	first := filepath.Join(dir, "first")
+	second := filepath.Join(dir, "second")
+	for _, d := range []string{first, second} {
+		if err := os.Mkdir(d, 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(second, "custom.efi"), []byte("custom"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(first, "undionly.kpxe"), []byte("local"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "secret"), []byte("secret"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	addr := serve(t, first, second)
+
+	tests := []struct {
+		name     string
+		filename string
+		want     []byte
+		wantErr  string
+	}{
+		{name: "found in second root", filename: "custom.efi", want: []byte("custom")},
+		{name: "first root wins over embedded", filename: "undionly.kpxe", want: []byte("local")},
+		{name: "embedded fallback", filename: "ipxe.efi", want: binary.Files["ipxe.efi"]},
+		{name: "not found", filename: "missing.efi", wantErr: "code: 1"},
+		{name: "traversal", filename: "../secret", wantErr: "code: 1"},
+		{name: "directory", filename: "/", wantErr: "code: 1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := get(t, addr, tt.filename)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("unexpected error, want: %q, got: %v", tt.wantErr, err)
+				}
+
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, tt.want) {
+				t.Fatalf("unexpected content, want %d bytes, got %d bytes", len(tt.want), len(got))
+			}
+		})
+	}
+}
+
+func TestRetransmit(t *testing.T) {
+	const retransmits = 3
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := newServer(Handler{}, 100*time.Millisecond, retransmits)
+	go func() { _ = s.Serve(conn) }()
+	t.Cleanup(s.Shutdown)
+
+	// blocks are sent from another port than the one of the server
+	c, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	// read request for ipxe.efi, the ack of its first block is never sent
+	if _, err := c.WriteTo([]byte("\x00\x01ipxe.efi\x00octet\x00"), conn.LocalAddr()); err != nil {
+		t.Fatal(err)
+	}
+
+	// the first block is sent, then sent again until the retransmits run out
+	var sent int
+	buf := make([]byte, 1024)
+	for {
+		_ = c.SetReadDeadline(time.Now().Add(2 * time.Second))
+		n, _, err := c.ReadFrom(buf)
+		if err != nil {
+			break
+		}
+		if n < 4 || buf[0] != 0 || buf[1] != 3 { // DATA
+			continue
+		}
+		if block := int(buf[2])<<8 | int(buf[3]); block != 1 {
+			t.Fatalf("unexpected block sent without an ack: %d", block)
+		}
+		sent++
+	}
+	if sent != retransmits+1 {
+		t.Fatalf("unexpected number of sends of the first block, want: %d, got: %d", retransmits+1, sent)
+	}
+}
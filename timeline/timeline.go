@@ -0,0 +1,171 @@
+// Package timeline keeps the recent interactions of boots with each machine,
+// across its DHCP, TFTP and HTTP servers, to follow a single machine boot.
+package timeline
+
+import (
+	"container/list"
+	"net"
+	"sync"
+	"time"
+)
+
+// Event is an interaction with a machine, Source being the server that had it.
+type Event struct {
+	Time    time.Time `json:"time"`
+	Source  string    `json:"source"`
+	Message string    `json:"message"`
+}
+
+// machines holds the timelines recorded by the package functions, nothing is
+// recorded until Init.
+var machines *store
+
+// Init keeps the last size events of up to max machines, 0 for either keeps
+// none.
+func Init(size, max int) {
+	machines = newStore(size, max)
+}
+
+// Record adds an event from source to the timeline of mac.
+func Record(mac net.HardwareAddr, source, message string) {
+	machines.record(mac.String(), source, message, time.Now())
+}
+
+// RecordIP adds an event from source to the timeline of the machine last
+// offered ip over DHCP, for servers that only know the address of clients.
+// Events of addresses no machine was offered are dropped.
+func RecordIP(ip net.IP, source, message string) {
+	if mac, ok := machines.macOf(ip.String()); ok {
+		machines.record(mac, source, message, time.Now())
+	}
+}
+
+// Offered notes that ip was offered to mac, see RecordIP.
+func Offered(ip net.IP, mac net.HardwareAddr) {
+	machines.offered(ip.String(), mac.String())
+}
+
+// Events returns the timeline of mac, oldest event first.
+func Events(mac net.HardwareAddr) []Event {
+	return machines.events(mac.String())
+}
+
+// store keeps the last size events of up to max machines, dropping the
+// machines without recent events first. A nil store records nothing.
+type store struct {
+	size, max int
+
+	mu       sync.Mutex
+	lru      *list.List // of *machine, most recently updated first
+	machines map[string]*list.Element
+	macs     map[string]string // by offered IP
+}
+
+type machine struct {
+	mac    string
+	ip     string
+	events []Event // ring of size events
+	next   int
+	full   bool
+}
+
+func newStore(size, max int) *store {
+	if size <= 0 || max <= 0 {
+		return nil
+	}
+
+	return &store{
+		size:     size,
+		max:      max,
+		lru:      list.New(),
+		machines: make(map[string]*list.Element),
+		macs:     make(map[string]string),
+	}
+}
+
+func (s *store) record(mac, source, message string, now time.Time) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	m := s.machine(mac)
+	m.events[m.next] = Event{Time: now, Source: source, Message: message}
+	m.next = (m.next + 1) % s.size
+	if m.next == 0 {
+		m.full = true
+	}
+}
+
+func (s *store) offered(ip, mac string) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	m := s.machine(mac)
+	if m.ip != "" && s.macs[m.ip] == mac {
+		delete(s.macs, m.ip)
+	}
+	m.ip = ip
+	s.macs[ip] = mac
+}
+
+func (s *store) macOf(ip string) (string, bool) {
+	if s == nil {
+		return "", false
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	mac, ok := s.macs[ip]
+
+	return mac, ok
+}
+
+func (s *store) events(mac string) []Event {
+	if s == nil {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e, ok := s.machines[mac]
+	if !ok {
+		return nil
+	}
+	m, _ := e.Value.(*machine)
+	if !m.full {
+		return append([]Event(nil), m.events[:m.next]...)
+	}
+
+	return append(append([]Event(nil), m.events[m.next:]...), m.events[:m.next]...)
+}
+
+// machine returns the timeline of mac, marked most recently updated, adding
+// it in place of the least recently updated one when max are already kept.
+// s.mu must be held.
+func (s *store) machine(mac string) *machine {
+	if e, ok := s.machines[mac]; ok {
+		s.lru.MoveToFront(e)
+		m, _ := e.Value.(*machine)
+
+		return m
+	}
+	m := &machine{mac: mac, events: make([]Event, s.size)}
+	s.machines[mac] = s.lru.PushFront(m)
+	for s.lru.Len() > s.max {
+		oldest := s.lru.Back()
+		s.lru.Remove(oldest)
+		if old, ok := oldest.Value.(*machine); ok {
+			delete(s.machines, old.mac)
+			if s.macs[old.ip] == old.mac {
+				delete(s.macs, old.ip)
+			}
+		}
+	}
+
+	return m
+}
@@ -0,0 +1,67 @@
+package timeline
+
+import (
+	"net"
+	"strconv"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func messages(events []Event) []string {
+	var m []string
+	for _, e := range events {
+		m = append(m, e.Source+": "+e.Message)
+	}
+
+	return m
+}
+
+func TestEvents(t *testing.T) {
+	Init(3, 2)
+	defer Init(0, 0)
+
+	a, _ := net.ParseMAC("00:00:ba:dd:be:ea")
+	b, _ := net.ParseMAC("00:00:ba:dd:be:eb")
+	c, _ := net.ParseMAC("00:00:ba:dd:be:ec")
+
+	for i := 0; i < 4; i++ {
+		Record(a, "http", strconv.Itoa(i))
+	}
+	if diff := cmp.Diff([]string{"http: 1", "http: 2", "http: 3"}, messages(Events(a))); diff != "" {
+		t.Fatal(diff)
+	}
+
+	Offered(net.ParseIP("10.0.0.2"), b)
+	RecordIP(net.ParseIP("10.0.0.2"), "tftp", "sent ipxe.efi")
+	RecordIP(net.ParseIP("10.0.0.3"), "tftp", "sent undionly.kpxe")
+	if diff := cmp.Diff([]string{"tftp: sent ipxe.efi"}, messages(Events(b))); diff != "" {
+		t.Fatal(diff)
+	}
+
+	// a was updated least recently, c takes its place
+	Record(c, "dhcp", "received DHCPDISCOVER")
+	if events := Events(a); events != nil {
+		t.Fatalf("unexpected events of an evicted machine: %v", messages(events))
+	}
+	if diff := cmp.Diff([]string{"dhcp: received DHCPDISCOVER"}, messages(Events(c))); diff != "" {
+		t.Fatal(diff)
+	}
+
+	// the address of an evicted machine is no longer attributed to it
+	Record(a, "dhcp", "received DHCPDISCOVER")
+	RecordIP(net.ParseIP("10.0.0.2"), "tftp", "sent ipxe.efi")
+	if events := Events(b); events != nil {
+		t.Fatalf("unexpected events of an evicted machine: %v", messages(events))
+	}
+}
+
+func TestEventsDisabled(t *testing.T) {
+	Init(0, 0)
+
+	mac, _ := net.ParseMAC("00:00:ba:dd:be:ef")
+	Record(mac, "http", "GET /auto.ipxe")
+	if events := Events(mac); events != nil {
+		t.Fatalf("unexpected events: %v", messages(events))
+	}
+}